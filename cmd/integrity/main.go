@@ -0,0 +1,54 @@
+package main
+
+import (
+	"PayWalletEngine/internal/db"
+	"PayWalletEngine/internal/integrity"
+
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+)
+
+// Run verifies every balance once and prints the report. It reports whether the balances were healthy.
+func Run(freeze bool) (bool, error) {
+	store, err := db.NewDatabase()
+	if err != nil {
+		log.Println("Database Connection Failure")
+		return false, err
+	}
+
+	if err := store.MigrateDB(); err != nil {
+		log.Println("failed to setup store migrations")
+		return false, err
+	}
+
+	integrityService := integrity.NewIntegrityService(store)
+	report, err := integrityService.Verify(context.Background(), freeze)
+	if err != nil {
+		return false, err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return false, err
+	}
+	return report.Healthy, nil
+}
+
+// main exits with 0 when the balances are healthy, 1 when discrepancies were found and 2 when the check failed
+func main() {
+	freeze := flag.Bool("freeze", integrity.AutoFreeze(), "freeze the customer accounts discrepancies are found on")
+	flag.Parse()
+
+	healthy, err := Run(*freeze)
+	if err != nil {
+		log.Println(err)
+		os.Exit(2)
+	}
+	if !healthy {
+		os.Exit(1)
+	}
+}
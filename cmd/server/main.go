@@ -2,19 +2,48 @@ package main
 
 import (
 	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/aliases"
+	"PayWalletEngine/internal/batches"
+	"PayWalletEngine/internal/beneficiaries"
+	"PayWalletEngine/internal/closing"
 	"PayWalletEngine/internal/db"
+	"PayWalletEngine/internal/disputes"
+	"PayWalletEngine/internal/escrows"
+	"PayWalletEngine/internal/events"
+	"PayWalletEngine/internal/fees"
+	"PayWalletEngine/internal/integrity"
+	"PayWalletEngine/internal/interest"
+	"PayWalletEngine/internal/ledger"
+	"PayWalletEngine/internal/mandates"
+	"PayWalletEngine/internal/paymentrequests"
+	"PayWalletEngine/internal/pots"
+	"PayWalletEngine/internal/privacy"
+	"PayWalletEngine/internal/reconciliation"
+	"PayWalletEngine/internal/schedules"
+	"PayWalletEngine/internal/statements"
 	"PayWalletEngine/internal/transactions"
 	transportHTTP "PayWalletEngine/internal/transport/http"
 	"PayWalletEngine/internal/users"
+	"PayWalletEngine/internal/webhooks"
 
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 )
 
 // Run - is going to be responsible for / the instantiation and startup of our / go application
 func Run() error {
 	fmt.Println("starting up the application...")
 
+	numberGenerator, err := accounts.NumberGeneratorFromEnv()
+	if err != nil {
+		log.Println("invalid account number configuration")
+		return err
+	}
+	accounts.SetNumberGenerator(numberGenerator)
+
 	store, err := db.NewDatabase()
 	if err != nil {
 		log.Println("Database Connection Failure")
@@ -26,10 +55,85 @@ func Run() error {
 		return err
 	}
 
+	legacyNumbers, err := store.MarkLegacyAccountNumbers(context.Background(), numberGenerator)
+	if err != nil {
+		log.Println("failed to load legacy account numbers")
+		return err
+	}
+	accounts.SetLegacyNumbers(legacyNumbers)
+
 	userService := users.NewService(store)
 	transactionService := transactions.NewTransactionService(store)
 	accountService := accounts.NewAccountService(store)
-	handler := transportHTTP.NewHandler(userService, transactionService, accountService)
+	privacyService := privacy.NewPrivacyService(store)
+	aliasService := aliases.NewAliasService(store, aliases.LogVerificationSender{})
+	beneficiaryService := beneficiaries.NewBeneficiaryService(store)
+	paymentRequestService := paymentrequests.NewPaymentRequestService(store, paymentrequests.LogNotifier{})
+	scheduleService := schedules.NewScheduleService(store, &transactionService, schedules.LogNotifier{})
+	mandateService := mandates.NewMandateService(store)
+	batchService := batches.NewBatchService(store)
+	feeService := fees.NewFeeService(store)
+	interestService := interest.NewInterestService(store)
+	potService := pots.NewPotService(store)
+	escrowService := escrows.NewEscrowService(store)
+	disputeService := disputes.NewDisputeService(store)
+	statementService := statements.NewStatementService(store)
+	reconciliationService := reconciliation.NewReconciliationService(store)
+	integrityService := integrity.NewIntegrityService(store)
+	closingService := closing.NewClosingService(store)
+	ledgerService := ledger.NewLedgerService(store)
+	webhookService := webhooks.NewWebhookService(store)
+
+	publisher, err := events.NewPublisher()
+	if err != nil && !errors.Is(err, events.ErrNoPublisher) {
+		log.Println("failed to set up the event publisher")
+		return err
+	}
+	outboxService := events.NewOutboxService(store, publisher)
+
+	// background jobs run until the server shuts down
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go accountService.RunDormancySweep(ctx, 24*time.Hour)
+	go paymentRequestService.RunExpirySweep(ctx, time.Hour)
+	go scheduleService.RunScheduler(ctx, time.Minute)
+	go interestService.RunInterestJob(ctx, time.Hour)
+	go potService.RunAutoSave(ctx, time.Minute)
+	go escrowService.RunAutoRelease(ctx, time.Hour)
+	go disputeService.RunDeadlines(ctx, time.Hour)
+	go integrityService.RunVerification(ctx, 24*time.Hour)
+	go closingService.RunDayClose(ctx, time.Hour)
+	go webhookService.RunDelivery(ctx, 5*time.Second)
+	if publisher != nil {
+		go outboxService.RunRelay(ctx, time.Second)
+	} else {
+		log.Println("EVENT_PUBLISHER is not set, domain events stay in the outbox unpublished")
+	}
+
+	handler := transportHTTP.NewHandler(transportHTTP.Services{
+		Users:           userService,
+		Transaction:     transactionService,
+		Accounts:        accountService,
+		Privacy:         privacyService,
+		Aliases:         aliasService,
+		Beneficiaries:   beneficiaryService,
+		PaymentRequests: paymentRequestService,
+		Schedules:       scheduleService,
+		Mandates:        mandateService,
+		Batches:         batchService,
+		Fees:            feeService,
+		Interest:        interestService,
+		Pots:            potService,
+		Escrows:         escrowService,
+		Disputes:        disputeService,
+		Statements:      statementService,
+		Reconciliation:  reconciliationService,
+		Integrity:       integrityService,
+		Closing:         closingService,
+		Ledger:          ledgerService,
+		Webhooks:        webhookService,
+		Outbox:          outboxService,
+	})
 
 	if err := handler.Serve(); err != nil {
 		log.Println("failed to gracefully serve our application")
@@ -3,17 +3,90 @@ package accounts
 import (
 	"PayWalletEngine/internal/users"
 	"context"
+	"errors"
+	"fmt"
 	"gorm.io/gorm"
 	"log"
+	"time"
+)
+
+// Wallet types a user can hold, at most one open wallet of each
+const (
+	TypeMain     = "main"
+	TypeSavings  = "savings"
+	TypeBusiness = "business"
+)
+
+// TypeSystem marks accounts held by the engine itself rather than a user. System accounts are named by their
+// nickname, created when the database is migrated and cannot be opened through the API.
+const TypeSystem = "system"
+
+// System account names
+const (
+	SystemFeeRevenue      = "fee_revenue"
+	SystemInterestExpense = "interest_expense"
+	SystemInterestIncome  = "interest_income"
+	SystemEscrow          = "escrow"
+	SystemDisputes        = "disputes"
+)
+
+// SystemAccounts lists every system account the engine needs
+var SystemAccounts = []string{SystemFeeRevenue, SystemInterestExpense, SystemInterestIncome, SystemEscrow, SystemDisputes}
+
+// Account statuses. Frozen and dormant accounts accept credits but block debits, closed accounts accept neither.
+const (
+	StatusActive  = "active"
+	StatusFrozen  = "frozen"
+	StatusDormant = "dormant"
+	StatusClosed  = "closed"
+)
+
+var (
+	ErrAccountFrozen           = errors.New("account is frozen")
+	ErrAccountDormant          = errors.New("account is dormant")
+	ErrAccountClosed           = errors.New("account is closed")
+	ErrInvalidStatusTransition = errors.New("invalid account status transition")
+	ErrNonZeroBalance          = errors.New("account balance must be zero or swept to a nominated account before closing")
+	ErrInvalidAccountType      = errors.New("invalid account type")
+	ErrDuplicateAccountType    = errors.New("duplicate account type")
+	ErrInsufficientFunds       = errors.New("insufficient funds in account")
+	ErrOverdraftLimitExceeded  = fmt.Errorf("%w: overdraft limit exceeded", ErrInsufficientFunds)
+	ErrInvalidOverdraftLimit   = errors.New("overdraft limit must be zero or positive")
+	ErrInvalidOverdraftRate    = errors.New("overdraft rate must be between 0 and 100")
+	ErrSystemAccount           = errors.New("system accounts cannot be changed")
+	ErrImmutableField          = errors.New("account number, balance and owner cannot be updated")
 )
 
 type Account struct {
-	gorm.Model    `json:"-"`
-	ID            uint    `json:"id"`
-	AccountNumber int64   `json:"account_number"`
-	AccountType   string  `json:"account_type"`
-	Balance       float64 `json:"balance"`
-	UserID        uint    `json:"user_id"`
+	gorm.Model     `json:"-"`
+	ID             uint       `json:"id"`
+	AccountNumber  int64      `json:"account_number"`
+	AccountType    string     `json:"account_type"`
+	Balance        float64    `json:"balance"`
+	UserID         uint       `json:"user_id"`
+	Nickname       string     `json:"nickname"`
+	IsDefault      bool       `json:"is_default"`
+	Status         string     `json:"status"`
+	StatusReason   string     `json:"status_reason,omitempty"`
+	LastActivityAt *time.Time `json:"last_activity_at,omitempty"`
+
+	// OverdraftLimit is how far below zero debits may take the balance, and OverdraftRate the annual rate in percent
+	// charged on the days the account ends below zero. OverdraftUsed and AvailableBalance are derived from the limit
+	// and the balance.
+	OverdraftLimit   float64 `json:"overdraft_limit"`
+	OverdraftRate    float64 `json:"overdraft_rate"`
+	OverdraftUsed    float64 `json:"overdraft_used" gorm:"-"`
+	AvailableBalance float64 `json:"available_balance" gorm:"-"`
+}
+
+// StatusChange - a record of an account moving from one status to another
+type StatusChange struct {
+	ID         uint      `json:"id"`
+	AccountID  uint      `json:"account_id"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
 type AccountStore interface {
@@ -23,6 +96,13 @@ type AccountStore interface {
 	UpdateAccountDetails(ctx context.Context, account Account) error
 	GetUserByAccountNumber(ctx context.Context, accountNumber uint) (*users.User, error)
 	GetAccountsByUserID(ctx context.Context, userID uint) ([]*Account, error)
+	ChangeAccountStatus(ctx context.Context, accountID uint, status string, reason string) error
+	CloseAccount(ctx context.Context, accountID uint, sweepAccountNumber int64, reason string) error
+	MarkDormantAccounts(ctx context.Context, inactiveSince time.Time) (int64, error)
+	GetAccountStatusHistory(ctx context.Context, accountID uint) ([]StatusChange, error)
+	SetDefaultAccount(ctx context.Context, accountID uint) error
+	SetOverdraftLimit(ctx context.Context, accountID uint, limit float64, rate float64, reason string) (Account, error)
+	GetOverdrawnAccounts(ctx context.Context) ([]Account, error)
 }
 
 // AccountService is the blueprint for the account logic
@@ -46,6 +126,9 @@ func (s *AccountService) GetUserByAccountNumber(ctx context.Context, accountNumb
 }
 
 func (s *AccountService) CreateAccount(ctx context.Context, account *Account) error {
+	if err := ValidateAccountType(account.AccountType); err != nil {
+		return err
+	}
 	if err := s.Store.CreateAccount(ctx, account); err != nil {
 		log.Printf("Error creating account: %v", err)
 		return err
@@ -72,6 +155,15 @@ func (s *AccountService) GetAccountByNumber(ctx context.Context, accountNumber u
 }
 
 func (s *AccountService) UpdateAccountDetails(ctx context.Context, account Account) error {
+	// money only moves through transactions, and an account never changes number or owner
+	if account.AccountNumber != 0 || account.Balance != 0 || account.UserID != 0 {
+		return ErrImmutableField
+	}
+	if account.AccountType != "" {
+		if err := ValidateAccountType(account.AccountType); err != nil {
+			return err
+		}
+	}
 	if err := s.Store.UpdateAccountDetails(ctx, account); err != nil {
 		log.Printf("Error updating account: %v", err)
 		return err
@@ -87,3 +179,100 @@ func (s *AccountService) GetAccountsByUserID(ctx context.Context, userID uint) (
 	}
 	return account, nil
 }
+
+// FreezeAccount blocks debits on the account while still allowing credits
+func (s *AccountService) FreezeAccount(ctx context.Context, accountID uint, reason string) error {
+	if err := s.Store.ChangeAccountStatus(ctx, accountID, StatusFrozen, reason); err != nil {
+		log.Printf("Error freezing account %v: %v", accountID, err)
+		return err
+	}
+	return nil
+}
+
+// UnfreezeAccount returns a frozen or dormant account to active
+func (s *AccountService) UnfreezeAccount(ctx context.Context, accountID uint, reason string) error {
+	if err := s.Store.ChangeAccountStatus(ctx, accountID, StatusActive, reason); err != nil {
+		log.Printf("Error unfreezing account %v: %v", accountID, err)
+		return err
+	}
+	return nil
+}
+
+// CloseAccount closes the account. A remaining balance is swept to sweepAccountNumber, which may be zero
+// only when the account is already empty.
+func (s *AccountService) CloseAccount(ctx context.Context, accountID uint, sweepAccountNumber int64, reason string) error {
+	if err := s.Store.CloseAccount(ctx, accountID, sweepAccountNumber, reason); err != nil {
+		log.Printf("Error closing account %v: %v", accountID, err)
+		return err
+	}
+	return nil
+}
+
+func (s *AccountService) GetAccountStatusHistory(ctx context.Context, accountID uint) ([]StatusChange, error) {
+	history, err := s.Store.GetAccountStatusHistory(ctx, accountID)
+	if err != nil {
+		log.Printf("Error fetching status history for account %v: %v", accountID, err)
+		return nil, err
+	}
+	return history, nil
+}
+
+// RunDormancySweep marks active accounts without activity for DormancyPeriodMonths as dormant, once per interval
+// until the context is cancelled.
+func (s *AccountService) RunDormancySweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		inactiveSince := time.Now().AddDate(0, -DormancyPeriodMonths(), 0)
+		count, err := s.Store.MarkDormantAccounts(ctx, inactiveSince)
+		if err != nil {
+			log.Printf("Error marking dormant accounts: %v", err)
+		} else if count > 0 {
+			log.Printf("Marked %d accounts as dormant", count)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetDefaultAccount makes the account its owner's default wallet
+func (s *AccountService) SetDefaultAccount(ctx context.Context, accountID uint) error {
+	if err := s.Store.SetDefaultAccount(ctx, accountID); err != nil {
+		log.Printf("Error setting account %v as default: %v", accountID, err)
+		return err
+	}
+	return nil
+}
+
+// SetOverdraftLimit approves an overdraft on the account. Lowering the limit below what is already used is allowed;
+// the account then takes no further debits until it is back within its limit. The rate is the annual overdraft
+// interest charged on the account, whether or not its account type has an interest plan.
+func (s *AccountService) SetOverdraftLimit(ctx context.Context, accountID uint, limit float64, rate float64, reason string) (Account, error) {
+	if limit < 0 {
+		return Account{}, ErrInvalidOverdraftLimit
+	}
+	if rate < 0 || rate > 100 {
+		return Account{}, ErrInvalidOverdraftRate
+	}
+	account, err := s.Store.SetOverdraftLimit(ctx, accountID, limit, rate, reason)
+	if err != nil {
+		log.Printf("Error setting overdraft limit of account %v: %v", accountID, err)
+		return account, err
+	}
+	return account, nil
+}
+
+// GetOverdrawnAccounts reports every account with a negative balance, most overdrawn first
+func (s *AccountService) GetOverdrawnAccounts(ctx context.Context) ([]Account, error) {
+	overdrawn, err := s.Store.GetOverdrawnAccounts(ctx)
+	if err != nil {
+		log.Printf("Error fetching overdrawn accounts: %v", err)
+		return nil, err
+	}
+	return overdrawn, nil
+}
@@ -0,0 +1,228 @@
+package accounts
+
+import (
+	crypto "crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultAccountNumberWidth = 10
+	maxAccountNumberWidth     = 18
+)
+
+var ErrInvalidAccountNumber = errors.New("invalid account number")
+
+// CheckDigitScheme computes and verifies the trailing check digits of an account number
+type CheckDigitScheme interface {
+	// Digits is the number of check digits the scheme appends
+	Digits() int
+	// Compute returns the check digits for the given digits
+	Compute(digits string) string
+	// Valid reports whether a full number, check digits included, is valid
+	Valid(number string) bool
+}
+
+// Luhn is the mod-10 scheme used for card numbers. It catches every single-digit typo and most transpositions.
+var Luhn CheckDigitScheme = luhnScheme{}
+
+// Mod97 is the ISO 7064 MOD 97-10 scheme used by IBAN. It appends two check digits.
+var Mod97 CheckDigitScheme = mod97Scheme{}
+
+// NoCheckDigit appends nothing. It exists for deployments that still hold account numbers issued without check digits.
+var NoCheckDigit CheckDigitScheme = noCheckDigitScheme{}
+
+type luhnScheme struct{}
+
+func (luhnScheme) Digits() int { return 1 }
+
+func (luhnScheme) Compute(digits string) string {
+	return strconv.Itoa((10 - luhnSum(digits+"0")%10) % 10)
+}
+
+func (luhnScheme) Valid(number string) bool {
+	return len(number) > 1 && luhnSum(number)%10 == 0
+}
+
+// luhnSum doubles every second digit from the right, starting with the rightmost check digit position undoubled
+func luhnSum(number string) int {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum
+}
+
+type mod97Scheme struct{}
+
+func (mod97Scheme) Digits() int { return 2 }
+
+func (mod97Scheme) Compute(digits string) string {
+	return fmt.Sprintf("%02d", 98-mod97(digits+"00"))
+}
+
+func (mod97Scheme) Valid(number string) bool {
+	return len(number) > 2 && mod97(number) == 1
+}
+
+func mod97(number string) int {
+	remainder := 0
+	for _, c := range number {
+		remainder = (remainder*10 + int(c-'0')) % 97
+	}
+	return remainder
+}
+
+type noCheckDigitScheme struct{}
+
+func (noCheckDigitScheme) Digits() int { return 0 }
+
+func (noCheckDigitScheme) Compute(string) string { return "" }
+
+func (noCheckDigitScheme) Valid(string) bool { return true }
+
+// NumberGenerator issues fixed-width account numbers made of a bank prefix, random digits and check digits
+type NumberGenerator struct {
+	Prefix string
+	Width  int
+	Scheme CheckDigitScheme
+}
+
+// NewNumberGenerator validates the configuration and returns a generator for it
+func NewNumberGenerator(prefix string, width int, scheme CheckDigitScheme) (NumberGenerator, error) {
+	if width <= 0 || width > maxAccountNumberWidth {
+		return NumberGenerator{}, fmt.Errorf("account number width must be between 1 and %d", maxAccountNumberWidth)
+	}
+	for _, c := range prefix {
+		if c < '0' || c > '9' {
+			return NumberGenerator{}, fmt.Errorf("account number prefix must only contain digits")
+		}
+	}
+	if strings.HasPrefix(prefix, "0") {
+		return NumberGenerator{}, fmt.Errorf("account number prefix cannot start with zero")
+	}
+	if len(prefix)+scheme.Digits() >= width {
+		return NumberGenerator{}, fmt.Errorf("account number width leaves no room for random digits")
+	}
+	return NumberGenerator{Prefix: prefix, Width: width, Scheme: scheme}, nil
+}
+
+// Generate returns a new random account number. The first digit is never zero, so every number has exactly Width digits.
+func (g NumberGenerator) Generate() (int64, error) {
+	var body strings.Builder
+	body.WriteString(g.Prefix)
+	for body.Len() < g.Width-g.Scheme.Digits() {
+		min := int64(0)
+		if body.Len() == 0 {
+			min = 1
+		}
+		n, err := crypto.Int(crypto.Reader, big.NewInt(10-min))
+		if err != nil {
+			return 0, err
+		}
+		body.WriteString(strconv.FormatInt(n.Int64()+min, 10))
+	}
+
+	digits := body.String()
+	return strconv.ParseInt(digits+g.Scheme.Compute(digits), 10, 64)
+}
+
+// Validate returns ErrInvalidAccountNumber unless the number has the configured width, prefix and valid check digits
+func (g NumberGenerator) Validate(accountNumber int64) error {
+	number := strconv.FormatInt(accountNumber, 10)
+	if len(number) != g.Width {
+		return fmt.Errorf("%w: expected %d digits", ErrInvalidAccountNumber, g.Width)
+	}
+	if !strings.HasPrefix(number, g.Prefix) {
+		return fmt.Errorf("%w: unknown bank prefix", ErrInvalidAccountNumber)
+	}
+	if !g.Scheme.Valid(number) {
+		return fmt.Errorf("%w: check digits do not match", ErrInvalidAccountNumber)
+	}
+	return nil
+}
+
+var (
+	numberGenerator     NumberGenerator
+	numberGeneratorErr  error
+	numberGeneratorOnce sync.Once
+
+	legacyNumbersMu sync.RWMutex
+	legacyNumbers   map[int64]bool
+)
+
+// NumberGeneratorFromEnv builds the generator configured by ACCOUNT_NUMBER_SCHEME (luhn, mod97 or none),
+// ACCOUNT_NUMBER_PREFIX and ACCOUNT_NUMBER_WIDTH
+func NumberGeneratorFromEnv() (NumberGenerator, error) {
+	var scheme CheckDigitScheme
+	switch name := strings.ToLower(strings.TrimSpace(os.Getenv("ACCOUNT_NUMBER_SCHEME"))); name {
+	case "", "luhn":
+		scheme = Luhn
+	case "mod97":
+		scheme = Mod97
+	case "none":
+		scheme = NoCheckDigit
+	default:
+		return NumberGenerator{}, fmt.Errorf("unknown ACCOUNT_NUMBER_SCHEME %q", name)
+	}
+
+	width := defaultAccountNumberWidth
+	if value := strings.TrimSpace(os.Getenv("ACCOUNT_NUMBER_WIDTH")); value != "" {
+		var err error
+		if width, err = strconv.Atoi(value); err != nil {
+			return NumberGenerator{}, fmt.Errorf("ACCOUNT_NUMBER_WIDTH must be a number")
+		}
+	}
+
+	return NewNumberGenerator(strings.TrimSpace(os.Getenv("ACCOUNT_NUMBER_PREFIX")), width, scheme)
+}
+
+// SetNumberGenerator replaces the generator used to issue and validate account numbers
+func SetNumberGenerator(g NumberGenerator) {
+	numberGeneratorOnce.Do(func() {})
+	numberGenerator, numberGeneratorErr = g, nil
+}
+
+// configuredNumberGenerator returns the generator set at startup, or builds it from the environment on first use
+// when none was set
+func configuredNumberGenerator() (NumberGenerator, error) {
+	numberGeneratorOnce.Do(func() {
+		numberGenerator, numberGeneratorErr = NumberGeneratorFromEnv()
+		if numberGeneratorErr != nil {
+			numberGeneratorErr = fmt.Errorf("invalid account number configuration: %w", numberGeneratorErr)
+		}
+	})
+	return numberGenerator, numberGeneratorErr
+}
+
+// SetLegacyNumbers registers the account numbers issued before the configured scheme, which were not given its check
+// digits. They keep being accepted so that existing customers can still use their accounts.
+func SetLegacyNumbers(accountNumbers []int64) {
+	legacy := make(map[int64]bool, len(accountNumbers))
+	for _, n := range accountNumbers {
+		legacy[n] = true
+	}
+	legacyNumbersMu.Lock()
+	defer legacyNumbersMu.Unlock()
+	legacyNumbers = legacy
+}
+
+func isLegacyNumber(accountNumber int64) bool {
+	legacyNumbersMu.RLock()
+	defer legacyNumbersMu.RUnlock()
+	return legacyNumbers[accountNumber]
+}
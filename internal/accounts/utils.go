@@ -1,26 +1,112 @@
 package accounts
 
 import (
-	crypto "crypto/rand"
-	"crypto/sha256"
 	"fmt"
-	"github.com/google/uuid"
-	"math/big"
-	"math/rand"
-	"time"
+	"os"
+	"strconv"
 )
 
-// GenerateAccountNumber generates a unique 10-digit account number
+// defaultDormancyMonths is used when DORMANCY_MONTHS is unset or invalid
+const defaultDormancyMonths = 12
+
+// GenerateAccountNumber generates a fixed-width account number using the configured number generator
 func GenerateAccountNumber() (int64, error) {
-	rand.Seed(time.Now().UnixNano())
-	randomInt := rand.Int63n(1e10)
-	uid, err := uuid.NewRandomFromReader(crypto.Reader)
+	g, err := configuredNumberGenerator()
 	if err != nil {
 		return 0, err
 	}
-	hash := sha256.Sum256([]byte(fmt.Sprintf("%d%v", randomInt, uid.String())))
-	hashInt := big.NewInt(0)
-	hashInt.SetBytes(hash[:])
-	accountNumber := hashInt.Mod(hashInt, big.NewInt(1e10)).Int64()
-	return accountNumber, nil
+	return g.Generate()
+}
+
+// ValidateAccountNumber checks the width, prefix and check digits of an account number against the configured
+// generator. Legacy numbers, issued before the scheme, are accepted as they are.
+func ValidateAccountNumber(accountNumber int64) error {
+	g, err := configuredNumberGenerator()
+	if err != nil {
+		return err
+	}
+	if err := g.Validate(accountNumber); err != nil {
+		if isLegacyNumber(accountNumber) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// DormancyPeriodMonths returns the number of months without activity after which an account becomes dormant
+func DormancyPeriodMonths() int {
+	months, err := strconv.Atoi(os.Getenv("DORMANCY_MONTHS"))
+	if err != nil || months <= 0 {
+		return defaultDormancyMonths
+	}
+	return months
+}
+
+// CanTransition reports whether an account may move from one status to another
+func CanTransition(from string, to string) bool {
+	switch from {
+	case StatusActive:
+		return to == StatusFrozen || to == StatusDormant || to == StatusClosed
+	case StatusFrozen:
+		return to == StatusActive
+	case StatusDormant:
+		return to == StatusActive || to == StatusFrozen || to == StatusClosed
+	}
+	return false
+}
+
+// CanDebit returns an error when the account status does not allow money to leave the account
+func CanDebit(status string) error {
+	switch status {
+	case StatusFrozen:
+		return ErrAccountFrozen
+	case StatusDormant:
+		return ErrAccountDormant
+	case StatusClosed:
+		return ErrAccountClosed
+	}
+	return nil
+}
+
+// CanCredit returns an error when the account status does not allow money to enter the account
+func CanCredit(status string) error {
+	if status == StatusClosed {
+		return ErrAccountClosed
+	}
+	return nil
+}
+
+// CheckFunds returns ErrInsufficientFunds when debiting the amount would take the account below zero, or
+// ErrOverdraftLimitExceeded, which wraps it, when the account has an overdraft and the debit would go past its limit
+func CheckFunds(account Account, amount float64) error {
+	if account.Balance+account.OverdraftLimit >= amount {
+		return nil
+	}
+	if account.OverdraftLimit > 0 {
+		return ErrOverdraftLimitExceeded
+	}
+	return ErrInsufficientFunds
+}
+
+// WithOverdraftUsage fills in the overdraft an account is using and the funds it has left to spend
+func WithOverdraftUsage(account Account) Account {
+	account.OverdraftUsed = 0
+	if account.Balance < 0 {
+		account.OverdraftUsed = -account.Balance
+	}
+	account.AvailableBalance = account.Balance + account.OverdraftLimit
+	if account.AvailableBalance < 0 {
+		account.AvailableBalance = 0
+	}
+	return account
+}
+
+// ValidateAccountType returns an error unless the account type is one of the supported wallet types
+func ValidateAccountType(accountType string) error {
+	switch accountType {
+	case TypeMain, TypeSavings, TypeBusiness:
+		return nil
+	}
+	return fmt.Errorf("%w: %q, expected one of %s, %s or %s", ErrInvalidAccountType, accountType, TypeMain, TypeSavings, TypeBusiness)
 }
@@ -0,0 +1,189 @@
+package aliases
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// Alias types a user can register
+const (
+	TypeEmail    = "email"
+	TypePhone    = "phone"
+	TypeUsername = "username"
+)
+
+// verificationCodeTTL is how long a verification code stays valid after it is issued
+const verificationCodeTTL = 15 * time.Minute
+
+// MaxVerificationAttempts is how many wrong codes an alias takes before its code is invalidated, so the million
+// possible codes can't be tried within the TTL. A new code has to be requested then.
+const MaxVerificationAttempts = 5
+
+var (
+	ErrInvalidAlias          = errors.New("invalid alias")
+	ErrAliasTaken            = errors.New("alias is already registered to another user")
+	ErrAliasNotVerified      = errors.New("alias has not been verified")
+	ErrInvalidCode           = errors.New("verification code is invalid or has expired")
+	ErrTooManyAttempts       = errors.New("too many wrong verification codes, request a new code")
+	ErrAlreadyVerified       = errors.New("alias is already verified")
+	ErrNoDefaultAccount      = errors.New("alias owner has no open default account")
+	ErrUsernameAliasMismatch = errors.New("username aliases must match the user's own username")
+)
+
+// Alias - a verified email, phone number or @username that resolves to a user's default account
+type Alias struct {
+	ID         uint       `json:"id"`
+	UserID     uint       `json:"user_id"`
+	Type       string     `json:"type"`
+	Value      string     `json:"value"`
+	Verified   bool       `json:"verified"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Resolution - the account an alias points to, with a masked name the sender can confirm before paying
+type Resolution struct {
+	Alias         string `json:"alias"`
+	DisplayName   string `json:"display_name"`
+	AccountNumber int64  `json:"-"`
+}
+
+type AliasStore interface {
+	CreateAlias(ctx context.Context, alias *Alias, codeHash string, codeExpiresAt time.Time) error
+	VerifyAlias(ctx context.Context, aliasID uint, code string) (Alias, error)
+	ResetVerificationCode(ctx context.Context, aliasID uint, codeHash string, codeExpiresAt time.Time) (Alias, error)
+	GetAliasesByUserID(ctx context.Context, userID uint) ([]Alias, error)
+	DeleteAlias(ctx context.Context, aliasID uint) error
+	ResolveAlias(ctx context.Context, aliasType string, value string) (Resolution, error)
+}
+
+// VerificationSender delivers verification codes to the email address or phone number being registered
+type VerificationSender interface {
+	SendVerificationCode(ctx context.Context, alias Alias, code string) error
+}
+
+// LogVerificationSender writes verification codes to the server log. It stands in until an email or SMS provider is configured.
+type LogVerificationSender struct{}
+
+func (LogVerificationSender) SendVerificationCode(ctx context.Context, alias Alias, code string) error {
+	log.Printf("Verification code for %s alias %q: %s", alias.Type, alias.Value, code)
+	return nil
+}
+
+// AliasService is the blueprint for the payment alias logic
+type AliasService struct {
+	Store  AliasStore
+	Sender VerificationSender
+}
+
+func NewAliasService(store AliasStore, sender VerificationSender) AliasService {
+	return AliasService{
+		Store:  store,
+		Sender: sender,
+	}
+}
+
+// RegisterAlias normalizes and stores a new alias for the user. Email and phone aliases stay unverified until the
+// code sent to them is confirmed; username aliases must match the user's username and are verified by the store.
+func (s *AliasService) RegisterAlias(ctx context.Context, userID uint, input string) (*Alias, error) {
+	aliasType, value, err := ParseAlias(input)
+	if err != nil {
+		return nil, err
+	}
+
+	alias := &Alias{
+		UserID: userID,
+		Type:   aliasType,
+		Value:  value,
+	}
+
+	code, err := GenerateVerificationCode()
+	if err != nil {
+		return nil, err
+	}
+	codeHash, err := HashVerificationCode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Store.CreateAlias(ctx, alias, codeHash, time.Now().Add(verificationCodeTTL)); err != nil {
+		log.Printf("Error registering alias for user %v: %v", userID, err)
+		return nil, err
+	}
+
+	if !alias.Verified {
+		if err := s.Sender.SendVerificationCode(ctx, *alias, code); err != nil {
+			log.Printf("Error sending verification code for alias %v: %v", alias.ID, err)
+			return nil, err
+		}
+	}
+	return alias, nil
+}
+
+// VerifyAlias confirms an alias with the code that was sent to it
+func (s *AliasService) VerifyAlias(ctx context.Context, aliasID uint, code string) (*Alias, error) {
+	alias, err := s.Store.VerifyAlias(ctx, aliasID, code)
+	if err != nil {
+		log.Printf("Error verifying alias %v: %v", aliasID, err)
+		return nil, err
+	}
+	return &alias, nil
+}
+
+// ResendVerificationCode replaces the code of an unverified alias with a new one and sends it. The new code gets a
+// fresh TTL and the full number of attempts.
+func (s *AliasService) ResendVerificationCode(ctx context.Context, aliasID uint) (*Alias, error) {
+	code, err := GenerateVerificationCode()
+	if err != nil {
+		return nil, err
+	}
+	codeHash, err := HashVerificationCode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	alias, err := s.Store.ResetVerificationCode(ctx, aliasID, codeHash, time.Now().Add(verificationCodeTTL))
+	if err != nil {
+		log.Printf("Error resetting verification code for alias %v: %v", aliasID, err)
+		return nil, err
+	}
+	if err := s.Sender.SendVerificationCode(ctx, alias, code); err != nil {
+		log.Printf("Error sending verification code for alias %v: %v", aliasID, err)
+		return nil, err
+	}
+	return &alias, nil
+}
+
+func (s *AliasService) GetAliasesByUserID(ctx context.Context, userID uint) ([]Alias, error) {
+	aliases, err := s.Store.GetAliasesByUserID(ctx, userID)
+	if err != nil {
+		log.Printf("Error fetching aliases for user %v: %v", userID, err)
+		return nil, err
+	}
+	return aliases, nil
+}
+
+func (s *AliasService) DeleteAlias(ctx context.Context, aliasID uint) error {
+	if err := s.Store.DeleteAlias(ctx, aliasID); err != nil {
+		log.Printf("Error deleting alias %v: %v", aliasID, err)
+		return err
+	}
+	return nil
+}
+
+// ResolveAlias looks up the default account behind a verified alias
+func (s *AliasService) ResolveAlias(ctx context.Context, input string) (Resolution, error) {
+	aliasType, value, err := ParseAlias(input)
+	if err != nil {
+		return Resolution{}, err
+	}
+	resolution, err := s.Store.ResolveAlias(ctx, aliasType, value)
+	if err != nil {
+		log.Printf("Error resolving alias %q: %v", input, err)
+		return Resolution{}, err
+	}
+	resolution.Alias = FormatAlias(aliasType, value)
+	return resolution, nil
+}
@@ -0,0 +1,82 @@
+package aliases
+
+import (
+	crypto "crypto/rand"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+var (
+	emailPattern    = regexp.MustCompile(`^[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}$`)
+	phonePattern    = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+	usernamePattern = regexp.MustCompile(`^[a-z0-9._-]{3,50}$`)
+)
+
+// ParseAlias works out the alias type from its shape and returns it with the normalized value.
+// "@name" is a username, anything else containing "@" is an email and anything starting with "+" is an E.164 phone number.
+func ParseAlias(input string) (string, string, error) {
+	input = strings.TrimSpace(input)
+	switch {
+	case strings.HasPrefix(input, "@"):
+		value := strings.ToLower(strings.TrimPrefix(input, "@"))
+		if !usernamePattern.MatchString(value) {
+			return "", "", fmt.Errorf("%w: malformed username", ErrInvalidAlias)
+		}
+		return TypeUsername, value, nil
+	case strings.Contains(input, "@"):
+		value := strings.ToLower(input)
+		if !emailPattern.MatchString(value) {
+			return "", "", fmt.Errorf("%w: malformed email address", ErrInvalidAlias)
+		}
+		return TypeEmail, value, nil
+	case strings.HasPrefix(input, "+"):
+		value := "+" + strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(strings.TrimPrefix(input, "+"))
+		if !phonePattern.MatchString(value) {
+			return "", "", fmt.Errorf("%w: phone numbers must be in international format", ErrInvalidAlias)
+		}
+		return TypePhone, value, nil
+	}
+	return "", "", fmt.Errorf("%w: expected an email, +phone or @username", ErrInvalidAlias)
+}
+
+// FormatAlias renders a stored alias the way users type it
+func FormatAlias(aliasType string, value string) string {
+	if aliasType == TypeUsername {
+		return "@" + value
+	}
+	return value
+}
+
+// MaskName hides all but the first two and the last character of a name so a sender can recognise the recipient
+// without the alias lookup leaking who owns it
+func MaskName(name string) string {
+	runes := []rune(name)
+	if len(runes) == 0 {
+		return ""
+	}
+	if len(runes) <= 3 {
+		return string(runes[:1]) + strings.Repeat("*", len(runes)-1)
+	}
+	return string(runes[:2]) + strings.Repeat("*", len(runes)-3) + string(runes[len(runes)-1:])
+}
+
+// GenerateVerificationCode returns a random six digit code
+func GenerateVerificationCode() (string, error) {
+	n, err := crypto.Int(crypto.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// HashVerificationCode hashes a verification code for storage
+func HashVerificationCode(code string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
@@ -0,0 +1,23 @@
+package audit
+
+import "time"
+
+// Actions recorded against a user in the audit log
+const (
+	ActionUserCreated      = "user.created"
+	ActionUserUpdated      = "user.updated"
+	ActionUserStatusChange = "user.status_changed"
+	ActionUserExported     = "user.exported"
+	ActionUserErased       = "user.erased"
+	ActionAccountCreated   = "account.created"
+	ActionOverdraftChanged = "account.overdraft_changed"
+)
+
+// Entry - a single audit log record describing an action taken on a user's data
+type Entry struct {
+	ID        uint      `json:"id"`
+	UserID    uint      `json:"user_id"`
+	Action    string    `json:"action"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,105 @@
+package batches
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+// Batch modes. An all-or-nothing batch executes every leg or none of them, a best-effort batch executes every leg it can.
+const (
+	ModeAllOrNothing = "all_or_nothing"
+	ModeBestEffort   = "best_effort"
+)
+
+// Batch statuses
+const (
+	StatusCompleted          = "completed"
+	StatusPartiallyCompleted = "partially_completed"
+	StatusFailed             = "failed"
+)
+
+// Leg statuses. Skipped legs were valid but not executed because another leg of an all-or-nothing batch failed.
+const (
+	LegCompleted = "completed"
+	LegFailed    = "failed"
+	LegSkipped   = "skipped"
+)
+
+var (
+	ErrInvalidBatch = errors.New("invalid batch")
+	ErrBatchFailed  = errors.New("batch failed")
+)
+
+// Batch - one sender paying many receivers
+type Batch struct {
+	ID                  uint      `json:"id"`
+	SenderAccountNumber int64     `json:"sender_account_number"`
+	Mode                string    `json:"mode"`
+	PaymentMethod       string    `json:"payment_method"`
+	Status              string    `json:"status"`
+	TotalAmount         float64   `json:"total_amount"`
+	SucceededAmount     float64   `json:"succeeded_amount"`
+	LegCount            int       `json:"leg_count"`
+	SucceededCount      int       `json:"succeeded_count"`
+	FailedCount         int       `json:"failed_count"`
+	Legs                []Leg     `json:"legs"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// Leg - a single payment within a batch
+type Leg struct {
+	ID                    uint       `json:"id"`
+	Position              int        `json:"position"`
+	ReceiverAccountNumber int64      `json:"receiver_account_number"`
+	Amount                float64    `json:"amount"`
+	Description           string     `json:"description"`
+	Status                string     `json:"status"`
+	Error                 string     `json:"error,omitempty"`
+	TransactionID         *uuid.UUID `json:"transaction_id,omitempty"`
+}
+
+type BatchStore interface {
+	ExecuteBatch(ctx context.Context, batch *Batch) error
+	GetBatchByID(ctx context.Context, batchID uint) (Batch, error)
+}
+
+// BatchService is the blueprint for the batch payment logic
+type BatchService struct {
+	Store BatchStore
+}
+
+func NewBatchService(store BatchStore) BatchService {
+	return BatchService{
+		Store: store,
+	}
+}
+
+// ExecuteBatch validates the batch and pays every leg from the sender. The batch is recorded with its per-leg results
+// whatever the outcome. An all-or-nothing batch that could not be executed returns ErrBatchFailed along with the record.
+func (s *BatchService) ExecuteBatch(ctx context.Context, batch *Batch) error {
+	if err := Validate(batch, MaxLegs()); err != nil {
+		return err
+	}
+
+	if err := s.Store.ExecuteBatch(ctx, batch); err != nil {
+		log.Printf("Error executing batch from account %v: %v", batch.SenderAccountNumber, err)
+		return err
+	}
+	if batch.Status == StatusFailed && batch.Mode == ModeAllOrNothing {
+		return fmt.Errorf("%w: %d of %d legs could not be paid", ErrBatchFailed, batch.FailedCount, batch.LegCount)
+	}
+	return nil
+}
+
+func (s *BatchService) GetBatchByID(ctx context.Context, batchID uint) (Batch, error) {
+	batch, err := s.Store.GetBatchByID(ctx, batchID)
+	if err != nil {
+		log.Printf("Error fetching batch %v: %v", batchID, err)
+		return batch, err
+	}
+	return batch, nil
+}
@@ -0,0 +1,126 @@
+package batches
+
+import (
+	"PayWalletEngine/internal/transactions"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultMaxLegs is used when BATCH_MAX_LEGS is unset or invalid
+const defaultMaxLegs = 500
+
+// MaxLegs returns the most legs a single batch may contain
+func MaxLegs() int {
+	max, err := strconv.Atoi(os.Getenv("BATCH_MAX_LEGS"))
+	if err != nil || max <= 0 {
+		return defaultMaxLegs
+	}
+	return max
+}
+
+// Validate checks the batch's mode and legs, numbers the legs and computes the totals
+func Validate(batch *Batch, maxLegs int) error {
+	switch batch.Mode {
+	case ModeAllOrNothing, ModeBestEffort:
+	case "":
+		batch.Mode = ModeAllOrNothing
+	default:
+		return fmt.Errorf("%w: unknown mode %q", ErrInvalidBatch, batch.Mode)
+	}
+	if len(batch.Legs) == 0 {
+		return fmt.Errorf("%w: a batch needs at least one leg", ErrInvalidBatch)
+	}
+	if len(batch.Legs) > maxLegs {
+		return fmt.Errorf("%w: a batch may contain at most %d legs", ErrInvalidBatch, maxLegs)
+	}
+
+	batch.TotalAmount = 0
+	for i := range batch.Legs {
+		leg := &batch.Legs[i]
+		leg.Position = i + 1
+		if leg.Amount <= 0 {
+			return fmt.Errorf("%w: leg %d", transactions.ErrInvalidAmount, leg.Position)
+		}
+		if leg.ReceiverAccountNumber == batch.SenderAccountNumber {
+			return fmt.Errorf("%w: leg %d pays the sender", ErrInvalidBatch, leg.Position)
+		}
+		batch.TotalAmount += leg.Amount
+	}
+	batch.LegCount = len(batch.Legs)
+	return nil
+}
+
+// ParseCSV reads batch legs from CSV with a header row naming the receiver_account_number, amount and, optionally,
+// description columns
+func ParseCSV(r io.Reader) ([]Leg, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing CSV header: %v", ErrInvalidBatch, err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	receiverColumn, hasReceiver := columns["receiver_account_number"]
+	amountColumn, hasAmount := columns["amount"]
+	descriptionColumn, hasDescription := columns["description"]
+	if !hasReceiver || !hasAmount {
+		return nil, fmt.Errorf("%w: CSV header must name receiver_account_number and amount", ErrInvalidBatch)
+	}
+
+	var legs []Leg
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBatch, err)
+		}
+
+		receiver, err := strconv.ParseInt(strings.TrimSpace(record[receiverColumn]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d has an invalid receiver_account_number", ErrInvalidBatch, line)
+		}
+		amount, err := strconv.ParseFloat(strings.TrimSpace(record[amountColumn]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d has an invalid amount", ErrInvalidBatch, line)
+		}
+		leg := Leg{ReceiverAccountNumber: receiver, Amount: amount}
+		if hasDescription {
+			leg.Description = record[descriptionColumn]
+		}
+		legs = append(legs, leg)
+	}
+	return legs, nil
+}
+
+// Summarize computes the batch's status and result totals from the status of its legs
+func Summarize(batch *Batch) {
+	batch.SucceededCount, batch.FailedCount, batch.SucceededAmount = 0, 0, 0
+	for _, leg := range batch.Legs {
+		switch leg.Status {
+		case LegCompleted:
+			batch.SucceededCount++
+			batch.SucceededAmount += leg.Amount
+		case LegFailed:
+			batch.FailedCount++
+		}
+	}
+
+	switch {
+	case batch.SucceededCount == batch.LegCount:
+		batch.Status = StatusCompleted
+	case batch.SucceededCount == 0:
+		batch.Status = StatusFailed
+	default:
+		batch.Status = StatusPartiallyCompleted
+	}
+}
@@ -0,0 +1,137 @@
+package beneficiaries
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/aliases"
+	"PayWalletEngine/internal/transactions"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// CoolingOffPeriod is how long a new or re-pointed beneficiary is subject to the cooling-off limit
+const CoolingOffPeriod = 24 * time.Hour
+
+var (
+	ErrInvalidDestination = errors.New("a beneficiary needs exactly one of account_number or alias")
+	ErrCoolingOffLimit    = errors.New("transfer exceeds the cooling-off limit for a new beneficiary")
+	ErrNotOwner           = errors.New("beneficiary does not belong to the owner of the sending account")
+)
+
+// Beneficiary - a payee saved by a user, identified by an account number or an alias
+type Beneficiary struct {
+	ID               uint      `json:"id"`
+	UserID           uint      `json:"user_id"`
+	Nickname         string    `json:"nickname"`
+	AccountNumber    int64     `json:"account_number,omitempty"`
+	Alias            string    `json:"alias,omitempty"`
+	CoolingOffEndsAt time.Time `json:"cooling_off_ends_at"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+type BeneficiaryStore interface {
+	CreateBeneficiary(ctx context.Context, beneficiary *Beneficiary) error
+	GetBeneficiaryByID(ctx context.Context, beneficiaryID uint) (Beneficiary, error)
+	GetBeneficiariesByUserID(ctx context.Context, userID uint) ([]Beneficiary, error)
+	UpdateBeneficiary(ctx context.Context, beneficiary Beneficiary) (Beneficiary, error)
+	DeleteBeneficiary(ctx context.Context, beneficiaryID uint) error
+	TransferToBeneficiary(ctx context.Context, senderAccountNumber int64, beneficiaryID uint, amount float64, description string, paymentMethod string, coolingOffLimit float64) (transactions.Transactions, error)
+}
+
+// BeneficiaryService is the blueprint for the saved payee logic
+type BeneficiaryService struct {
+	Store BeneficiaryStore
+}
+
+func NewBeneficiaryService(store BeneficiaryStore) BeneficiaryService {
+	return BeneficiaryService{
+		Store: store,
+	}
+}
+
+// validateDestination checks that exactly one destination is set and normalizes an alias
+func validateDestination(beneficiary *Beneficiary) error {
+	if (beneficiary.AccountNumber == 0) == (beneficiary.Alias == "") {
+		return ErrInvalidDestination
+	}
+	if beneficiary.AccountNumber != 0 {
+		return accounts.ValidateAccountNumber(beneficiary.AccountNumber)
+	}
+	aliasType, value, err := aliases.ParseAlias(beneficiary.Alias)
+	if err != nil {
+		return err
+	}
+	beneficiary.Alias = aliases.FormatAlias(aliasType, value)
+	return nil
+}
+
+func (s *BeneficiaryService) CreateBeneficiary(ctx context.Context, beneficiary *Beneficiary) error {
+	if beneficiary.Nickname == "" {
+		return fmt.Errorf("%w: nickname is required", ErrInvalidDestination)
+	}
+	if err := validateDestination(beneficiary); err != nil {
+		return err
+	}
+	if err := s.Store.CreateBeneficiary(ctx, beneficiary); err != nil {
+		log.Printf("Error creating beneficiary for user %v: %v", beneficiary.UserID, err)
+		return err
+	}
+	return nil
+}
+
+func (s *BeneficiaryService) GetBeneficiaryByID(ctx context.Context, beneficiaryID uint) (Beneficiary, error) {
+	beneficiary, err := s.Store.GetBeneficiaryByID(ctx, beneficiaryID)
+	if err != nil {
+		log.Printf("Error fetching beneficiary %v: %v", beneficiaryID, err)
+		return beneficiary, err
+	}
+	return beneficiary, nil
+}
+
+func (s *BeneficiaryService) GetBeneficiariesByUserID(ctx context.Context, userID uint) ([]Beneficiary, error) {
+	list, err := s.Store.GetBeneficiariesByUserID(ctx, userID)
+	if err != nil {
+		log.Printf("Error fetching beneficiaries for user %v: %v", userID, err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// UpdateBeneficiary renames a beneficiary or points it at a new destination. A new destination restarts the cooling-off period.
+func (s *BeneficiaryService) UpdateBeneficiary(ctx context.Context, beneficiary Beneficiary) (Beneficiary, error) {
+	if beneficiary.AccountNumber != 0 || beneficiary.Alias != "" {
+		if err := validateDestination(&beneficiary); err != nil {
+			return Beneficiary{}, err
+		}
+	}
+	updated, err := s.Store.UpdateBeneficiary(ctx, beneficiary)
+	if err != nil {
+		log.Printf("Error updating beneficiary %v: %v", beneficiary.ID, err)
+		return Beneficiary{}, err
+	}
+	return updated, nil
+}
+
+func (s *BeneficiaryService) DeleteBeneficiary(ctx context.Context, beneficiaryID uint) error {
+	if err := s.Store.DeleteBeneficiary(ctx, beneficiaryID); err != nil {
+		log.Printf("Error deleting beneficiary %v: %v", beneficiaryID, err)
+		return err
+	}
+	return nil
+}
+
+// TransferToBeneficiary sends money to a saved beneficiary. While the beneficiary is in its cooling-off period the
+// total sent to it, this transfer included, may not exceed the configured cooling-off limit.
+func (s *BeneficiaryService) TransferToBeneficiary(ctx context.Context, senderAccountNumber int64, beneficiaryID uint, amount float64, description string, paymentMethod string) (*transactions.Transactions, error) {
+	if amount <= 0 {
+		return nil, transactions.ErrInvalidAmount
+	}
+	transaction, err := s.Store.TransferToBeneficiary(ctx, senderAccountNumber, beneficiaryID, amount, description, paymentMethod, CoolingOffLimit())
+	if err != nil {
+		log.Printf("Error transferring to beneficiary %v: %v", beneficiaryID, err)
+		return nil, err
+	}
+	return &transaction, nil
+}
@@ -0,0 +1,18 @@
+package beneficiaries
+
+import (
+	"os"
+	"strconv"
+)
+
+// defaultCoolingOffLimit is used when BENEFICIARY_COOLING_OFF_LIMIT is unset or invalid
+const defaultCoolingOffLimit = 500.00
+
+// CoolingOffLimit returns the most that may be sent to a beneficiary during its cooling-off period
+func CoolingOffLimit() float64 {
+	limit, err := strconv.ParseFloat(os.Getenv("BENEFICIARY_COOLING_OFF_LIMIT"), 64)
+	if err != nil || limit < 0 {
+		return defaultCoolingOffLimit
+	}
+	return limit
+}
@@ -0,0 +1,223 @@
+package closing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Day close statuses. A reopened day has no snapshots until it is closed again.
+const (
+	StatusClosed   = "closed"
+	StatusReopened = "reopened"
+)
+
+var (
+	ErrInvalidDay       = errors.New("invalid business day")
+	ErrInvalidAsOf      = errors.New("invalid as_of")
+	ErrInvalidReopen    = errors.New("a reason is required to reopen a business day")
+	ErrDayClosed        = errors.New("business day is already closed")
+	ErrDayNotClosed     = errors.New("business day is not closed")
+	ErrPreviousDayOpen  = errors.New("the previous business day must be closed first")
+	ErrLaterDayClosed   = errors.New("a later business day is closed")
+	ErrPostingDayClosed = errors.New("the business day of the posting is closed")
+)
+
+// DayClose - the end-of-day close of one business day. Business days run from midnight to midnight UTC; once a day
+// is closed no transaction can be posted into it.
+type DayClose struct {
+	ID              uint       `json:"id"`
+	Date            time.Time  `json:"date"`
+	Status          string     `json:"status"`
+	Accounts        int        `json:"accounts"`
+	ExternalCredits float64    `json:"external_credits"`
+	ExternalDebits  float64    `json:"external_debits"`
+	ClosedAt        time.Time  `json:"closed_at"`
+	ReopenedAt      *time.Time `json:"reopened_at,omitempty"`
+	ReopenReason    string     `json:"reopen_reason,omitempty"`
+}
+
+// DailyBalance - an account's balance at the close of a business day, with what moved during it
+type DailyBalance struct {
+	AccountID      uint      `json:"account_id"`
+	AccountNumber  int64     `json:"account_number"`
+	AccountType    string    `json:"account_type"`
+	Date           time.Time `json:"date"`
+	OpeningBalance float64   `json:"opening_balance"`
+	Credits        float64   `json:"credits"`
+	Debits         float64   `json:"debits"`
+	ClosingBalance float64   `json:"closing_balance"`
+}
+
+// TrialBalanceLine - the daily balances of one account type, or of one system account, added up
+type TrialBalanceLine struct {
+	AccountType    string  `json:"account_type"`
+	SystemAccount  string  `json:"system_account,omitempty"`
+	Accounts       int     `json:"accounts"`
+	OpeningBalance float64 `json:"opening_balance"`
+	Credits        float64 `json:"credits"`
+	Debits         float64 `json:"debits"`
+	ClosingBalance float64 `json:"closing_balance"`
+}
+
+// TrialBalance - the summary of a closed day. It is balanced when every line's opening balance plus its credits less
+// its debits is its closing balance, and the credits and debits that did not come from or go outside net to zero.
+type TrialBalance struct {
+	Close          DayClose           `json:"close"`
+	Lines          []TrialBalanceLine `json:"lines"`
+	OpeningBalance float64            `json:"opening_balance"`
+	Credits        float64            `json:"credits"`
+	Debits         float64            `json:"debits"`
+	ClosingBalance float64            `json:"closing_balance"`
+	Balanced       bool               `json:"balanced"`
+}
+
+// Balance - an account's balance at a point in time, built from the last snapshot at or before it and what moved
+// since. Without a snapshot it is the current balance less what moved after the point in time.
+type Balance struct {
+	AccountID     uint       `json:"account_id"`
+	AccountNumber int64      `json:"account_number"`
+	AsOf          time.Time  `json:"as_of"`
+	Balance       float64    `json:"balance"`
+	SnapshotDate  *time.Time `json:"snapshot_date,omitempty"`
+	IntradayDelta float64    `json:"intraday_delta"`
+}
+
+type ClosingStore interface {
+	CloseDay(ctx context.Context, date time.Time) (DayClose, error)
+	ReopenDay(ctx context.Context, date time.Time, reason string) (DayClose, error)
+	LastDayClose(ctx context.Context) (*DayClose, error)
+	GetDayCloses(ctx context.Context) ([]DayClose, error)
+	GetTrialBalance(ctx context.Context, date time.Time) (TrialBalance, error)
+	GetDailyBalances(ctx context.Context, date time.Time) ([]DailyBalance, error)
+	GetBalanceAsOf(ctx context.Context, accountID uint, asOf time.Time) (Balance, error)
+}
+
+// ClosingService is the blueprint for the end-of-day logic
+type ClosingService struct {
+	Store ClosingStore
+}
+
+func NewClosingService(store ClosingStore) ClosingService {
+	return ClosingService{
+		Store: store,
+	}
+}
+
+// CloseDay snapshots every account's balance at the end of a business day that has ended and locks the day against
+// postings. Days are closed in order, so the day before must be closed unless no day ever was.
+func (s *ClosingService) CloseDay(ctx context.Context, date time.Time) (DayClose, error) {
+	if err := ValidateDay(date, time.Now()); err != nil {
+		return DayClose{}, err
+	}
+	dayClose, err := s.Store.CloseDay(ctx, date)
+	if err != nil {
+		log.Printf("Error closing business day %s: %v", date.Format("2006-01-02"), err)
+		return dayClose, err
+	}
+	return dayClose, nil
+}
+
+// ReopenDay reopens the latest closed day, dropping its snapshots so it can be corrected and closed again
+func (s *ClosingService) ReopenDay(ctx context.Context, date time.Time, reason string) (DayClose, error) {
+	if err := ValidateReopen(date, reason); err != nil {
+		return DayClose{}, err
+	}
+	dayClose, err := s.Store.ReopenDay(ctx, date, reason)
+	if err != nil {
+		log.Printf("Error reopening business day %s: %v", date.Format("2006-01-02"), err)
+		return dayClose, err
+	}
+	return dayClose, nil
+}
+
+func (s *ClosingService) GetDayCloses(ctx context.Context) ([]DayClose, error) {
+	list, err := s.Store.GetDayCloses(ctx)
+	if err != nil {
+		log.Printf("Error fetching day closes: %v", err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetTrialBalance returns the trial balance of a closed day
+func (s *ClosingService) GetTrialBalance(ctx context.Context, date time.Time) (TrialBalance, error) {
+	trial, err := s.Store.GetTrialBalance(ctx, date)
+	if err != nil {
+		log.Printf("Error fetching trial balance of %s: %v", date.Format("2006-01-02"), err)
+		return trial, err
+	}
+	return trial, nil
+}
+
+// GetDailyBalances returns every account's snapshot of a closed day
+func (s *ClosingService) GetDailyBalances(ctx context.Context, date time.Time) ([]DailyBalance, error) {
+	list, err := s.Store.GetDailyBalances(ctx, date)
+	if err != nil {
+		log.Printf("Error fetching daily balances of %s: %v", date.Format("2006-01-02"), err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetBalanceAsOf returns an account's balance at a point in time that is not in the future
+func (s *ClosingService) GetBalanceAsOf(ctx context.Context, accountID uint, asOf time.Time) (Balance, error) {
+	if asOf.After(time.Now()) {
+		return Balance{}, fmt.Errorf("%w: must not be in the future", ErrInvalidAsOf)
+	}
+	balance, err := s.Store.GetBalanceAsOf(ctx, accountID, asOf)
+	if err != nil {
+		log.Printf("Error fetching balance of account %v as of %s: %v", accountID, asOf.Format(time.RFC3339), err)
+		return balance, err
+	}
+	return balance, nil
+}
+
+// RunDayClose closes every business day that has ended since the last closed day once per interval until the context
+// is cancelled. Without any closed day it starts from yesterday.
+func (s *ClosingService) RunDayClose(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.CloseEndedDays(ctx, time.Now()); err != nil {
+			log.Printf("Error running end-of-day close: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CloseEndedDays closes, in order, the days after the last closed day up to yesterday. A reopened day is left for an
+// admin to close again, and the days after it wait until then.
+func (s *ClosingService) CloseEndedDays(ctx context.Context, now time.Time) error {
+	yesterday := StartOfDay(now).AddDate(0, 0, -1)
+
+	from := yesterday
+	last, err := s.Store.LastDayClose(ctx)
+	if err != nil {
+		return fmt.Errorf("finding last day close: %w", err)
+	}
+	if last != nil {
+		if last.Status == StatusReopened {
+			log.Printf("Business day %s is reopened, waiting for it to be closed again", last.Date.Format("2006-01-02"))
+			return nil
+		}
+		from = last.Date.AddDate(0, 0, 1)
+	}
+
+	for day := from; !day.After(yesterday); day = day.AddDate(0, 0, 1) {
+		dayClose, err := s.Store.CloseDay(ctx, day)
+		if err != nil {
+			return fmt.Errorf("closing %s: %w", day.Format("2006-01-02"), err)
+		}
+		log.Printf("Closed business day %s with %d accounts", day.Format("2006-01-02"), dayClose.Accounts)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package closing
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// StartOfDay truncates t to the start of its business day, at midnight UTC
+func StartOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// ValidateDay checks that a day to close starts at midnight UTC and has ended
+func ValidateDay(date time.Time, now time.Time) error {
+	if !date.Equal(StartOfDay(date)) {
+		return fmt.Errorf("%w: must be a date", ErrInvalidDay)
+	}
+	if !date.Before(StartOfDay(now)) {
+		return fmt.Errorf("%w: only days that have ended can be closed", ErrInvalidDay)
+	}
+	return nil
+}
+
+// ValidateReopen checks that a day to reopen is a date and that a reason is given
+func ValidateReopen(date time.Time, reason string) error {
+	if !date.Equal(StartOfDay(date)) {
+		return fmt.Errorf("%w: must be a date", ErrInvalidDay)
+	}
+	if strings.TrimSpace(reason) == "" || len(reason) > 255 {
+		return ErrInvalidReopen
+	}
+	return nil
+}
+
+// Disagrees reports whether two amounts differ by more than rounding
+func Disagrees(a float64, b float64) bool {
+	return math.Abs(a-b) >= 0.005
+}
+
+// Round rounds an amount to the cent
+func Round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
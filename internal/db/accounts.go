@@ -2,22 +2,68 @@ package db
 
 import (
 	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/audit"
+	"PayWalletEngine/internal/disputes"
+	"PayWalletEngine/internal/events"
+	"PayWalletEngine/internal/pots"
+	"PayWalletEngine/internal/transactions"
 	"PayWalletEngine/internal/users"
 	"context"
 	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"time"
 )
 
 type Account struct {
 	gorm.Model
-	AccountNumber int64   `gorm:"type:varchar(100);uniqueIndex;column:account_number"`
-	AccountType   string  `gorm:"type:varchar(50)"`
-	Balance       float64 `gorm:"type:decimal(10,2)"`
-	UserID        uint    `gorm:"column:user_id"`
+	AccountNumber  int64   `gorm:"type:bigint;uniqueIndex;column:account_number"`
+	AccountType    string  `gorm:"type:varchar(50)"`
+	Balance        float64 `gorm:"type:decimal(10,2)"`
+	UserID         uint    `gorm:"column:user_id;index"`
+	Nickname       string  `gorm:"type:varchar(100)"`
+	IsDefault      bool    `gorm:"not null;default:false"`
+	Status         string  `gorm:"type:varchar(20);not null;default:active;index"`
+	StatusReason   string  `gorm:"type:varchar(255)"`
+	LastActivityAt *time.Time
+	OverdraftLimit float64 `gorm:"type:decimal(10,2);not null;default:0"`
+	OverdraftRate  float64 `gorm:"type:decimal(7,4);not null;default:0"`
+	// LegacyNumber marks an account number issued before the configured check digit scheme
+	LegacyNumber bool `gorm:"not null;default:false"`
 }
 
-// CreateAccount creates a new account in the database for the provided user.
+type AccountStatusChange struct {
+	ID         uint   `gorm:"primarykey"`
+	AccountID  uint   `gorm:"index;column:account_id"`
+	FromStatus string `gorm:"type:varchar(20);not null"`
+	ToStatus   string `gorm:"type:varchar(20);not null"`
+	Reason     string `gorm:"type:varchar(255);not null"`
+	CreatedAt  time.Time
+}
+
+// accountFromModel maps a stored account to the accounts domain type
+func accountFromModel(a Account) accounts.Account {
+	return accounts.WithOverdraftUsage(accounts.Account{
+		ID:             a.ID,
+		AccountNumber:  a.AccountNumber,
+		AccountType:    a.AccountType,
+		Balance:        a.Balance,
+		UserID:         a.UserID,
+		Nickname:       a.Nickname,
+		IsDefault:      a.IsDefault,
+		Status:         a.Status,
+		StatusReason:   a.StatusReason,
+		LastActivityAt: a.LastActivityAt,
+		OverdraftLimit: a.OverdraftLimit,
+		OverdraftRate:  a.OverdraftRate,
+	})
+}
+
+// CreateAccount creates a new wallet in the database for the provided user. A user may hold one open wallet
+// of each account type, and their first wallet becomes the default one.
 func (d *Database) CreateAccount(ctx context.Context, account *accounts.Account) error {
 	if account.UserID == 0 {
 		return fmt.Errorf("UserID is required to create an account")
@@ -33,68 +79,181 @@ func (d *Database) CreateAccount(ctx context.Context, account *accounts.Account)
 		return err
 	}
 
-	// Check if an account for the given UserID already exists
-	var existingAccount Account
-	err = d.Client.WithContext(ctx).Where("user_id = ?", account.UserID).First(&existingAccount).Error
-	if err == nil {
-		return fmt.Errorf("account with the provided UserID already exists")
-	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
-		return err
+	newAccount := Account{
+		AccountType: account.AccountType,
+		Nickname:    account.Nickname,
+		UserID:      account.UserID,
+		Balance:     account.Balance,
+		Status:      accounts.StatusActive,
 	}
-	accountNumber, err := accounts.GenerateAccountNumber()
+
+	err = d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the user's wallets so concurrent requests cannot both pass the checks below
+		var existing []Account
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND status <> ?", account.UserID, accounts.StatusClosed).
+			Find(&existing).Error
+		if err != nil {
+			return err
+		}
+		for _, e := range existing {
+			if e.AccountType == account.AccountType {
+				return fmt.Errorf("%w: user already holds a %s wallet", accounts.ErrDuplicateAccountType, account.AccountType)
+			}
+		}
+		newAccount.IsDefault = len(existing) == 0
+
+		if err := d.insertAccount(tx, ctx, &newAccount); err != nil {
+			return err
+		}
+		if err := d.recordOpeningBalance(tx, ctx, newAccount); err != nil {
+			return err
+		}
+		keys := []string{events.AccountKey(newAccount.AccountNumber), events.UserKey(newAccount.UserID)}
+		return writeOutbox(tx, ctx, events.TypeAccountCreated, keys, accountFromModel(newAccount))
+	})
 	if err != nil {
 		return err
 	}
 
-	// If account doesn't exist, proceed to create
-	newAccount := Account{
-		AccountType:   account.AccountType,
-		UserID:        account.UserID,
-		Balance:       account.Balance,
-		AccountNumber: accountNumber, // We'll populate this below
-	}
-
-	// Save the new account to the database
-	if err := d.Client.WithContext(ctx).Create(&newAccount).Error; err != nil {
-		return err
+	details := fmt.Sprintf("account %d opened", newAccount.AccountNumber)
+	if err := d.recordAudit(d.Client, ctx, newAccount.UserID, audit.ActionAccountCreated, details); err != nil {
+		log.Println("Error recording audit entry:", err)
 	}
 
+	*account = accountFromModel(newAccount)
 	return nil
 }
 
-// UpdateAccountDetails updates an existing account in the database within a transaction.
-func (d *Database) UpdateAccountDetails(ctx context.Context, account accounts.Account) error {
-	tx := d.Client.WithContext(ctx).Begin() // Start a new transaction
+// maxAccountNumberAttempts bounds how often a colliding account number is regenerated
+const maxAccountNumberAttempts = 5
 
-	var a Account
-	err := tx.Where("id = ?", account.ID).First(&a).Error
+// recordOpeningBalance records the balance an account was opened with as a credit, so that its transaction history
+// explains its balance
+func (d *Database) recordOpeningBalance(tx *gorm.DB, ctx context.Context, account Account) error {
+	if account.Balance == 0 {
+		return nil
+	}
+	reference, err := transactions.GenerateTransactionRef()
 	if err != nil {
-		tx.Rollback() // Rollback transaction on error
 		return err
 	}
-
-	// Update account details only if they are non-empty or non-zero
-	if account.AccountNumber != 0 {
-		a.AccountNumber = account.AccountNumber
+	balance := account.Balance
+	t := transactions.Transactions{
+		Amount:        balance,
+		PaymentMethod: "internal",
+		Status:        "Completed",
+		Type:          "Credit",
+		Description:   "Opening balance",
+		Reference:     reference,
+		TransactionID: uuid.New(),
 	}
-	if account.AccountType != "" {
-		a.AccountType = account.AccountType
+	if balance > 0 {
+		t.ReceiverAccountNumber = account.AccountNumber
+		t.ReceiverBalanceAfter = &balance
+	} else {
+		t.Amount = -balance
+		t.Type = "Debit"
+		t.SenderAccountNumber = account.AccountNumber
+		t.SenderBalanceAfter = &balance
 	}
-	if account.Balance != 0 {
-		a.Balance = account.Balance
+	if err := tx.WithContext(ctx).Create(&t).Error; err != nil {
+		return err
 	}
-	if account.UserID != 0 {
-		a.UserID = account.UserID
+	return d.transactionPosted(tx, ctx, t)
+}
+
+// insertAccount allocates an account number and inserts the account. The insert runs behind a savepoint so that
+// a collision on the account_number unique index can be retried with a fresh number inside the same transaction.
+func (d *Database) insertAccount(tx *gorm.DB, ctx context.Context, account *Account) error {
+	for attempt := 1; attempt <= maxAccountNumberAttempts; attempt++ {
+		accountNumber, err := accounts.GenerateAccountNumber()
+		if err != nil {
+			return err
+		}
+		account.AccountNumber = accountNumber
+
+		if err := tx.WithContext(ctx).SavePoint("allocate_account_number").Error; err != nil {
+			return err
+		}
+		err = tx.WithContext(ctx).Create(account).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return err
+		}
+		if err := tx.WithContext(ctx).RollbackTo("allocate_account_number").Error; err != nil {
+			return err
+		}
+		account.ID = 0
+		log.Printf("Account number %d already allocated, retrying (attempt %d)", accountNumber, attempt)
 	}
+	return fmt.Errorf("could not allocate a unique account number after %d attempts", maxAccountNumberAttempts)
+}
 
-	err = tx.Save(&a).Error
+// UpdateAccountDetails changes the type and nickname of an account. The row is locked so that the update cannot
+// interleave with a status change, and closed accounts cannot be changed.
+func (d *Database) UpdateAccountDetails(ctx context.Context, account accounts.Account) error {
+	return d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var a Account
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", account.ID).First(&a).Error; err != nil {
+			return err
+		}
+		if a.Status == accounts.StatusClosed {
+			return accounts.ErrAccountClosed
+		}
+
+		updates := map[string]interface{}{}
+		if account.AccountType != "" && account.AccountType != a.AccountType {
+			var count int64
+			err := tx.Model(&Account{}).
+				Where("user_id = ? AND account_type = ? AND status <> ? AND id <> ?", a.UserID, account.AccountType, accounts.StatusClosed, a.ID).
+				Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return fmt.Errorf("%w: user already holds a %s wallet", accounts.ErrDuplicateAccountType, account.AccountType)
+			}
+			updates["account_type"] = account.AccountType
+		}
+		if account.Nickname != "" {
+			updates["nickname"] = account.Nickname
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Model(&a).Updates(updates).Error
+	})
+}
+
+// MarkLegacyAccountNumbers flags the accounts whose number does not pass the generator's validation, because it was
+// issued before the check digit scheme was introduced or changed, and returns every flagged number
+func (d *Database) MarkLegacyAccountNumbers(ctx context.Context, generator accounts.NumberGenerator) ([]int64, error) {
+	var records []Account
+	err := d.Client.WithContext(ctx).Unscoped().Select("id", "account_number").Where("NOT legacy_number").
+		FindInBatches(&records, 1000, func(tx *gorm.DB, batch int) error {
+			var ids []uint
+			for _, a := range records {
+				if generator.Validate(a.AccountNumber) != nil {
+					ids = append(ids, a.ID)
+				}
+			}
+			if len(ids) == 0 {
+				return nil
+			}
+			return d.Client.WithContext(ctx).Unscoped().Model(&Account{}).Where("id IN ?", ids).Update("legacy_number", true).Error
+		}).Error
 	if err != nil {
-		tx.Rollback() // Rollback transaction on error
-		return err
+		return nil, err
 	}
 
-	tx.Commit() // Commit the transaction
-	return nil
+	var legacy []int64
+	if err := d.Client.WithContext(ctx).Unscoped().Model(&Account{}).Where("legacy_number").Pluck("account_number", &legacy).Error; err != nil {
+		return nil, err
+	}
+	return legacy, nil
 }
 
 // GetAccountByID retrieves an account by its ID
@@ -104,13 +263,7 @@ func (d *Database) GetAccountByID(ctx context.Context, id uint) (accounts.Accoun
 	if err != nil {
 		return accounts.Account{}, err
 	}
-	return accounts.Account{
-		ID:            a.ID,
-		AccountNumber: a.AccountNumber,
-		AccountType:   a.AccountType,
-		Balance:       a.Balance,
-		UserID:        a.UserID,
-	}, nil
+	return accountFromModel(a), nil
 }
 
 // GetAccountByNumber retrieves an account by its account number
@@ -120,13 +273,7 @@ func (d *Database) GetAccountByNumber(ctx context.Context, accountNumber uint) (
 	if err != nil {
 		return accounts.Account{}, err
 	}
-	return accounts.Account{
-		ID:            a.ID,
-		AccountNumber: a.AccountNumber,
-		AccountType:   a.AccountType,
-		Balance:       a.Balance,
-		UserID:        a.UserID,
-	}, nil
+	return accountFromModel(a), nil
 }
 
 // GetUserByAccountNumber retrieves a user by their account details
@@ -160,35 +307,316 @@ func (d *Database) GetAccountsByUserID(ctx context.Context, userID uint) ([]*acc
 	if err != nil {
 		return nil, err
 	}
+	for _, a := range userAccounts {
+		*a = accounts.WithOverdraftUsage(*a)
+	}
 
 	return userAccounts, nil
 }
 
-// Helper function to credit an account
+// lockAccounts locks the rows of the given accounts in ascending account number order. Postings that touch several
+// accounts take their locks through it before changing any of them, so two postings between the same accounts
+// always lock them in the same order and cannot deadlock. Zero, the outside side of a credit or debit, is skipped.
+func lockAccounts(tx *gorm.DB, ctx context.Context, accountNumbers ...int64) error {
+	var numbers []int64
+	for _, n := range accountNumbers {
+		if n != 0 {
+			numbers = append(numbers, n)
+		}
+	}
+	if len(numbers) == 0 {
+		return nil
+	}
+	var locked []Account
+	return tx.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("account_number IN ?", numbers).
+		Order("account_number").
+		Find(&locked).Error
+}
+
+// Helper function to credit an account. Postings that touch other accounts too lock them all with lockAccounts first.
 func (d *Database) creditAccountHelper(tx *gorm.DB, ctx context.Context, receiverAccountNumber int64, amount float64) (accounts.Account, error) {
 	var receiverAccount accounts.Account
-	if err := tx.WithContext(ctx).Where("account_number = ?", receiverAccountNumber).First(&receiverAccount).Error; err != nil {
+	if err := tx.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Where("account_number = ?", receiverAccountNumber).First(&receiverAccount).Error; err != nil {
+		return receiverAccount, err
+	}
+	if err := accounts.CanCredit(receiverAccount.Status); err != nil {
 		return receiverAccount, err
 	}
+	now := time.Now()
 	receiverAccount.Balance += amount
+	receiverAccount.LastActivityAt = &now
 	if err := tx.WithContext(ctx).Save(&receiverAccount).Error; err != nil {
 		return receiverAccount, err
 	}
 	return receiverAccount, nil
 }
 
-// Helper function to debit an account
+// accountBalance reads the balance of an account inside a transaction, for rows recorded after the balance was
+// changed with an SQL expression rather than one of the helpers
+func accountBalance(tx *gorm.DB, ctx context.Context, accountNumber int64) (*float64, error) {
+	var balance float64
+	err := tx.WithContext(ctx).Model(&Account{}).Where("account_number = ?", accountNumber).Select("balance").Scan(&balance).Error
+	if err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
+
+// Helper function to debit an account. Postings that touch other accounts too lock them all with lockAccounts first.
 func (d *Database) debitAccountHelper(tx *gorm.DB, ctx context.Context, senderAccountNumber int64, amount float64) (accounts.Account, error) {
 	var senderAccount accounts.Account
-	if err := tx.WithContext(ctx).Where("account_number = ?", senderAccountNumber).First(&senderAccount).Error; err != nil {
+	if err := tx.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Where("account_number = ?", senderAccountNumber).First(&senderAccount).Error; err != nil {
+		return senderAccount, err
+	}
+	if err := accounts.CanDebit(senderAccount.Status); err != nil {
 		return senderAccount, err
 	}
-	if senderAccount.Balance < amount {
-		return senderAccount, fmt.Errorf("insufficient funds in account")
+	if err := accounts.CheckFunds(senderAccount, amount); err != nil {
+		return senderAccount, err
 	}
+	now := time.Now()
 	senderAccount.Balance -= amount
+	senderAccount.LastActivityAt = &now
 	if err := tx.WithContext(ctx).Save(&senderAccount).Error; err != nil {
 		return senderAccount, err
 	}
 	return senderAccount, nil
 }
+
+// setAccountStatus moves a locked account to a new status and records the change with its reason
+func (d *Database) setAccountStatus(tx *gorm.DB, ctx context.Context, a *Account, status string, reason string) error {
+	change := AccountStatusChange{
+		AccountID:  a.ID,
+		FromStatus: a.Status,
+		ToStatus:   status,
+		Reason:     reason,
+	}
+	err := tx.WithContext(ctx).Model(a).Updates(map[string]interface{}{
+		"status":        status,
+		"status_reason": reason,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return tx.WithContext(ctx).Create(&change).Error
+}
+
+// ChangeAccountStatus moves an account to the given status if the transition is allowed
+func (d *Database) ChangeAccountStatus(ctx context.Context, accountID uint, status string, reason string) error {
+	var a Account
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", accountID).First(&a).Error; err != nil {
+			return err
+		}
+		if !accounts.CanTransition(a.Status, status) {
+			return fmt.Errorf("%w: %s to %s", accounts.ErrInvalidStatusTransition, a.Status, status)
+		}
+		return d.setAccountStatus(tx, ctx, &a, status, reason)
+	})
+	if err != nil {
+		return err
+	}
+	if status == accounts.StatusFrozen {
+		d.accountFrozen(ctx, a, reason)
+	}
+	return nil
+}
+
+// CloseAccount closes an account. Any remaining balance is first swept to the nominated account
+// as a final settlement transfer in the same database transaction.
+func (d *Database) CloseAccount(ctx context.Context, accountID uint, sweepAccountNumber int64, reason string) error {
+	return d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var a Account
+		if err := tx.Where("id = ?", accountID).First(&a).Error; err != nil {
+			return err
+		}
+		// the account and the one its balance is swept to are locked together, in account number order
+		if err := lockAccounts(tx, ctx, a.AccountNumber, sweepAccountNumber); err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", accountID).First(&a).Error; err != nil {
+			return err
+		}
+		if !accounts.CanTransition(a.Status, accounts.StatusClosed) {
+			return fmt.Errorf("%w: %s to %s", accounts.ErrInvalidStatusTransition, a.Status, accounts.StatusClosed)
+		}
+
+		if a.Balance < 0 || (a.Balance > 0 && sweepAccountNumber == 0) {
+			return accounts.ErrNonZeroBalance
+		}
+
+		var potBalance float64
+		err := tx.Model(&Pot{}).Where("account_number = ? AND status = ?", a.AccountNumber, pots.StatusActive).Select("COALESCE(SUM(balance), 0)").Scan(&potBalance).Error
+		if err != nil {
+			return err
+		}
+		if potBalance > 0 {
+			return fmt.Errorf("%w: close the account's pots first", accounts.ErrNonZeroBalance)
+		}
+
+		var openDisputes int64
+		err = tx.Model(&Dispute{}).
+			Where("status IN ? AND account_number = ?", []string{disputes.StatusOpen, disputes.StatusUnderReview}, a.AccountNumber).
+			Count(&openDisputes).Error
+		if err != nil {
+			return err
+		}
+		if openDisputes > 0 {
+			return fmt.Errorf("%w: the account has open disputes", accounts.ErrInvalidStatusTransition)
+		}
+
+		if a.Balance > 0 {
+			if sweepAccountNumber == a.AccountNumber {
+				return fmt.Errorf("cannot sweep an account into itself")
+			}
+			amount := a.Balance
+			receiverAccount, err := d.creditAccountHelper(tx, ctx, sweepAccountNumber, amount)
+			if err != nil {
+				return err
+			}
+			reference, err := transactions.GenerateTransactionRef()
+			if err != nil {
+				return err
+			}
+			t := transactions.Transactions{
+				SenderAccountNumber:   a.AccountNumber,
+				ReceiverAccountNumber: receiverAccount.AccountNumber,
+				Amount:                amount,
+				PaymentMethod:         "internal",
+				Status:                "Completed",
+				Type:                  "Transfer",
+				Description:           "Final settlement on account closure",
+				Reference:             reference,
+				TransactionID:         uuid.New(),
+				SenderBalanceAfter:    new(float64),
+				ReceiverBalanceAfter:  &receiverAccount.Balance,
+			}
+			if err := tx.WithContext(ctx).Create(&t).Error; err != nil {
+				return err
+			}
+			if err := tx.WithContext(ctx).Model(&a).Update("balance", 0).Error; err != nil {
+				return err
+			}
+			if err := d.transactionPosted(tx, ctx, t); err != nil {
+				return err
+			}
+		}
+
+		return d.setAccountStatus(tx, ctx, &a, accounts.StatusClosed, reason)
+	})
+}
+
+// MarkDormantAccounts moves active accounts with no activity since the given time to dormant
+func (d *Database) MarkDormantAccounts(ctx context.Context, inactiveSince time.Time) (int64, error) {
+	var count int64
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var stale []Account
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND account_type <> ?", accounts.StatusActive, accounts.TypeSystem).
+			Where("COALESCE(last_activity_at, created_at) < ?", inactiveSince).
+			Find(&stale).Error
+		if err != nil {
+			return err
+		}
+		reason := fmt.Sprintf("no activity since %s", inactiveSince.Format("2006-01-02"))
+		for i := range stale {
+			if err := d.setAccountStatus(tx, ctx, &stale[i], accounts.StatusDormant, reason); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// GetAccountStatusHistory retrieves every status change recorded for an account, oldest first
+func (d *Database) GetAccountStatusHistory(ctx context.Context, accountID uint) ([]accounts.StatusChange, error) {
+	var changes []AccountStatusChange
+	err := d.Client.WithContext(ctx).Where("account_id = ?", accountID).Order("created_at asc").Find(&changes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var history []accounts.StatusChange
+	for _, c := range changes {
+		history = append(history, accounts.StatusChange{
+			ID:         c.ID,
+			AccountID:  c.AccountID,
+			FromStatus: c.FromStatus,
+			ToStatus:   c.ToStatus,
+			Reason:     c.Reason,
+			CreatedAt:  c.CreatedAt,
+		})
+	}
+	return history, nil
+}
+
+// SetDefaultAccount makes the account its owner's default wallet and clears the flag on their other wallets
+func (d *Database) SetDefaultAccount(ctx context.Context, accountID uint) error {
+	return d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var a Account
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", accountID).First(&a).Error; err != nil {
+			return err
+		}
+		if a.Status == accounts.StatusClosed {
+			return accounts.ErrAccountClosed
+		}
+		if err := tx.Model(&Account{}).Where("user_id = ? AND id <> ?", a.UserID, a.ID).Update("is_default", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&a).Update("is_default", true).Error
+	})
+}
+
+// SetOverdraftLimit changes the overdraft limit and rate of a user's account and records the change in the owner's
+// audit log
+func (d *Database) SetOverdraftLimit(ctx context.Context, accountID uint, limit float64, rate float64, reason string) (accounts.Account, error) {
+	var a Account
+	var previous, previousRate float64
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", accountID).First(&a).Error; err != nil {
+			return err
+		}
+		if a.AccountType == accounts.TypeSystem {
+			return accounts.ErrSystemAccount
+		}
+		if a.Status == accounts.StatusClosed {
+			return accounts.ErrAccountClosed
+		}
+		previous, previousRate = a.OverdraftLimit, a.OverdraftRate
+		return tx.Model(&a).Updates(map[string]interface{}{
+			"overdraft_limit": limit,
+			"overdraft_rate":  rate,
+		}).Error
+	})
+	if err != nil {
+		return accounts.Account{}, err
+	}
+
+	details := fmt.Sprintf("overdraft of account %d changed from %.2f at %.4f%% to %.2f at %.4f%%: %s",
+		a.AccountNumber, previous, previousRate, limit, rate, reason)
+	if err := d.recordAudit(d.Client, ctx, a.UserID, audit.ActionOverdraftChanged, details); err != nil {
+		log.Println("Error recording audit entry:", err)
+	}
+	return accountFromModel(a), nil
+}
+
+// GetOverdrawnAccounts retrieves every user account with a negative balance, most overdrawn first
+func (d *Database) GetOverdrawnAccounts(ctx context.Context) ([]accounts.Account, error) {
+	var records []Account
+	err := d.Client.WithContext(ctx).
+		Where("balance < 0 AND account_type <> ?", accounts.TypeSystem).
+		Order("balance asc").
+		Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+
+	overdrawn := []accounts.Account{}
+	for _, a := range records {
+		overdrawn = append(overdrawn, accountFromModel(a))
+	}
+	return overdrawn, nil
+}
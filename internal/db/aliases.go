@@ -0,0 +1,209 @@
+package db
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/aliases"
+	"PayWalletEngine/utils"
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type PaymentAlias struct {
+	ID                    uint   `gorm:"primarykey"`
+	UserID                uint   `gorm:"index;column:user_id;not null"`
+	Type                  string `gorm:"type:varchar(20);not null;uniqueIndex:idx_verified_alias,where:verified = true"`
+	Value                 string `gorm:"type:varchar(255);not null;uniqueIndex:idx_verified_alias,where:verified = true"`
+	Verified              bool   `gorm:"not null;default:false"`
+	VerificationCodeHash  string `gorm:"type:varchar(100)"`
+	VerificationExpiresAt *time.Time
+	VerificationAttempts  int `gorm:"not null;default:0"`
+	VerifiedAt            *time.Time
+	CreatedAt             time.Time
+}
+
+func aliasFromModel(a PaymentAlias) aliases.Alias {
+	return aliases.Alias{
+		ID:         a.ID,
+		UserID:     a.UserID,
+		Type:       a.Type,
+		Value:      a.Value,
+		Verified:   a.Verified,
+		VerifiedAt: a.VerifiedAt,
+		CreatedAt:  a.CreatedAt,
+	}
+}
+
+// CreateAlias stores a new alias for the user. Username aliases are verified straight away when they match the
+// user's own username; email and phone aliases wait for the verification code.
+func (d *Database) CreateAlias(ctx context.Context, alias *aliases.Alias, codeHash string, codeExpiresAt time.Time) error {
+	var user User
+	if err := d.Client.WithContext(ctx).Where("id = ?", alias.UserID).First(&user).Error; err != nil {
+		return err
+	}
+
+	var taken int64
+	err := d.Client.WithContext(ctx).Model(&PaymentAlias{}).
+		Where("type = ? AND value = ? AND verified = ? AND user_id <> ?", alias.Type, alias.Value, true, alias.UserID).
+		Count(&taken).Error
+	if err != nil {
+		return err
+	}
+	if taken > 0 {
+		return aliases.ErrAliasTaken
+	}
+
+	record := PaymentAlias{
+		UserID:                alias.UserID,
+		Type:                  alias.Type,
+		Value:                 alias.Value,
+		VerificationCodeHash:  codeHash,
+		VerificationExpiresAt: &codeExpiresAt,
+	}
+	if alias.Type == aliases.TypeUsername {
+		if alias.Value != user.Username {
+			return aliases.ErrUsernameAliasMismatch
+		}
+		now := time.Now()
+		record.Verified = true
+		record.VerifiedAt = &now
+		record.VerificationCodeHash = ""
+		record.VerificationExpiresAt = nil
+	}
+
+	if err := d.Client.WithContext(ctx).Create(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return aliases.ErrAliasTaken
+		}
+		return err
+	}
+
+	*alias = aliasFromModel(record)
+	return nil
+}
+
+// VerifyAlias checks the code against the stored hash and marks the alias verified. Wrong codes are counted, and
+// the code is invalidated once the alias has taken MaxVerificationAttempts of them.
+func (d *Database) VerifyAlias(ctx context.Context, aliasID uint, code string) (aliases.Alias, error) {
+	var record PaymentAlias
+	// codeErr rejects the code once the transaction has committed the attempt it counted
+	var codeErr error
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", aliasID).First(&record).Error; err != nil {
+			return err
+		}
+		if record.Verified {
+			return nil
+		}
+		if record.VerificationAttempts >= aliases.MaxVerificationAttempts {
+			return aliases.ErrTooManyAttempts
+		}
+		if record.VerificationExpiresAt == nil || time.Now().After(*record.VerificationExpiresAt) {
+			return aliases.ErrInvalidCode
+		}
+		if !utils.ComparePasswords(record.VerificationCodeHash, code) {
+			record.VerificationAttempts++
+			codeErr = aliases.ErrInvalidCode
+			if record.VerificationAttempts >= aliases.MaxVerificationAttempts {
+				record.VerificationCodeHash = ""
+				record.VerificationExpiresAt = nil
+				codeErr = aliases.ErrTooManyAttempts
+			}
+			return tx.Save(&record).Error
+		}
+
+		now := time.Now()
+		record.Verified = true
+		record.VerifiedAt = &now
+		record.VerificationCodeHash = ""
+		record.VerificationExpiresAt = nil
+		return tx.Save(&record).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return aliases.Alias{}, aliases.ErrAliasTaken
+		}
+		return aliases.Alias{}, err
+	}
+	if codeErr != nil {
+		return aliases.Alias{}, codeErr
+	}
+	return aliasFromModel(record), nil
+}
+
+// ResetVerificationCode gives an unverified alias a new code, with a new expiry and its attempts counted afresh
+func (d *Database) ResetVerificationCode(ctx context.Context, aliasID uint, codeHash string, codeExpiresAt time.Time) (aliases.Alias, error) {
+	var record PaymentAlias
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", aliasID).First(&record).Error; err != nil {
+			return err
+		}
+		if record.Verified {
+			return aliases.ErrAlreadyVerified
+		}
+		record.VerificationCodeHash = codeHash
+		record.VerificationExpiresAt = &codeExpiresAt
+		record.VerificationAttempts = 0
+		return tx.Save(&record).Error
+	})
+	if err != nil {
+		return aliases.Alias{}, err
+	}
+	return aliasFromModel(record), nil
+}
+
+// GetAliasesByUserID retrieves every alias a user has registered, verified or not
+func (d *Database) GetAliasesByUserID(ctx context.Context, userID uint) ([]aliases.Alias, error) {
+	var records []PaymentAlias
+	if err := d.Client.WithContext(ctx).Where("user_id = ?", userID).Order("created_at asc").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	var result []aliases.Alias
+	for _, r := range records {
+		result = append(result, aliasFromModel(r))
+	}
+	return result, nil
+}
+
+func (d *Database) DeleteAlias(ctx context.Context, aliasID uint) error {
+	result := d.Client.WithContext(ctx).Where("id = ?", aliasID).Delete(&PaymentAlias{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ResolveAlias finds the verified alias and returns the owner's open default account with their masked username
+func (d *Database) ResolveAlias(ctx context.Context, aliasType string, value string) (aliases.Resolution, error) {
+	var record PaymentAlias
+	err := d.Client.WithContext(ctx).Where("type = ? AND value = ? AND verified = ?", aliasType, value, true).First(&record).Error
+	if err != nil {
+		return aliases.Resolution{}, err
+	}
+
+	var user User
+	if err := d.Client.WithContext(ctx).Where("id = ?", record.UserID).First(&user).Error; err != nil {
+		return aliases.Resolution{}, err
+	}
+
+	var account Account
+	err = d.Client.WithContext(ctx).
+		Where("user_id = ? AND is_default = ? AND status <> ?", record.UserID, true, accounts.StatusClosed).
+		First(&account).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return aliases.Resolution{}, aliases.ErrNoDefaultAccount
+		}
+		return aliases.Resolution{}, err
+	}
+
+	return aliases.Resolution{
+		DisplayName:   aliases.MaskName(user.Username),
+		AccountNumber: account.AccountNumber,
+	}, nil
+}
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"PayWalletEngine/internal/aliases"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+// createTestAlias registers an unverified email alias for the user with a known verification code
+func createTestAlias(t *testing.T, d *Database, userID uint, code string) aliases.Alias {
+	t.Helper()
+	codeHash, err := aliases.HashVerificationCode(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alias := aliases.Alias{UserID: userID, Type: aliases.TypeEmail, Value: uuid.New().String() + "@example.com"}
+	if err := d.CreateAlias(context.Background(), &alias, codeHash, time.Now().Add(15*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	return alias
+}
+
+func TestVerifyAliasLocksOutAfterWrongCodes(t *testing.T) {
+	d := testDatabase(t)
+	ctx := context.Background()
+	alias := createTestAlias(t, d, createTestUser(t, d), "123456")
+
+	for attempt := 1; attempt < aliases.MaxVerificationAttempts; attempt++ {
+		if _, err := d.VerifyAlias(ctx, alias.ID, "000000"); !errors.Is(err, aliases.ErrInvalidCode) {
+			t.Fatalf("wrong code %d: got %v, want ErrInvalidCode", attempt, err)
+		}
+	}
+	if _, err := d.VerifyAlias(ctx, alias.ID, "000000"); !errors.Is(err, aliases.ErrTooManyAttempts) {
+		t.Fatalf("last wrong code: got %v, want ErrTooManyAttempts", err)
+	}
+	if _, err := d.VerifyAlias(ctx, alias.ID, "123456"); !errors.Is(err, aliases.ErrTooManyAttempts) {
+		t.Fatalf("the right code after the lockout: got %v, want ErrTooManyAttempts", err)
+	}
+}
+
+func TestResetVerificationCodeRestoresAttempts(t *testing.T) {
+	d := testDatabase(t)
+	ctx := context.Background()
+	alias := createTestAlias(t, d, createTestUser(t, d), "123456")
+
+	for attempt := 0; attempt < aliases.MaxVerificationAttempts; attempt++ {
+		d.VerifyAlias(ctx, alias.ID, "000000")
+	}
+
+	codeHash, err := aliases.HashVerificationCode("654321")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.ResetVerificationCode(ctx, alias.ID, codeHash, time.Now().Add(15*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.VerifyAlias(ctx, alias.ID, "123456"); !errors.Is(err, aliases.ErrInvalidCode) {
+		t.Errorf("the replaced code: got %v, want ErrInvalidCode", err)
+	}
+	verified, err := d.VerifyAlias(ctx, alias.ID, "654321")
+	if err != nil {
+		t.Fatalf("the new code: %v", err)
+	}
+	if !verified.Verified {
+		t.Error("the alias was not verified with the new code")
+	}
+
+	if _, err := d.ResetVerificationCode(ctx, alias.ID, codeHash, time.Now().Add(15*time.Minute)); !errors.Is(err, aliases.ErrAlreadyVerified) {
+		t.Errorf("resending to a verified alias: got %v, want ErrAlreadyVerified", err)
+	}
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"PayWalletEngine/internal/audit"
+	"context"
+	"gorm.io/gorm"
+	"time"
+)
+
+type AuditLog struct {
+	ID        uint   `gorm:"primarykey"`
+	UserID    uint   `gorm:"index;column:user_id"`
+	Action    string `gorm:"type:varchar(100);not null"`
+	Details   string `gorm:"type:varchar(255)"`
+	CreatedAt time.Time
+}
+
+// recordAudit writes an audit entry for the user using the provided connection or transaction
+func (d *Database) recordAudit(tx *gorm.DB, ctx context.Context, userID uint, action string, details string) error {
+	entry := AuditLog{
+		UserID:  userID,
+		Action:  action,
+		Details: details,
+	}
+	return tx.WithContext(ctx).Create(&entry).Error
+}
+
+// GetAuditEntriesByUserID retrieves every audit entry recorded for a user, oldest first
+func (d *Database) GetAuditEntriesByUserID(ctx context.Context, userID uint) ([]audit.Entry, error) {
+	var logs []AuditLog
+	err := d.Client.WithContext(ctx).Where("user_id = ?", userID).Order("created_at asc").Find(&logs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []audit.Entry
+	for _, l := range logs {
+		entries = append(entries, audit.Entry{
+			ID:        l.ID,
+			UserID:    l.UserID,
+			Action:    l.Action,
+			Details:   l.Details,
+			CreatedAt: l.CreatedAt,
+		})
+	}
+	return entries, nil
+}
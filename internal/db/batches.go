@@ -0,0 +1,280 @@
+package db
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/batches"
+	"PayWalletEngine/internal/fees"
+	"PayWalletEngine/internal/transactions"
+	"PayWalletEngine/internal/webhooks"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type PaymentBatch struct {
+	ID                  uint    `gorm:"primarykey"`
+	SenderAccountNumber int64   `gorm:"type:bigint;not null;index"`
+	Mode                string  `gorm:"type:varchar(20);not null"`
+	PaymentMethod       string  `gorm:"type:varchar(50)"`
+	Status              string  `gorm:"type:varchar(20);not null"`
+	TotalAmount         float64 `gorm:"type:decimal(12,2);not null"`
+	SucceededAmount     float64 `gorm:"type:decimal(12,2);not null"`
+	LegCount            int
+	SucceededCount      int
+	FailedCount         int
+	Legs                []PaymentBatchLeg `gorm:"foreignKey:BatchID"`
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+}
+
+type PaymentBatchLeg struct {
+	ID                    uint       `gorm:"primarykey"`
+	BatchID               uint       `gorm:"not null;index"`
+	Position              int        `gorm:"not null"`
+	ReceiverAccountNumber int64      `gorm:"type:bigint;not null"`
+	Amount                float64    `gorm:"type:decimal(10,2);not null"`
+	Description           string     `gorm:"type:varchar(255)"`
+	Status                string     `gorm:"type:varchar(20);not null"`
+	Error                 string     `gorm:"type:varchar(255)"`
+	TransactionID         *uuid.UUID `gorm:"type:uuid"`
+}
+
+func batchFromModel(b PaymentBatch) batches.Batch {
+	batch := batches.Batch{
+		ID:                  b.ID,
+		SenderAccountNumber: b.SenderAccountNumber,
+		Mode:                b.Mode,
+		PaymentMethod:       b.PaymentMethod,
+		Status:              b.Status,
+		TotalAmount:         b.TotalAmount,
+		SucceededAmount:     b.SucceededAmount,
+		LegCount:            b.LegCount,
+		SucceededCount:      b.SucceededCount,
+		FailedCount:         b.FailedCount,
+		CreatedAt:           b.CreatedAt,
+	}
+	for _, l := range b.Legs {
+		batch.Legs = append(batch.Legs, batches.Leg{
+			ID:                    l.ID,
+			Position:              l.Position,
+			ReceiverAccountNumber: l.ReceiverAccountNumber,
+			Amount:                l.Amount,
+			Description:           l.Description,
+			Status:                l.Status,
+			Error:                 l.Error,
+			TransactionID:         l.TransactionID,
+		})
+	}
+	return batch
+}
+
+func batchToModel(batch batches.Batch) PaymentBatch {
+	record := PaymentBatch{
+		SenderAccountNumber: batch.SenderAccountNumber,
+		Mode:                batch.Mode,
+		PaymentMethod:       batch.PaymentMethod,
+		Status:              batch.Status,
+		TotalAmount:         batch.TotalAmount,
+		SucceededAmount:     batch.SucceededAmount,
+		LegCount:            batch.LegCount,
+		SucceededCount:      batch.SucceededCount,
+		FailedCount:         batch.FailedCount,
+	}
+	for _, l := range batch.Legs {
+		errorText := l.Error
+		if len(errorText) > 255 {
+			errorText = errorText[:255]
+		}
+		record.Legs = append(record.Legs, PaymentBatchLeg{
+			Position:              l.Position,
+			ReceiverAccountNumber: l.ReceiverAccountNumber,
+			Amount:                l.Amount,
+			Description:           l.Description,
+			Status:                l.Status,
+			Error:                 errorText,
+			TransactionID:         l.TransactionID,
+		})
+	}
+	return record
+}
+
+// errBatchAborted stops an all-or-nothing batch after its first failed leg so that the whole transaction rolls back
+var errBatchAborted = errors.New("batch aborted")
+
+// ExecuteBatch pays every leg of a batch inside one database transaction. The sender is locked once and debited once
+// for the total of the legs that succeed. Best-effort batches roll each failed leg back to a savepoint and carry on,
+// all-or-nothing batches roll everything back on the first failure. The batch and its legs are recorded either way.
+func (d *Database) ExecuteBatch(ctx context.Context, batch *batches.Batch) error {
+	var record PaymentBatch
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// the sender and every receiver are locked up front, in account number order, so the batch cannot deadlock
+		// with a transfer between two of its accounts
+		accountNumbers := []int64{batch.SenderAccountNumber}
+		for _, leg := range batch.Legs {
+			accountNumbers = append(accountNumbers, leg.ReceiverAccountNumber)
+		}
+		if err := lockAccounts(tx, ctx, accountNumbers...); err != nil {
+			return err
+		}
+
+		var sender accounts.Account
+		if err := tx.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Where("account_number = ?", batch.SenderAccountNumber).First(&sender).Error; err != nil {
+			return err
+		}
+		if err := accounts.CanDebit(sender.Status); err != nil {
+			return err
+		}
+
+		for i := range batch.Legs {
+			leg := &batch.Legs[i]
+			savepoint := fmt.Sprintf("batch_leg_%d", leg.Position)
+			if batch.Mode == batches.ModeBestEffort {
+				if err := tx.SavePoint(savepoint).Error; err != nil {
+					return err
+				}
+			}
+
+			t, err := d.payBatchLeg(tx, ctx, &sender, *leg, batch.PaymentMethod)
+			if err != nil {
+				leg.Status = batches.LegFailed
+				leg.Error = err.Error()
+				if batch.Mode == batches.ModeAllOrNothing {
+					return errBatchAborted
+				}
+				if err := tx.RollbackTo(savepoint).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			leg.Status = batches.LegCompleted
+			leg.TransactionID = &t.TransactionID
+		}
+
+		now := time.Now()
+		sender.LastActivityAt = &now
+		if err := tx.WithContext(ctx).Save(&sender).Error; err != nil {
+			return err
+		}
+
+		batches.Summarize(batch)
+		record = batchToModel(*batch)
+		return tx.Create(&record).Error
+	})
+
+	if err != nil {
+		statusErr := errors.Is(err, accounts.ErrAccountFrozen) || errors.Is(err, accounts.ErrAccountDormant) || errors.Is(err, accounts.ErrAccountClosed)
+		if !errors.Is(err, errBatchAborted) && !statusErr {
+			return err
+		}
+
+		// Nothing was paid. Legs that did not fail themselves were either never tried or blocked by the sender's status.
+		for i := range batch.Legs {
+			leg := &batch.Legs[i]
+			leg.TransactionID = nil
+			switch {
+			case leg.Status == batches.LegFailed:
+			case statusErr:
+				leg.Status = batches.LegFailed
+				leg.Error = err.Error()
+			default:
+				leg.Status = batches.LegSkipped
+			}
+		}
+		batches.Summarize(batch)
+		record = batchToModel(*batch)
+		if err := d.Client.WithContext(ctx).Create(&record).Error; err != nil {
+			return err
+		}
+	}
+
+	// the legs paid were announced by their postings; the failed ones are announced now that the batch is settled
+	for _, leg := range batch.Legs {
+		if leg.Status == batches.LegFailed {
+			d.transactionFailed(ctx, webhooks.FailedTransaction{
+				SenderAccountNumber:   batch.SenderAccountNumber,
+				ReceiverAccountNumber: leg.ReceiverAccountNumber,
+				Amount:                leg.Amount,
+				Type:                  "Transfer",
+				PaymentMethod:         batch.PaymentMethod,
+				Description:           leg.Description,
+				Error:                 leg.Error,
+			})
+		}
+	}
+
+	*batch = batchFromModel(record)
+	return nil
+}
+
+// payBatchLeg credits one receiver, records the transfer and posts its fees. The sender is already locked by the
+// caller, which saves its balance once all legs are done.
+func (d *Database) payBatchLeg(tx *gorm.DB, ctx context.Context, sender *accounts.Account, leg batches.Leg, paymentMethod string) (transactions.Transactions, error) {
+	if leg.Amount <= 0 {
+		return transactions.Transactions{}, transactions.ErrInvalidAmount
+	}
+	quote, err := d.quoteFees(tx.WithContext(ctx), fees.Context{
+		TransactionType: "Transfer",
+		PaymentMethod:   paymentMethod,
+		AccountType:     sender.AccountType,
+		Currency:        fees.Currency(),
+		Amount:          leg.Amount,
+	})
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+	if err := accounts.CheckFunds(*sender, leg.Amount+quote.TotalFee); err != nil {
+		return transactions.Transactions{}, err
+	}
+	reference, err := transactions.GenerateTransactionRef()
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+
+	receiver, err := d.creditAccountHelper(tx, ctx, leg.ReceiverAccountNumber, leg.Amount)
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+	senderBalance := sender.Balance - leg.Amount
+
+	t := transactions.Transactions{
+		SenderAccountNumber:   sender.AccountNumber,
+		ReceiverAccountNumber: receiver.AccountNumber,
+		Amount:                leg.Amount,
+		PaymentMethod:         paymentMethod,
+		Status:                "Completed",
+		Type:                  "Transfer",
+		Description:           leg.Description,
+		Reference:             reference,
+		TransactionID:         uuid.New(),
+		SenderBalanceAfter:    &senderBalance,
+		ReceiverBalanceAfter:  &receiver.Balance,
+	}
+	if err := tx.WithContext(ctx).Create(&t).Error; err != nil {
+		return transactions.Transactions{}, err
+	}
+	if err := d.postFees(tx, ctx, &t, sender.AccountNumber, senderBalance, quote.Fees); err != nil {
+		return transactions.Transactions{}, err
+	}
+	if err := d.transactionPosted(tx, ctx, t); err != nil {
+		return transactions.Transactions{}, err
+	}
+
+	sender.Balance -= leg.Amount + quote.TotalFee
+	return t, nil
+}
+
+func (d *Database) GetBatchByID(ctx context.Context, batchID uint) (batches.Batch, error) {
+	var record PaymentBatch
+	err := d.Client.WithContext(ctx).
+		Preload("Legs", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Where("id = ?", batchID).
+		First(&record).Error
+	if err != nil {
+		return batches.Batch{}, err
+	}
+	return batchFromModel(record), nil
+}
@@ -0,0 +1,215 @@
+package db
+
+import (
+	"PayWalletEngine/internal/aliases"
+	"PayWalletEngine/internal/beneficiaries"
+	"PayWalletEngine/internal/transactions"
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type Beneficiary struct {
+	ID                 uint   `gorm:"primarykey"`
+	UserID             uint   `gorm:"index;column:user_id;not null"`
+	Nickname           string `gorm:"type:varchar(100);not null"`
+	AccountNumber      int64  `gorm:"type:bigint;column:account_number"`
+	Alias              string `gorm:"type:varchar(255)"`
+	CoolingOffStartsAt time.Time
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	DeletedAt          gorm.DeletedAt `gorm:"index"`
+}
+
+func beneficiaryFromModel(b Beneficiary) beneficiaries.Beneficiary {
+	return beneficiaries.Beneficiary{
+		ID:               b.ID,
+		UserID:           b.UserID,
+		Nickname:         b.Nickname,
+		AccountNumber:    b.AccountNumber,
+		Alias:            b.Alias,
+		CoolingOffEndsAt: b.CoolingOffStartsAt.Add(beneficiaries.CoolingOffPeriod),
+		CreatedAt:        b.CreatedAt,
+	}
+}
+
+// beneficiaryAccountNumber returns the account a beneficiary currently points to, resolving aliases to the
+// owner's default wallet
+func (d *Database) beneficiaryAccountNumber(ctx context.Context, accountNumber int64, alias string) (int64, error) {
+	if alias == "" {
+		var account Account
+		if err := d.Client.WithContext(ctx).Where("account_number = ?", accountNumber).First(&account).Error; err != nil {
+			return 0, fmt.Errorf("beneficiary account %d: %w", accountNumber, err)
+		}
+		return account.AccountNumber, nil
+	}
+
+	aliasType, value, err := aliases.ParseAlias(alias)
+	if err != nil {
+		return 0, err
+	}
+	resolution, err := d.ResolveAlias(ctx, aliasType, value)
+	if err != nil {
+		return 0, fmt.Errorf("beneficiary alias %s: %w", alias, err)
+	}
+	return resolution.AccountNumber, nil
+}
+
+// CreateBeneficiary saves a payee for the user once its destination is known to exist
+func (d *Database) CreateBeneficiary(ctx context.Context, beneficiary *beneficiaries.Beneficiary) error {
+	var user User
+	if err := d.Client.WithContext(ctx).Where("id = ?", beneficiary.UserID).First(&user).Error; err != nil {
+		return err
+	}
+	if _, err := d.beneficiaryAccountNumber(ctx, beneficiary.AccountNumber, beneficiary.Alias); err != nil {
+		return err
+	}
+
+	record := Beneficiary{
+		UserID:             beneficiary.UserID,
+		Nickname:           beneficiary.Nickname,
+		AccountNumber:      beneficiary.AccountNumber,
+		Alias:              beneficiary.Alias,
+		CoolingOffStartsAt: time.Now(),
+	}
+	if err := d.Client.WithContext(ctx).Create(&record).Error; err != nil {
+		return err
+	}
+
+	*beneficiary = beneficiaryFromModel(record)
+	return nil
+}
+
+func (d *Database) GetBeneficiaryByID(ctx context.Context, beneficiaryID uint) (beneficiaries.Beneficiary, error) {
+	var record Beneficiary
+	if err := d.Client.WithContext(ctx).Where("id = ?", beneficiaryID).First(&record).Error; err != nil {
+		return beneficiaries.Beneficiary{}, err
+	}
+	return beneficiaryFromModel(record), nil
+}
+
+func (d *Database) GetBeneficiariesByUserID(ctx context.Context, userID uint) ([]beneficiaries.Beneficiary, error) {
+	var records []Beneficiary
+	if err := d.Client.WithContext(ctx).Where("user_id = ?", userID).Order("nickname asc").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	var list []beneficiaries.Beneficiary
+	for _, r := range records {
+		list = append(list, beneficiaryFromModel(r))
+	}
+	return list, nil
+}
+
+// UpdateBeneficiary changes the nickname and/or destination. Pointing a beneficiary somewhere new restarts its
+// cooling-off period, otherwise an old payee could be redirected without the fraud control applying.
+func (d *Database) UpdateBeneficiary(ctx context.Context, beneficiary beneficiaries.Beneficiary) (beneficiaries.Beneficiary, error) {
+	var record Beneficiary
+	if err := d.Client.WithContext(ctx).Where("id = ?", beneficiary.ID).First(&record).Error; err != nil {
+		return beneficiaries.Beneficiary{}, err
+	}
+
+	if beneficiary.Nickname != "" {
+		record.Nickname = beneficiary.Nickname
+	}
+	if beneficiary.AccountNumber != 0 || beneficiary.Alias != "" {
+		if beneficiary.AccountNumber != record.AccountNumber || beneficiary.Alias != record.Alias {
+			if _, err := d.beneficiaryAccountNumber(ctx, beneficiary.AccountNumber, beneficiary.Alias); err != nil {
+				return beneficiaries.Beneficiary{}, err
+			}
+			record.AccountNumber = beneficiary.AccountNumber
+			record.Alias = beneficiary.Alias
+			record.CoolingOffStartsAt = time.Now()
+		}
+	}
+
+	if err := d.Client.WithContext(ctx).Save(&record).Error; err != nil {
+		return beneficiaries.Beneficiary{}, err
+	}
+	return beneficiaryFromModel(record), nil
+}
+
+func (d *Database) DeleteBeneficiary(ctx context.Context, beneficiaryID uint) error {
+	result := d.Client.WithContext(ctx).Where("id = ?", beneficiaryID).Delete(&Beneficiary{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// TransferToBeneficiary transfers funds to the beneficiary's current destination and links the transaction to it.
+// The beneficiary row is locked so concurrent transfers cannot both slip under the cooling-off limit. A transfer that
+// fails is announced to webhook subscribers once it has been rolled back.
+func (d *Database) TransferToBeneficiary(ctx context.Context, senderAccountNumber int64, beneficiaryID uint, amount float64, description string, paymentMethod string, coolingOffLimit float64) (transactions.Transactions, error) {
+	tx := d.Client.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var beneficiary Beneficiary
+	if err := tx.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", beneficiaryID).First(&beneficiary).Error; err != nil {
+		tx.Rollback()
+		return transactions.Transactions{}, err
+	}
+
+	var sender Account
+	if err := tx.WithContext(ctx).Where("account_number = ?", senderAccountNumber).First(&sender).Error; err != nil {
+		tx.Rollback()
+		return transactions.Transactions{}, err
+	}
+	if sender.UserID != beneficiary.UserID {
+		tx.Rollback()
+		return transactions.Transactions{}, beneficiaries.ErrNotOwner
+	}
+
+	if time.Now().Before(beneficiary.CoolingOffStartsAt.Add(beneficiaries.CoolingOffPeriod)) {
+		var sent float64
+		err := tx.WithContext(ctx).Model(&Transactions{}).
+			Select("COALESCE(SUM(amount), 0)").
+			Where("beneficiary_id = ? AND status = ? AND created_at >= ?", beneficiary.ID, "Completed", beneficiary.CoolingOffStartsAt).
+			Scan(&sent).Error
+		if err != nil {
+			tx.Rollback()
+			return transactions.Transactions{}, err
+		}
+		if sent+amount > coolingOffLimit {
+			tx.Rollback()
+			return transactions.Transactions{}, fmt.Errorf("%w: %.2f of %.2f already sent", beneficiaries.ErrCoolingOffLimit, sent, coolingOffLimit)
+		}
+	}
+
+	receiverAccountNumber, err := d.beneficiaryAccountNumber(ctx, beneficiary.AccountNumber, beneficiary.Alias)
+	if err != nil {
+		tx.Rollback()
+		return transactions.Transactions{}, err
+	}
+
+	transfer := transactions.Transactions{
+		SenderAccountNumber:   senderAccountNumber,
+		ReceiverAccountNumber: receiverAccountNumber,
+		Amount:                amount,
+		PaymentMethod:         paymentMethod,
+		Description:           description,
+		BeneficiaryID:         &beneficiary.ID,
+	}
+	t, err := d.transferInTx(tx, ctx, transfer)
+	if err != nil {
+		tx.Rollback()
+		d.transactionFailed(ctx, *failedTransfer(transfer, err))
+		return transactions.Transactions{}, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return transactions.Transactions{}, err
+	}
+
+	t.BeneficiaryName = beneficiary.Nickname
+	return t, nil
+}
@@ -0,0 +1,466 @@
+package db
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/closing"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"time"
+)
+
+// closedDayConstraint is the constraint name the day close trigger reports its violations under
+const closedDayConstraint = "transactions_closed_day"
+
+// DayClose is the close of one business day, covering postings from StartsAt up to EndsAt. A day is closed at most
+// once at a time: closing a reopened day updates its row.
+type DayClose struct {
+	ID              uint      `gorm:"primarykey"`
+	Date            time.Time `gorm:"type:date;not null;uniqueIndex"`
+	StartsAt        time.Time `gorm:"not null"`
+	EndsAt          time.Time `gorm:"not null"`
+	Status          string    `gorm:"type:varchar(20);not null"`
+	Accounts        int       `gorm:"not null"`
+	ExternalCredits float64   `gorm:"type:decimal(18,2);not null"`
+	ExternalDebits  float64   `gorm:"type:decimal(18,2);not null"`
+	ClosedAt        time.Time `gorm:"not null"`
+	ReopenedAt      *time.Time
+	ReopenReason    string `gorm:"type:varchar(255)"`
+}
+
+// DailyBalance is an account's balance at the close of a business day
+type DailyBalance struct {
+	ID             uint      `gorm:"primarykey"`
+	Date           time.Time `gorm:"type:date;not null;uniqueIndex:idx_daily_balance_account_date,priority:2;index"`
+	AccountID      uint      `gorm:"not null;uniqueIndex:idx_daily_balance_account_date,priority:1"`
+	AccountNumber  int64     `gorm:"type:bigint;not null"`
+	AccountType    string    `gorm:"type:varchar(50);not null"`
+	OpeningBalance float64   `gorm:"type:decimal(12,2);not null"`
+	Credits        float64   `gorm:"type:decimal(12,2);not null"`
+	Debits         float64   `gorm:"type:decimal(12,2);not null"`
+	ClosingBalance float64   `gorm:"type:decimal(12,2);not null"`
+	CreatedAt      time.Time
+}
+
+// TableName keeps the name finance queries the snapshots by
+func (DailyBalance) TableName() string {
+	return "daily_balances"
+}
+
+func dayCloseFromModel(c DayClose) closing.DayClose {
+	return closing.DayClose{
+		ID:              c.ID,
+		Date:            c.Date,
+		Status:          c.Status,
+		Accounts:        c.Accounts,
+		ExternalCredits: c.ExternalCredits,
+		ExternalDebits:  c.ExternalDebits,
+		ClosedAt:        c.ClosedAt,
+		ReopenedAt:      c.ReopenedAt,
+		ReopenReason:    c.ReopenReason,
+	}
+}
+
+func dailyBalanceFromModel(b DailyBalance) closing.DailyBalance {
+	return closing.DailyBalance{
+		AccountID:      b.AccountID,
+		AccountNumber:  b.AccountNumber,
+		AccountType:    b.AccountType,
+		Date:           b.Date,
+		OpeningBalance: b.OpeningBalance,
+		Credits:        b.Credits,
+		Debits:         b.Debits,
+		ClosingBalance: b.ClosingBalance,
+	}
+}
+
+// createDayCloseGuard installs the trigger that refuses postings into a closed day. Inserting a transaction dated in
+// a closed day, or changing the amount, status, parties, date or deletion of one, fails with a check violation of
+// closedDayConstraint, which registerClosedDayError turns into closing.ErrPostingDayClosed.
+func (d *Database) createDayCloseGuard() error {
+	err := d.Client.Exec(`CREATE OR REPLACE FUNCTION refuse_closed_day_posting() RETURNS trigger AS $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM day_close WHERE status = 'closed' AND NEW.created_at >= starts_at AND NEW.created_at < ends_at)
+		OR (TG_OP = 'UPDATE' AND EXISTS (SELECT 1 FROM day_close WHERE status = 'closed' AND OLD.created_at >= starts_at AND OLD.created_at < ends_at)) THEN
+		RAISE EXCEPTION 'business day is closed' USING ERRCODE = 'check_violation', CONSTRAINT = '` + closedDayConstraint + `';
+	END IF;
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql`).Error
+	if err != nil {
+		return err
+	}
+	if err := d.Client.Exec("DROP TRIGGER IF EXISTS transactions_closed_day ON transactions").Error; err != nil {
+		return err
+	}
+	return d.Client.Exec(`CREATE TRIGGER transactions_closed_day
+	BEFORE INSERT OR UPDATE OF amount, status, sender_account_number, receiver_account_number, created_at, deleted_at ON transactions
+	FOR EACH ROW EXECUTE FUNCTION refuse_closed_day_posting()`).Error
+}
+
+// registerClosedDayError makes every create, update and delete that the day close trigger refuses fail with
+// closing.ErrPostingDayClosed, whichever posting path ran it
+func registerClosedDayError(db *gorm.DB) error {
+	translate := func(tx *gorm.DB) {
+		var pgErr *pgconn.PgError
+		if errors.As(tx.Error, &pgErr) && pgErr.ConstraintName == closedDayConstraint {
+			tx.Error = closing.ErrPostingDayClosed
+		}
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("closing:closed_day_error", translate); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("closing:closed_day_error", translate); err != nil {
+		return err
+	}
+	return db.Callback().Delete().After("gorm:delete").Register("closing:closed_day_error", translate)
+}
+
+// dayMovements returns the credits and debits of each account in completed transactions from start up to end
+func dayMovements(tx *gorm.DB, start time.Time, end time.Time) (map[int64]float64, map[int64]float64, error) {
+	type movement struct {
+		AccountNumber int64
+		Total         float64
+	}
+	var credits, debits []movement
+	err := tx.Model(&Transactions{}).
+		Select("receiver_account_number AS account_number, SUM(amount) AS total").
+		Where("status = ? AND created_at >= ? AND created_at < ? AND receiver_account_number <> 0", "Completed", start, end).
+		Group("receiver_account_number").
+		Scan(&credits).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	err = tx.Model(&Transactions{}).
+		Select("sender_account_number AS account_number, SUM(amount) AS total").
+		Where("status = ? AND created_at >= ? AND created_at < ? AND sender_account_number <> 0", "Completed", start, end).
+		Group("sender_account_number").
+		Scan(&debits).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	creditTotals := make(map[int64]float64, len(credits))
+	for _, m := range credits {
+		creditTotals[m.AccountNumber] = m.Total
+	}
+	debitTotals := make(map[int64]float64, len(debits))
+	for _, m := range debits {
+		debitTotals[m.AccountNumber] = m.Total
+	}
+	return creditTotals, debitTotals, nil
+}
+
+// CloseDay snapshots every account that existed by the end of the day and marks the day closed. Closes are
+// serialized, and the transactions table is share-locked while the snapshot is taken: postings still in flight finish
+// first, and postings that come after it are dated after the day or refused by the guard.
+func (d *Database) CloseDay(ctx context.Context, date time.Time) (closing.DayClose, error) {
+	start, end := date, date.AddDate(0, 0, 1)
+	var record DayClose
+
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("LOCK TABLE day_close IN EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+
+		err := tx.Where("date = ?", date).Limit(1).Find(&record).Error
+		if err != nil {
+			return err
+		}
+		if record.ID != 0 && record.Status == closing.StatusClosed {
+			return closing.ErrDayClosed
+		}
+		var later int64
+		if err := tx.Model(&DayClose{}).Where("date > ?", date).Count(&later).Error; err != nil {
+			return err
+		}
+		if later > 0 {
+			return closing.ErrLaterDayClosed
+		}
+		var earlier, previous int64
+		if err := tx.Model(&DayClose{}).Where("date < ?", date).Count(&earlier).Error; err != nil {
+			return err
+		}
+		err = tx.Model(&DayClose{}).Where("date = ? AND status = ?", date.AddDate(0, 0, -1), closing.StatusClosed).Count(&previous).Error
+		if err != nil {
+			return err
+		}
+		if earlier > 0 && previous == 0 {
+			return closing.ErrPreviousDayOpen
+		}
+
+		if err := tx.Exec("LOCK TABLE transactions IN SHARE MODE").Error; err != nil {
+			return err
+		}
+
+		var all []Account
+		if err := tx.Unscoped().Where("created_at < ?", end).Order("account_number").Find(&all).Error; err != nil {
+			return err
+		}
+		after, err := movementsSince(tx, end)
+		if err != nil {
+			return err
+		}
+		credits, debits, err := dayMovements(tx, start, end)
+		if err != nil {
+			return err
+		}
+
+		balances := make([]DailyBalance, 0, len(all))
+		for _, a := range all {
+			closingBalance := closing.Round(a.Balance - after[a.AccountNumber])
+			balances = append(balances, DailyBalance{
+				Date:           date,
+				AccountID:      a.ID,
+				AccountNumber:  a.AccountNumber,
+				AccountType:    a.AccountType,
+				OpeningBalance: closing.Round(closingBalance - credits[a.AccountNumber] + debits[a.AccountNumber]),
+				Credits:        closing.Round(credits[a.AccountNumber]),
+				Debits:         closing.Round(debits[a.AccountNumber]),
+				ClosingBalance: closingBalance,
+			})
+		}
+		if len(balances) > 0 {
+			if err := tx.CreateInBatches(&balances, 500).Error; err != nil {
+				return err
+			}
+		}
+
+		var external struct {
+			Credits float64
+			Debits  float64
+		}
+		err = tx.Model(&Transactions{}).
+			Select("COALESCE(SUM(CASE WHEN sender_account_number = 0 THEN amount ELSE 0 END), 0) AS credits, "+
+				"COALESCE(SUM(CASE WHEN receiver_account_number = 0 THEN amount ELSE 0 END), 0) AS debits").
+			Where("status = ? AND created_at >= ? AND created_at < ?", "Completed", start, end).
+			Scan(&external).Error
+		if err != nil {
+			return err
+		}
+
+		record.Date = date
+		record.StartsAt = start
+		record.EndsAt = end
+		record.Status = closing.StatusClosed
+		record.Accounts = len(balances)
+		record.ExternalCredits = closing.Round(external.Credits)
+		record.ExternalDebits = closing.Round(external.Debits)
+		record.ClosedAt = time.Now()
+		return tx.Save(&record).Error
+	})
+	if err != nil {
+		return closing.DayClose{}, err
+	}
+	return dayCloseFromModel(record), nil
+}
+
+// ReopenDay reopens the latest closed day and drops its snapshots. Earlier days stay closed, so they can only be
+// reopened one at a time from the latest backwards.
+func (d *Database) ReopenDay(ctx context.Context, date time.Time, reason string) (closing.DayClose, error) {
+	var record DayClose
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("LOCK TABLE day_close IN EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+		if err := tx.Where("date = ?", date).First(&record).Error; err != nil {
+			return err
+		}
+		if record.Status != closing.StatusClosed {
+			return closing.ErrDayNotClosed
+		}
+		var later int64
+		if err := tx.Model(&DayClose{}).Where("date > ?", date).Count(&later).Error; err != nil {
+			return err
+		}
+		if later > 0 {
+			return closing.ErrLaterDayClosed
+		}
+
+		if err := tx.Where("date = ?", date).Delete(&DailyBalance{}).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		record.Status = closing.StatusReopened
+		record.ReopenedAt = &now
+		record.ReopenReason = reason
+		return tx.Model(&record).Updates(map[string]interface{}{
+			"status":        record.Status,
+			"reopened_at":   now,
+			"reopen_reason": reason,
+		}).Error
+	})
+	if err != nil {
+		return closing.DayClose{}, err
+	}
+	return dayCloseFromModel(record), nil
+}
+
+// LastDayClose returns the close of the latest day closed or reopened, or nil if no day ever was
+func (d *Database) LastDayClose(ctx context.Context) (*closing.DayClose, error) {
+	var record DayClose
+	if err := d.Client.WithContext(ctx).Order("date desc").Limit(1).Find(&record).Error; err != nil {
+		return nil, err
+	}
+	if record.ID == 0 {
+		return nil, nil
+	}
+	dayClose := dayCloseFromModel(record)
+	return &dayClose, nil
+}
+
+func (d *Database) GetDayCloses(ctx context.Context) ([]closing.DayClose, error) {
+	var records []DayClose
+	if err := d.Client.WithContext(ctx).Order("date desc").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	list := make([]closing.DayClose, 0, len(records))
+	for _, r := range records {
+		list = append(list, dayCloseFromModel(r))
+	}
+	return list, nil
+}
+
+// closedDay loads the close of a day and checks that it is closed
+func closedDay(tx *gorm.DB, date time.Time) (DayClose, error) {
+	var record DayClose
+	if err := tx.Where("date = ?", date).First(&record).Error; err != nil {
+		return record, err
+	}
+	if record.Status != closing.StatusClosed {
+		return record, closing.ErrDayNotClosed
+	}
+	return record, nil
+}
+
+// GetTrialBalance adds up the snapshots of a closed day by account type, with each system account on its own line
+func (d *Database) GetTrialBalance(ctx context.Context, date time.Time) (closing.TrialBalance, error) {
+	var trial closing.TrialBalance
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		record, err := closedDay(tx, date)
+		if err != nil {
+			return err
+		}
+
+		var lines []closing.TrialBalanceLine
+		err = tx.Table("daily_balances AS b").
+			Select("b.account_type, CASE WHEN b.account_type = ? THEN a.nickname ELSE '' END AS system_account, "+
+				"COUNT(*) AS accounts, SUM(b.opening_balance) AS opening_balance, SUM(b.credits) AS credits, "+
+				"SUM(b.debits) AS debits, SUM(b.closing_balance) AS closing_balance", accounts.TypeSystem).
+			Joins("JOIN account a ON a.id = b.account_id").
+			Where("b.date = ?", date).
+			Group("1, 2").
+			Order("1, 2").
+			Scan(&lines).Error
+		if err != nil {
+			return err
+		}
+
+		trial = closing.TrialBalance{Close: dayCloseFromModel(record), Lines: []closing.TrialBalanceLine{}, Balanced: true}
+		for _, line := range lines {
+			line.OpeningBalance = closing.Round(line.OpeningBalance)
+			line.Credits = closing.Round(line.Credits)
+			line.Debits = closing.Round(line.Debits)
+			line.ClosingBalance = closing.Round(line.ClosingBalance)
+			if closing.Disagrees(line.OpeningBalance+line.Credits-line.Debits, line.ClosingBalance) {
+				trial.Balanced = false
+			}
+			trial.OpeningBalance += line.OpeningBalance
+			trial.Credits += line.Credits
+			trial.Debits += line.Debits
+			trial.ClosingBalance += line.ClosingBalance
+			trial.Lines = append(trial.Lines, line)
+		}
+		trial.OpeningBalance = closing.Round(trial.OpeningBalance)
+		trial.Credits = closing.Round(trial.Credits)
+		trial.Debits = closing.Round(trial.Debits)
+		trial.ClosingBalance = closing.Round(trial.ClosingBalance)
+		if closing.Disagrees(trial.Credits-record.ExternalCredits, trial.Debits-record.ExternalDebits) {
+			trial.Balanced = false
+		}
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return closing.TrialBalance{}, err
+	}
+	return trial, nil
+}
+
+// GetDailyBalances returns the snapshots of a closed day in account number order
+func (d *Database) GetDailyBalances(ctx context.Context, date time.Time) ([]closing.DailyBalance, error) {
+	var records []DailyBalance
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := closedDay(tx, date); err != nil {
+			return err
+		}
+		return tx.Where("date = ?", date).Order("account_number").Find(&records).Error
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	list := make([]closing.DailyBalance, 0, len(records))
+	for _, r := range records {
+		list = append(list, dailyBalanceFromModel(r))
+	}
+	return list, nil
+}
+
+// GetBalanceAsOf answers from the account's latest snapshot of a day that ended by asOf, adding what moved from the
+// end of that day up to asOf. An account without such a snapshot is answered from its current balance less what
+// moved since asOf.
+func (d *Database) GetBalanceAsOf(ctx context.Context, accountID uint, asOf time.Time) (closing.Balance, error) {
+	var balance closing.Balance
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var account Account
+		if err := tx.Where("id = ?", accountID).First(&account).Error; err != nil {
+			return err
+		}
+		balance = closing.Balance{AccountID: account.ID, AccountNumber: account.AccountNumber, AsOf: asOf}
+
+		var snapshot DailyBalance
+		err := tx.Where("account_id = ? AND date <= ?", account.ID, closing.StartOfDay(asOf).AddDate(0, 0, -1)).
+			Order("date desc").
+			Limit(1).
+			Find(&snapshot).Error
+		if err != nil {
+			return err
+		}
+
+		net := func(from time.Time, to *time.Time) (float64, error) {
+			var total float64
+			query := tx.Model(&Transactions{}).
+				Select("COALESCE(SUM(CASE WHEN receiver_account_number = ? THEN amount ELSE -amount END), 0)", account.AccountNumber).
+				Where("(sender_account_number = ? OR receiver_account_number = ?) AND status = ? AND created_at >= ?",
+					account.AccountNumber, account.AccountNumber, "Completed", from)
+			if to != nil {
+				query = query.Where("created_at < ?", *to)
+			}
+			err := query.Scan(&total).Error
+			return total, err
+		}
+
+		if snapshot.ID == 0 {
+			since, err := net(asOf, nil)
+			if err != nil {
+				return err
+			}
+			balance.Balance = closing.Round(account.Balance - since)
+			return nil
+		}
+		delta, err := net(snapshot.Date.AddDate(0, 0, 1), &asOf)
+		if err != nil {
+			return err
+		}
+		snapshotDate := snapshot.Date
+		balance.SnapshotDate = &snapshotDate
+		balance.IntradayDelta = closing.Round(delta)
+		balance.Balance = closing.Round(snapshot.ClosingBalance + delta)
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return closing.Balance{}, err
+	}
+	return balance, nil
+}
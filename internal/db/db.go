@@ -18,9 +18,13 @@ func NewDatabase() (*Database, error) {
 	db, err := gorm.Open(postgres.New(postgres.Config{
 		DSN:                  configurations,
 		PreferSimpleProtocol: true,
-	}), &gorm.Config{NamingStrategy: schema.NamingStrategy{
-		SingularTable: true,
-	}})
+	}), &gorm.Config{
+		NamingStrategy: schema.NamingStrategy{
+			SingularTable: true,
+		},
+		// translate unique violations into gorm.ErrDuplicatedKey so callers can retry or report a conflict
+		TranslateError: true,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -33,6 +37,10 @@ func NewDatabase() (*Database, error) {
 	sqlDB.SetMaxIdleConns(10)
 	sqlDB.SetMaxOpenConns(100)
 
+	if err := registerClosedDayError(db); err != nil {
+		return nil, err
+	}
+
 	return &Database{
 		Client: db,
 	}, nil
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"context"
+	"github.com/google/uuid"
+	"os"
+	"sync"
+	"testing"
+)
+
+var (
+	testDB     *Database
+	testDBErr  error
+	testDBOnce sync.Once
+)
+
+// testDatabase connects to the database configured by the DB_* variables and migrates it, once per test run. Tests
+// that need it are skipped unless TEST_DATABASE is true, since they write to the database.
+func testDatabase(t *testing.T) *Database {
+	t.Helper()
+	if os.Getenv("TEST_DATABASE") != "true" {
+		t.Skip("TEST_DATABASE is not true")
+	}
+	testDBOnce.Do(func() {
+		testDB, testDBErr = NewDatabase()
+		if testDBErr == nil {
+			testDBErr = testDB.MigrateDB()
+		}
+	})
+	if testDBErr != nil {
+		t.Fatalf("connecting to the test database: %v", testDBErr)
+	}
+	return testDB
+}
+
+// createTestUser inserts an active user with a unique name
+func createTestUser(t *testing.T, d *Database) uint {
+	t.Helper()
+	name := uuid.New().String()
+	user := User{Username: name, Email: name + "@example.com", Password: "secret", IsActive: true}
+	if err := d.Client.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user.ID
+}
+
+// createTestAccount opens a main wallet for the user with an opening balance
+func createTestAccount(t *testing.T, d *Database, userID uint, balance float64) accounts.Account {
+	t.Helper()
+	account := accounts.Account{UserID: userID, AccountType: accounts.TypeMain, Balance: balance}
+	if err := d.CreateAccount(context.Background(), &account); err != nil {
+		t.Fatal(err)
+	}
+	return account
+}
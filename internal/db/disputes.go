@@ -0,0 +1,511 @@
+package db
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/disputes"
+	"PayWalletEngine/internal/transactions"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type Dispute struct {
+	ID                        uint      `gorm:"primarykey"`
+	TransactionID             uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_dispute_active_transaction,where:resolved_at IS NULL"`
+	UserID                    uint      `gorm:"index;not null"`
+	AccountNumber             int64     `gorm:"type:bigint;not null"`
+	CounterpartyAccountNumber int64     `gorm:"type:bigint;not null;index"`
+	Amount                    float64   `gorm:"type:decimal(10,2);not null"`
+	ReasonCode                string    `gorm:"type:varchar(30);not null"`
+	Description               string    `gorm:"type:varchar(500)"`
+	Status                    string    `gorm:"type:varchar(20);not null;index"`
+	Evidence                  []DisputeEvidence
+	MerchantResponse          string `gorm:"type:text"`
+	MerchantRespondedAt       *time.Time
+	ResponseDueAt             time.Time `gorm:"index"`
+	ResolveBy                 time.Time
+	AgentID                   *uint
+	ResolutionNote            string     `gorm:"type:varchar(500)"`
+	ProvisionalCreditID       *uuid.UUID `gorm:"type:uuid"`
+	SettlementID              *uuid.UUID `gorm:"type:uuid"`
+	ResolvedAt                *time.Time
+	CreatedAt                 time.Time
+	UpdatedAt                 time.Time
+}
+
+type DisputeEvidence struct {
+	ID          uint   `gorm:"primarykey"`
+	DisputeID   uint   `gorm:"not null;index"`
+	UserID      uint   `gorm:"not null"`
+	Party       string `gorm:"type:varchar(20);not null"`
+	FileName    string `gorm:"type:varchar(255);not null"`
+	ContentType string `gorm:"type:varchar(100)"`
+	URL         string `gorm:"type:varchar(2048);not null"`
+	Note        string `gorm:"type:varchar(500)"`
+	CreatedAt   time.Time
+}
+
+func disputeFromModel(d Dispute) disputes.Dispute {
+	dispute := disputes.Dispute{
+		ID:                        d.ID,
+		TransactionID:             d.TransactionID,
+		UserID:                    d.UserID,
+		AccountNumber:             d.AccountNumber,
+		CounterpartyAccountNumber: d.CounterpartyAccountNumber,
+		Amount:                    d.Amount,
+		ReasonCode:                d.ReasonCode,
+		Description:               d.Description,
+		Status:                    d.Status,
+		Evidence:                  []disputes.Evidence{},
+		MerchantResponse:          d.MerchantResponse,
+		MerchantRespondedAt:       d.MerchantRespondedAt,
+		ResponseDueAt:             d.ResponseDueAt,
+		ResolveBy:                 d.ResolveBy,
+		AgentID:                   d.AgentID,
+		ResolutionNote:            d.ResolutionNote,
+		ProvisionalCreditID:       d.ProvisionalCreditID,
+		SettlementID:              d.SettlementID,
+		CreatedAt:                 d.CreatedAt,
+		ResolvedAt:                d.ResolvedAt,
+	}
+	for _, e := range d.Evidence {
+		dispute.Evidence = append(dispute.Evidence, disputes.Evidence{
+			ID:          e.ID,
+			UserID:      e.UserID,
+			Party:       e.Party,
+			FileName:    e.FileName,
+			ContentType: e.ContentType,
+			URL:         e.URL,
+			Note:        e.Note,
+			CreatedAt:   e.CreatedAt,
+		})
+	}
+	return dispute
+}
+
+// preloadEvidence loads a dispute's evidence in the order it was submitted
+func preloadEvidence(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
+
+// CreateDispute opens a dispute against a completed transfer sent from one of the customer's accounts to a user
+// account, within the dispute window. A transfer can only have one dispute that was not withdrawn.
+func (d *Database) CreateDispute(ctx context.Context, dispute *disputes.Dispute) error {
+	var record Dispute
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var txn Transactions
+		if err := tx.Where("transaction_id = ?", dispute.TransactionID).First(&txn).Error; err != nil {
+			return err
+		}
+		if txn.Type != "Transfer" || txn.Status != "Completed" {
+			return fmt.Errorf("%w: only completed transfers can be disputed", disputes.ErrNotDisputable)
+		}
+		if txn.CreatedAt.Before(time.Now().AddDate(0, 0, -disputes.WindowDays())) {
+			return fmt.Errorf("%w: transfers can only be disputed within %d days", disputes.ErrNotDisputable, disputes.WindowDays())
+		}
+
+		var sender, receiver Account
+		if err := tx.Where("account_number = ?", txn.SenderAccountNumber).First(&sender).Error; err != nil {
+			return err
+		}
+		if sender.UserID != dispute.UserID {
+			return disputes.ErrNotParty
+		}
+		if err := tx.Where("account_number = ?", txn.ReceiverAccountNumber).First(&receiver).Error; err != nil {
+			return err
+		}
+		if receiver.AccountType == accounts.TypeSystem || receiver.UserID == sender.UserID {
+			return fmt.Errorf("%w: only transfers to other users can be disputed", disputes.ErrNotDisputable)
+		}
+
+		if dispute.Amount == 0 {
+			dispute.Amount = txn.Amount
+		}
+		if dispute.Amount > txn.Amount {
+			return fmt.Errorf("%w: amount exceeds the %.2f transferred", disputes.ErrInvalidDispute, txn.Amount)
+		}
+
+		var previous int64
+		err := tx.Model(&Dispute{}).
+			Where("transaction_id = ? AND status <> ?", dispute.TransactionID, disputes.StatusWithdrawn).
+			Count(&previous).Error
+		if err != nil {
+			return err
+		}
+		if previous > 0 {
+			return disputes.ErrDisputeExists
+		}
+
+		record = Dispute{
+			TransactionID:             dispute.TransactionID,
+			UserID:                    dispute.UserID,
+			AccountNumber:             txn.SenderAccountNumber,
+			CounterpartyAccountNumber: txn.ReceiverAccountNumber,
+			Amount:                    dispute.Amount,
+			ReasonCode:                dispute.ReasonCode,
+			Description:               dispute.Description,
+			Status:                    dispute.Status,
+			ResponseDueAt:             dispute.ResponseDueAt,
+			ResolveBy:                 dispute.ResolveBy,
+		}
+		return tx.Create(&record).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return disputes.ErrDisputeExists
+	}
+	if err != nil {
+		return err
+	}
+
+	*dispute = disputeFromModel(record)
+	return nil
+}
+
+func (d *Database) GetDisputeByID(ctx context.Context, disputeID uint) (disputes.Dispute, error) {
+	var record Dispute
+	if err := d.Client.WithContext(ctx).Preload("Evidence", preloadEvidence).Where("id = ?", disputeID).First(&record).Error; err != nil {
+		return disputes.Dispute{}, err
+	}
+	return disputeFromModel(record), nil
+}
+
+// findDisputes runs a dispute query and maps the results, with their evidence
+func (d *Database) findDisputes(query *gorm.DB) ([]disputes.Dispute, error) {
+	var records []Dispute
+	if err := query.Preload("Evidence", preloadEvidence).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	list := []disputes.Dispute{}
+	for _, r := range records {
+		list = append(list, disputeFromModel(r))
+	}
+	return list, nil
+}
+
+func (d *Database) GetDisputesByUserID(ctx context.Context, userID uint) ([]disputes.Dispute, error) {
+	return d.findDisputes(d.Client.WithContext(ctx).Where("user_id = ?", userID).Order("created_at desc"))
+}
+
+func (d *Database) GetDisputesByMerchant(ctx context.Context, userID uint) ([]disputes.Dispute, error) {
+	return d.findDisputes(d.Client.WithContext(ctx).
+		Where("counterparty_account_number IN (?)", d.Client.Model(&Account{}).Select("account_number").Where("user_id = ?", userID)).
+		Order("created_at desc"))
+}
+
+// GetDisputeQueue lists disputes with a status, or every active dispute, those due to be resolved first at the top
+func (d *Database) GetDisputeQueue(ctx context.Context, status string) ([]disputes.Dispute, error) {
+	query := d.Client.WithContext(ctx)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	} else {
+		query = query.Where("status IN ?", []string{disputes.StatusOpen, disputes.StatusUnderReview})
+	}
+	return d.findDisputes(query.Order("resolve_by, id"))
+}
+
+// lockActiveDispute locks a dispute and checks that it is still open or under review
+func (d *Database) lockActiveDispute(tx *gorm.DB, disputeID uint) (Dispute, error) {
+	var record Dispute
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", disputeID).First(&record).Error; err != nil {
+		return record, err
+	}
+	if !disputes.IsActive(record.Status) {
+		return record, disputes.ErrDisputeClosed
+	}
+	return record, nil
+}
+
+// isMerchant reports whether the user owns the account that received the disputed transfer
+func isMerchant(tx *gorm.DB, record Dispute, userID uint) (bool, error) {
+	var merchant Account
+	if err := tx.Where("account_number = ?", record.CounterpartyAccountNumber).First(&merchant).Error; err != nil {
+		return false, err
+	}
+	return merchant.UserID == userID, nil
+}
+
+// AddDisputeEvidence attaches evidence to an active dispute. The party is worked out from who submits it.
+func (d *Database) AddDisputeEvidence(ctx context.Context, disputeID uint, evidence disputes.Evidence, isAgent bool) (disputes.Dispute, error) {
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		record, err := d.lockActiveDispute(tx, disputeID)
+		if err != nil {
+			return err
+		}
+
+		party := ""
+		switch {
+		case evidence.UserID == record.UserID:
+			party = disputes.PartyCustomer
+		case isAgent:
+			party = disputes.PartyAgent
+		default:
+			merchant, err := isMerchant(tx, record, evidence.UserID)
+			if err != nil {
+				return err
+			}
+			if !merchant {
+				return disputes.ErrNotParty
+			}
+			party = disputes.PartyMerchant
+		}
+
+		return tx.Create(&DisputeEvidence{
+			DisputeID:   record.ID,
+			UserID:      evidence.UserID,
+			Party:       party,
+			FileName:    evidence.FileName,
+			ContentType: evidence.ContentType,
+			URL:         evidence.URL,
+			Note:        evidence.Note,
+		}).Error
+	})
+	if err != nil {
+		return disputes.Dispute{}, err
+	}
+	return d.GetDisputeByID(ctx, disputeID)
+}
+
+// RespondToDispute stores the merchant's one response, if it arrives before the response deadline
+func (d *Database) RespondToDispute(ctx context.Context, disputeID uint, userID uint, response string) (disputes.Dispute, error) {
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		record, err := d.lockActiveDispute(tx, disputeID)
+		if err != nil {
+			return err
+		}
+		merchant, err := isMerchant(tx, record, userID)
+		if err != nil {
+			return err
+		}
+		if !merchant {
+			return disputes.ErrNotParty
+		}
+		if record.MerchantRespondedAt != nil {
+			return disputes.ErrAlreadyResponded
+		}
+		now := time.Now()
+		if now.After(record.ResponseDueAt) {
+			return disputes.ErrDeadlinePassed
+		}
+		return tx.Model(&record).Updates(map[string]interface{}{
+			"merchant_response":     response,
+			"merchant_responded_at": now,
+		}).Error
+	})
+	if err != nil {
+		return disputes.Dispute{}, err
+	}
+	return d.GetDisputeByID(ctx, disputeID)
+}
+
+// postDisputeMovement moves money for a dispute without checking the sender's funds: a chargeback or claw-back is
+// taken even when it leaves the account overdrawn, and the disputes system account may go negative while it funds
+// provisional credits. Dispute movements carry no fees.
+func (d *Database) postDisputeMovement(tx *gorm.DB, ctx context.Context, record Dispute, sender int64, receiver int64, description string) (transactions.Transactions, error) {
+	if err := lockAccounts(tx, ctx, sender, receiver); err != nil {
+		return transactions.Transactions{}, err
+	}
+	err := tx.WithContext(ctx).Model(&Account{}).
+		Where("account_number = ?", sender).
+		Update("balance", gorm.Expr("balance - ?", record.Amount)).Error
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+	senderBalance, err := accountBalance(tx, ctx, sender)
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+	receiverAccount, err := d.creditAccountHelper(tx, ctx, receiver, record.Amount)
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+
+	reference, err := transactions.GenerateTransactionRef()
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+	disputeID := record.ID
+	t := transactions.Transactions{
+		SenderAccountNumber:   sender,
+		ReceiverAccountNumber: receiver,
+		Amount:                record.Amount,
+		PaymentMethod:         disputes.PaymentMethodDispute,
+		Status:                "Completed",
+		Type:                  "Transfer",
+		Description:           fmt.Sprintf("Dispute %d: %s", record.ID, description),
+		Reference:             reference,
+		TransactionID:         uuid.New(),
+		DisputeID:             &disputeID,
+		SenderBalanceAfter:    senderBalance,
+		ReceiverBalanceAfter:  &receiverAccount.Balance,
+	}
+	if err := tx.WithContext(ctx).Create(&t).Error; err != nil {
+		return transactions.Transactions{}, err
+	}
+	return t, d.transactionPosted(tx, ctx, t)
+}
+
+// clawBackProvisionalCredit takes a provisional credit back from the customer when their dispute does not succeed
+func (d *Database) clawBackProvisionalCredit(tx *gorm.DB, ctx context.Context, record Dispute) (*uuid.UUID, error) {
+	if record.ProvisionalCreditID == nil {
+		return nil, nil
+	}
+	disputesAccountNumber, err := d.systemAccountNumber(tx, ctx, accounts.SystemDisputes)
+	if err != nil {
+		return nil, err
+	}
+	t, err := d.postDisputeMovement(tx, ctx, record, record.AccountNumber, disputesAccountNumber, "provisional credit reversed")
+	if err != nil {
+		return nil, err
+	}
+	return &t.TransactionID, nil
+}
+
+// WithdrawDispute closes an active dispute on behalf of the customer who opened it
+func (d *Database) WithdrawDispute(ctx context.Context, disputeID uint, userID uint) (disputes.Dispute, error) {
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		record, err := d.lockActiveDispute(tx, disputeID)
+		if err != nil {
+			return err
+		}
+		if record.UserID != userID {
+			return disputes.ErrNotParty
+		}
+		settlementID, err := d.clawBackProvisionalCredit(tx, ctx, record)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&record).Updates(map[string]interface{}{
+			"status":        disputes.StatusWithdrawn,
+			"settlement_id": settlementID,
+			"resolved_at":   time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return disputes.Dispute{}, err
+	}
+	return d.GetDisputeByID(ctx, disputeID)
+}
+
+// ReviewDispute puts a dispute under review by an agent and optionally credits the disputed amount to the customer
+// from the disputes system account until the dispute is decided
+func (d *Database) ReviewDispute(ctx context.Context, disputeID uint, agentID uint, provisionalCredit bool) (disputes.Dispute, error) {
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		record, err := d.lockActiveDispute(tx, disputeID)
+		if err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"status":   disputes.StatusUnderReview,
+			"agent_id": agentID,
+		}
+		if provisionalCredit {
+			if record.ProvisionalCreditID != nil {
+				return disputes.ErrProvisionalCredit
+			}
+			disputesAccountNumber, err := d.systemAccountNumber(tx, ctx, accounts.SystemDisputes)
+			if err != nil {
+				return err
+			}
+			t, err := d.postDisputeMovement(tx, ctx, record, disputesAccountNumber, record.AccountNumber, "provisional credit")
+			if err != nil {
+				return err
+			}
+			updates["provisional_credit_id"] = t.TransactionID
+		}
+		return tx.Model(&record).Updates(updates).Error
+	})
+	if err != nil {
+		return disputes.Dispute{}, err
+	}
+	return d.GetDisputeByID(ctx, disputeID)
+}
+
+// DecideDispute closes an active dispute. A won dispute takes the disputed amount back from the merchant, repaying
+// the provisional credit or refunding the customer directly; when the merchant account has been closed the
+// disputes system account bears the loss. A lost dispute takes back any provisional credit. Without an agent the
+// dispute is being decided because the merchant did not respond, which no longer applies once they have.
+func (d *Database) DecideDispute(ctx context.Context, disputeID uint, agentID *uint, outcome string, note string) (disputes.Dispute, error) {
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		record, err := d.lockActiveDispute(tx, disputeID)
+		if err != nil {
+			return err
+		}
+		if agentID == nil && record.MerchantRespondedAt != nil {
+			return disputes.ErrAlreadyResponded
+		}
+
+		var settlementID *uuid.UUID
+		if outcome == disputes.StatusWon {
+			disputesAccountNumber, err := d.systemAccountNumber(tx, ctx, accounts.SystemDisputes)
+			if err != nil {
+				return err
+			}
+			var merchant Account
+			if err := tx.Where("account_number = ?", record.CounterpartyAccountNumber).First(&merchant).Error; err != nil {
+				return err
+			}
+
+			sender, receiver, description := record.CounterpartyAccountNumber, record.AccountNumber, "transfer reversed"
+			if record.ProvisionalCreditID != nil {
+				receiver, description = disputesAccountNumber, "chargeback of provisional credit"
+			}
+			if merchant.Status == accounts.StatusClosed {
+				sender, description = disputesAccountNumber, "refund written off"
+			}
+			if sender != receiver {
+				t, err := d.postDisputeMovement(tx, ctx, record, sender, receiver, description)
+				if err != nil {
+					return err
+				}
+				settlementID = &t.TransactionID
+			}
+		} else {
+			settlementID, err = d.clawBackProvisionalCredit(tx, ctx, record)
+			if err != nil {
+				return err
+			}
+		}
+
+		updates := map[string]interface{}{
+			"status":          outcome,
+			"resolution_note": note,
+			"settlement_id":   settlementID,
+			"resolved_at":     time.Now(),
+		}
+		if agentID != nil {
+			updates["agent_id"] = *agentID
+		}
+		return tx.Model(&record).Updates(updates).Error
+	})
+	if err != nil {
+		return disputes.Dispute{}, err
+	}
+	return d.GetDisputeByID(ctx, disputeID)
+}
+
+// GetUnansweredDisputes returns the active disputes whose merchant response deadline passed without a response
+func (d *Database) GetUnansweredDisputes(ctx context.Context, now time.Time) ([]uint, error) {
+	var ids []uint
+	err := d.Client.WithContext(ctx).Model(&Dispute{}).
+		Where("status IN ?", []string{disputes.StatusOpen, disputes.StatusUnderReview}).
+		Where("merchant_responded_at IS NULL AND response_due_at <= ?", now).
+		Order("id").
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (d *Database) GetDisputeTransactions(ctx context.Context, disputeID uint) ([]transactions.Transactions, error) {
+	var records []Transactions
+	if err := d.Client.WithContext(ctx).Where("dispute_id = ?", disputeID).Order("created_at").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	txns := []transactions.Transactions{}
+	for _, t := range records {
+		txns = append(txns, transactionFromModel(t))
+	}
+	return txns, nil
+}
@@ -0,0 +1,434 @@
+package db
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/escrows"
+	"PayWalletEngine/internal/transactions"
+	"PayWalletEngine/internal/webhooks"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"math"
+	"time"
+)
+
+type Escrow struct {
+	ID                  uint    `gorm:"primarykey"`
+	BuyerUserID         uint    `gorm:"index;not null"`
+	BuyerAccountNumber  int64   `gorm:"type:bigint;not null"`
+	SellerAccountNumber int64   `gorm:"type:bigint;not null;index"`
+	ArbiterUserID       uint    `gorm:"index;not null"`
+	Amount              float64 `gorm:"type:decimal(10,2);not null"`
+	Held                float64 `gorm:"type:decimal(10,2);not null"`
+	Description         string  `gorm:"type:varchar(255)"`
+	Status              string  `gorm:"type:varchar(20);not null;index"`
+	Milestones          []EscrowMilestone
+	AutoReleaseAt       time.Time `gorm:"index"`
+	DisputedByUserID    *uint
+	DisputeReason       string `gorm:"type:varchar(255)"`
+	ClosedAt            *time.Time
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+}
+
+type EscrowMilestone struct {
+	ID            uint       `gorm:"primarykey"`
+	EscrowID      uint       `gorm:"not null;index"`
+	Position      int        `gorm:"not null"`
+	Name          string     `gorm:"type:varchar(100);not null"`
+	Amount        float64    `gorm:"type:decimal(10,2);not null"`
+	Status        string     `gorm:"type:varchar(20);not null"`
+	TransactionID *uuid.UUID `gorm:"type:uuid"`
+	ReleasedAt    *time.Time
+}
+
+func escrowFromModel(e Escrow) escrows.Escrow {
+	escrow := escrows.Escrow{
+		ID:                  e.ID,
+		BuyerUserID:         e.BuyerUserID,
+		BuyerAccountNumber:  e.BuyerAccountNumber,
+		SellerAccountNumber: e.SellerAccountNumber,
+		ArbiterUserID:       e.ArbiterUserID,
+		Amount:              e.Amount,
+		Held:                e.Held,
+		Description:         e.Description,
+		Status:              e.Status,
+		Milestones:          []escrows.Milestone{},
+		AutoReleaseAt:       e.AutoReleaseAt,
+		DisputedByUserID:    e.DisputedByUserID,
+		DisputeReason:       e.DisputeReason,
+		CreatedAt:           e.CreatedAt,
+		ClosedAt:            e.ClosedAt,
+	}
+	for _, m := range e.Milestones {
+		escrow.Milestones = append(escrow.Milestones, escrows.Milestone{
+			ID:            m.ID,
+			Name:          m.Name,
+			Amount:        m.Amount,
+			Status:        m.Status,
+			TransactionID: m.TransactionID,
+			ReleasedAt:    m.ReleasedAt,
+		})
+	}
+	return escrow
+}
+
+// preloadMilestones loads an escrow's milestones in the order they were given
+func preloadMilestones(db *gorm.DB) *gorm.DB {
+	return db.Order("position")
+}
+
+// CreateEscrow stores the escrow with its milestones and moves the amount from the buyer's account into the escrow
+// system account, all in one database transaction. The funding transfer is charged fees like any other transfer.
+func (d *Database) CreateEscrow(ctx context.Context, escrow *escrows.Escrow) error {
+	record := Escrow{
+		BuyerUserID:         escrow.BuyerUserID,
+		BuyerAccountNumber:  escrow.BuyerAccountNumber,
+		SellerAccountNumber: escrow.SellerAccountNumber,
+		ArbiterUserID:       escrow.ArbiterUserID,
+		Amount:              escrow.Amount,
+		Held:                escrow.Held,
+		Description:         escrow.Description,
+		Status:              escrow.Status,
+		AutoReleaseAt:       escrow.AutoReleaseAt,
+	}
+	for i, m := range escrow.Milestones {
+		record.Milestones = append(record.Milestones, EscrowMilestone{
+			Position: i,
+			Name:     m.Name,
+			Amount:   m.Amount,
+			Status:   m.Status,
+		})
+	}
+
+	var failed *webhooks.FailedTransaction
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var buyer, seller Account
+		if err := tx.Where("account_number = ?", escrow.BuyerAccountNumber).First(&buyer).Error; err != nil {
+			return fmt.Errorf("buyer account: %w", err)
+		}
+		if buyer.UserID != escrow.BuyerUserID || buyer.AccountType == accounts.TypeSystem {
+			return escrows.ErrNotParty
+		}
+		if err := tx.Where("account_number = ?", escrow.SellerAccountNumber).First(&seller).Error; err != nil {
+			return fmt.Errorf("seller account: %w", err)
+		}
+		if seller.AccountType == accounts.TypeSystem {
+			return fmt.Errorf("%w: the seller cannot be a system account", escrows.ErrInvalidEscrow)
+		}
+		if seller.UserID == escrow.ArbiterUserID {
+			return fmt.Errorf("%w: the arbiter cannot be the seller", escrows.ErrInvalidEscrow)
+		}
+
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+
+		escrowAccountNumber, err := d.systemAccountNumber(tx, ctx, accounts.SystemEscrow)
+		if err != nil {
+			return err
+		}
+		escrowID := record.ID
+		transfer := transactions.Transactions{
+			SenderAccountNumber:   escrow.BuyerAccountNumber,
+			ReceiverAccountNumber: escrowAccountNumber,
+			Amount:                escrow.Amount,
+			PaymentMethod:         escrows.PaymentMethodEscrow,
+			Description:           fmt.Sprintf("Escrow %d funded", record.ID),
+			EscrowID:              &escrowID,
+		}
+		if _, err := d.transferInTx(tx, ctx, transfer); err != nil {
+			failed = failedTransfer(transfer, err)
+			return err
+		}
+		return nil
+	})
+	if failed != nil {
+		d.transactionFailed(ctx, *failed)
+	}
+	if err != nil {
+		return err
+	}
+
+	*escrow = escrowFromModel(record)
+	return nil
+}
+
+func (d *Database) GetEscrowByID(ctx context.Context, escrowID uint) (escrows.Escrow, error) {
+	var record Escrow
+	if err := d.Client.WithContext(ctx).Preload("Milestones", preloadMilestones).Where("id = ?", escrowID).First(&record).Error; err != nil {
+		return escrows.Escrow{}, err
+	}
+	return escrowFromModel(record), nil
+}
+
+func (d *Database) GetEscrowsByUserID(ctx context.Context, userID uint) ([]escrows.Escrow, error) {
+	var records []Escrow
+	err := d.Client.WithContext(ctx).Preload("Milestones", preloadMilestones).
+		Where("buyer_user_id = ? OR arbiter_user_id = ?", userID, userID).
+		Or("seller_account_number IN (?)", d.Client.Model(&Account{}).Select("account_number").Where("user_id = ?", userID)).
+		Order("created_at desc").
+		Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	var list []escrows.Escrow
+	for _, e := range records {
+		list = append(list, escrowFromModel(e))
+	}
+	return list, nil
+}
+
+// lockOpenEscrow locks an escrow with its milestones and checks that it still holds funds
+func (d *Database) lockOpenEscrow(tx *gorm.DB, escrowID uint) (Escrow, error) {
+	var record Escrow
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Milestones", preloadMilestones).Where("id = ?", escrowID).First(&record).Error
+	if err != nil {
+		return record, err
+	}
+	if record.Status != escrows.StatusFunded && record.Status != escrows.StatusDisputed {
+		return record, escrows.ErrEscrowClosed
+	}
+	return record, nil
+}
+
+// escrowPayout moves held funds from the escrow system account to the seller or back to the buyer. Payouts carry no
+// fees; the buyer already paid any fee when funding the escrow.
+func (d *Database) escrowPayout(tx *gorm.DB, ctx context.Context, escrow *Escrow, receiverAccountNumber int64, amount float64, description string) (transactions.Transactions, error) {
+	escrowAccountNumber, err := d.systemAccountNumber(tx, ctx, accounts.SystemEscrow)
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+	if err := lockAccounts(tx, ctx, escrowAccountNumber, receiverAccountNumber); err != nil {
+		return transactions.Transactions{}, err
+	}
+	sender, err := d.debitAccountHelper(tx, ctx, escrowAccountNumber, amount)
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+	receiver, err := d.creditAccountHelper(tx, ctx, receiverAccountNumber, amount)
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+
+	reference, err := transactions.GenerateTransactionRef()
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+	escrowID := escrow.ID
+	t := transactions.Transactions{
+		SenderAccountNumber:   escrowAccountNumber,
+		ReceiverAccountNumber: receiverAccountNumber,
+		Amount:                amount,
+		PaymentMethod:         escrows.PaymentMethodEscrow,
+		Status:                "Completed",
+		Type:                  "Transfer",
+		Description:           description,
+		Reference:             reference,
+		TransactionID:         uuid.New(),
+		EscrowID:              &escrowID,
+		SenderBalanceAfter:    &sender.Balance,
+		ReceiverBalanceAfter:  &receiver.Balance,
+	}
+	if err := tx.WithContext(ctx).Create(&t).Error; err != nil {
+		return transactions.Transactions{}, err
+	}
+	if err := d.transactionPosted(tx, ctx, t); err != nil {
+		return transactions.Transactions{}, err
+	}
+
+	escrow.Held = math.Round((escrow.Held-amount)*100) / 100
+	return t, tx.Model(escrow).Update("held", escrow.Held).Error
+}
+
+// releaseMilestone pays one pending milestone of a locked escrow to the seller, completing the escrow once nothing
+// is held any more
+func (d *Database) releaseMilestone(tx *gorm.DB, ctx context.Context, escrow *Escrow, milestone *EscrowMilestone, description string) error {
+	t, err := d.escrowPayout(tx, ctx, escrow, escrow.SellerAccountNumber, milestone.Amount, description)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	err = tx.Model(milestone).Updates(map[string]interface{}{
+		"status":         escrows.MilestoneReleased,
+		"transaction_id": t.TransactionID,
+		"released_at":    now,
+	}).Error
+	if err != nil {
+		return err
+	}
+	if escrow.Held <= 0 {
+		return tx.Model(escrow).Updates(map[string]interface{}{
+			"status":    escrows.StatusCompleted,
+			"closed_at": now,
+		}).Error
+	}
+	return nil
+}
+
+// ReleaseMilestone pays a milestone to the seller on behalf of the buyer or the arbiter
+func (d *Database) ReleaseMilestone(ctx context.Context, escrowID uint, milestoneID uint, userID uint) (escrows.Escrow, error) {
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		record, err := d.lockOpenEscrow(tx, escrowID)
+		if err != nil {
+			return err
+		}
+		if userID != record.BuyerUserID && userID != record.ArbiterUserID {
+			return escrows.ErrNotParty
+		}
+		if record.Status == escrows.StatusDisputed {
+			return escrows.ErrEscrowDisputed
+		}
+
+		for i := range record.Milestones {
+			milestone := &record.Milestones[i]
+			if milestone.ID != milestoneID {
+				continue
+			}
+			if milestone.Status != escrows.MilestonePending {
+				return escrows.ErrMilestoneReleased
+			}
+			return d.releaseMilestone(tx, ctx, &record, milestone, fmt.Sprintf("Escrow %d: %s released", record.ID, milestone.Name))
+		}
+		return gorm.ErrRecordNotFound
+	})
+	if err != nil {
+		return escrows.Escrow{}, err
+	}
+	return d.GetEscrowByID(ctx, escrowID)
+}
+
+// OpenEscrowDispute freezes an escrow on behalf of its buyer or seller
+func (d *Database) OpenEscrowDispute(ctx context.Context, escrowID uint, userID uint, reason string) (escrows.Escrow, error) {
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		record, err := d.lockOpenEscrow(tx, escrowID)
+		if err != nil {
+			return err
+		}
+		if record.Status == escrows.StatusDisputed {
+			return escrows.ErrEscrowDisputed
+		}
+		if userID != record.BuyerUserID {
+			var seller Account
+			if err := tx.Where("account_number = ?", record.SellerAccountNumber).First(&seller).Error; err != nil {
+				return err
+			}
+			if seller.UserID != userID {
+				return escrows.ErrNotParty
+			}
+		}
+		return tx.Model(&record).Updates(map[string]interface{}{
+			"status":              escrows.StatusDisputed,
+			"disputed_by_user_id": userID,
+			"dispute_reason":      reason,
+		}).Error
+	})
+	if err != nil {
+		return escrows.Escrow{}, err
+	}
+	return d.GetEscrowByID(ctx, escrowID)
+}
+
+// ResolveEscrowDispute splits what a disputed escrow still holds between seller and buyer on behalf of the arbiter,
+// cancels the pending milestones and closes the escrow
+func (d *Database) ResolveEscrowDispute(ctx context.Context, escrowID uint, userID uint, sellerAmount float64) (escrows.Escrow, error) {
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		record, err := d.lockOpenEscrow(tx, escrowID)
+		if err != nil {
+			return err
+		}
+		if userID != record.ArbiterUserID {
+			return escrows.ErrNotParty
+		}
+		if record.Status != escrows.StatusDisputed {
+			return fmt.Errorf("%w: only a disputed escrow can be resolved", escrows.ErrInvalidEscrow)
+		}
+		if sellerAmount > record.Held {
+			return fmt.Errorf("%w: seller_amount exceeds the %.2f held", escrows.ErrInvalidEscrow, record.Held)
+		}
+
+		buyerAmount := math.Round((record.Held-sellerAmount)*100) / 100
+		if sellerAmount > 0 {
+			if _, err := d.escrowPayout(tx, ctx, &record, record.SellerAccountNumber, sellerAmount, fmt.Sprintf("Escrow %d: dispute resolved", record.ID)); err != nil {
+				return err
+			}
+		}
+		if buyerAmount > 0 {
+			if _, err := d.escrowPayout(tx, ctx, &record, record.BuyerAccountNumber, buyerAmount, fmt.Sprintf("Escrow %d: refund on dispute", record.ID)); err != nil {
+				return err
+			}
+		}
+
+		err = tx.Model(&EscrowMilestone{}).
+			Where("escrow_id = ? AND status = ?", record.ID, escrows.MilestonePending).
+			Update("status", escrows.MilestoneCancelled).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&record).Updates(map[string]interface{}{
+			"status":    escrows.StatusResolved,
+			"closed_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return escrows.Escrow{}, err
+	}
+	return d.GetEscrowByID(ctx, escrowID)
+}
+
+// AutoReleaseEscrows pays every pending milestone of undisputed escrows whose auto-release time has passed. Each
+// escrow is released in its own transaction, and escrows locked by a concurrent request are left for the next run.
+func (d *Database) AutoReleaseEscrows(ctx context.Context, now time.Time) (int, error) {
+	var due []Escrow
+	err := d.Client.WithContext(ctx).
+		Where("status = ? AND auto_release_at <= ?", escrows.StatusFunded, now).
+		Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, e := range due {
+		err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var record Escrow
+			result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Preload("Milestones", preloadMilestones).
+				Where("id = ? AND status = ? AND auto_release_at <= ?", e.ID, escrows.StatusFunded, now).
+				Limit(1).Find(&record)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+
+			for i := range record.Milestones {
+				milestone := &record.Milestones[i]
+				if milestone.Status != escrows.MilestonePending {
+					continue
+				}
+				if err := d.releaseMilestone(tx, ctx, &record, milestone, fmt.Sprintf("Escrow %d: %s auto-released", record.ID, milestone.Name)); err != nil {
+					return err
+				}
+			}
+			count++
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error auto-releasing escrow %v: %v", e.ID, err)
+		}
+	}
+	return count, nil
+}
+
+func (d *Database) GetEscrowTransactions(ctx context.Context, escrowID uint) ([]transactions.Transactions, error) {
+	var records []Transactions
+	if err := d.Client.WithContext(ctx).Where("escrow_id = ?", escrowID).Order("created_at").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	txns := []transactions.Transactions{}
+	for _, t := range records {
+		txns = append(txns, transactionFromModel(t))
+	}
+	return txns, nil
+}
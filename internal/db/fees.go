@@ -0,0 +1,232 @@
+package db
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/fees"
+	"PayWalletEngine/internal/transactions"
+	"context"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math"
+	"time"
+)
+
+type FeeSchedule struct {
+	ID              uint        `gorm:"primarykey"`
+	Name            string      `gorm:"type:varchar(100);not null"`
+	TransactionType string      `gorm:"type:varchar(50)"`
+	PaymentMethod   string      `gorm:"type:varchar(50)"`
+	AccountType     string      `gorm:"type:varchar(50)"`
+	Currency        string      `gorm:"type:varchar(3)"`
+	Kind            string      `gorm:"type:varchar(20);not null"`
+	FlatAmount      float64     `gorm:"type:decimal(10,2)"`
+	Percentage      float64     `gorm:"type:decimal(7,4)"`
+	Tiers           []fees.Tier `gorm:"serializer:json"`
+	MinFee          float64     `gorm:"type:decimal(10,2)"`
+	MaxFee          float64     `gorm:"type:decimal(10,2)"`
+	Active          bool        `gorm:"not null;default:true;index"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+func feeScheduleFromModel(f FeeSchedule) fees.Schedule {
+	return fees.Schedule{
+		ID:              f.ID,
+		Name:            f.Name,
+		TransactionType: f.TransactionType,
+		PaymentMethod:   f.PaymentMethod,
+		AccountType:     f.AccountType,
+		Currency:        f.Currency,
+		Kind:            f.Kind,
+		FlatAmount:      f.FlatAmount,
+		Percentage:      f.Percentage,
+		Tiers:           f.Tiers,
+		MinFee:          f.MinFee,
+		MaxFee:          f.MaxFee,
+		Active:          f.Active,
+		CreatedAt:       f.CreatedAt,
+		UpdatedAt:       f.UpdatedAt,
+	}
+}
+
+// applyFeeSchedule copies the editable fields of a fee schedule onto the model
+func applyFeeSchedule(model *FeeSchedule, s fees.Schedule) {
+	model.Name = s.Name
+	model.TransactionType = s.TransactionType
+	model.PaymentMethod = s.PaymentMethod
+	model.AccountType = s.AccountType
+	model.Currency = s.Currency
+	model.Kind = s.Kind
+	model.FlatAmount = s.FlatAmount
+	model.Percentage = s.Percentage
+	model.Tiers = s.Tiers
+	model.MinFee = s.MinFee
+	model.MaxFee = s.MaxFee
+	model.Active = s.Active
+}
+
+func (d *Database) CreateFeeSchedule(ctx context.Context, schedule *fees.Schedule) error {
+	var record FeeSchedule
+	applyFeeSchedule(&record, *schedule)
+	if err := d.Client.WithContext(ctx).Create(&record).Error; err != nil {
+		return err
+	}
+	// Active defaults to true in the database, so an inactive schedule must be written explicitly
+	if !schedule.Active {
+		if err := d.Client.WithContext(ctx).Model(&record).Update("active", false).Error; err != nil {
+			return err
+		}
+	}
+	*schedule = feeScheduleFromModel(record)
+	return nil
+}
+
+func (d *Database) GetFeeSchedules(ctx context.Context) ([]fees.Schedule, error) {
+	var records []FeeSchedule
+	if err := d.Client.WithContext(ctx).Order("id").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	var list []fees.Schedule
+	for _, r := range records {
+		list = append(list, feeScheduleFromModel(r))
+	}
+	return list, nil
+}
+
+func (d *Database) UpdateFeeSchedule(ctx context.Context, schedule fees.Schedule) (fees.Schedule, error) {
+	var record FeeSchedule
+	if err := d.Client.WithContext(ctx).Where("id = ?", schedule.ID).First(&record).Error; err != nil {
+		return fees.Schedule{}, err
+	}
+	applyFeeSchedule(&record, schedule)
+	if err := d.Client.WithContext(ctx).Save(&record).Error; err != nil {
+		return fees.Schedule{}, err
+	}
+	return feeScheduleFromModel(record), nil
+}
+
+// QuoteFees prices a transaction for the payer's account without executing it
+func (d *Database) QuoteFees(ctx context.Context, payerAccountNumber int64, c fees.Context) (fees.Quote, error) {
+	var payer Account
+	if err := d.Client.WithContext(ctx).Where("account_number = ?", payerAccountNumber).First(&payer).Error; err != nil {
+		return fees.Quote{}, err
+	}
+	c.AccountType = payer.AccountType
+	return d.quoteFees(d.Client.WithContext(ctx), c)
+}
+
+// quoteFees applies the active fee schedules to a transaction. Movements between a user's own wallets are free.
+func (d *Database) quoteFees(tx *gorm.DB, c fees.Context) (fees.Quote, error) {
+	if c.PaymentMethod == transactions.PaymentMethodInternal {
+		return fees.Quote{Context: c, Fees: []fees.Item{}}, nil
+	}
+	var records []FeeSchedule
+	if err := tx.Where("active = ?", true).Order("id").Find(&records).Error; err != nil {
+		return fees.Quote{}, err
+	}
+	var list []fees.Schedule
+	for _, r := range records {
+		list = append(list, feeScheduleFromModel(r))
+	}
+	return fees.Calculate(list, c), nil
+}
+
+// chargeFees works out the fees on a recorded transaction, takes them from the payer and posts them to the fee
+// revenue account. The fees are itemized on the transaction.
+func (d *Database) chargeFees(tx *gorm.DB, ctx context.Context, t *transactions.Transactions, payer accounts.Account) error {
+	quote, err := d.quoteFees(tx.WithContext(ctx), fees.Context{
+		TransactionType: t.Type,
+		PaymentMethod:   t.PaymentMethod,
+		AccountType:     payer.AccountType,
+		Currency:        fees.Currency(),
+		Amount:          t.Amount,
+	})
+	if err != nil || quote.TotalFee == 0 {
+		return err
+	}
+
+	// Fees are taken whatever the payer's status, since the transaction they are charged on has already been allowed
+	var account accounts.Account
+	if err := tx.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Where("account_number = ?", payer.AccountNumber).First(&account).Error; err != nil {
+		return err
+	}
+	if err := accounts.CheckFunds(account, quote.TotalFee); err != nil {
+		return err
+	}
+	balance := account.Balance
+	account.Balance -= quote.TotalFee
+	if err := tx.WithContext(ctx).Save(&account).Error; err != nil {
+		return err
+	}
+
+	return d.postFees(tx, ctx, t, payer.AccountNumber, balance, quote.Fees)
+}
+
+// postFees credits already collected fees to the fee revenue account and records one fee transaction per item.
+// payerBalance is the payer's balance before the fees, from which the balance after each fee is worked out.
+func (d *Database) postFees(tx *gorm.DB, ctx context.Context, t *transactions.Transactions, payerAccountNumber int64, payerBalance float64, items []fees.Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	revenueAccountNumber, err := d.systemAccountNumber(tx, ctx, accounts.SystemFeeRevenue)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		revenueAccount, err := d.creditAccountHelper(tx, ctx, revenueAccountNumber, item.Amount)
+		if err != nil {
+			return err
+		}
+		payerBalance = math.Round((payerBalance-item.Amount)*100) / 100
+		payerBalanceAfter := payerBalance
+		reference, err := transactions.GenerateTransactionRef()
+		if err != nil {
+			return err
+		}
+		scheduleID := item.ScheduleID
+		fee := transactions.Transactions{
+			SenderAccountNumber:   payerAccountNumber,
+			ReceiverAccountNumber: revenueAccountNumber,
+			Amount:                item.Amount,
+			PaymentMethod:         fees.PaymentMethodFee,
+			Status:                "Completed",
+			Type:                  "Fee",
+			Description:           item.Name,
+			Reference:             reference,
+			TransactionID:         uuid.New(),
+			FeeFor:                &t.TransactionID,
+			FeeScheduleID:         &scheduleID,
+			SenderBalanceAfter:    &payerBalanceAfter,
+			ReceiverBalanceAfter:  &revenueAccount.Balance,
+		}
+		if err := tx.WithContext(ctx).Create(&fee).Error; err != nil {
+			return err
+		}
+		if err := d.transactionPosted(tx, ctx, fee); err != nil {
+			return err
+		}
+		item.TransactionID = &fee.TransactionID
+		t.Fees = append(t.Fees, item)
+	}
+	return nil
+}
+
+// getFeeItems lists the fees charged on a transaction
+func (d *Database) getFeeItems(tx *gorm.DB, transactionID uuid.UUID) ([]fees.Item, error) {
+	var records []Transactions
+	if err := tx.Where("fee_for = ?", transactionID).Order("created_at").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	var items []fees.Item
+	for i := range records {
+		r := &records[i]
+		item := fees.Item{Name: r.Description, Amount: r.Amount, TransactionID: &r.TransactionID}
+		if r.FeeScheduleID != nil {
+			item.ScheduleID = *r.FeeScheduleID
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
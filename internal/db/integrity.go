@@ -0,0 +1,319 @@
+package db
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/integrity"
+	"PayWalletEngine/internal/pots"
+	"context"
+	"database/sql"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+	"time"
+)
+
+// IntegrityReport is one run of the balance integrity check
+type IntegrityReport struct {
+	ID              uint                   `gorm:"primarykey"`
+	StartedAt       time.Time              `gorm:"not null;index"`
+	CompletedAt     time.Time              `gorm:"not null"`
+	AccountsChecked int                    `gorm:"not null"`
+	PotsChecked     int                    `gorm:"not null"`
+	TotalBalances   float64                `gorm:"type:decimal(18,2);not null"`
+	ExternalNet     float64                `gorm:"type:decimal(18,2);not null"`
+	Healthy         bool                   `gorm:"not null"`
+	FrozenAccounts  int                    `gorm:"not null;default:0"`
+	Discrepancies   []IntegrityDiscrepancy `gorm:"foreignKey:ReportID"`
+}
+
+// IntegrityDiscrepancy is a balance the check could not explain from its history
+type IntegrityDiscrepancy struct {
+	ID              uint   `gorm:"primarykey"`
+	ReportID        uint   `gorm:"not null;index"`
+	Kind            string `gorm:"type:varchar(20);not null"`
+	AccountID       uint   `gorm:"index"`
+	AccountNumber   int64  `gorm:"type:bigint"`
+	PotID           uint
+	StoredBalance   float64 `gorm:"type:decimal(18,2);not null"`
+	ComputedBalance float64 `gorm:"type:decimal(18,2);not null"`
+	Difference      float64 `gorm:"type:decimal(18,2);not null"`
+	Frozen          bool    `gorm:"not null;default:false"`
+}
+
+func integrityReportFromModel(r IntegrityReport) integrity.Report {
+	report := integrity.Report{
+		ID:              r.ID,
+		StartedAt:       r.StartedAt,
+		CompletedAt:     r.CompletedAt,
+		AccountsChecked: r.AccountsChecked,
+		PotsChecked:     r.PotsChecked,
+		TotalBalances:   r.TotalBalances,
+		ExternalNet:     r.ExternalNet,
+		Healthy:         r.Healthy,
+		FrozenAccounts:  r.FrozenAccounts,
+		Discrepancies:   []integrity.Discrepancy{},
+	}
+	for _, d := range r.Discrepancies {
+		report.Discrepancies = append(report.Discrepancies, integrity.Discrepancy{
+			ID:              d.ID,
+			Kind:            d.Kind,
+			AccountID:       d.AccountID,
+			AccountNumber:   d.AccountNumber,
+			PotID:           d.PotID,
+			StoredBalance:   d.StoredBalance,
+			ComputedBalance: d.ComputedBalance,
+			Difference:      d.Difference,
+			Frozen:          d.Frozen,
+		})
+	}
+	return report
+}
+
+// VerifyBalances recomputes balances from one consistent snapshot and stores what disagrees:
+//   - every account's balance against the net of its completed transactions, including deleted and closed accounts
+//     and accounts the transactions name but that no longer exist
+//   - every pot's balance against the net of its completed movements
+//   - the sum of all account and pot balances against the money that came in from outside less the money that went
+//     out. Transfers, fees and interest move money between accounts and cancel out; money moved into or out of a pot
+//     stays in the system and is not counted as external.
+//
+// When freeze is set, the customer accounts behind a discrepancy are frozen in the same database transaction that
+// stores the report. System accounts are never frozen, since that would stop fees, interest and disputes.
+func (d *Database) VerifyBalances(ctx context.Context, freeze bool) (integrity.Report, error) {
+	record := IntegrityReport{StartedAt: time.Now()}
+
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var all []Account
+		if err := tx.Unscoped().Order("account_number").Find(&all).Error; err != nil {
+			return err
+		}
+		net, err := movementsSince(tx, time.Time{})
+		if err != nil {
+			return err
+		}
+
+		var total float64
+		for _, a := range all {
+			total += a.Balance
+			computed := integrity.Round(net[a.AccountNumber])
+			delete(net, a.AccountNumber)
+			if integrity.Disagrees(a.Balance, computed) {
+				record.Discrepancies = append(record.Discrepancies, IntegrityDiscrepancy{
+					Kind:            integrity.KindAccountBalance,
+					AccountID:       a.ID,
+					AccountNumber:   a.AccountNumber,
+					StoredBalance:   a.Balance,
+					ComputedBalance: computed,
+					Difference:      integrity.Round(a.Balance - computed),
+				})
+			}
+		}
+		// whatever is left moved through account numbers without an account
+		orphans := make([]int64, 0, len(net))
+		for accountNumber := range net {
+			orphans = append(orphans, accountNumber)
+		}
+		sort.Slice(orphans, func(i, j int) bool { return orphans[i] < orphans[j] })
+		for _, accountNumber := range orphans {
+			if computed := integrity.Round(net[accountNumber]); integrity.Disagrees(0, computed) {
+				record.Discrepancies = append(record.Discrepancies, IntegrityDiscrepancy{
+					Kind:            integrity.KindAccountBalance,
+					AccountNumber:   accountNumber,
+					ComputedBalance: computed,
+					Difference:      -computed,
+				})
+			}
+		}
+		record.AccountsChecked = len(all)
+
+		var potList []Pot
+		if err := tx.Order("id").Find(&potList).Error; err != nil {
+			return err
+		}
+		type potNet struct {
+			PotID uint
+			Total float64
+		}
+		var potNets []potNet
+		err = tx.Model(&PotMovement{}).
+			Select("pot_id, SUM(CASE WHEN kind = ? THEN -amount ELSE amount END) AS total", pots.MovementWithdrawal).
+			Where("status = ?", pots.MovementCompleted).
+			Group("pot_id").
+			Scan(&potNets).Error
+		if err != nil {
+			return err
+		}
+		moved := make(map[uint]float64, len(potNets))
+		for _, p := range potNets {
+			moved[p.PotID] = p.Total
+		}
+		for _, p := range potList {
+			total += p.Balance
+			computed := integrity.Round(moved[p.ID])
+			if integrity.Disagrees(p.Balance, computed) {
+				record.Discrepancies = append(record.Discrepancies, IntegrityDiscrepancy{
+					Kind:            integrity.KindPotBalance,
+					AccountNumber:   p.AccountNumber,
+					PotID:           p.ID,
+					StoredBalance:   p.Balance,
+					ComputedBalance: computed,
+					Difference:      integrity.Round(p.Balance - computed),
+				})
+			}
+		}
+		record.PotsChecked = len(potList)
+
+		var external float64
+		err = tx.Model(&Transactions{}).
+			Select("COALESCE(SUM(CASE WHEN sender_account_number = 0 THEN amount ELSE 0 END), 0) - "+
+				"COALESCE(SUM(CASE WHEN receiver_account_number = 0 THEN amount ELSE 0 END), 0)").
+			Where("status = ? AND COALESCE(payment_method, '') <> ?", "Completed", pots.PaymentMethodPot).
+			Scan(&external).Error
+		if err != nil {
+			return err
+		}
+		record.TotalBalances = integrity.Round(total)
+		record.ExternalNet = integrity.Round(external)
+		if integrity.Disagrees(record.TotalBalances, record.ExternalNet) {
+			record.Discrepancies = append(record.Discrepancies, IntegrityDiscrepancy{
+				Kind:            integrity.KindLedgerTotal,
+				StoredBalance:   record.TotalBalances,
+				ComputedBalance: record.ExternalNet,
+				Difference:      integrity.Round(record.TotalBalances - record.ExternalNet),
+			})
+		}
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return integrity.Report{}, err
+	}
+
+	record.Healthy = len(record.Discrepancies) == 0
+	var frozen []Account
+	err = d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if freeze {
+			var err error
+			if frozen, err = d.freezeDiscrepancies(tx, ctx, &record); err != nil {
+				return err
+			}
+		}
+		record.CompletedAt = time.Now()
+		return tx.WithContext(ctx).Create(&record).Error
+	})
+	if err != nil {
+		return integrity.Report{}, err
+	}
+	for _, a := range frozen {
+		d.accountFrozen(ctx, a, a.StatusReason)
+	}
+	return integrityReportFromModel(record), nil
+}
+
+// freezeDiscrepancies freezes the customer accounts named by the discrepancies of a report and returns them. Accounts
+// already frozen or closed are left as they are. The report was read from an earlier snapshot, so each account's
+// balance is checked against its ledger again once it is locked, and an account that agrees by then, because a
+// posting was in flight when the snapshot was taken, is not frozen.
+func (d *Database) freezeDiscrepancies(tx *gorm.DB, ctx context.Context, record *IntegrityReport) ([]Account, error) {
+	var accountsFrozen []Account
+	frozen := make(map[int64]bool)
+	for i := range record.Discrepancies {
+		discrepancy := &record.Discrepancies[i]
+		if discrepancy.AccountNumber == 0 {
+			continue
+		}
+		if done, seen := frozen[discrepancy.AccountNumber]; seen {
+			discrepancy.Frozen = done
+			continue
+		}
+
+		// pot movements lock the pot before its account, so a pot discrepancy does the same
+		var pot Pot
+		if discrepancy.Kind == integrity.KindPotBalance {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", discrepancy.PotID).First(&pot).Error; err != nil {
+				return nil, err
+			}
+		}
+		var a Account
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("account_number = ?", discrepancy.AccountNumber).Limit(1).Find(&a).Error
+		if err != nil {
+			return nil, err
+		}
+		if a.ID == 0 || a.AccountType == accounts.TypeSystem || !accounts.CanTransition(a.Status, accounts.StatusFrozen) {
+			frozen[discrepancy.AccountNumber] = false
+			continue
+		}
+		stored, computed, err := recheckDiscrepancy(tx, ctx, a, pot, discrepancy.Kind)
+		if err != nil {
+			return nil, err
+		}
+		if !integrity.Disagrees(stored, computed) {
+			// resolved since the snapshot; another discrepancy of the account may still freeze it
+			continue
+		}
+		reason := fmt.Sprintf("balance integrity check: stored %.2f, computed %.2f", stored, computed)
+		if err := d.setAccountStatus(tx, ctx, &a, accounts.StatusFrozen, reason); err != nil {
+			return nil, err
+		}
+		accountsFrozen = append(accountsFrozen, a)
+		frozen[discrepancy.AccountNumber] = true
+		discrepancy.Frozen = true
+		record.FrozenAccounts++
+	}
+	return accountsFrozen, nil
+}
+
+// recheckDiscrepancy reads the stored and computed balance behind a discrepancy again, from the locked account or, for
+// a pot discrepancy, the locked pot
+func recheckDiscrepancy(tx *gorm.DB, ctx context.Context, a Account, pot Pot, kind string) (float64, float64, error) {
+	if kind != integrity.KindPotBalance {
+		computed, err := ledgerBalance(tx, ctx, a.AccountNumber)
+		return a.Balance, computed, err
+	}
+	var moved float64
+	err := tx.WithContext(ctx).Model(&PotMovement{}).
+		Select("COALESCE(SUM(CASE WHEN kind = ? THEN -amount ELSE amount END), 0)", pots.MovementWithdrawal).
+		Where("pot_id = ? AND status = ?", pot.ID, pots.MovementCompleted).
+		Scan(&moved).Error
+	return pot.Balance, integrity.Round(moved), err
+}
+
+// ledgerBalance recomputes the balance of an account from its completed transactions, rounded to cents
+func ledgerBalance(tx *gorm.DB, ctx context.Context, accountNumber int64) (float64, error) {
+	var balance float64
+	err := tx.WithContext(ctx).Model(&Transactions{}).
+		Select("COALESCE(SUM(CASE WHEN receiver_account_number = ? THEN amount ELSE 0 END), 0) - "+
+			"COALESCE(SUM(CASE WHEN sender_account_number = ? THEN amount ELSE 0 END), 0)", accountNumber, accountNumber).
+		Where("status = ? AND (receiver_account_number = ? OR sender_account_number = ?)", "Completed", accountNumber, accountNumber).
+		Scan(&balance).Error
+	if err != nil {
+		return 0, err
+	}
+	return integrity.Round(balance), nil
+}
+
+// GetIntegrityReports lists the latest reports, newest first, without their discrepancies
+func (d *Database) GetIntegrityReports(ctx context.Context, limit int) ([]integrity.Report, error) {
+	var records []IntegrityReport
+	if err := d.Client.WithContext(ctx).Order("started_at desc").Limit(limit).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	list := make([]integrity.Report, 0, len(records))
+	for _, r := range records {
+		list = append(list, integrityReportFromModel(r))
+	}
+	return list, nil
+}
+
+// GetIntegrityReport returns one report with its discrepancies
+func (d *Database) GetIntegrityReport(ctx context.Context, id uint) (integrity.Report, error) {
+	var record IntegrityReport
+	err := d.Client.WithContext(ctx).
+		Preload("Discrepancies", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("id = ?", id).
+		First(&record).Error
+	if err != nil {
+		return integrity.Report{}, err
+	}
+	return integrityReportFromModel(record), nil
+}
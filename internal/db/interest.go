@@ -0,0 +1,417 @@
+package db
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/interest"
+	"PayWalletEngine/internal/transactions"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"math"
+	"time"
+)
+
+type InterestPlan struct {
+	ID            uint    `gorm:"primarykey"`
+	Name          string  `gorm:"type:varchar(100);not null"`
+	AccountType   string  `gorm:"type:varchar(50);not null;uniqueIndex:idx_interest_plan_active_type,where:active = true"`
+	AnnualRate    float64 `gorm:"type:decimal(7,4);not null"`
+	OverdraftRate float64 `gorm:"type:decimal(7,4);not null;default:0"`
+	DayCount      string  `gorm:"type:varchar(10);not null"`
+	Active        bool    `gorm:"not null"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// InterestAccrual is the interest one account earned on one day. The unique index on the account and date makes
+// accruing a day that was already accrued a no-op.
+type InterestAccrual struct {
+	ID        uint      `gorm:"primarykey"`
+	AccountID uint      `gorm:"not null;uniqueIndex:idx_interest_accrual_day"`
+	PlanID    uint      `gorm:"not null"`
+	Date      time.Time `gorm:"type:date;not null;uniqueIndex:idx_interest_accrual_day;index"`
+	Balance   float64   `gorm:"type:decimal(12,2);not null"`
+	Rate      float64   `gorm:"type:decimal(7,4);not null"`
+	Amount    float64   `gorm:"type:decimal(18,6);not null"`
+	PayoutID  *uint     `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// InterestPayout is one month of interest credited to an account, unique per account and month
+type InterestPayout struct {
+	ID            uint       `gorm:"primarykey"`
+	AccountID     uint       `gorm:"not null;uniqueIndex:idx_interest_payout_period"`
+	Period        string     `gorm:"type:varchar(7);not null;uniqueIndex:idx_interest_payout_period"`
+	Amount        float64    `gorm:"type:decimal(12,2);not null"`
+	TransactionID *uuid.UUID `gorm:"type:uuid"`
+	CreatedAt     time.Time
+}
+
+func interestPlanFromModel(p InterestPlan) interest.Plan {
+	return interest.Plan{
+		ID:            p.ID,
+		Name:          p.Name,
+		AccountType:   p.AccountType,
+		AnnualRate:    p.AnnualRate,
+		OverdraftRate: p.OverdraftRate,
+		DayCount:      p.DayCount,
+		Active:        p.Active,
+		CreatedAt:     p.CreatedAt,
+		UpdatedAt:     p.UpdatedAt,
+	}
+}
+
+func (d *Database) CreateInterestPlan(ctx context.Context, plan *interest.Plan) error {
+	record := InterestPlan{
+		Name:          plan.Name,
+		AccountType:   plan.AccountType,
+		AnnualRate:    plan.AnnualRate,
+		OverdraftRate: plan.OverdraftRate,
+		DayCount:      plan.DayCount,
+		Active:        plan.Active,
+	}
+	if err := d.Client.WithContext(ctx).Create(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return interest.ErrPlanExists
+		}
+		return err
+	}
+	*plan = interestPlanFromModel(record)
+	return nil
+}
+
+func (d *Database) GetInterestPlans(ctx context.Context) ([]interest.Plan, error) {
+	var records []InterestPlan
+	if err := d.Client.WithContext(ctx).Order("id").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	var plans []interest.Plan
+	for _, p := range records {
+		plans = append(plans, interestPlanFromModel(p))
+	}
+	return plans, nil
+}
+
+func (d *Database) UpdateInterestPlan(ctx context.Context, plan interest.Plan) (interest.Plan, error) {
+	var record InterestPlan
+	if err := d.Client.WithContext(ctx).Where("id = ?", plan.ID).First(&record).Error; err != nil {
+		return interest.Plan{}, err
+	}
+	record.Name = plan.Name
+	record.AccountType = plan.AccountType
+	record.AnnualRate = plan.AnnualRate
+	record.OverdraftRate = plan.OverdraftRate
+	record.DayCount = plan.DayCount
+	record.Active = plan.Active
+	if err := d.Client.WithContext(ctx).Save(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return interest.Plan{}, interest.ErrPlanExists
+		}
+		return interest.Plan{}, err
+	}
+	return interestPlanFromModel(record), nil
+}
+
+// LastAccrualDate returns the latest day interest was accrued for, or nil before the first accrual
+func (d *Database) LastAccrualDate(ctx context.Context) (*time.Time, error) {
+	var last sql.NullTime
+	if err := d.Client.WithContext(ctx).Model(&InterestAccrual{}).Select("MAX(date)").Scan(&last).Error; err != nil {
+		return nil, err
+	}
+	if !last.Valid {
+		return nil, nil
+	}
+	return &last.Time, nil
+}
+
+// movementsSince returns the net amount each account received in completed transactions from the given time on.
+// Subtracting it from the current balance gives the balance at that time.
+func movementsSince(tx *gorm.DB, since time.Time) (map[int64]float64, error) {
+	type movement struct {
+		AccountNumber int64
+		Total         float64
+	}
+	net := make(map[int64]float64)
+
+	var credits, debits []movement
+	err := tx.Model(&Transactions{}).
+		Select("receiver_account_number AS account_number, SUM(amount) AS total").
+		Where("status = ? AND created_at >= ? AND receiver_account_number <> 0", "Completed", since).
+		Group("receiver_account_number").
+		Scan(&credits).Error
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Model(&Transactions{}).
+		Select("sender_account_number AS account_number, SUM(amount) AS total").
+		Where("status = ? AND created_at >= ? AND sender_account_number <> 0", "Completed", since).
+		Group("sender_account_number").
+		Scan(&debits).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range credits {
+		net[m.AccountNumber] += m.Total
+	}
+	for _, m := range debits {
+		net[m.AccountNumber] -= m.Total
+	}
+	return net, nil
+}
+
+// AccrueInterest records one day of interest for every open account whose type has an active plan, and of overdraft
+// interest for every open account that ended the day below zero. The overdraft rate is the one stored with the
+// account's overdraft, or its plan's overdraft rate when the account has none, so overdraft interest accrues on
+// account types without a plan too. Balances are taken at the end of the day from a single snapshot, and days already
+// accrued for an account are left untouched.
+func (d *Database) AccrueInterest(ctx context.Context, date time.Time) (int, error) {
+	var planRecords []InterestPlan
+	if err := d.Client.WithContext(ctx).Where("active = ?", true).Find(&planRecords).Error; err != nil {
+		return 0, err
+	}
+	plans := make(map[string]interest.Plan)
+	var accountTypes []string
+	for _, p := range planRecords {
+		plans[p.AccountType] = interestPlanFromModel(p)
+		accountTypes = append(accountTypes, p.AccountType)
+	}
+
+	day := interest.StartOfDay(date)
+	endOfDay := day.AddDate(0, 0, 1)
+	count := 0
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var eligible []Account
+		err := tx.Where("status <> ? AND created_at < ?", accounts.StatusClosed, endOfDay).
+			Where(tx.Where("overdraft_rate > 0").Or("account_type IN ?", accountTypes)).
+			Find(&eligible).Error
+		if err != nil || len(eligible) == 0 {
+			return err
+		}
+		since, err := movementsSince(tx, endOfDay)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range eligible {
+			plan, ok := plans[a.AccountType]
+			if !ok {
+				plan = interest.Plan{DayCount: interest.DefaultDayCount()}
+			}
+			if a.OverdraftRate > 0 {
+				plan.OverdraftRate = a.OverdraftRate
+			}
+			balance := a.Balance - since[a.AccountNumber]
+			amount := interest.DailyInterest(balance, plan, day)
+			if amount == 0 {
+				continue
+			}
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&InterestAccrual{
+				AccountID: a.ID,
+				PlanID:    plan.ID,
+				Date:      day,
+				Balance:   balance,
+				Rate:      interest.DailyRate(balance, plan),
+				Amount:    amount,
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+			count += int(result.RowsAffected)
+		}
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	return count, err
+}
+
+// CapitalizeInterest settles the unpaid interest of every month that ended before the given time, one payout per
+// account and month. Interest earned and overdraft interest charged in the same month are netted. Interest accrued on
+// an account that has since closed is forfeited.
+func (d *Database) CapitalizeInterest(ctx context.Context, before time.Time) (int, error) {
+	type pending struct {
+		AccountID uint
+		Period    string
+	}
+	var due []pending
+	err := d.Client.WithContext(ctx).Model(&InterestAccrual{}).
+		Select("account_id, to_char(date, 'YYYY-MM') AS period").
+		Where("payout_id IS NULL AND date < ?", before).
+		Group("account_id, to_char(date, 'YYYY-MM')").
+		Order("period, account_id").
+		Scan(&due).Error
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, p := range due {
+		if err := d.capitalizeMonth(ctx, p.AccountID, p.Period); err != nil {
+			log.Printf("Error capitalizing %s interest of account %v: %v", p.Period, p.AccountID, err)
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// capitalizeMonth pays out one account's unpaid interest for one month in a single database transaction
+func (d *Database) capitalizeMonth(ctx context.Context, accountID uint, period string) error {
+	monthStart, err := time.Parse("2006-01", period)
+	if err != nil {
+		return err
+	}
+	monthEnd := monthStart.AddDate(0, 1, 0)
+
+	return d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		payout := InterestPayout{AccountID: accountID, Period: period}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&payout)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("interest for %s was already paid out", period)
+		}
+
+		unpaid := tx.Model(&InterestAccrual{}).Where("account_id = ? AND payout_id IS NULL AND date >= ? AND date < ?", accountID, monthStart, monthEnd)
+		var total float64
+		if err := unpaid.Session(&gorm.Session{}).Select("COALESCE(SUM(amount), 0)").Scan(&total).Error; err != nil {
+			return err
+		}
+		amount := math.Round(total*100) / 100
+
+		var account accounts.Account
+		if err := tx.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", accountID).First(&account).Error; err != nil {
+			return err
+		}
+		if account.Status == accounts.StatusClosed {
+			log.Printf("Forfeiting %.2f interest for %s on closed account %d", amount, period, account.AccountNumber)
+			amount = 0
+		}
+
+		if amount != 0 {
+			t, err := d.payInterest(tx, ctx, account.AccountNumber, amount, period)
+			if err != nil {
+				return err
+			}
+			payout.Amount = amount
+			payout.TransactionID = &t.TransactionID
+			if err := tx.Save(&payout).Error; err != nil {
+				return err
+			}
+		}
+
+		return unpaid.Session(&gorm.Session{}).Update("payout_id", payout.ID).Error
+	})
+}
+
+// payInterest posts a month of interest as a completed transaction. Interest earned is a Credit from the interest
+// expense system account, which is allowed to go negative. Overdraft interest is a Debit to the interest income system
+// account, taken even when it pushes the account past its overdraft limit.
+func (d *Database) payInterest(tx *gorm.DB, ctx context.Context, accountNumber int64, amount float64, period string) (transactions.Transactions, error) {
+	systemAccount, transactionType, description := accounts.SystemInterestExpense, "Credit", "Interest for %s"
+	if amount < 0 {
+		systemAccount, transactionType, description = accounts.SystemInterestIncome, "Debit", "Overdraft interest for %s"
+	}
+	systemAccountNumber, err := d.systemAccountNumber(tx, ctx, systemAccount)
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+
+	sender, receiver := systemAccountNumber, accountNumber
+	if amount < 0 {
+		sender, receiver, amount = accountNumber, systemAccountNumber, -amount
+	}
+	err = tx.WithContext(ctx).Model(&Account{}).
+		Where("account_number = ?", sender).
+		Update("balance", gorm.Expr("balance - ?", amount)).Error
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+	senderBalance, err := accountBalance(tx, ctx, sender)
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+	receiverAccount, err := d.creditAccountHelper(tx, ctx, receiver, amount)
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+
+	reference, err := transactions.GenerateTransactionRef()
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+	t := transactions.Transactions{
+		SenderAccountNumber:   sender,
+		ReceiverAccountNumber: receiver,
+		Amount:                amount,
+		PaymentMethod:         interest.PaymentMethodInterest,
+		Status:                "Completed",
+		Type:                  transactionType,
+		Description:           fmt.Sprintf(description, period),
+		Reference:             reference,
+		TransactionID:         uuid.New(),
+		SenderBalanceAfter:    senderBalance,
+		ReceiverBalanceAfter:  &receiverAccount.Balance,
+	}
+	if err := tx.WithContext(ctx).Create(&t).Error; err != nil {
+		return transactions.Transactions{}, err
+	}
+	return t, d.transactionPosted(tx, ctx, t)
+}
+
+// GetInterestSummary returns an account's accrued but unpaid interest with its last month of accruals and its payouts
+func (d *Database) GetInterestSummary(ctx context.Context, accountID uint) (interest.Summary, error) {
+	var account Account
+	if err := d.Client.WithContext(ctx).Where("id = ?", accountID).First(&account).Error; err != nil {
+		return interest.Summary{}, err
+	}
+
+	summary := interest.Summary{AccountID: accountID, RecentAccruals: []interest.Accrual{}, Payouts: []interest.Payout{}}
+	var unpaid float64
+	err := d.Client.WithContext(ctx).Model(&InterestAccrual{}).
+		Where("account_id = ? AND payout_id IS NULL", accountID).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&unpaid).Error
+	if err != nil {
+		return interest.Summary{}, err
+	}
+	summary.AccruedUnpaid = math.Round(unpaid*100) / 100
+
+	var accruals []InterestAccrual
+	if err := d.Client.WithContext(ctx).Where("account_id = ?", accountID).Order("date desc").Limit(31).Find(&accruals).Error; err != nil {
+		return interest.Summary{}, err
+	}
+	for _, a := range accruals {
+		summary.RecentAccruals = append(summary.RecentAccruals, interest.Accrual{
+			ID:        a.ID,
+			AccountID: a.AccountID,
+			PlanID:    a.PlanID,
+			Date:      a.Date,
+			Balance:   a.Balance,
+			Rate:      a.Rate,
+			Amount:    a.Amount,
+			PayoutID:  a.PayoutID,
+		})
+	}
+
+	var payouts []InterestPayout
+	if err := d.Client.WithContext(ctx).Where("account_id = ?", accountID).Order("period desc").Find(&payouts).Error; err != nil {
+		return interest.Summary{}, err
+	}
+	for _, p := range payouts {
+		summary.Payouts = append(summary.Payouts, interest.Payout{
+			ID:            p.ID,
+			AccountID:     p.AccountID,
+			Period:        p.Period,
+			Amount:        p.Amount,
+			TransactionID: p.TransactionID,
+			CreatedAt:     p.CreatedAt,
+		})
+	}
+	return summary, nil
+}
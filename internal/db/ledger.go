@@ -0,0 +1,237 @@
+package db
+
+import (
+	"PayWalletEngine/internal/ledger"
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// GLAccount is an account of the chart of accounts, identified by its code
+type GLAccount struct {
+	Code      string `gorm:"type:varchar(20);primarykey"`
+	Name      string `gorm:"type:varchar(100);not null"`
+	Category  string `gorm:"type:varchar(20);not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// GLMapping maps a kind of transaction onto a debit and a credit GL account. The unique index keeps one mapping per
+// combination of keys, with empty keys stored as "" and 0.
+type GLMapping struct {
+	ID              uint   `gorm:"primarykey"`
+	TransactionType string `gorm:"type:varchar(50);not null;default:'';uniqueIndex:idx_gl_mapping_keys"`
+	PaymentMethod   string `gorm:"type:varchar(50);not null;default:'';uniqueIndex:idx_gl_mapping_keys"`
+	FeeScheduleID   uint   `gorm:"not null;default:0;uniqueIndex:idx_gl_mapping_keys"`
+	DebitCode       string `gorm:"type:varchar(20);not null"`
+	CreditCode      string `gorm:"type:varchar(20);not null"`
+	Memo            string `gorm:"type:varchar(255)"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+func glAccountFromModel(a GLAccount) ledger.GLAccount {
+	return ledger.GLAccount{
+		Code:      a.Code,
+		Name:      a.Name,
+		Category:  a.Category,
+		CreatedAt: a.CreatedAt,
+		UpdatedAt: a.UpdatedAt,
+	}
+}
+
+func glMappingFromModel(m GLMapping) ledger.Mapping {
+	return ledger.Mapping{
+		ID:              m.ID,
+		TransactionType: m.TransactionType,
+		PaymentMethod:   m.PaymentMethod,
+		FeeScheduleID:   m.FeeScheduleID,
+		DebitCode:       m.DebitCode,
+		CreditCode:      m.CreditCode,
+		Memo:            m.Memo,
+		CreatedAt:       m.CreatedAt,
+		UpdatedAt:       m.UpdatedAt,
+	}
+}
+
+// EnsureDefaultLedger seeds the default chart of accounts and mappings when the chart is empty
+func (d *Database) EnsureDefaultLedger(ctx context.Context) error {
+	return d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&GLAccount{}).Count(&count).Error; err != nil || count > 0 {
+			return err
+		}
+		for _, a := range ledger.DefaultChart {
+			if err := tx.Create(&GLAccount{Code: a.Code, Name: a.Name, Category: a.Category}).Error; err != nil {
+				return err
+			}
+		}
+		for _, m := range ledger.DefaultMappings {
+			record := GLMapping{
+				TransactionType: m.TransactionType,
+				PaymentMethod:   m.PaymentMethod,
+				FeeScheduleID:   m.FeeScheduleID,
+				DebitCode:       m.DebitCode,
+				CreditCode:      m.CreditCode,
+				Memo:            m.Memo,
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				return err
+			}
+		}
+		log.Printf("Created default chart of accounts with %d GL accounts", len(ledger.DefaultChart))
+		return nil
+	})
+}
+
+func (d *Database) CreateGLAccount(ctx context.Context, account *ledger.GLAccount) error {
+	record := GLAccount{Code: account.Code, Name: account.Name, Category: account.Category}
+	if err := d.Client.WithContext(ctx).Create(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ledger.ErrGLAccountExists
+		}
+		return err
+	}
+	*account = glAccountFromModel(record)
+	return nil
+}
+
+func (d *Database) GetGLAccounts(ctx context.Context) ([]ledger.GLAccount, error) {
+	var records []GLAccount
+	if err := d.Client.WithContext(ctx).Order("code").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	list := make([]ledger.GLAccount, 0, len(records))
+	for _, r := range records {
+		list = append(list, glAccountFromModel(r))
+	}
+	return list, nil
+}
+
+func (d *Database) UpdateGLAccount(ctx context.Context, account ledger.GLAccount) (ledger.GLAccount, error) {
+	var record GLAccount
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("code = ?", account.Code).First(&record).Error; err != nil {
+			return err
+		}
+		record.Name = account.Name
+		record.Category = account.Category
+		return tx.Save(&record).Error
+	})
+	if err != nil {
+		return ledger.GLAccount{}, err
+	}
+	return glAccountFromModel(record), nil
+}
+
+// checkGLCodes checks that both GL accounts of a mapping are in the chart of accounts
+func checkGLCodes(tx *gorm.DB, mapping ledger.Mapping) error {
+	for _, code := range []string{mapping.DebitCode, mapping.CreditCode} {
+		var count int64
+		if err := tx.Model(&GLAccount{}).Where("code = ?", code).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("%w: %s", ledger.ErrUnknownGLAccount, code)
+		}
+	}
+	return nil
+}
+
+func (d *Database) CreateGLMapping(ctx context.Context, mapping *ledger.Mapping) error {
+	record := GLMapping{
+		TransactionType: mapping.TransactionType,
+		PaymentMethod:   mapping.PaymentMethod,
+		FeeScheduleID:   mapping.FeeScheduleID,
+		DebitCode:       mapping.DebitCode,
+		CreditCode:      mapping.CreditCode,
+		Memo:            mapping.Memo,
+	}
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkGLCodes(tx, *mapping); err != nil {
+			return err
+		}
+		return tx.Create(&record).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ledger.ErrMappingExists
+	}
+	if err != nil {
+		return err
+	}
+	*mapping = glMappingFromModel(record)
+	return nil
+}
+
+// GetGLMappings lists the mappings in the order they were created
+func (d *Database) GetGLMappings(ctx context.Context) ([]ledger.Mapping, error) {
+	var records []GLMapping
+	if err := d.Client.WithContext(ctx).Order("id").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	list := make([]ledger.Mapping, 0, len(records))
+	for _, r := range records {
+		list = append(list, glMappingFromModel(r))
+	}
+	return list, nil
+}
+
+func (d *Database) UpdateGLMapping(ctx context.Context, mapping ledger.Mapping) (ledger.Mapping, error) {
+	var record GLMapping
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", mapping.ID).First(&record).Error; err != nil {
+			return err
+		}
+		if err := checkGLCodes(tx, mapping); err != nil {
+			return err
+		}
+		record.TransactionType = mapping.TransactionType
+		record.PaymentMethod = mapping.PaymentMethod
+		record.FeeScheduleID = mapping.FeeScheduleID
+		record.DebitCode = mapping.DebitCode
+		record.CreditCode = mapping.CreditCode
+		record.Memo = mapping.Memo
+		return tx.Save(&record).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ledger.Mapping{}, ledger.ErrMappingExists
+	}
+	if err != nil {
+		return ledger.Mapping{}, err
+	}
+	return glMappingFromModel(record), nil
+}
+
+func (d *Database) DeleteGLMapping(ctx context.Context, id uint) error {
+	result := d.Client.WithContext(ctx).Where("id = ?", id).Delete(&GLMapping{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetPostingSummaries adds up the completed transactions from from up to to by UTC day, type, payment method and fee
+// schedule
+func (d *Database) GetPostingSummaries(ctx context.Context, from time.Time, to time.Time) ([]ledger.PostingSummary, error) {
+	var summaries []ledger.PostingSummary
+	err := d.Client.WithContext(ctx).Model(&Transactions{}).
+		Select("date_trunc('day', created_at AT TIME ZONE 'UTC') AS date, type AS transaction_type, payment_method, "+
+			"COALESCE(fee_schedule_id, 0) AS fee_schedule_id, COUNT(*) AS count, SUM(amount) AS amount").
+		Where("status = ? AND created_at >= ? AND created_at < ?", "Completed", from, to).
+		Group("1, 2, 3, 4").
+		Order("1, 2, 3, 4").
+		Scan(&summaries).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range summaries {
+		summaries[i].Date = time.Date(summaries[i].Date.Year(), summaries[i].Date.Month(), summaries[i].Date.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return summaries, nil
+}
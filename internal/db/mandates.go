@@ -0,0 +1,237 @@
+package db
+
+import (
+	"PayWalletEngine/internal/mandates"
+	"PayWalletEngine/internal/transactions"
+	"PayWalletEngine/internal/webhooks"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"time"
+)
+
+type Mandate struct {
+	ID                    uint    `gorm:"primarykey"`
+	CustomerUserID        uint    `gorm:"index;not null"`
+	CustomerAccountNumber int64   `gorm:"type:bigint;not null"`
+	MerchantAccountNumber int64   `gorm:"type:bigint;not null;index"`
+	Reference             string  `gorm:"type:varchar(100)"`
+	MaxAmount             float64 `gorm:"type:decimal(10,2);not null"`
+	Period                string  `gorm:"type:varchar(20);not null"`
+	ValidFrom             time.Time
+	ValidUntil            *time.Time
+	Status                string `gorm:"type:varchar(20);not null"`
+	RevokedAt             *time.Time
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+}
+
+type MandatePull struct {
+	ID            uint       `gorm:"primarykey"`
+	MandateID     uint       `gorm:"not null;index:idx_mandate_pull_period"`
+	Amount        float64    `gorm:"type:decimal(10,2);not null"`
+	Description   string     `gorm:"type:varchar(255)"`
+	Status        string     `gorm:"type:varchar(20);not null"`
+	Reason        string     `gorm:"type:varchar(255)"`
+	TransactionID *uuid.UUID `gorm:"type:uuid"`
+	CreatedAt     time.Time  `gorm:"index:idx_mandate_pull_period"`
+}
+
+func mandateFromModel(m Mandate) mandates.Mandate {
+	return mandates.Mandate{
+		ID:                    m.ID,
+		CustomerUserID:        m.CustomerUserID,
+		CustomerAccountNumber: m.CustomerAccountNumber,
+		MerchantAccountNumber: m.MerchantAccountNumber,
+		Reference:             m.Reference,
+		MaxAmount:             m.MaxAmount,
+		Period:                m.Period,
+		ValidFrom:             m.ValidFrom,
+		ValidUntil:            m.ValidUntil,
+		Status:                m.Status,
+		RevokedAt:             m.RevokedAt,
+		CreatedAt:             m.CreatedAt,
+	}
+}
+
+func mandatePullFromModel(p MandatePull) mandates.Pull {
+	return mandates.Pull{
+		ID:            p.ID,
+		MandateID:     p.MandateID,
+		Amount:        p.Amount,
+		Description:   p.Description,
+		Status:        p.Status,
+		Reason:        p.Reason,
+		TransactionID: p.TransactionID,
+		CreatedAt:     p.CreatedAt,
+	}
+}
+
+// CreateMandate stores a mandate once the customer account is confirmed to belong to the customer and the merchant
+// account exists
+func (d *Database) CreateMandate(ctx context.Context, mandate *mandates.Mandate) error {
+	var customer, merchant Account
+	if err := d.Client.WithContext(ctx).Where("account_number = ?", mandate.CustomerAccountNumber).First(&customer).Error; err != nil {
+		return fmt.Errorf("customer account: %w", err)
+	}
+	if customer.UserID != mandate.CustomerUserID {
+		return mandates.ErrNotOwner
+	}
+	if err := d.Client.WithContext(ctx).Where("account_number = ?", mandate.MerchantAccountNumber).First(&merchant).Error; err != nil {
+		return fmt.Errorf("merchant account: %w", err)
+	}
+
+	record := Mandate{
+		CustomerUserID:        mandate.CustomerUserID,
+		CustomerAccountNumber: mandate.CustomerAccountNumber,
+		MerchantAccountNumber: mandate.MerchantAccountNumber,
+		Reference:             mandate.Reference,
+		MaxAmount:             mandate.MaxAmount,
+		Period:                mandate.Period,
+		ValidFrom:             mandate.ValidFrom,
+		ValidUntil:            mandate.ValidUntil,
+		Status:                mandate.Status,
+	}
+	if err := d.Client.WithContext(ctx).Create(&record).Error; err != nil {
+		return err
+	}
+
+	*mandate = mandateFromModel(record)
+	return nil
+}
+
+func (d *Database) GetMandateByID(ctx context.Context, mandateID uint) (mandates.Mandate, error) {
+	var record Mandate
+	if err := d.Client.WithContext(ctx).Where("id = ?", mandateID).First(&record).Error; err != nil {
+		return mandates.Mandate{}, err
+	}
+	return mandateFromModel(record), nil
+}
+
+func (d *Database) listMandates(ctx context.Context, column string, value interface{}) ([]mandates.Mandate, error) {
+	var records []Mandate
+	if err := d.Client.WithContext(ctx).Where(column+" = ?", value).Order("created_at desc").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	var list []mandates.Mandate
+	for _, m := range records {
+		list = append(list, mandateFromModel(m))
+	}
+	return list, nil
+}
+
+func (d *Database) GetMandatesByUserID(ctx context.Context, userID uint) ([]mandates.Mandate, error) {
+	return d.listMandates(ctx, "customer_user_id", userID)
+}
+
+func (d *Database) GetMandatesByMerchant(ctx context.Context, merchantAccountNumber int64) ([]mandates.Mandate, error) {
+	return d.listMandates(ctx, "merchant_account_number", merchantAccountNumber)
+}
+
+// RevokeMandate marks a mandate revoked on behalf of its customer. Revoking twice is not an error.
+func (d *Database) RevokeMandate(ctx context.Context, mandateID uint, userID uint) (mandates.Mandate, error) {
+	var record Mandate
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", mandateID).First(&record).Error; err != nil {
+			return err
+		}
+		if record.CustomerUserID != userID {
+			return mandates.ErrNotOwner
+		}
+		if record.Status == mandates.StatusRevoked {
+			return nil
+		}
+		now := time.Now()
+		record.Status = mandates.StatusRevoked
+		record.RevokedAt = &now
+		return tx.Save(&record).Error
+	})
+	if err != nil {
+		return mandates.Mandate{}, err
+	}
+	return mandateFromModel(record), nil
+}
+
+// PullFunds transfers funds from the customer to the merchant under a mandate. The mandate row is locked while the
+// pulls of the current period are summed, so concurrent pulls cannot together exceed the maximum. Pulls rejected on
+// the mandate's terms are recorded before the error is returned.
+func (d *Database) PullFunds(ctx context.Context, mandateID uint, merchantAccountNumber int64, amount float64, description string) (mandates.Pull, error) {
+	pull := MandatePull{
+		MandateID:   mandateID,
+		Amount:      amount,
+		Description: description,
+		Status:      mandates.PullCompleted,
+	}
+	var failed *webhooks.FailedTransaction
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var record Mandate
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", mandateID).First(&record).Error; err != nil {
+			return err
+		}
+		if record.MerchantAccountNumber != merchantAccountNumber {
+			return mandates.ErrNotMerchant
+		}
+
+		now := time.Now()
+		var pulled float64
+		err := tx.Model(&MandatePull{}).
+			Where("mandate_id = ? AND status = ? AND created_at >= ?", mandateID, mandates.PullCompleted, mandates.PeriodStart(record.Period, now)).
+			Select("COALESCE(SUM(amount), 0)").
+			Scan(&pulled).Error
+		if err != nil {
+			return err
+		}
+		if err := mandates.CheckTerms(mandateFromModel(record), amount, pulled, now); err != nil {
+			return err
+		}
+
+		if description == "" {
+			description = fmt.Sprintf("Direct debit %s", record.Reference)
+		}
+		transfer := transactions.Transactions{
+			SenderAccountNumber:   record.CustomerAccountNumber,
+			ReceiverAccountNumber: record.MerchantAccountNumber,
+			Amount:                amount,
+			PaymentMethod:         mandates.PaymentMethodDirectDebit,
+			Description:           description,
+		}
+		t, err := d.transferInTx(tx, ctx, transfer)
+		if err != nil {
+			failed = failedTransfer(transfer, err)
+			return err
+		}
+
+		pull.Description = description
+		pull.TransactionID = &t.TransactionID
+		return tx.Create(&pull).Error
+	})
+	if failed != nil {
+		d.transactionFailed(ctx, *failed)
+	}
+	if err != nil {
+		if mandates.IsTermsViolation(err) {
+			pull.Status = mandates.PullRejected
+			pull.Reason = err.Error()
+			if recordErr := d.Client.WithContext(ctx).Create(&pull).Error; recordErr != nil {
+				log.Printf("Error recording rejected pull on mandate %v: %v", mandateID, recordErr)
+			}
+		}
+		return mandates.Pull{}, err
+	}
+	return mandatePullFromModel(pull), nil
+}
+
+func (d *Database) GetMandatePulls(ctx context.Context, mandateID uint) ([]mandates.Pull, error) {
+	var records []MandatePull
+	if err := d.Client.WithContext(ctx).Where("mandate_id = ?", mandateID).Order("created_at desc").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	var pulls []mandates.Pull
+	for _, p := range records {
+		pulls = append(pulls, mandatePullFromModel(p))
+	}
+	return pulls, nil
+}
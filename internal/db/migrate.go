@@ -1,16 +1,33 @@
 package db
 
-import "log"
+import (
+	"context"
+	"log"
+)
 
 func (d *Database) MigrateDB() error {
 	log.Println("Database Migration in Process...")
 
 	// Use GORM AutoMigrate to migrate all the database schemas.
-	err := d.Client.AutoMigrate(&User{}, &Account{}, &Transactions{})
+	err := d.Client.AutoMigrate(&User{}, &Account{}, &Transactions{}, &AuditLog{}, &AccountStatusChange{}, &PaymentAlias{}, &Beneficiary{}, &PaymentRequest{}, &Schedule{}, &ScheduleRun{}, &Mandate{}, &MandatePull{}, &PaymentBatch{}, &PaymentBatchLeg{}, &FeeSchedule{}, &InterestPlan{}, &InterestAccrual{}, &InterestPayout{}, &Pot{}, &PotRule{}, &PotMovement{}, &Escrow{}, &EscrowMilestone{}, &Dispute{}, &DisputeEvidence{}, &ExpectedCredit{}, &BankStatementImport{}, &BankStatementLine{}, &IntegrityReport{}, &IntegrityDiscrepancy{}, &DayClose{}, &DailyBalance{}, &GLAccount{}, &GLMapping{}, &WebhookEndpoint{}, &WebhookSubscription{}, &WebhookDelivery{}, &WebhookAttempt{}, &OutboxMessage{})
 	if err != nil {
 		return err
 	}
 
+	d.createSearchIndexes()
+
+	if err := d.createDayCloseGuard(); err != nil {
+		return err
+	}
+
+	if err := d.EnsureSystemAccounts(context.Background()); err != nil {
+		return err
+	}
+
+	if err := d.EnsureDefaultLedger(context.Background()); err != nil {
+		return err
+	}
+
 	log.Println("Database Migration Complete!")
 	return nil
 }
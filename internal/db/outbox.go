@@ -0,0 +1,117 @@
+package db
+
+import (
+	"PayWalletEngine/internal/events"
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// outboxRelayLock is the advisory lock a relay holds while it publishes, so that only one relay publishes at a time
+// and messages that share a key go out in order
+const outboxRelayLock = 0x6f7574626f78
+
+// OutboxMessage is a domain event waiting to be published. Keys is the comma-separated list of its ordering keys.
+type OutboxMessage struct {
+	ID          uint       `gorm:"primarykey"`
+	EventID     string     `gorm:"type:varchar(36);not null;uniqueIndex"`
+	Type        string     `gorm:"type:varchar(50);not null"`
+	Keys        string     `gorm:"type:varchar(255);not null"`
+	Payload     string     `gorm:"type:text;not null"`
+	Attempts    int        `gorm:"not null;default:0"`
+	LastError   string     `gorm:"type:varchar(255)"`
+	PublishedAt *time.Time `gorm:"index"`
+	CreatedAt   time.Time
+}
+
+func outboxMessageFromModel(m OutboxMessage) events.Message {
+	return events.Message{
+		ID:          m.ID,
+		EventID:     m.EventID,
+		Type:        m.Type,
+		Keys:        strings.Split(m.Keys, ","),
+		Payload:     json.RawMessage(m.Payload),
+		CreatedAt:   m.CreatedAt,
+		Attempts:    m.Attempts,
+		LastError:   m.LastError,
+		PublishedAt: m.PublishedAt,
+	}
+}
+
+// writeOutbox adds an event to the outbox inside the caller's transaction, so it is published if and only if the
+// transaction commits
+func writeOutbox(tx *gorm.DB, ctx context.Context, eventType string, keys []string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return tx.WithContext(ctx).Create(&OutboxMessage{
+		EventID: uuid.New().String(),
+		Type:    eventType,
+		Keys:    strings.Join(keys, ","),
+		Payload: string(payload),
+	}).Error
+}
+
+// RelayOutbox hands the unpublished messages to publish in the order they were written and marks those it took as
+// published, all in one transaction holding the relay lock. When another relay holds the lock it returns at once.
+// If the transaction fails after publishing, the messages stay unpublished and are published again.
+func (d *Database) RelayOutbox(ctx context.Context, limit int, publish func(events.Message) error) (events.RelayResult, error) {
+	var result events.RelayResult
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var locked bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", outboxRelayLock).Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			result.Busy = true
+			return nil
+		}
+
+		var records []OutboxMessage
+		if err := tx.Where("published_at IS NULL").Order("id").Limit(limit).Find(&records).Error; err != nil {
+			return err
+		}
+		for _, r := range records {
+			updates := map[string]interface{}{"attempts": r.Attempts + 1}
+			if err := publish(outboxMessageFromModel(r)); err != nil {
+				updates["last_error"] = truncate(err.Error())
+				result.Failed++
+			} else {
+				updates["published_at"] = time.Now()
+				updates["last_error"] = ""
+				result.Published++
+			}
+			if err := tx.Model(&OutboxMessage{}).Where("id = ?", r.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return events.RelayResult{}, err
+	}
+	return result, nil
+}
+
+// PurgeOutbox deletes the messages published before a point in time
+func (d *Database) PurgeOutbox(ctx context.Context, before time.Time) (int64, error) {
+	result := d.Client.WithContext(ctx).Where("published_at < ?", before).Delete(&OutboxMessage{})
+	return result.RowsAffected, result.Error
+}
+
+// GetPendingOutbox lists the messages not published yet, oldest first
+func (d *Database) GetPendingOutbox(ctx context.Context, limit int) ([]events.Message, error) {
+	var records []OutboxMessage
+	if err := d.Client.WithContext(ctx).Where("published_at IS NULL").Order("id").Limit(limit).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	list := make([]events.Message, 0, len(records))
+	for _, r := range records {
+		list = append(list, outboxMessageFromModel(r))
+	}
+	return list, nil
+}
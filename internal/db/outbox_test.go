@@ -0,0 +1,158 @@
+package db
+
+import (
+	"PayWalletEngine/internal/beneficiaries"
+	"PayWalletEngine/internal/events"
+	"PayWalletEngine/internal/fees"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"strings"
+	"testing"
+)
+
+// outboxMessageOf returns the outbox message written for a transaction, whose id leads its payload
+func outboxMessageOf(t *testing.T, d *Database, transactionID string) OutboxMessage {
+	t.Helper()
+	var record OutboxMessage
+	err := d.Client.Where("type = ? AND payload LIKE ?", events.TypeTransactionCompleted, `{"transaction_id":"`+transactionID+`"%`).First(&record).Error
+	if err != nil {
+		t.Fatalf("no outbox message for transaction %s: %v", transactionID, err)
+	}
+	return record
+}
+
+func TestPostingWritesOutbox(t *testing.T) {
+	d := testDatabase(t)
+	ctx := context.Background()
+
+	payer := createTestUser(t, d)
+	sender := createTestAccount(t, d, payer, 100)
+	receiver := createTestAccount(t, d, createTestUser(t, d), 0)
+	beneficiary := beneficiaries.Beneficiary{UserID: payer, Nickname: "Landlord", AccountNumber: receiver.AccountNumber}
+	if err := d.CreateBeneficiary(ctx, &beneficiary); err != nil {
+		t.Fatal(err)
+	}
+
+	txn, err := d.TransferToBeneficiary(ctx, sender.AccountNumber, beneficiary.ID, 40, "Rent", "app transfer", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := outboxMessageFromModel(outboxMessageOf(t, d, txn.TransactionID.String()))
+	want := []string{events.AccountKey(sender.AccountNumber), events.AccountKey(receiver.AccountNumber)}
+	if len(message.Keys) != 2 || message.Keys[0] != want[0] || message.Keys[1] != want[1] {
+		t.Errorf("keys %v, want %v", message.Keys, want)
+	}
+}
+
+func TestFeeWritesOutbox(t *testing.T) {
+	d := testDatabase(t)
+	ctx := context.Background()
+
+	// a payment method of its own, so the schedule only prices this transfer
+	paymentMethod := uuid.New().String()[:20]
+	schedule := fees.Schedule{Name: "Transfer fee", TransactionType: "Transfer", PaymentMethod: paymentMethod, Kind: fees.KindFlat, FlatAmount: 1.5, Active: true}
+	if err := d.CreateFeeSchedule(ctx, &schedule); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		schedule.Active = false
+		d.UpdateFeeSchedule(ctx, schedule)
+	})
+
+	sender := createTestAccount(t, d, createTestUser(t, d), 100)
+	receiver := createTestAccount(t, d, createTestUser(t, d), 0)
+	txn, err := d.TransferFunds(ctx, sender.AccountNumber, receiver.AccountNumber, 40, "rent", paymentMethod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txn.Fees) != 1 || txn.Fees[0].TransactionID == nil {
+		t.Fatalf("expected one fee on the transfer, got %+v", txn.Fees)
+	}
+
+	var records []OutboxMessage
+	if err := d.Client.Where("type = ?", events.TypeTransactionCompleted).Order("id").Find(&records).Error; err != nil {
+		t.Fatal(err)
+	}
+	var payerEvents []string
+	for _, r := range records {
+		message := outboxMessageFromModel(r)
+		for _, key := range message.Keys {
+			if key == events.AccountKey(sender.AccountNumber) {
+				payerEvents = append(payerEvents, string(message.Payload))
+			}
+		}
+	}
+	if len(payerEvents) != 2 {
+		t.Fatalf("expected two outbox messages for the payer, got %d", len(payerEvents))
+	}
+	fee := outboxMessageOf(t, d, txn.Fees[0].TransactionID.String())
+	if !strings.Contains(fee.Keys, events.AccountKey(sender.AccountNumber)) {
+		t.Errorf("the fee event is keyed %q, not by the payer", fee.Keys)
+	}
+}
+
+func TestRelayOutboxLockIsExclusive(t *testing.T) {
+	d := testDatabase(t)
+	ctx := context.Background()
+
+	other := d.Client.Begin()
+	defer other.Rollback()
+	if err := other.Exec("SELECT pg_advisory_xact_lock(?)", outboxRelayLock).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	called := false
+	result, err := d.RelayOutbox(ctx, 10, func(events.Message) error {
+		called = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Busy || called {
+		t.Errorf("relayed while another relay held the lock: %+v", result)
+	}
+
+	other.Rollback()
+	if result, err = d.RelayOutbox(ctx, 10, func(events.Message) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if result.Busy {
+		t.Error("the relay still found the lock held after it was released")
+	}
+}
+
+func TestRelayOutboxRetries(t *testing.T) {
+	d := testDatabase(t)
+	ctx := context.Background()
+
+	account := createTestAccount(t, d, createTestUser(t, d), 0)
+	txn, err := d.CreditAccount(ctx, account.AccountNumber, 25, "top up", "card")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventID := outboxMessageOf(t, d, txn.TransactionID.String()).EventID
+
+	failing := func(message events.Message) error {
+		if message.EventID == eventID {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	if _, err := d.RelayOutbox(ctx, 500, failing); err != nil {
+		t.Fatal(err)
+	}
+	record := outboxMessageOf(t, d, txn.TransactionID.String())
+	if record.PublishedAt != nil || record.Attempts != 1 || record.LastError != "connection refused" {
+		t.Fatalf("after a failed publish: published %v, %d attempts, last error %q", record.PublishedAt, record.Attempts, record.LastError)
+	}
+
+	if _, err := d.RelayOutbox(ctx, 500, func(events.Message) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	record = outboxMessageOf(t, d, txn.TransactionID.String())
+	if record.PublishedAt == nil || record.Attempts != 2 || record.LastError != "" {
+		t.Errorf("after the retry: published %v, %d attempts, last error %q", record.PublishedAt, record.Attempts, record.LastError)
+	}
+}
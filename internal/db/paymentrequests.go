@@ -0,0 +1,239 @@
+package db
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/paymentrequests"
+	"PayWalletEngine/internal/transactions"
+	"PayWalletEngine/internal/webhooks"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type PaymentRequest struct {
+	ID                     uint    `gorm:"primarykey"`
+	RequesterUserID        uint    `gorm:"index;not null"`
+	RequesterAccountNumber int64   `gorm:"type:bigint;not null"`
+	PayerUserID            uint    `gorm:"index;not null"`
+	PayerAccountNumber     int64   `gorm:"type:bigint;not null"`
+	Amount                 float64 `gorm:"type:decimal(10,2);not null"`
+	Note                   string  `gorm:"type:varchar(255)"`
+	Status                 string  `gorm:"type:varchar(20);not null;index"`
+	ExpiresAt              time.Time
+	TransactionID          *uuid.UUID `gorm:"type:uuid"`
+	CreatedAt              time.Time
+	UpdatedAt              time.Time
+}
+
+func paymentRequestFromModel(r PaymentRequest) paymentrequests.PaymentRequest {
+	return paymentrequests.PaymentRequest{
+		ID:                     r.ID,
+		RequesterUserID:        r.RequesterUserID,
+		RequesterAccountNumber: r.RequesterAccountNumber,
+		PayerUserID:            r.PayerUserID,
+		PayerAccountNumber:     r.PayerAccountNumber,
+		Amount:                 r.Amount,
+		Note:                   r.Note,
+		Status:                 r.Status,
+		ExpiresAt:              r.ExpiresAt,
+		TransactionID:          r.TransactionID,
+		CreatedAt:              r.CreatedAt,
+		UpdatedAt:              r.UpdatedAt,
+	}
+}
+
+// CreatePaymentRequest stores a pending request after checking both accounts exist and can receive or send money
+func (d *Database) CreatePaymentRequest(ctx context.Context, request *paymentrequests.PaymentRequest) error {
+	var requester, payer Account
+	if err := d.Client.WithContext(ctx).Where("account_number = ?", request.RequesterAccountNumber).First(&requester).Error; err != nil {
+		return fmt.Errorf("requester account: %w", err)
+	}
+	if err := d.Client.WithContext(ctx).Where("account_number = ?", request.PayerAccountNumber).First(&payer).Error; err != nil {
+		return fmt.Errorf("payer account: %w", err)
+	}
+	if err := accounts.CanCredit(requester.Status); err != nil {
+		return err
+	}
+	if payer.Status == accounts.StatusClosed {
+		return accounts.ErrAccountClosed
+	}
+	if requester.UserID == payer.UserID {
+		return fmt.Errorf("%w: cannot request money from yourself", paymentrequests.ErrInvalidRequest)
+	}
+
+	record := PaymentRequest{
+		RequesterUserID:        requester.UserID,
+		RequesterAccountNumber: requester.AccountNumber,
+		PayerUserID:            payer.UserID,
+		PayerAccountNumber:     payer.AccountNumber,
+		Amount:                 request.Amount,
+		Note:                   request.Note,
+		Status:                 request.Status,
+		ExpiresAt:              request.ExpiresAt,
+	}
+	if err := d.Client.WithContext(ctx).Create(&record).Error; err != nil {
+		return err
+	}
+
+	*request = paymentRequestFromModel(record)
+	return nil
+}
+
+func (d *Database) GetPaymentRequestByID(ctx context.Context, requestID uint) (paymentrequests.PaymentRequest, error) {
+	var record PaymentRequest
+	if err := d.Client.WithContext(ctx).Where("id = ?", requestID).First(&record).Error; err != nil {
+		return paymentrequests.PaymentRequest{}, err
+	}
+	return paymentRequestFromModel(record), nil
+}
+
+func (d *Database) listPaymentRequests(ctx context.Context, column string, userID uint, status string) ([]paymentrequests.PaymentRequest, error) {
+	query := d.Client.WithContext(ctx).Where(column+" = ?", userID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var records []PaymentRequest
+	if err := query.Order("created_at desc").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	var list []paymentrequests.PaymentRequest
+	for _, r := range records {
+		list = append(list, paymentRequestFromModel(r))
+	}
+	return list, nil
+}
+
+// GetIncomingPaymentRequests lists requests where the user is the payer
+func (d *Database) GetIncomingPaymentRequests(ctx context.Context, userID uint, status string) ([]paymentrequests.PaymentRequest, error) {
+	return d.listPaymentRequests(ctx, "payer_user_id", userID, status)
+}
+
+// GetOutgoingPaymentRequests lists requests where the user is the requester
+func (d *Database) GetOutgoingPaymentRequests(ctx context.Context, userID uint, status string) ([]paymentrequests.PaymentRequest, error) {
+	return d.listPaymentRequests(ctx, "requester_user_id", userID, status)
+}
+
+// lockPendingPaymentRequest loads a request for update and checks it can still change status
+func lockPendingPaymentRequest(tx *gorm.DB, requestID uint) (PaymentRequest, error) {
+	var record PaymentRequest
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", requestID).First(&record).Error; err != nil {
+		return record, err
+	}
+	if record.Status != paymentrequests.StatusPending {
+		return record, fmt.Errorf("%w: request is %s", paymentrequests.ErrNotPending, record.Status)
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return record, paymentrequests.ErrExpired
+	}
+	return record, nil
+}
+
+// PayPaymentRequest executes the transfer from payer to requester and marks the request paid in one database
+// transaction. A transfer that fails is announced to webhook subscribers once it has been rolled back.
+func (d *Database) PayPaymentRequest(ctx context.Context, requestID uint, userID uint) (paymentrequests.PaymentRequest, error) {
+	var record PaymentRequest
+	var failed *webhooks.FailedTransaction
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		record, err = lockPendingPaymentRequest(tx, requestID)
+		if err != nil {
+			return err
+		}
+		if record.PayerUserID != userID {
+			return paymentrequests.ErrNotPayer
+		}
+
+		description := fmt.Sprintf("Payment request %d", record.ID)
+		if record.Note != "" {
+			description = fmt.Sprintf("%s: %s", description, record.Note)
+		}
+		transfer := transactions.Transactions{
+			SenderAccountNumber:   record.PayerAccountNumber,
+			ReceiverAccountNumber: record.RequesterAccountNumber,
+			Amount:                record.Amount,
+			PaymentMethod:         "payment request",
+			Description:           description,
+		}
+		t, err := d.transferInTx(tx, ctx, transfer)
+		if err != nil {
+			failed = failedTransfer(transfer, err)
+			return err
+		}
+
+		record.Status = paymentrequests.StatusPaid
+		record.TransactionID = &t.TransactionID
+		return tx.Save(&record).Error
+	})
+	if failed != nil {
+		d.transactionFailed(ctx, *failed)
+	}
+	if err != nil {
+		return paymentrequests.PaymentRequest{}, err
+	}
+	return paymentRequestFromModel(record), nil
+}
+
+// ChangePaymentRequestStatus declines or cancels a pending request on behalf of the payer or requester respectively
+func (d *Database) ChangePaymentRequestStatus(ctx context.Context, requestID uint, userID uint, status string) (paymentrequests.PaymentRequest, error) {
+	var record PaymentRequest
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		record, err = lockPendingPaymentRequest(tx, requestID)
+		if err != nil {
+			return err
+		}
+
+		switch status {
+		case paymentrequests.StatusDeclined:
+			if record.PayerUserID != userID {
+				return paymentrequests.ErrNotPayer
+			}
+		case paymentrequests.StatusCancelled:
+			if record.RequesterUserID != userID {
+				return paymentrequests.ErrNotRequester
+			}
+		default:
+			return fmt.Errorf("%w: cannot move a request to %s", paymentrequests.ErrInvalidRequest, status)
+		}
+
+		record.Status = status
+		return tx.Save(&record).Error
+	})
+	if err != nil {
+		return paymentrequests.PaymentRequest{}, err
+	}
+	return paymentRequestFromModel(record), nil
+}
+
+// ExpirePaymentRequests marks pending requests past their expiry as expired and returns them
+func (d *Database) ExpirePaymentRequests(ctx context.Context, now time.Time) ([]paymentrequests.PaymentRequest, error) {
+	var records []PaymentRequest
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND expires_at <= ?", paymentrequests.StatusPending, now).
+			Find(&records).Error
+		if err != nil || len(records) == 0 {
+			return err
+		}
+
+		var ids []uint
+		for i := range records {
+			ids = append(ids, records[i].ID)
+			records[i].Status = paymentrequests.StatusExpired
+		}
+		return tx.Model(&PaymentRequest{}).Where("id IN ?", ids).Update("status", paymentrequests.StatusExpired).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []paymentrequests.PaymentRequest
+	for _, r := range records {
+		expired = append(expired, paymentRequestFromModel(r))
+	}
+	return expired, nil
+}
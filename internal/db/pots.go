@@ -0,0 +1,560 @@
+package db
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/pots"
+	"PayWalletEngine/internal/transactions"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"time"
+)
+
+type Pot struct {
+	ID            uint    `gorm:"primarykey"`
+	UserID        uint    `gorm:"index;not null"`
+	AccountNumber int64   `gorm:"type:bigint;not null;index"`
+	Name          string  `gorm:"type:varchar(100);not null"`
+	TargetAmount  float64 `gorm:"type:decimal(10,2);not null;default:0"`
+	TargetDate    *time.Time
+	Balance       float64 `gorm:"type:decimal(10,2);not null;default:0"`
+	LockedUntil   *time.Time
+	Status        string    `gorm:"type:varchar(20);not null"`
+	Rules         []PotRule `gorm:"foreignKey:PotID"`
+	ClosedAt      *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+type PotRule struct {
+	ID        uint       `gorm:"primarykey"`
+	PotID     uint       `gorm:"not null;index"`
+	Kind      string     `gorm:"type:varchar(20);not null"`
+	Amount    float64    `gorm:"type:decimal(10,2);not null;default:0"`
+	RoundTo   float64    `gorm:"type:decimal(10,2);not null;default:0"`
+	NextRunAt *time.Time `gorm:"index"`
+	Active    bool       `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// PotMovement records money moved into or out of a pot. The unique index on the rule and source transaction makes
+// sure a debit is rounded up at most once per rule.
+type PotMovement struct {
+	ID                  uint       `gorm:"primarykey"`
+	PotID               uint       `gorm:"not null;index"`
+	RuleID              *uint      `gorm:"uniqueIndex:idx_pot_round_up"`
+	Kind                string     `gorm:"type:varchar(20);not null"`
+	Amount              float64    `gorm:"type:decimal(10,2);not null"`
+	Status              string     `gorm:"type:varchar(20);not null"`
+	Reason              string     `gorm:"type:varchar(255)"`
+	TransactionID       *uuid.UUID `gorm:"type:uuid"`
+	SourceTransactionID *uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_pot_round_up"`
+	CreatedAt           time.Time
+}
+
+func potFromModel(p Pot) pots.Pot {
+	pot := pots.Pot{
+		ID:            p.ID,
+		UserID:        p.UserID,
+		AccountNumber: p.AccountNumber,
+		Name:          p.Name,
+		TargetAmount:  p.TargetAmount,
+		TargetDate:    p.TargetDate,
+		Balance:       p.Balance,
+		LockedUntil:   p.LockedUntil,
+		Status:        p.Status,
+		Rules:         []pots.Rule{},
+		CreatedAt:     p.CreatedAt,
+		ClosedAt:      p.ClosedAt,
+	}
+	for _, r := range p.Rules {
+		pot.Rules = append(pot.Rules, potRuleFromModel(r))
+	}
+	return pot
+}
+
+func potRuleFromModel(r PotRule) pots.Rule {
+	return pots.Rule{
+		ID:        r.ID,
+		PotID:     r.PotID,
+		Kind:      r.Kind,
+		Amount:    r.Amount,
+		RoundTo:   r.RoundTo,
+		NextRunAt: r.NextRunAt,
+		Active:    r.Active,
+		CreatedAt: r.CreatedAt,
+	}
+}
+
+func potMovementFromModel(m PotMovement) pots.Movement {
+	return pots.Movement{
+		ID:                  m.ID,
+		PotID:               m.PotID,
+		RuleID:              m.RuleID,
+		Kind:                m.Kind,
+		Amount:              m.Amount,
+		Status:              m.Status,
+		Reason:              m.Reason,
+		TransactionID:       m.TransactionID,
+		SourceTransactionID: m.SourceTransactionID,
+		CreatedAt:           m.CreatedAt,
+	}
+}
+
+// CreatePot stores a pot once its account is confirmed to be an open account of the user
+func (d *Database) CreatePot(ctx context.Context, pot *pots.Pot) error {
+	var account Account
+	if err := d.Client.WithContext(ctx).Where("account_number = ?", pot.AccountNumber).First(&account).Error; err != nil {
+		return err
+	}
+	if account.UserID != pot.UserID || account.AccountType == accounts.TypeSystem {
+		return pots.ErrNotOwner
+	}
+	if account.Status == accounts.StatusClosed {
+		return accounts.ErrAccountClosed
+	}
+
+	record := Pot{
+		UserID:        pot.UserID,
+		AccountNumber: pot.AccountNumber,
+		Name:          pot.Name,
+		TargetAmount:  pot.TargetAmount,
+		TargetDate:    pot.TargetDate,
+		LockedUntil:   pot.LockedUntil,
+		Status:        pot.Status,
+	}
+	if err := d.Client.WithContext(ctx).Create(&record).Error; err != nil {
+		return err
+	}
+
+	*pot = potFromModel(record)
+	return nil
+}
+
+func (d *Database) GetPotByID(ctx context.Context, potID uint) (pots.Pot, error) {
+	var record Pot
+	if err := d.Client.WithContext(ctx).Preload("Rules").Where("id = ?", potID).First(&record).Error; err != nil {
+		return pots.Pot{}, err
+	}
+	return potFromModel(record), nil
+}
+
+func (d *Database) GetPotsByUserID(ctx context.Context, userID uint) ([]pots.Pot, error) {
+	var records []Pot
+	if err := d.Client.WithContext(ctx).Preload("Rules").Where("user_id = ?", userID).Order("created_at desc").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	var list []pots.Pot
+	for _, p := range records {
+		list = append(list, potFromModel(p))
+	}
+	return list, nil
+}
+
+// lockOwnedPot locks an open pot on behalf of its owner
+func (d *Database) lockOwnedPot(tx *gorm.DB, potID uint, userID uint) (Pot, error) {
+	var record Pot
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", potID).First(&record).Error; err != nil {
+		return record, err
+	}
+	if record.UserID != userID {
+		return record, pots.ErrNotOwner
+	}
+	if record.Status != pots.StatusActive {
+		return record, pots.ErrPotClosed
+	}
+	return record, nil
+}
+
+// movePotFunds moves money between a locked pot and its account with the account credit and debit helpers, and
+// records the account side as a completed transaction. Money moved into a pot must be covered by the account's own
+// balance, not its overdraft.
+func (d *Database) movePotFunds(tx *gorm.DB, ctx context.Context, pot *Pot, kind string, amount float64, description string) (transactions.Transactions, error) {
+	t := transactions.Transactions{
+		Amount:        amount,
+		PaymentMethod: pots.PaymentMethodPot,
+		Status:        "Completed",
+		Description:   description,
+		TransactionID: uuid.New(),
+	}
+
+	if kind == pots.MovementWithdrawal {
+		if pot.Balance < amount {
+			return t, pots.ErrInsufficientPotFunds
+		}
+		account, err := d.creditAccountHelper(tx, ctx, pot.AccountNumber, amount)
+		if err != nil {
+			return t, err
+		}
+		pot.Balance -= amount
+		t.Type = "Credit"
+		t.ReceiverAccountNumber = pot.AccountNumber
+		t.ReceiverBalanceAfter = &account.Balance
+	} else {
+		account, err := d.debitAccountHelper(tx, ctx, pot.AccountNumber, amount)
+		if err != nil {
+			return t, err
+		}
+		if account.Balance < 0 {
+			return t, accounts.ErrInsufficientFunds
+		}
+		pot.Balance += amount
+		t.Type = "Debit"
+		t.SenderAccountNumber = pot.AccountNumber
+		t.SenderBalanceAfter = &account.Balance
+	}
+
+	reference, err := transactions.GenerateTransactionRef()
+	if err != nil {
+		return t, err
+	}
+	t.Reference = reference
+	if err := tx.WithContext(ctx).Create(&t).Error; err != nil {
+		return t, err
+	}
+	if err := tx.WithContext(ctx).Model(pot).Update("balance", pot.Balance).Error; err != nil {
+		return t, err
+	}
+	return t, d.transactionPosted(tx, ctx, t)
+}
+
+// MovePotFunds deposits into or withdraws from a pot on behalf of its owner
+func (d *Database) MovePotFunds(ctx context.Context, potID uint, userID uint, kind string, amount float64) (pots.Movement, error) {
+	var movement PotMovement
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		record, err := d.lockOwnedPot(tx, potID, userID)
+		if err != nil {
+			return err
+		}
+		description := fmt.Sprintf("Moved to pot %s", record.Name)
+		if kind == pots.MovementWithdrawal {
+			if pots.IsLocked(potFromModel(record), time.Now()) {
+				return pots.ErrPotLocked
+			}
+			description = fmt.Sprintf("Moved from pot %s", record.Name)
+		}
+
+		t, err := d.movePotFunds(tx, ctx, &record, kind, amount, description)
+		if err != nil {
+			return err
+		}
+		movement = PotMovement{
+			PotID:         record.ID,
+			Kind:          kind,
+			Amount:        amount,
+			Status:        pots.MovementCompleted,
+			TransactionID: &t.TransactionID,
+		}
+		return tx.Create(&movement).Error
+	})
+	if err != nil {
+		return pots.Movement{}, err
+	}
+	return potMovementFromModel(movement), nil
+}
+
+// LockPot sets or extends the date until which withdrawals are blocked
+func (d *Database) LockPot(ctx context.Context, potID uint, userID uint, until time.Time) (pots.Pot, error) {
+	var record Pot
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		record, err = d.lockOwnedPot(tx, potID, userID)
+		if err != nil {
+			return err
+		}
+		if record.LockedUntil != nil && record.LockedUntil.After(until) {
+			return fmt.Errorf("%w: the pot is already locked until %s", pots.ErrPotLocked, record.LockedUntil.Format(time.RFC3339))
+		}
+		record.LockedUntil = &until
+		return tx.Model(&record).Update("locked_until", until).Error
+	})
+	if err != nil {
+		return pots.Pot{}, err
+	}
+	return d.GetPotByID(ctx, record.ID)
+}
+
+// ClosePot returns a pot's balance to its account, closes it and disables its rules
+func (d *Database) ClosePot(ctx context.Context, potID uint, userID uint) (pots.Pot, error) {
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		record, err := d.lockOwnedPot(tx, potID, userID)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if pots.IsLocked(potFromModel(record), now) {
+			return pots.ErrPotLocked
+		}
+
+		if record.Balance > 0 {
+			amount := record.Balance
+			t, err := d.movePotFunds(tx, ctx, &record, pots.MovementWithdrawal, amount, fmt.Sprintf("Closed pot %s", record.Name))
+			if err != nil {
+				return err
+			}
+			movement := PotMovement{
+				PotID:         record.ID,
+				Kind:          pots.MovementWithdrawal,
+				Amount:        amount,
+				Status:        pots.MovementCompleted,
+				TransactionID: &t.TransactionID,
+			}
+			if err := tx.Create(&movement).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&PotRule{}).Where("pot_id = ?", record.ID).Update("active", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&record).Updates(map[string]interface{}{
+			"status":    pots.StatusClosed,
+			"closed_at": now,
+		}).Error
+	})
+	if err != nil {
+		return pots.Pot{}, err
+	}
+	return d.GetPotByID(ctx, potID)
+}
+
+// AddPotRule attaches an auto-save rule to an open pot of the user
+func (d *Database) AddPotRule(ctx context.Context, userID uint, rule *pots.Rule) error {
+	record := PotRule{
+		PotID:     rule.PotID,
+		Kind:      rule.Kind,
+		Amount:    rule.Amount,
+		RoundTo:   rule.RoundTo,
+		NextRunAt: rule.NextRunAt,
+		Active:    rule.Active,
+	}
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := d.lockOwnedPot(tx, rule.PotID, userID); err != nil {
+			return err
+		}
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		return err
+	}
+	*rule = potRuleFromModel(record)
+	return nil
+}
+
+// DisablePotRule stops an auto-save rule. Disabling twice is not an error.
+func (d *Database) DisablePotRule(ctx context.Context, potID uint, ruleID uint, userID uint) (pots.Rule, error) {
+	var record PotRule
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var pot Pot
+		if err := tx.Where("id = ?", potID).First(&pot).Error; err != nil {
+			return err
+		}
+		if pot.UserID != userID {
+			return pots.ErrNotOwner
+		}
+		if err := tx.Where("id = ? AND pot_id = ?", ruleID, potID).First(&record).Error; err != nil {
+			return err
+		}
+		record.Active = false
+		return tx.Model(&record).Update("active", false).Error
+	})
+	if err != nil {
+		return pots.Rule{}, err
+	}
+	return potRuleFromModel(record), nil
+}
+
+func (d *Database) GetPotMovements(ctx context.Context, potID uint) ([]pots.Movement, error) {
+	var records []PotMovement
+	if err := d.Client.WithContext(ctx).Where("pot_id = ?", potID).Order("created_at desc").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	movements := []pots.Movement{}
+	for _, m := range records {
+		movements = append(movements, potMovementFromModel(m))
+	}
+	return movements, nil
+}
+
+// autoSave moves an auto-save amount into a locked pot behind a savepoint. When the account cannot fund it the
+// movement is recorded as skipped instead of failing the surrounding transaction.
+func (d *Database) autoSave(tx *gorm.DB, ctx context.Context, pot *Pot, movement *PotMovement, description string) error {
+	movement.Status = pots.MovementSkipped
+	if movement.Amount == 0 {
+		movement.Reason = "nothing to save"
+		return tx.Save(movement).Error
+	}
+
+	if err := tx.SavePoint("auto_save").Error; err != nil {
+		return err
+	}
+	t, err := d.movePotFunds(tx, ctx, pot, movement.Kind, movement.Amount, description)
+	if err != nil {
+		if !errors.Is(err, accounts.ErrInsufficientFunds) && !isAccountStatusError(err) {
+			return err
+		}
+		if err := tx.RollbackTo("auto_save").Error; err != nil {
+			return err
+		}
+		movement.Reason = err.Error()
+		return tx.Save(movement).Error
+	}
+
+	movement.Status = pots.MovementCompleted
+	movement.TransactionID = &t.TransactionID
+	return tx.Save(movement).Error
+}
+
+// isAccountStatusError reports whether err is an account status that blocks a debit
+func isAccountStatusError(err error) bool {
+	return errors.Is(err, accounts.ErrAccountFrozen) || errors.Is(err, accounts.ErrAccountDormant) || errors.Is(err, accounts.ErrAccountClosed)
+}
+
+// ApplyRoundUps rounds up the completed debits and outgoing transfers of every account with an active round-up rule,
+// saving the change into the rule's pot. Only debits made after the rule was added are rounded up, each at most once.
+func (d *Database) ApplyRoundUps(ctx context.Context, limit int) (int, error) {
+	var rules []PotRule
+	err := d.Client.WithContext(ctx).
+		Joins("JOIN pot ON pot.id = pot_rule.pot_id").
+		Where("pot_rule.kind = ? AND pot_rule.active = ? AND pot.status = ?", pots.RuleRoundUp, true, pots.StatusActive).
+		Find(&rules).Error
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, rule := range rules {
+		applied, err := d.applyRoundUps(ctx, rule, limit)
+		if err != nil {
+			log.Printf("Error applying round-ups of rule %v: %v", rule.ID, err)
+		}
+		count += applied
+	}
+	return count, nil
+}
+
+func (d *Database) applyRoundUps(ctx context.Context, rule PotRule, limit int) (int, error) {
+	var pot Pot
+	if err := d.Client.WithContext(ctx).Where("id = ?", rule.PotID).First(&pot).Error; err != nil {
+		return 0, err
+	}
+
+	type debit struct {
+		TransactionID uuid.UUID
+		Amount        float64
+		Description   string
+	}
+	var debits []debit
+	err := d.Client.WithContext(ctx).Model(&Transactions{}).
+		Select("transaction_id, amount, description").
+		Where("sender_account_number = ? AND status = ? AND type IN ? AND payment_method <> ? AND created_at >= ?",
+			pot.AccountNumber, "Completed", []string{"Debit", "Transfer"}, pots.PaymentMethodPot, rule.CreatedAt).
+		Where("NOT EXISTS (SELECT 1 FROM pot_movement m WHERE m.rule_id = ? AND m.source_transaction_id = transactions.transaction_id)", rule.ID).
+		Order("created_at").
+		Limit(limit).
+		Scan(&debits).Error
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, source := range debits {
+		applied := false
+		err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var locked Pot
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", pot.ID).First(&locked).Error; err != nil {
+				return err
+			}
+			if locked.Status != pots.StatusActive {
+				return pots.ErrPotClosed
+			}
+
+			ruleID, sourceID := rule.ID, source.TransactionID
+			movement := PotMovement{
+				PotID:               locked.ID,
+				RuleID:              &ruleID,
+				Kind:                pots.MovementRoundUp,
+				Amount:              pots.RoundUp(source.Amount, rule.RoundTo),
+				Status:              pots.MovementSkipped,
+				SourceTransactionID: &sourceID,
+			}
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&movement)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			applied = true
+			return d.autoSave(tx, ctx, &locked, &movement, fmt.Sprintf("Round-up to pot %s", locked.Name))
+		})
+		if err != nil {
+			return count, err
+		}
+		if applied {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// RunWeeklySweeps moves the amount of every due weekly rule into its pot and schedules the rule's next run. Weeks
+// missed while the job was down are skipped rather than paid out in one go.
+func (d *Database) RunWeeklySweeps(ctx context.Context, now time.Time) (int, error) {
+	var due []PotRule
+	err := d.Client.WithContext(ctx).
+		Where("kind = ? AND active = ? AND next_run_at <= ?", pots.RuleWeekly, true, now).
+		Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, r := range due {
+		swept := false
+		err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var rule PotRule
+			result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("id = ? AND active = ? AND next_run_at <= ?", r.ID, true, now).
+				Limit(1).Find(&rule)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+
+			var pot Pot
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", rule.PotID).First(&pot).Error; err != nil {
+				return err
+			}
+			if pot.Status == pots.StatusActive {
+				ruleID := rule.ID
+				movement := PotMovement{
+					PotID:  pot.ID,
+					RuleID: &ruleID,
+					Kind:   pots.MovementSweep,
+					Amount: rule.Amount,
+					Status: pots.MovementSkipped,
+				}
+				if err := tx.Create(&movement).Error; err != nil {
+					return err
+				}
+				if err := d.autoSave(tx, ctx, &pot, &movement, fmt.Sprintf("Weekly saving to pot %s", pot.Name)); err != nil {
+					return err
+				}
+				swept = true
+			}
+
+			next := pots.NextSweep(*rule.NextRunAt, now)
+			return tx.Model(&rule).Update("next_run_at", next).Error
+		})
+		if err != nil {
+			log.Printf("Error running weekly sweep of rule %v: %v", r.ID, err)
+			continue
+		}
+		if swept {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,227 @@
+package db
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/audit"
+	"PayWalletEngine/internal/disputes"
+	"PayWalletEngine/internal/escrows"
+	"PayWalletEngine/internal/mandates"
+	"PayWalletEngine/internal/paymentrequests"
+	"PayWalletEngine/internal/pots"
+	"PayWalletEngine/internal/privacy"
+	"PayWalletEngine/internal/schedules"
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// GetUserDataExport collects the profile, accounts, transactions and audit entries held for a user
+func (d *Database) GetUserDataExport(ctx context.Context, userID uint) (*privacy.Export, error) {
+	var user User
+	if err := d.Client.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("user with ID %d not found: %w", userID, err)
+		}
+		return nil, err
+	}
+
+	var accts []Account
+	if err := d.Client.WithContext(ctx).Where("user_id = ?", userID).Find(&accts).Error; err != nil {
+		return nil, err
+	}
+
+	export := &privacy.Export{
+		GeneratedAt: time.Now().UTC(),
+		Profile: privacy.Profile{
+			ID:        user.ID,
+			Username:  user.Username,
+			Email:     user.Email,
+			IsActive:  user.IsActive,
+			CreatedAt: user.CreatedAt,
+			ErasedAt:  user.ErasedAt,
+		},
+	}
+
+	var accountNumbers []int64
+	for _, a := range accts {
+		accountNumbers = append(accountNumbers, a.AccountNumber)
+		export.Accounts = append(export.Accounts, accountFromModel(a))
+	}
+
+	if len(accountNumbers) > 0 {
+		var txns []Transactions
+		err := d.Client.WithContext(ctx).
+			Where("sender_account_number IN ?", accountNumbers).
+			Or("receiver_account_number IN ?", accountNumbers).
+			Order("created_at asc").
+			Find(&txns).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range txns {
+			export.Transactions = append(export.Transactions, transactionFromModel(t))
+		}
+	}
+
+	userAliases, err := d.GetAliasesByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	export.Aliases = userAliases
+
+	if err := d.recordAudit(d.Client, ctx, userID, audit.ActionUserExported, "personal data export generated"); err != nil {
+		return nil, err
+	}
+
+	entries, err := d.GetAuditEntriesByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	export.AuditEntries = entries
+
+	return export, nil
+}
+
+// EraseUser pseudonymizes the user's personal data and closes their accounts, so that nothing can be paid into them
+// any more. Accounts and transactions are kept for legal retention, so erasure is refused while any account still
+// holds money, is frozen, or has money about to move: a standing order being paid, an active mandate, an open payment
+// request, a funded escrow or an open dispute.
+func (d *Database) EraseUser(ctx context.Context, userID uint) error {
+	return d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userID).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("user with ID %d not found: %w", userID, err)
+			}
+			return err
+		}
+		if user.ErasedAt != nil {
+			return privacy.ErrAlreadyErased
+		}
+
+		var accts []Account
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).Find(&accts).Error; err != nil {
+			return err
+		}
+
+		var accountNumbers []int64
+		for _, a := range accts {
+			if a.Balance != 0 {
+				return privacy.ErrOutstandingBalance
+			}
+			if a.Status == accounts.StatusFrozen {
+				return fmt.Errorf("%w: account %d is frozen", privacy.ErrOpenHolds, a.AccountNumber)
+			}
+			accountNumbers = append(accountNumbers, a.AccountNumber)
+		}
+
+		if len(accountNumbers) > 0 {
+			// a standing order occurrence being paid or waiting for its next attempt
+			var runningSchedules int64
+			err := tx.Model(&ScheduleRun{}).
+				Joins("JOIN schedule ON schedule.id = schedule_run.schedule_id").
+				Where("schedule_run.status IN ?", []string{schedules.RunProcessing, schedules.RunRetrying}).
+				Where(tx.Where("schedule.sender_account_number IN ?", accountNumbers).Or("schedule.receiver_account_number IN ?", accountNumbers)).
+				Count(&runningSchedules).Error
+			if err != nil {
+				return err
+			}
+			if runningSchedules > 0 {
+				return fmt.Errorf("%w: a standing order is being paid", privacy.ErrOpenHolds)
+			}
+
+			var activeMandates int64
+			err = tx.Model(&Mandate{}).
+				Where("status = ?", mandates.StatusActive).
+				Where(tx.Where("customer_account_number IN ?", accountNumbers).Or("merchant_account_number IN ?", accountNumbers)).
+				Count(&activeMandates).Error
+			if err != nil {
+				return err
+			}
+			if activeMandates > 0 {
+				return fmt.Errorf("%w: a mandate is active", privacy.ErrOpenHolds)
+			}
+
+			var openRequests int64
+			err = tx.Model(&PaymentRequest{}).
+				Where("status = ?", paymentrequests.StatusPending).
+				Where(tx.Where("requester_account_number IN ?", accountNumbers).Or("payer_account_number IN ?", accountNumbers)).
+				Count(&openRequests).Error
+			if err != nil {
+				return err
+			}
+			if openRequests > 0 {
+				return fmt.Errorf("%w: a payment request is open", privacy.ErrOpenHolds)
+			}
+
+			var potBalance float64
+			err = tx.Model(&Pot{}).Where("account_number IN ? AND status = ?", accountNumbers, pots.StatusActive).Select("COALESCE(SUM(balance), 0)").Scan(&potBalance).Error
+			if err != nil {
+				return err
+			}
+			if potBalance > 0 {
+				return privacy.ErrOutstandingBalance
+			}
+
+			var openEscrows int64
+			err = tx.Model(&Escrow{}).
+				Where("status IN ?", []string{escrows.StatusFunded, escrows.StatusDisputed}).
+				Where(tx.Where("buyer_account_number IN ?", accountNumbers).Or("seller_account_number IN ?", accountNumbers)).
+				Count(&openEscrows).Error
+			if err != nil {
+				return err
+			}
+			if openEscrows > 0 {
+				return privacy.ErrOpenHolds
+			}
+
+			var openDisputes int64
+			err = tx.Model(&Dispute{}).
+				Where("status IN ?", []string{disputes.StatusOpen, disputes.StatusUnderReview}).
+				Where(tx.Where("account_number IN ?", accountNumbers).Or("counterparty_account_number IN ?", accountNumbers)).
+				Count(&openDisputes).Error
+			if err != nil {
+				return err
+			}
+			if openDisputes > 0 {
+				return privacy.ErrOpenHolds
+			}
+		}
+
+		username, email, password, err := privacy.Pseudonymize(userID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		err = tx.Model(&user).Updates(map[string]interface{}{
+			"username":  username,
+			"email":     email,
+			"password":  password,
+			"is_active": false,
+			"erased_at": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range accts {
+			if accts[i].Status == accounts.StatusClosed {
+				continue
+			}
+			if err := d.setAccountStatus(tx, ctx, &accts[i], accounts.StatusClosed, "user data erased"); err != nil {
+				return err
+			}
+		}
+
+		// aliases are email addresses and phone numbers, so they go entirely
+		if err := tx.Where("user_id = ?", userID).Delete(&PaymentAlias{}).Error; err != nil {
+			return err
+		}
+
+		return d.recordAudit(tx, ctx, userID, audit.ActionUserErased, "personal data pseudonymized")
+	})
+}
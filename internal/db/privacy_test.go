@@ -0,0 +1,86 @@
+package db
+
+import (
+	"PayWalletEngine/internal/mandates"
+	"PayWalletEngine/internal/privacy"
+	"PayWalletEngine/internal/users"
+	"PayWalletEngine/internal/webhooks"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"testing"
+	"time"
+)
+
+func TestEraseUserLeavesNoEmailInEvents(t *testing.T) {
+	d := testDatabase(t)
+	ctx := context.Background()
+
+	email := uuid.New().String() + "@example.com"
+	if err := d.CreateUser(ctx, &users.User{Username: uuid.New().String(), Email: email, Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	var user User
+	if err := d.Client.Where("email = ?", email).First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	endpoint := webhooks.Endpoint{UserID: user.ID, URL: "https://example.com/hooks", Secret: "whsec_test", Events: []string{webhooks.EventUserActivated}, Active: true}
+	if err := d.CreateWebhookEndpoint(ctx, &endpoint); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ChangeUserStatus(ctx, users.User{IsActive: true}, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	createTestAccount(t, d, user.ID, 0)
+	if len(queuedEvents(t, d, endpoint.ID, webhooks.EventUserActivated)) != 1 {
+		t.Fatal("expected a user.activated delivery")
+	}
+
+	if err := d.EraseUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var outbox, deliveries int64
+	if err := d.Client.Model(&OutboxMessage{}).Where("payload LIKE ?", "%"+email+"%").Count(&outbox).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Client.Model(&WebhookDelivery{}).Where("payload LIKE ?", "%"+email+"%").Count(&deliveries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if outbox != 0 || deliveries != 0 {
+		t.Errorf("the erased user's email is still in %d outbox messages and %d webhook deliveries", outbox, deliveries)
+	}
+}
+
+func TestEraseUserRefusedWhileMandateActive(t *testing.T) {
+	d := testDatabase(t)
+	ctx := context.Background()
+
+	customer := createTestUser(t, d)
+	account := createTestAccount(t, d, customer, 0)
+	merchant := createTestAccount(t, d, createTestUser(t, d), 0)
+	mandate := mandates.Mandate{
+		CustomerUserID:        customer,
+		CustomerAccountNumber: account.AccountNumber,
+		MerchantAccountNumber: merchant.AccountNumber,
+		Reference:             "Gym membership",
+		MaxAmount:             50,
+		Period:                mandates.PeriodMonthly,
+		ValidFrom:             time.Now(),
+		Status:                mandates.StatusActive,
+	}
+	if err := d.CreateMandate(ctx, &mandate); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.EraseUser(ctx, customer); !errors.Is(err, privacy.ErrOpenHolds) {
+		t.Fatalf("erasing with an active mandate: got %v, want ErrOpenHolds", err)
+	}
+
+	if _, err := d.RevokeMandate(ctx, mandate.ID, customer); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.EraseUser(ctx, customer); err != nil {
+		t.Errorf("erasing once the mandate was revoked: %v", err)
+	}
+}
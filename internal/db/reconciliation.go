@@ -0,0 +1,599 @@
+package db
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/reconciliation"
+	"PayWalletEngine/internal/transactions"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math"
+	"time"
+)
+
+type ExpectedCredit struct {
+	ID            uint      `gorm:"primarykey"`
+	AccountNumber int64     `gorm:"type:bigint;not null;index"`
+	Amount        float64   `gorm:"type:decimal(10,2);not null"`
+	Reference     string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_expected_credit_pending_reference,where:status = 'pending'"`
+	Description   string    `gorm:"type:varchar(255)"`
+	ExpectedDate  time.Time `gorm:"type:date;not null;index"`
+	Status        string    `gorm:"type:varchar(20);not null;index"`
+	LineID        *uint
+	TransactionID *uuid.UUID `gorm:"type:uuid"`
+	CreatedAt     time.Time
+	MatchedAt     *time.Time
+}
+
+type BankStatementImport struct {
+	ID                 uint   `gorm:"primarykey"`
+	Format             string `gorm:"type:varchar(20);not null"`
+	Digest             string `gorm:"type:varchar(64);not null;uniqueIndex"`
+	StatementReference string `gorm:"type:varchar(100)"`
+	Currency           string `gorm:"type:varchar(3);not null"`
+	LineCount          int    `gorm:"not null"`
+	DuplicateLines     int    `gorm:"not null"`
+	SkippedDebits      int    `gorm:"not null"`
+	CreatedAt          time.Time
+}
+
+// BankStatementLine - a credit read from a bank statement. The fingerprint identifies the booking across imports and
+// a wallet transaction is reconciled with at most one line.
+type BankStatementLine struct {
+	ID                     uint       `gorm:"primarykey"`
+	ImportID               uint       `gorm:"not null;index"`
+	Fingerprint            string     `gorm:"type:varchar(64);not null;uniqueIndex"`
+	Date                   time.Time  `gorm:"not null;index"`
+	Amount                 float64    `gorm:"type:decimal(10,2);not null"`
+	Reference              string     `gorm:"type:varchar(100)"`
+	Description            string     `gorm:"type:varchar(255)"`
+	Status                 string     `gorm:"type:varchar(20);not null;index"`
+	MatchKind              string     `gorm:"type:varchar(20)"`
+	ExpectedCreditID       *uint      `gorm:"index"`
+	TransactionID          *uuid.UUID `gorm:"type:uuid;uniqueIndex"`
+	CandidateTransactionID *uuid.UUID `gorm:"type:uuid"`
+	Difference             float64    `gorm:"type:decimal(10,2);not null;default:0"`
+	Note                   string     `gorm:"type:varchar(255)"`
+	MatchedAt              *time.Time
+	CreatedAt              time.Time
+}
+
+func expectedCreditFromModel(e ExpectedCredit) reconciliation.ExpectedCredit {
+	return reconciliation.ExpectedCredit{
+		ID:            e.ID,
+		AccountNumber: e.AccountNumber,
+		Amount:        e.Amount,
+		Reference:     e.Reference,
+		Description:   e.Description,
+		ExpectedDate:  e.ExpectedDate,
+		Status:        e.Status,
+		LineID:        e.LineID,
+		TransactionID: e.TransactionID,
+		CreatedAt:     e.CreatedAt,
+		MatchedAt:     e.MatchedAt,
+	}
+}
+
+func bankImportFromModel(i BankStatementImport) reconciliation.Import {
+	return reconciliation.Import{
+		ID:                 i.ID,
+		Format:             i.Format,
+		StatementReference: i.StatementReference,
+		Currency:           i.Currency,
+		LineCount:          i.LineCount,
+		DuplicateLines:     i.DuplicateLines,
+		SkippedDebits:      i.SkippedDebits,
+		CreatedAt:          i.CreatedAt,
+	}
+}
+
+func bankLineFromModel(l BankStatementLine) reconciliation.Line {
+	return reconciliation.Line{
+		ID:                     l.ID,
+		ImportID:               l.ImportID,
+		Date:                   l.Date,
+		Amount:                 l.Amount,
+		Reference:              l.Reference,
+		Description:            l.Description,
+		Status:                 l.Status,
+		MatchKind:              l.MatchKind,
+		ExpectedCreditID:       l.ExpectedCreditID,
+		TransactionID:          l.TransactionID,
+		CandidateTransactionID: l.CandidateTransactionID,
+		Difference:             l.Difference,
+		Note:                   l.Note,
+		MatchedAt:              l.MatchedAt,
+		CreatedAt:              l.CreatedAt,
+	}
+}
+
+// CreateExpectedCredit records funding expected for a user account
+func (d *Database) CreateExpectedCredit(ctx context.Context, credit *reconciliation.ExpectedCredit) error {
+	var account Account
+	if err := d.Client.WithContext(ctx).Where("account_number = ?", credit.AccountNumber).First(&account).Error; err != nil {
+		return err
+	}
+	if account.AccountType == accounts.TypeSystem {
+		return fmt.Errorf("%w: system accounts cannot be funded from the bank", reconciliation.ErrInvalidExpectedCredit)
+	}
+
+	record := ExpectedCredit{
+		AccountNumber: credit.AccountNumber,
+		Amount:        credit.Amount,
+		Reference:     credit.Reference,
+		Description:   credit.Description,
+		ExpectedDate:  credit.ExpectedDate,
+		Status:        credit.Status,
+	}
+	if err := d.Client.WithContext(ctx).Create(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return reconciliation.ErrExpectedCreditExists
+		}
+		return err
+	}
+	*credit = expectedCreditFromModel(record)
+	return nil
+}
+
+// GetExpectedCredits lists expected credits with a status, or all of them, the earliest expected first
+func (d *Database) GetExpectedCredits(ctx context.Context, status string) ([]reconciliation.ExpectedCredit, error) {
+	query := d.Client.WithContext(ctx)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var records []ExpectedCredit
+	if err := query.Order("expected_date, id").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	list := []reconciliation.ExpectedCredit{}
+	for _, r := range records {
+		list = append(list, expectedCreditFromModel(r))
+	}
+	return list, nil
+}
+
+// CancelExpectedCredit cancels a pending expected credit
+func (d *Database) CancelExpectedCredit(ctx context.Context, creditID uint) (reconciliation.ExpectedCredit, error) {
+	var record ExpectedCredit
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", creditID).First(&record).Error; err != nil {
+			return err
+		}
+		if record.Status != reconciliation.ExpectedPending {
+			return reconciliation.ErrExpectedCreditClosed
+		}
+		record.Status = reconciliation.ExpectedCancelled
+		return tx.Save(&record).Error
+	})
+	if err != nil {
+		return reconciliation.ExpectedCredit{}, err
+	}
+	return expectedCreditFromModel(record), nil
+}
+
+// ImportBankStatement records an import and reconciles each of its lines not seen before. Lines that fail to post,
+// e.g. because the account has since been closed, stay in the exception queue rather than failing the import.
+func (d *Database) ImportBankStatement(ctx context.Context, imp *reconciliation.Import, lines []reconciliation.Line, toleranceDays int) (reconciliation.Report, error) {
+	var report reconciliation.Report
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		record := BankStatementImport{
+			Format:             imp.Format,
+			Digest:             imp.Digest,
+			StatementReference: imp.StatementReference,
+			Currency:           imp.Currency,
+			SkippedDebits:      imp.SkippedDebits,
+		}
+		if err := tx.Create(&record).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return reconciliation.ErrDuplicateImport
+			}
+			return err
+		}
+
+		for _, l := range lines {
+			line := BankStatementLine{
+				ImportID:    record.ID,
+				Fingerprint: l.Fingerprint,
+				Date:        l.Date,
+				Amount:      l.Amount,
+				Reference:   l.Reference,
+				Description: l.Description,
+				Status:      reconciliation.LineUnmatched,
+			}
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&line)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				record.DuplicateLines++
+				continue
+			}
+			record.LineCount++
+
+			if err := d.reconcileLine(tx, ctx, &line, toleranceDays); err != nil {
+				return err
+			}
+			if err := tx.Save(&line).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Save(&record).Error; err != nil {
+			return err
+		}
+		var err error
+		report, err = reconciliationReport(tx, record)
+		return err
+	})
+	if err != nil {
+		return reconciliation.Report{}, err
+	}
+	*imp = report.Import
+	return report, nil
+}
+
+// unreconciledCredits selects completed credits that no bank line has been reconciled with yet
+func unreconciledCredits(tx *gorm.DB) *gorm.DB {
+	return tx.Model(&Transactions{}).
+		Where("type = ? AND status = ?", "Credit", "Completed").
+		Where("NOT EXISTS (SELECT 1 FROM bank_statement_line l WHERE l.transaction_id = transactions.transaction_id)")
+}
+
+// reconcileLine matches a new line, first by reference and then by amount and date, with a pending expected credit
+// or an existing credit. A reference match with a different amount is a discrepancy; an amount match is only taken
+// when it is the only candidate.
+func (d *Database) reconcileLine(tx *gorm.DB, ctx context.Context, line *BankStatementLine, toleranceDays int) error {
+	referenceMatch := "upper(reference) = upper(?) OR position(upper(reference) in upper(?)) > 0"
+	text := line.Reference + " " + line.Description
+
+	var expected []ExpectedCredit
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("status = ?", reconciliation.ExpectedPending).
+		Where(referenceMatch, line.Reference, text).
+		Order("expected_date, id").
+		Find(&expected).Error
+	if err != nil {
+		return err
+	}
+	if len(expected) > 0 {
+		candidate := expected[0]
+		for _, e := range expected {
+			if e.Amount == line.Amount {
+				candidate = e
+				break
+			}
+		}
+		if candidate.Amount != line.Amount {
+			line.Status = reconciliation.LineDiscrepancy
+			line.ExpectedCreditID = &candidate.ID
+			line.Difference = math.Round((line.Amount-candidate.Amount)*100) / 100
+			line.Note = fmt.Sprintf("reference matches expected credit %d for %.2f", candidate.ID, candidate.Amount)
+			return nil
+		}
+		return d.autoPostLine(tx, ctx, line, &candidate)
+	}
+
+	var credits []Transactions
+	err = unreconciledCredits(tx).
+		Where(referenceMatch, line.Reference, text).
+		Order("created_at").
+		Find(&credits).Error
+	if err != nil {
+		return err
+	}
+	if len(credits) > 0 {
+		candidate := credits[0]
+		for _, c := range credits {
+			if c.Amount == line.Amount {
+				candidate = c
+				break
+			}
+		}
+		if candidate.Amount != line.Amount {
+			line.Status = reconciliation.LineDiscrepancy
+			line.CandidateTransactionID = &candidate.TransactionID
+			line.Difference = math.Round((line.Amount-candidate.Amount)*100) / 100
+			line.Note = fmt.Sprintf("reference matches credit %s for %.2f", candidate.Reference, candidate.Amount)
+			return nil
+		}
+		confirmLine(line, candidate.TransactionID)
+		return nil
+	}
+
+	from := line.Date.AddDate(0, 0, -toleranceDays)
+	to := line.Date.AddDate(0, 0, toleranceDays+1)
+	expected = nil
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("status = ? AND amount = ? AND expected_date >= ? AND expected_date < ?", reconciliation.ExpectedPending, line.Amount, from, to).
+		Limit(2).
+		Find(&expected).Error
+	if err != nil {
+		return err
+	}
+	if len(expected) == 1 {
+		return d.autoPostLine(tx, ctx, line, &expected[0])
+	}
+	if len(expected) > 1 {
+		line.Note = "several expected credits match the amount and date"
+		return nil
+	}
+
+	credits = nil
+	err = unreconciledCredits(tx).
+		Where("amount = ? AND created_at >= ? AND created_at < ?", line.Amount, from, to).
+		Limit(2).
+		Find(&credits).Error
+	if err != nil {
+		return err
+	}
+	switch len(credits) {
+	case 1:
+		confirmLine(line, credits[0].TransactionID)
+	case 2:
+		line.Note = "several credits match the amount and date"
+	}
+	return nil
+}
+
+// confirmLine reconciles a line with a credit already posted by hand
+func confirmLine(line *BankStatementLine, transactionID uuid.UUID) {
+	now := time.Now()
+	line.Status = reconciliation.LineMatched
+	line.MatchKind = reconciliation.MatchConfirmed
+	line.TransactionID = &transactionID
+	line.MatchedAt = &now
+}
+
+// autoPostLine posts a matched line to its expected credit's account. The posting runs in a savepoint, so a line that
+// cannot be posted is left in the exception queue with the reason.
+func (d *Database) autoPostLine(tx *gorm.DB, ctx context.Context, line *BankStatementLine, expected *ExpectedCredit) error {
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		return d.postLineToExpectedCredit(tx, ctx, line, expected)
+	})
+	if err != nil {
+		line.ExpectedCreditID = &expected.ID
+		line.Note = fmt.Sprintf("could not post to account %d: %v", expected.AccountNumber, err)
+	}
+	return nil
+}
+
+// postLineToExpectedCredit credits the line's amount to the expected credit's account and closes both
+func (d *Database) postLineToExpectedCredit(tx *gorm.DB, ctx context.Context, line *BankStatementLine, expected *ExpectedCredit) error {
+	description := expected.Description
+	if description == "" {
+		description = "Bank transfer " + expected.Reference
+	}
+	t, err := d.postBankCredit(tx, ctx, expected.AccountNumber, line.Amount, description)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	expected.Status = reconciliation.ExpectedMatched
+	expected.LineID = &line.ID
+	expected.TransactionID = &t.TransactionID
+	expected.MatchedAt = &now
+	if err := tx.Save(expected).Error; err != nil {
+		return err
+	}
+
+	line.Status = reconciliation.LineMatched
+	line.MatchKind = reconciliation.MatchPosted
+	line.ExpectedCreditID = &expected.ID
+	line.TransactionID = &t.TransactionID
+	line.Difference = math.Round((line.Amount-expected.Amount)*100) / 100
+	line.MatchedAt = &now
+	return nil
+}
+
+// postBankCredit credits funding received on the bank account to a user account, charging the fees of a credit
+func (d *Database) postBankCredit(tx *gorm.DB, ctx context.Context, accountNumber int64, amount float64, description string) (transactions.Transactions, error) {
+	reference, err := transactions.GenerateTransactionRef()
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+	account, err := d.creditAccountHelper(tx, ctx, accountNumber, amount)
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+	if account.AccountType == accounts.TypeSystem {
+		return transactions.Transactions{}, fmt.Errorf("%w: system accounts cannot be funded from the bank", reconciliation.ErrInvalidMatch)
+	}
+
+	t := transactions.Transactions{
+		ReceiverAccountNumber: accountNumber,
+		Amount:                amount,
+		PaymentMethod:         reconciliation.PaymentMethodBankTransfer,
+		Status:                "Completed",
+		Type:                  "Credit",
+		Description:           description,
+		Reference:             reference,
+		TransactionID:         uuid.New(),
+		ReceiverBalanceAfter:  &account.Balance,
+	}
+	if err := tx.WithContext(ctx).Create(&t).Error; err != nil {
+		return transactions.Transactions{}, err
+	}
+	if err := d.chargeFees(tx, ctx, &t, account); err != nil {
+		return transactions.Transactions{}, err
+	}
+	return t, d.transactionPosted(tx, ctx, t)
+}
+
+// reconciliationReport groups an import's lines by outcome
+func reconciliationReport(tx *gorm.DB, record BankStatementImport) (reconciliation.Report, error) {
+	var lines []BankStatementLine
+	if err := tx.Where("import_id = ?", record.ID).Order("id").Find(&lines).Error; err != nil {
+		return reconciliation.Report{}, err
+	}
+
+	report := reconciliation.Report{
+		Import:           bankImportFromModel(record),
+		MatchedLines:     []reconciliation.Line{},
+		UnmatchedLines:   []reconciliation.Line{},
+		DiscrepancyLines: []reconciliation.Line{},
+		IgnoredLines:     []reconciliation.Line{},
+	}
+	add := func(total *reconciliation.Total, amount float64) {
+		total.Count++
+		total.Amount = math.Round((total.Amount+amount)*100) / 100
+	}
+	for _, l := range lines {
+		line := bankLineFromModel(l)
+		switch l.Status {
+		case reconciliation.LineMatched:
+			add(&report.Matched, l.Amount)
+			if l.MatchKind == reconciliation.MatchPosted {
+				add(&report.Posted, l.Amount)
+			} else {
+				add(&report.Confirmed, l.Amount)
+			}
+			report.MatchedLines = append(report.MatchedLines, line)
+		case reconciliation.LineDiscrepancy:
+			add(&report.Discrepancies, l.Amount)
+			report.DiscrepancyLines = append(report.DiscrepancyLines, line)
+		case reconciliation.LineIgnored:
+			add(&report.Ignored, l.Amount)
+			report.IgnoredLines = append(report.IgnoredLines, line)
+		default:
+			add(&report.Unmatched, l.Amount)
+			report.UnmatchedLines = append(report.UnmatchedLines, line)
+		}
+	}
+	return report, nil
+}
+
+// GetImports lists bank statement imports, the latest first
+func (d *Database) GetImports(ctx context.Context) ([]reconciliation.Import, error) {
+	var records []BankStatementImport
+	if err := d.Client.WithContext(ctx).Order("created_at desc, id desc").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	list := []reconciliation.Import{}
+	for _, r := range records {
+		list = append(list, bankImportFromModel(r))
+	}
+	return list, nil
+}
+
+// GetReconciliationReport reports on an import as its lines stand now, including exceptions resolved since
+func (d *Database) GetReconciliationReport(ctx context.Context, importID uint) (reconciliation.Report, error) {
+	var record BankStatementImport
+	if err := d.Client.WithContext(ctx).Where("id = ?", importID).First(&record).Error; err != nil {
+		return reconciliation.Report{}, err
+	}
+	return reconciliationReport(d.Client.WithContext(ctx), record)
+}
+
+// GetExceptions lists the unmatched lines and discrepancies of every import, oldest booking first
+func (d *Database) GetExceptions(ctx context.Context) ([]reconciliation.Line, error) {
+	var records []BankStatementLine
+	err := d.Client.WithContext(ctx).
+		Where("status IN ?", []string{reconciliation.LineUnmatched, reconciliation.LineDiscrepancy}).
+		Order("date, id").
+		Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	list := []reconciliation.Line{}
+	for _, r := range records {
+		list = append(list, bankLineFromModel(r))
+	}
+	return list, nil
+}
+
+// lockOpenLine locks a line and checks that it is still in the exception queue
+func lockOpenLine(tx *gorm.DB, lineID uint) (BankStatementLine, error) {
+	var line BankStatementLine
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", lineID).First(&line).Error; err != nil {
+		return line, err
+	}
+	if line.Status == reconciliation.LineMatched || line.Status == reconciliation.LineIgnored {
+		return line, reconciliation.ErrLineResolved
+	}
+	return line, nil
+}
+
+// MatchLine resolves an exception against an expected credit, an existing credit or an account. The amount the bank
+// received is what gets posted; any difference to the expected credit or confirmed credit is kept on the line.
+func (d *Database) MatchLine(ctx context.Context, lineID uint, match reconciliation.Match) (reconciliation.Line, error) {
+	var line BankStatementLine
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if line, err = lockOpenLine(tx, lineID); err != nil {
+			return err
+		}
+
+		// a candidate noted at import no longer applies once the line is matched to something else
+		line.ExpectedCreditID = nil
+		line.CandidateTransactionID = nil
+		switch {
+		case match.ExpectedCreditID != nil:
+			var expected ExpectedCredit
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", *match.ExpectedCreditID).First(&expected).Error; err != nil {
+				return err
+			}
+			if expected.Status != reconciliation.ExpectedPending {
+				return reconciliation.ErrExpectedCreditClosed
+			}
+			if err := d.postLineToExpectedCredit(tx, ctx, &line, &expected); err != nil {
+				return err
+			}
+		case match.TransactionID != nil:
+			var credit Transactions
+			if err := tx.Where("transaction_id = ?", *match.TransactionID).First(&credit).Error; err != nil {
+				return err
+			}
+			if credit.Type != "Credit" || credit.Status != "Completed" {
+				return fmt.Errorf("%w: transaction is not a completed credit", reconciliation.ErrInvalidMatch)
+			}
+			var reconciled int64
+			if err := tx.Model(&BankStatementLine{}).Where("transaction_id = ?", credit.TransactionID).Count(&reconciled).Error; err != nil {
+				return err
+			}
+			if reconciled > 0 {
+				return reconciliation.ErrAlreadyReconciled
+			}
+			confirmLine(&line, credit.TransactionID)
+			line.Difference = math.Round((line.Amount-credit.Amount)*100) / 100
+		default:
+			t, err := d.postBankCredit(tx, ctx, match.AccountNumber, line.Amount, "Bank transfer "+line.Reference)
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			line.Status = reconciliation.LineMatched
+			line.MatchKind = reconciliation.MatchPosted
+			line.TransactionID = &t.TransactionID
+			line.MatchedAt = &now
+		}
+
+		line.Note = match.Note
+		return tx.Save(&line).Error
+	})
+	if err != nil {
+		return reconciliation.Line{}, err
+	}
+	return bankLineFromModel(line), nil
+}
+
+// IgnoreLine takes an exception out of the queue without posting anything
+func (d *Database) IgnoreLine(ctx context.Context, lineID uint, note string) (reconciliation.Line, error) {
+	var line BankStatementLine
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if line, err = lockOpenLine(tx, lineID); err != nil {
+			return err
+		}
+		line.Status = reconciliation.LineIgnored
+		line.Note = note
+		return tx.Save(&line).Error
+	})
+	if err != nil {
+		return reconciliation.Line{}, err
+	}
+	return bankLineFromModel(line), nil
+}
@@ -0,0 +1,312 @@
+package db
+
+import (
+	"PayWalletEngine/internal/schedules"
+	"context"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type Schedule struct {
+	ID                    uint    `gorm:"primarykey"`
+	UserID                uint    `gorm:"index;not null"`
+	SenderAccountNumber   int64   `gorm:"type:bigint;not null"`
+	ReceiverAccountNumber int64   `gorm:"type:bigint;not null"`
+	Amount                float64 `gorm:"type:decimal(10,2);not null"`
+	Description           string  `gorm:"type:varchar(255)"`
+	Frequency             string  `gorm:"type:varchar(20);not null"`
+	Interval              int     `gorm:"not null;default:1"`
+	DayOfMonth            int
+	StartAt               time.Time `gorm:"not null"`
+	EndAt                 *time.Time
+	Count                 int
+	Occurrences           int        `gorm:"not null;default:0"`
+	NextRunAt             *time.Time `gorm:"index"`
+	Status                string     `gorm:"type:varchar(20);not null;index"`
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+}
+
+// ScheduleRun records the execution of one occurrence. The unique index on the schedule and occurrence time makes
+// sure an occurrence is only ever claimed by one worker.
+type ScheduleRun struct {
+	ID            uint      `gorm:"primarykey"`
+	ScheduleID    uint      `gorm:"not null;uniqueIndex:idx_schedule_occurrence"`
+	OccurrenceAt  time.Time `gorm:"not null;uniqueIndex:idx_schedule_occurrence"`
+	Status        string    `gorm:"type:varchar(20);not null"`
+	Attempts      int       `gorm:"not null"`
+	NextAttemptAt *time.Time
+	TransactionID *uuid.UUID `gorm:"type:uuid"`
+	Error         string     `gorm:"type:varchar(255)"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func scheduleFromModel(s Schedule) schedules.Schedule {
+	return schedules.Schedule{
+		ID:                    s.ID,
+		UserID:                s.UserID,
+		SenderAccountNumber:   s.SenderAccountNumber,
+		ReceiverAccountNumber: s.ReceiverAccountNumber,
+		Amount:                s.Amount,
+		Description:           s.Description,
+		Frequency:             s.Frequency,
+		Interval:              s.Interval,
+		DayOfMonth:            s.DayOfMonth,
+		StartAt:               s.StartAt,
+		EndAt:                 s.EndAt,
+		Count:                 s.Count,
+		Occurrences:           s.Occurrences,
+		NextRunAt:             s.NextRunAt,
+		Status:                s.Status,
+		CreatedAt:             s.CreatedAt,
+		UpdatedAt:             s.UpdatedAt,
+	}
+}
+
+// applySchedule copies the recurrence state worked out by the schedules package back onto the model
+func applySchedule(model *Schedule, s schedules.Schedule) {
+	model.Occurrences = s.Occurrences
+	model.NextRunAt = s.NextRunAt
+	model.Status = s.Status
+}
+
+func scheduleRunFromModel(r ScheduleRun) schedules.Run {
+	return schedules.Run{
+		ID:            r.ID,
+		ScheduleID:    r.ScheduleID,
+		OccurrenceAt:  r.OccurrenceAt,
+		Status:        r.Status,
+		Attempts:      r.Attempts,
+		NextAttemptAt: r.NextAttemptAt,
+		TransactionID: r.TransactionID,
+		Error:         r.Error,
+		CreatedAt:     r.CreatedAt,
+		UpdatedAt:     r.UpdatedAt,
+	}
+}
+
+// CreateSchedule stores a schedule once the sender account is confirmed to belong to the user and the receiver exists
+func (d *Database) CreateSchedule(ctx context.Context, schedule *schedules.Schedule) error {
+	var sender, receiver Account
+	if err := d.Client.WithContext(ctx).Where("account_number = ?", schedule.SenderAccountNumber).First(&sender).Error; err != nil {
+		return fmt.Errorf("sender account: %w", err)
+	}
+	if sender.UserID != schedule.UserID {
+		return schedules.ErrNotOwner
+	}
+	if err := d.Client.WithContext(ctx).Where("account_number = ?", schedule.ReceiverAccountNumber).First(&receiver).Error; err != nil {
+		return fmt.Errorf("receiver account: %w", err)
+	}
+
+	record := Schedule{
+		UserID:                schedule.UserID,
+		SenderAccountNumber:   schedule.SenderAccountNumber,
+		ReceiverAccountNumber: schedule.ReceiverAccountNumber,
+		Amount:                schedule.Amount,
+		Description:           schedule.Description,
+		Frequency:             schedule.Frequency,
+		Interval:              schedule.Interval,
+		DayOfMonth:            schedule.DayOfMonth,
+		StartAt:               schedule.StartAt,
+		EndAt:                 schedule.EndAt,
+		Count:                 schedule.Count,
+	}
+	applySchedule(&record, *schedule)
+	if err := d.Client.WithContext(ctx).Create(&record).Error; err != nil {
+		return err
+	}
+
+	*schedule = scheduleFromModel(record)
+	return nil
+}
+
+func (d *Database) GetScheduleByID(ctx context.Context, scheduleID uint) (schedules.Schedule, error) {
+	var record Schedule
+	if err := d.Client.WithContext(ctx).Where("id = ?", scheduleID).First(&record).Error; err != nil {
+		return schedules.Schedule{}, err
+	}
+	return scheduleFromModel(record), nil
+}
+
+func (d *Database) GetSchedulesByUserID(ctx context.Context, userID uint) ([]schedules.Schedule, error) {
+	var records []Schedule
+	if err := d.Client.WithContext(ctx).Where("user_id = ?", userID).Order("created_at desc").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	var list []schedules.Schedule
+	for _, r := range records {
+		list = append(list, scheduleFromModel(r))
+	}
+	return list, nil
+}
+
+// ChangeScheduleStatus pauses, resumes or cancels a schedule on behalf of its owner. Resuming skips the occurrences
+// that fell due while paused, and any retries left waiting on skipped or cancelled occurrences are failed.
+func (d *Database) ChangeScheduleStatus(ctx context.Context, scheduleID uint, userID uint, status string) (schedules.Schedule, error) {
+	var record Schedule
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", scheduleID).First(&record).Error; err != nil {
+			return err
+		}
+		if record.UserID != userID {
+			return schedules.ErrNotOwner
+		}
+		if !schedules.CanTransition(record.Status, status) {
+			return fmt.Errorf("%w: %s to %s", schedules.ErrInvalidStatusTransition, record.Status, status)
+		}
+
+		schedule := scheduleFromModel(record)
+		schedule.Status = status
+		if status == schedules.StatusActive {
+			schedules.SkipMissed(&schedule, time.Now())
+		}
+		applySchedule(&record, schedule)
+
+		abandoned := tx.Model(&ScheduleRun{}).Where("schedule_id = ? AND status = ?", record.ID, schedules.RunRetrying)
+		if record.Status == schedules.StatusActive && record.NextRunAt != nil {
+			abandoned = abandoned.Where("occurrence_at < ?", *record.NextRunAt)
+		}
+		if record.Status != schedules.StatusPaused {
+			err := abandoned.Updates(map[string]interface{}{
+				"status":          schedules.RunFailed,
+				"next_attempt_at": nil,
+				"error":           "occurrence skipped after the schedule was " + status,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Save(&record).Error
+	})
+	if err != nil {
+		return schedules.Schedule{}, err
+	}
+	return scheduleFromModel(record), nil
+}
+
+// GetDueSchedules returns active schedules whose next occurrence is due and is not already being executed or waiting
+// for a later retry
+func (d *Database) GetDueSchedules(ctx context.Context, now time.Time, limit int) ([]schedules.Schedule, error) {
+	var records []Schedule
+	err := d.Client.WithContext(ctx).
+		Where("status = ? AND next_run_at <= ?", schedules.StatusActive, now).
+		Where(`NOT EXISTS (SELECT 1 FROM schedule_run r WHERE r.schedule_id = schedule.id AND r.occurrence_at = schedule.next_run_at
+			AND (r.status = ? OR (r.status = ? AND r.next_attempt_at > ?)))`, schedules.RunProcessing, schedules.RunRetrying, now).
+		Order("next_run_at").
+		Limit(limit).
+		Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var due []schedules.Schedule
+	for _, r := range records {
+		due = append(due, scheduleFromModel(r))
+	}
+	return due, nil
+}
+
+// ClaimOccurrence marks an occurrence as processing so that only the caller executes it. It returns false when the
+// schedule is no longer active on that occurrence, or when the occurrence is already claimed, finished or not yet
+// due for a retry.
+func (d *Database) ClaimOccurrence(ctx context.Context, scheduleID uint, occurrenceAt time.Time, now time.Time) (schedules.Run, bool, error) {
+	var run ScheduleRun
+	claimed := false
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var record Schedule
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).Where("id = ?", scheduleID).Find(&record).Error
+		if err != nil || record.ID == 0 {
+			return err
+		}
+		if record.Status != schedules.StatusActive || record.NextRunAt == nil || !record.NextRunAt.Equal(occurrenceAt) {
+			return nil
+		}
+
+		run = ScheduleRun{
+			ScheduleID:   scheduleID,
+			OccurrenceAt: occurrenceAt,
+			Status:       schedules.RunProcessing,
+			Attempts:     1,
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&run)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			claimed = true
+			return nil
+		}
+
+		// The occurrence has been attempted before, so only a retry that is now due may be claimed
+		if err := tx.Where("schedule_id = ? AND occurrence_at = ?", scheduleID, occurrenceAt).First(&run).Error; err != nil {
+			return err
+		}
+		if run.Status != schedules.RunRetrying || run.NextAttemptAt == nil || run.NextAttemptAt.After(now) {
+			return nil
+		}
+		run.Status = schedules.RunProcessing
+		run.Attempts++
+		run.NextAttemptAt = nil
+		claimed = true
+		return tx.Save(&run).Error
+	})
+	if err != nil {
+		return schedules.Run{}, false, err
+	}
+	return scheduleRunFromModel(run), claimed, nil
+}
+
+// FinishRun records the outcome of a claimed run. A completed or failed run moves its schedule on to the next
+// occurrence, while a retrying run keeps the schedule on the same one.
+func (d *Database) FinishRun(ctx context.Context, run schedules.Run) (schedules.Schedule, error) {
+	var record Schedule
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", run.ScheduleID).First(&record).Error; err != nil {
+			return err
+		}
+
+		errorText := run.Error
+		if len(errorText) > 255 {
+			errorText = errorText[:255]
+		}
+		err := tx.Model(&ScheduleRun{}).Where("id = ?", run.ID).Updates(map[string]interface{}{
+			"status":          run.Status,
+			"attempts":        run.Attempts,
+			"next_attempt_at": run.NextAttemptAt,
+			"transaction_id":  run.TransactionID,
+			"error":           errorText,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if run.Status == schedules.RunRetrying || record.NextRunAt == nil || !record.NextRunAt.Equal(run.OccurrenceAt) {
+			return nil
+		}
+		schedule := scheduleFromModel(record)
+		schedules.Advance(&schedule)
+		applySchedule(&record, schedule)
+		return tx.Save(&record).Error
+	})
+	if err != nil {
+		return schedules.Schedule{}, err
+	}
+	return scheduleFromModel(record), nil
+}
+
+func (d *Database) GetScheduleRuns(ctx context.Context, scheduleID uint) ([]schedules.Run, error) {
+	var records []ScheduleRun
+	if err := d.Client.WithContext(ctx).Where("schedule_id = ?", scheduleID).Order("occurrence_at desc").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	var runs []schedules.Run
+	for _, r := range records {
+		runs = append(runs, scheduleRunFromModel(r))
+	}
+	return runs, nil
+}
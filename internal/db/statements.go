@@ -0,0 +1,100 @@
+package db
+
+import (
+	"PayWalletEngine/internal/fees"
+	"PayWalletEngine/internal/statements"
+	"context"
+	"database/sql"
+	"gorm.io/gorm"
+	"math"
+	"time"
+)
+
+// GetStatement builds an account's statement for [from, to) from a consistent snapshot. The opening balance is the
+// current balance less everything that moved since from. Each line shows the balance recorded on its transaction, or,
+// for transactions recorded before balances were, the running balance reconstructed from the opening balance.
+func (d *Database) GetStatement(ctx context.Context, accountID uint, from time.Time, to time.Time) (statements.Statement, error) {
+	var statement statements.Statement
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var account Account
+		if err := tx.Where("id = ?", accountID).First(&account).Error; err != nil {
+			return err
+		}
+
+		var sinceFrom struct {
+			Credits float64
+			Debits  float64
+		}
+		err := tx.Model(&Transactions{}).
+			Select("COALESCE(SUM(CASE WHEN receiver_account_number = ? THEN amount ELSE 0 END), 0) AS credits, "+
+				"COALESCE(SUM(CASE WHEN sender_account_number = ? THEN amount ELSE 0 END), 0) AS debits",
+				account.AccountNumber, account.AccountNumber).
+			Where("(sender_account_number = ? OR receiver_account_number = ?) AND status = ? AND created_at >= ?",
+				account.AccountNumber, account.AccountNumber, "Completed", from).
+			Scan(&sinceFrom).Error
+		if err != nil {
+			return err
+		}
+
+		var rows []Transactions
+		err = tx.Where("(sender_account_number = ? OR receiver_account_number = ?) AND status = ? AND created_at >= ? AND created_at < ?",
+			account.AccountNumber, account.AccountNumber, "Completed", from, to).
+			Order("created_at asc, transaction_id asc").
+			Find(&rows).Error
+		if err != nil {
+			return err
+		}
+
+		statement = statements.Statement{
+			AccountID:      account.ID,
+			AccountNumber:  account.AccountNumber,
+			AccountType:    account.AccountType,
+			Nickname:       account.Nickname,
+			Currency:       fees.Currency(),
+			From:           from,
+			To:             to,
+			OpeningBalance: math.Round((account.Balance-sinceFrom.Credits+sinceFrom.Debits)*100) / 100,
+			Lines:          []statements.Line{},
+			GeneratedAt:    time.Now(),
+		}
+
+		running := statement.OpeningBalance
+		for _, t := range rows {
+			line := statements.Line{
+				TransactionID: t.TransactionID,
+				Date:          t.CreatedAt,
+				Reference:     t.Reference,
+				Type:          t.Type,
+				Description:   t.Description,
+			}
+			recorded := t.ReceiverBalanceAfter
+			if t.ReceiverAccountNumber == account.AccountNumber {
+				line.Credit = t.Amount
+				line.Counterparty = t.SenderAccountNumber
+				statement.TotalCredits += t.Amount
+				running += t.Amount
+			} else {
+				line.Debit = t.Amount
+				line.Counterparty = t.ReceiverAccountNumber
+				statement.TotalDebits += t.Amount
+				running -= t.Amount
+				recorded = t.SenderBalanceAfter
+			}
+			if recorded != nil {
+				running = *recorded
+			}
+			running = math.Round(running*100) / 100
+			line.BalanceAfter = running
+			statement.Lines = append(statement.Lines, line)
+		}
+
+		statement.TotalCredits = math.Round(statement.TotalCredits*100) / 100
+		statement.TotalDebits = math.Round(statement.TotalDebits*100) / 100
+		statement.ClosingBalance = math.Round((statement.OpeningBalance+statement.TotalCredits-statement.TotalDebits)*100) / 100
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return statements.Statement{}, err
+	}
+	return statement, nil
+}
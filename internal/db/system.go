@@ -0,0 +1,46 @@
+package db
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+)
+
+// EnsureSystemAccounts creates any missing system account. System accounts have no user and are found by nickname.
+func (d *Database) EnsureSystemAccounts(ctx context.Context) error {
+	for _, name := range accounts.SystemAccounts {
+		err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var count int64
+			err := tx.Model(&Account{}).Where("user_id = 0 AND account_type = ? AND nickname = ?", accounts.TypeSystem, name).Count(&count).Error
+			if err != nil || count > 0 {
+				return err
+			}
+			account := Account{
+				AccountType: accounts.TypeSystem,
+				Nickname:    name,
+				Status:      accounts.StatusActive,
+			}
+			if err := d.insertAccount(tx, ctx, &account); err != nil {
+				return err
+			}
+			log.Printf("Created %s system account %d", name, account.AccountNumber)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("creating %s system account: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// systemAccountNumber looks up the account number of a named system account
+func (d *Database) systemAccountNumber(tx *gorm.DB, ctx context.Context, name string) (int64, error) {
+	var account Account
+	err := tx.WithContext(ctx).Where("user_id = 0 AND account_type = ? AND nickname = ?", accounts.TypeSystem, name).First(&account).Error
+	if err != nil {
+		return 0, fmt.Errorf("%s system account: %w", name, err)
+	}
+	return account.AccountNumber, nil
+}
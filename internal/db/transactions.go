@@ -4,27 +4,62 @@ import (
 	"PayWalletEngine/internal/accounts"
 	"PayWalletEngine/internal/transactions"
 	"PayWalletEngine/internal/users"
+	"PayWalletEngine/internal/webhooks"
 	"context"
+	"fmt"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"strings"
 	"time"
 )
 
 type Transactions struct {
-	TransactionID         uuid.UUID `gorm:"primarykey;autoIncrement"`
-	Amount                float64   `gorm:"type:decimal(10,2);not null"`
-	PaymentMethod         string    `gorm:"type:varchar(50);not null"`
-	Type                  string    `gorm:"type:varchar(50);not null"`
-	Status                string    `gorm:"type:varchar(50);not null"`
-	Description           string    `gorm:"type:varchar(255)"`
-	Reference             string    `gorm:"type:varchar(100);uniqueIndex"`
-	SenderAccountNumber   int64     `gorm:"type:bigint;column:sender_account_number"`
-	ReceiverAccountNumber int64     `gorm:"type:bigint;column:receiver_account_number"`
-	CreatedAt             time.Time
+	TransactionID         uuid.UUID  `gorm:"primarykey;autoIncrement"`
+	Amount                float64    `gorm:"type:decimal(10,2);not null;index:idx_transactions_sender_amount,priority:2;index:idx_transactions_receiver_amount,priority:2"`
+	PaymentMethod         string     `gorm:"type:varchar(50);not null"`
+	Type                  string     `gorm:"type:varchar(50);not null;index"`
+	Status                string     `gorm:"type:varchar(50);not null;index"`
+	Description           string     `gorm:"type:varchar(255)"`
+	Reference             string     `gorm:"type:varchar(100);uniqueIndex"`
+	SenderAccountNumber   int64      `gorm:"type:bigint;column:sender_account_number;index:idx_transactions_sender_created,priority:1;index:idx_transactions_sender_amount,priority:1"`
+	ReceiverAccountNumber int64      `gorm:"type:bigint;column:receiver_account_number;index:idx_transactions_receiver_created,priority:1;index:idx_transactions_receiver_amount,priority:1"`
+	BeneficiaryID         *uint      `gorm:"index;column:beneficiary_id"`
+	FeeFor                *uuid.UUID `gorm:"type:uuid;index"`
+	FeeScheduleID         *uint
+	EscrowID              *uint     `gorm:"index"`
+	DisputeID             *uint     `gorm:"index"`
+	SenderBalanceAfter    *float64  `gorm:"type:decimal(12,2)"`
+	ReceiverBalanceAfter  *float64  `gorm:"type:decimal(12,2)"`
+	CreatedAt             time.Time `gorm:"index:idx_transactions_sender_created,priority:2;index:idx_transactions_receiver_created,priority:2"`
 	UpdatedAt             time.Time
 	DeletedAt             gorm.DeletedAt `gorm:"index"`
 }
 
+// transactionFromModel maps a stored transaction to the transactions domain type
+func transactionFromModel(t Transactions) transactions.Transactions {
+	return transactions.Transactions{
+		SenderAccountNumber:   t.SenderAccountNumber,
+		ReceiverAccountNumber: t.ReceiverAccountNumber,
+		Amount:                t.Amount,
+		Type:                  t.Type,
+		PaymentMethod:         t.PaymentMethod,
+		Status:                t.Status,
+		Description:           t.Description,
+		Reference:             t.Reference,
+		TransactionID:         t.TransactionID,
+		BeneficiaryID:         t.BeneficiaryID,
+		FeeFor:                t.FeeFor,
+		FeeScheduleID:         t.FeeScheduleID,
+		EscrowID:              t.EscrowID,
+		DisputeID:             t.DisputeID,
+		CreatedAt:             t.CreatedAt,
+		SenderBalanceAfter:    t.SenderBalanceAfter,
+		ReceiverBalanceAfter:  t.ReceiverBalanceAfter,
+	}
+}
+
 func (d *Database) GetUserAccountAndTransactionByTransactionID(ctx context.Context, transactionID string) (*users.User, *accounts.Account, *transactions.Transactions, error) {
 	var txn Transactions
 
@@ -45,29 +80,15 @@ func (d *Database) GetUserAccountAndTransactionByTransactionID(ctx context.Conte
 	if err != nil {
 		return nil, nil, nil, err
 	}
+	account := accountFromModel(acct)
+	transaction := transactionFromModel(txn)
 
 	return &users.User{
-			Username: usr.Username,
-			Email:    usr.Email,
-			Password: usr.Password,
-			IsActive: false,
-		}, &accounts.Account{
-			ID:            acct.ID,
-			AccountNumber: acct.AccountNumber,
-			AccountType:   acct.AccountType,
-			Balance:       acct.Balance,
-			UserID:        acct.UserID,
-		}, &transactions.Transactions{
-			SenderAccountNumber:   txn.SenderAccountNumber,
-			ReceiverAccountNumber: txn.ReceiverAccountNumber,
-			Amount:                txn.Amount,
-			Type:                  txn.Type,
-			PaymentMethod:         txn.PaymentMethod,
-			Status:                txn.Status,
-			Description:           txn.Description,
-			Reference:             txn.Reference,
-			TransactionID:         txn.TransactionID,
-		}, nil
+		Username: usr.Username,
+		Email:    usr.Email,
+		Password: usr.Password,
+		IsActive: false,
+	}, &account, &transaction, nil
 }
 
 func (d *Database) GetAccountandTransactionByTransactionID(ctx context.Context, transactionID string) (*accounts.Account, *transactions.Transactions, error) {
@@ -82,24 +103,10 @@ func (d *Database) GetAccountandTransactionByTransactionID(ctx context.Context,
 	if err != nil {
 		return nil, nil, err
 	}
+	account := accountFromModel(acct)
+	transaction := transactionFromModel(txn)
 
-	return &accounts.Account{
-			ID:            acct.ID,
-			AccountNumber: acct.AccountNumber,
-			AccountType:   acct.AccountType,
-			Balance:       acct.Balance,
-			UserID:        acct.UserID,
-		}, &transactions.Transactions{
-			SenderAccountNumber:   txn.SenderAccountNumber,
-			ReceiverAccountNumber: txn.ReceiverAccountNumber,
-			Amount:                txn.Amount,
-			Type:                  txn.Type,
-			PaymentMethod:         txn.PaymentMethod,
-			Status:                txn.Status,
-			Description:           txn.Description,
-			Reference:             txn.Reference,
-			TransactionID:         txn.TransactionID, // Assuming TransactionID is a field in your Transactions struct
-		}, nil
+	return &account, &transaction, nil
 }
 
 // GetTransactionByReference retrieves a transaction by its reference
@@ -109,44 +116,169 @@ func (d *Database) GetTransactionByReference(ctx context.Context, reference stri
 	if err != nil {
 		return nil, err
 	}
-	return &transactions.Transactions{
-		SenderAccountNumber:   t.SenderAccountNumber,
-		ReceiverAccountNumber: t.ReceiverAccountNumber,
-		Amount:                t.Amount,
-		Type:                  t.Type,
-		PaymentMethod:         t.PaymentMethod,
-		Status:                t.Status,
-		Description:           t.Description,
-		Reference:             t.Reference,
-		TransactionID:         t.TransactionID,
-	}, nil
+	transaction := transactionFromModel(t)
+	if transaction.Fees, err = d.getFeeItems(d.Client.WithContext(ctx), t.TransactionID); err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+// escapeLike escapes the LIKE wildcards in a search term so that it is matched literally
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+}
+
+// historyOrder returns the ORDER BY clause and the keyset condition that continues after a cursor for a sort order
+func historyOrder(sort string, cursor *transactions.Cursor) (string, *clause.Expr) {
+	column, direction, comparison := "created_at", "DESC", "<"
+	switch sort {
+	case transactions.SortOldest:
+		direction, comparison = "ASC", ">"
+	case transactions.SortLargest:
+		column = "amount"
+	case transactions.SortSmallest:
+		column, direction, comparison = "amount", "ASC", ">"
+	}
+	order := fmt.Sprintf("%s %s, transaction_id %s", column, direction, direction)
+	if cursor == nil {
+		return order, nil
+	}
+	var value interface{} = cursor.CreatedAt
+	if column == "amount" {
+		value = cursor.Amount
+	}
+	after := gorm.Expr(fmt.Sprintf("(%s, transaction_id) %s (?, ?)", column, comparison), value, cursor.TransactionID)
+	return order, &after
 }
 
-// GetTransactionsFromAccount retrieves the transactions a specific account made to the database
-func (d *Database) GetTransactionsFromAccount(ctx context.Context, accountNumber int64) ([]transactions.Transactions, error) {
+// GetTransactionHistory reads one page of the transactions an account sent or received. It fetches one row more
+// than the page holds to find out whether there is a next page.
+func (d *Database) GetTransactionHistory(ctx context.Context, query transactions.HistoryQuery) (transactions.HistoryPage, error) {
+	accountNumber := query.AccountNumber
+	db := d.Client.WithContext(ctx).Model(&Transactions{})
+
+	switch query.Direction {
+	case transactions.DirectionIncoming:
+		db = db.Where("receiver_account_number = ?", accountNumber)
+	case transactions.DirectionOutgoing:
+		db = db.Where("sender_account_number = ?", accountNumber)
+	default:
+		db = db.Where(d.Client.Where("sender_account_number = ?", accountNumber).Or("receiver_account_number = ?", accountNumber))
+	}
+	if query.Counterparty != 0 {
+		db = db.Where(d.Client.
+			Where("sender_account_number = ? AND receiver_account_number = ?", accountNumber, query.Counterparty).
+			Or("sender_account_number = ? AND receiver_account_number = ?", query.Counterparty, accountNumber))
+	}
+	if query.From != nil {
+		db = db.Where("created_at >= ?", *query.From)
+	}
+	if query.To != nil {
+		db = db.Where("created_at < ?", *query.To)
+	}
+	if query.Type != "" {
+		db = db.Where("type = ?", query.Type)
+	}
+	if query.Status != "" {
+		db = db.Where("status = ?", query.Status)
+	}
+	if query.MinAmount != nil {
+		db = db.Where("amount >= ?", *query.MinAmount)
+	}
+	if query.MaxAmount != nil {
+		db = db.Where("amount <= ?", *query.MaxAmount)
+	}
+	if query.Search != "" {
+		db = db.Where("description ILIKE ?", "%"+escapeLike(query.Search)+"%")
+	}
+
+	order, after := historyOrder(query.Sort, query.Cursor)
+	if after != nil {
+		db = db.Where(*after)
+	}
+
 	var t []Transactions
-	err := d.Client.WithContext(ctx).Where("sender_account_number = ?", accountNumber).Or("receiver_account_number = ?", accountNumber).Find(&t).Error
-	if err != nil {
-		return nil, err
+	if err := db.Order(order).Limit(query.Limit + 1).Find(&t).Error; err != nil {
+		return transactions.HistoryPage{}, err
 	}
-	var transactionsList []transactions.Transactions
-	for _, transaction := range t {
-		transactionsList = append(transactionsList, transactions.Transactions{
-			SenderAccountNumber:   transaction.SenderAccountNumber,
-			ReceiverAccountNumber: transaction.ReceiverAccountNumber,
-			Amount:                transaction.Amount,
-			Type:                  transaction.Type,
-			PaymentMethod:         transaction.PaymentMethod,
-			Status:                transaction.Status,
-			Description:           transaction.Description,
-			Reference:             transaction.Reference,
-			TransactionID:         transaction.TransactionID,
+	page := transactions.HistoryPage{Transactions: []transactions.Transactions{}}
+	if len(t) > query.Limit {
+		t = t[:query.Limit]
+		last := t[len(t)-1]
+		page.NextCursor = transactions.EncodeCursor(transactions.Cursor{
+			Sort:          query.Sort,
+			CreatedAt:     last.CreatedAt,
+			Amount:        last.Amount,
+			TransactionID: last.TransactionID,
 		})
 	}
-	return transactionsList, nil
+
+	// Beneficiary nicknames belong to the sender, so they are only shown on the sender's side of a transfer
+	var beneficiaryIDs []uint
+	for _, transaction := range t {
+		if transaction.BeneficiaryID != nil && transaction.SenderAccountNumber == accountNumber {
+			beneficiaryIDs = append(beneficiaryIDs, *transaction.BeneficiaryID)
+		}
+	}
+	names := make(map[uint]string)
+	if len(beneficiaryIDs) > 0 {
+		var saved []Beneficiary
+		if err := d.Client.WithContext(ctx).Unscoped().Where("id IN ?", beneficiaryIDs).Find(&saved).Error; err != nil {
+			return transactions.HistoryPage{}, err
+		}
+		for _, b := range saved {
+			names[b.ID] = b.Nickname
+		}
+	}
+
+	for _, transaction := range t {
+		item := transactionFromModel(transaction)
+		if transaction.BeneficiaryID != nil && transaction.SenderAccountNumber == accountNumber {
+			item.BeneficiaryName = names[*transaction.BeneficiaryID]
+		} else {
+			item.BeneficiaryID = nil
+		}
+		item.Direction, item.BalanceAfter = transactions.DirectionIncoming, transaction.ReceiverBalanceAfter
+		if transaction.SenderAccountNumber == accountNumber {
+			item.Direction, item.BalanceAfter = transactions.DirectionOutgoing, transaction.SenderBalanceAfter
+		}
+		page.Transactions = append(page.Transactions, item)
+	}
+	return page, nil
 }
 
+// createSearchIndexes adds a trigram index for the description search of the transaction history. It needs the
+// pg_trgm extension; without it the search still works, only slower.
+func (d *Database) createSearchIndexes() {
+	if err := d.Client.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		log.Printf("pg_trgm is not available, transaction search will not be indexed: %v", err)
+		return
+	}
+	err := d.Client.Exec("CREATE INDEX IF NOT EXISTS idx_transactions_description_trgm ON transactions USING gin (description gin_trgm_ops)").Error
+	if err != nil {
+		log.Printf("Error creating the transaction search index: %v", err)
+	}
+}
+
+// CreditAccount credits an account from outside. A failure is announced to webhook subscribers once the database
+// transaction has been rolled back; completion is announced by the posting itself.
 func (d *Database) CreditAccount(ctx context.Context, receiverAccountNumber int64, amount float64, description string, paymentMethod string) (transactions.Transactions, error) {
+	t, err := d.creditAccount(ctx, receiverAccountNumber, amount, description, paymentMethod)
+	if err != nil {
+		d.transactionFailed(ctx, webhooks.FailedTransaction{
+			ReceiverAccountNumber: receiverAccountNumber,
+			Amount:                amount,
+			Type:                  "Credit",
+			PaymentMethod:         paymentMethod,
+			Description:           description,
+			Error:                 err.Error(),
+		})
+		return t, err
+	}
+	return t, nil
+}
+
+func (d *Database) creditAccount(ctx context.Context, receiverAccountNumber int64, amount float64, description string, paymentMethod string) (transactions.Transactions, error) {
 	reference, err := transactions.GenerateTransactionRef()
 	if err != nil {
 		return transactions.Transactions{}, err
@@ -172,6 +304,7 @@ func (d *Database) CreditAccount(ctx context.Context, receiverAccountNumber int6
 		Description:           description,
 		Reference:             reference,
 		TransactionID:         uuid.New(),
+		ReceiverBalanceAfter:  &receiverAccount.Balance,
 	}
 
 	if err := tx.WithContext(ctx).Create(&t).Error; err != nil {
@@ -183,6 +316,17 @@ func (d *Database) CreditAccount(ctx context.Context, receiverAccountNumber int6
 		tx.Rollback()
 		return transactions.Transactions{}, err
 	}
+	t.Status = "Completed"
+
+	if err := d.chargeFees(tx, ctx, &t, receiverAccount); err != nil {
+		tx.Rollback()
+		return transactions.Transactions{}, err
+	}
+
+	if err := d.transactionPosted(tx, ctx, t); err != nil {
+		tx.Rollback()
+		return transactions.Transactions{}, err
+	}
 
 	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
@@ -192,7 +336,25 @@ func (d *Database) CreditAccount(ctx context.Context, receiverAccountNumber int6
 	return t, nil
 }
 
+// DebitAccount debits an account to outside. A failure is announced to webhook subscribers once the database
+// transaction has been rolled back; completion is announced by the posting itself.
 func (d *Database) DebitAccount(ctx context.Context, senderAccountNumber int64, amount float64, description string, paymentMethod string) (transactions.Transactions, error) {
+	t, err := d.debitAccount(ctx, senderAccountNumber, amount, description, paymentMethod)
+	if err != nil {
+		d.transactionFailed(ctx, webhooks.FailedTransaction{
+			SenderAccountNumber: senderAccountNumber,
+			Amount:              amount,
+			Type:                "Debit",
+			PaymentMethod:       paymentMethod,
+			Description:         description,
+			Error:               err.Error(),
+		})
+		return t, err
+	}
+	return t, nil
+}
+
+func (d *Database) debitAccount(ctx context.Context, senderAccountNumber int64, amount float64, description string, paymentMethod string) (transactions.Transactions, error) {
 	reference, err := transactions.GenerateTransactionRef()
 	if err != nil {
 		return transactions.Transactions{}, err
@@ -220,6 +382,7 @@ func (d *Database) DebitAccount(ctx context.Context, senderAccountNumber int64,
 		Description:         description,
 		Reference:           reference,
 		TransactionID:       uuid.New(),
+		SenderBalanceAfter:  &senderAccount.Balance,
 	}
 
 	if err := tx.WithContext(ctx).Create(&t).Error; err != nil {
@@ -231,6 +394,17 @@ func (d *Database) DebitAccount(ctx context.Context, senderAccountNumber int64,
 		tx.Rollback()
 		return transactions.Transactions{}, err
 	}
+	t.Status = "Completed"
+
+	if err := d.chargeFees(tx, ctx, &t, senderAccount); err != nil {
+		tx.Rollback()
+		return transactions.Transactions{}, err
+	}
+
+	if err := d.transactionPosted(tx, ctx, t); err != nil {
+		tx.Rollback()
+		return transactions.Transactions{}, err
+	}
 
 	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
@@ -240,12 +414,26 @@ func (d *Database) DebitAccount(ctx context.Context, senderAccountNumber int64,
 	return t, nil
 }
 
+// TransferFunds moves funds between two accounts. Webhook subscribers are told about the transfer only once its
+// database transaction has committed, or about its failure once it has been rolled back.
 func (d *Database) TransferFunds(ctx context.Context, senderAccountNumber int64, receiverAccountNumber int64, amount float64, description string, paymentMethod string) (transactions.Transactions, error) {
-	reference, err := transactions.GenerateTransactionRef()
+	t, err := d.transferFunds(ctx, senderAccountNumber, receiverAccountNumber, amount, description, paymentMethod)
 	if err != nil {
-		return transactions.Transactions{}, err
+		d.transactionFailed(ctx, webhooks.FailedTransaction{
+			SenderAccountNumber:   senderAccountNumber,
+			ReceiverAccountNumber: receiverAccountNumber,
+			Amount:                amount,
+			Type:                  "Transfer",
+			PaymentMethod:         paymentMethod,
+			Description:           description,
+			Error:                 err.Error(),
+		})
+		return t, err
 	}
+	return t, nil
+}
 
+func (d *Database) transferFunds(ctx context.Context, senderAccountNumber int64, receiverAccountNumber int64, amount float64, description string, paymentMethod string) (transactions.Transactions, error) {
 	tx := d.Client.Begin()
 	defer func() {
 		if r := recover(); r != nil {
@@ -253,44 +441,94 @@ func (d *Database) TransferFunds(ctx context.Context, senderAccountNumber int64,
 		}
 	}()
 
-	senderAccount, err := d.debitAccountHelper(tx, ctx, senderAccountNumber, amount)
+	t, err := d.transferInTx(tx, ctx, transactions.Transactions{
+		SenderAccountNumber:   senderAccountNumber,
+		ReceiverAccountNumber: receiverAccountNumber,
+		Amount:                amount,
+		PaymentMethod:         paymentMethod,
+		Description:           description,
+	})
 	if err != nil {
 		tx.Rollback()
 		return transactions.Transactions{}, err
 	}
 
-	receiverAccount, err := d.creditAccountHelper(tx, ctx, receiverAccountNumber, amount)
-	if err != nil {
+	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
 		return transactions.Transactions{}, err
 	}
 
-	t := transactions.Transactions{
-		SenderAccountNumber:   senderAccount.AccountNumber,
-		ReceiverAccountNumber: receiverAccount.AccountNumber,
-		Amount:                amount,
-		PaymentMethod:         paymentMethod,
-		Status:                "Pending",
-		Type:                  "Transfer",
-		Description:           description,
-		Reference:             reference,
-		TransactionID:         uuid.New(),
+	return t, nil
+}
+
+// transferInTx debits the sender, credits the receiver and records and announces the completed transfer inside an
+// open transaction. The caller provides the accounts, amount, description, payment method and any optional links.
+func (d *Database) transferInTx(tx *gorm.DB, ctx context.Context, t transactions.Transactions) (transactions.Transactions, error) {
+	reference, err := transactions.GenerateTransactionRef()
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+
+	if err := lockAccounts(tx, ctx, t.SenderAccountNumber, t.ReceiverAccountNumber); err != nil {
+		return transactions.Transactions{}, err
+	}
+
+	senderAccount, err := d.debitAccountHelper(tx, ctx, t.SenderAccountNumber, t.Amount)
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+
+	receiverAccount, err := d.creditAccountHelper(tx, ctx, t.ReceiverAccountNumber, t.Amount)
+	if err != nil {
+		return transactions.Transactions{}, err
 	}
 
+	t.SenderAccountNumber = senderAccount.AccountNumber
+	t.ReceiverAccountNumber = receiverAccount.AccountNumber
+	t.Status = "Pending"
+	t.Type = "Transfer"
+	t.Reference = reference
+	t.TransactionID = uuid.New()
+	t.SenderBalanceAfter = &senderAccount.Balance
+	t.ReceiverBalanceAfter = &receiverAccount.Balance
+
 	if err := tx.WithContext(ctx).Create(&t).Error; err != nil {
-		tx.Rollback()
 		return transactions.Transactions{}, err
 	}
 
 	if err := tx.WithContext(ctx).Model(&transactions.Transactions{}).Where("transaction_id = ?", t.TransactionID).Update("Status", "Completed").Error; err != nil {
-		tx.Rollback()
 		return transactions.Transactions{}, err
 	}
+	t.Status = "Completed"
 
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
+	if err := d.chargeFees(tx, ctx, &t, senderAccount); err != nil {
+		return transactions.Transactions{}, err
+	}
+
+	if err := d.transactionPosted(tx, ctx, t); err != nil {
 		return transactions.Transactions{}, err
 	}
 
 	return t, nil
 }
+
+// TransferBetweenOwnAccounts moves funds instantly between two wallets held by the same user. These transfers
+// carry no fee and are recorded with the "internal" payment method.
+func (d *Database) TransferBetweenOwnAccounts(ctx context.Context, userID uint, fromAccountNumber int64, toAccountNumber int64, amount float64, description string) (transactions.Transactions, error) {
+	if fromAccountNumber == toAccountNumber {
+		return transactions.Transactions{}, fmt.Errorf("cannot transfer between the same wallet")
+	}
+
+	var owned int64
+	err := d.Client.WithContext(ctx).Model(&Account{}).
+		Where("user_id = ? AND account_number IN ?", userID, []int64{fromAccountNumber, toAccountNumber}).
+		Count(&owned).Error
+	if err != nil {
+		return transactions.Transactions{}, err
+	}
+	if owned != 2 {
+		return transactions.Transactions{}, transactions.ErrNotOwnAccounts
+	}
+
+	return d.TransferFunds(ctx, fromAccountNumber, toAccountNumber, amount, description, transactions.PaymentMethodInternal)
+}
@@ -1,12 +1,16 @@
 package db
 
 import (
+	"PayWalletEngine/internal/audit"
+	"PayWalletEngine/internal/events"
 	"PayWalletEngine/internal/users"
+	"PayWalletEngine/internal/webhooks"
 	"context"
 	"errors"
 	"fmt"
 	"gorm.io/gorm"
 	"log"
+	"time"
 )
 
 type User struct {
@@ -15,6 +19,7 @@ type User struct {
 	Email    string `gorm:"unique;not null"`
 	Password string `gorm:"not null"`
 	IsActive bool   `gorm:"not null"`
+	ErasedAt *time.Time
 }
 
 func (d *Database) CreateUser(ctx context.Context, user *users.User) error {
@@ -25,10 +30,20 @@ func (d *Database) CreateUser(ctx context.Context, user *users.User) error {
 		IsActive: false,
 	}
 
-	if err := d.Client.WithContext(ctx).Create(dbUser).Error; err != nil {
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(dbUser).Error; err != nil {
+			return err
+		}
+		return writeOutbox(tx, ctx, events.TypeUserCreated, []string{events.UserKey(dbUser.ID)}, events.UserCreated{UserID: dbUser.ID})
+	})
+	if err != nil {
 		return err
 	}
 
+	if err := d.recordAudit(d.Client, ctx, dbUser.ID, audit.ActionUserCreated, "user registered"); err != nil {
+		log.Println("Error recording audit entry:", err)
+	}
+
 	return nil
 }
 
@@ -106,6 +121,10 @@ func (d *Database) UpdateUser(ctx context.Context, user users.User, id uint) err
 		return err
 	}
 
+	if err := d.recordAudit(d.Client, ctx, id, audit.ActionUserUpdated, "profile details updated"); err != nil {
+		log.Println("Error recording audit entry:", err)
+	}
+
 	return nil
 }
 
@@ -120,6 +139,8 @@ func (d *Database) ChangeUserStatus(ctx context.Context, user users.User, id uin
 		return err
 	}
 
+	wasActive := existingUser.IsActive
+
 	// Create a map of columns and their values that you want to update
 	updateColumns := map[string]interface{}{
 		"IsActive": user.IsActive,
@@ -131,6 +152,14 @@ func (d *Database) ChangeUserStatus(ctx context.Context, user users.User, id uin
 		return err
 	}
 
+	if err := d.recordAudit(d.Client, ctx, id, audit.ActionUserStatusChange, fmt.Sprintf("is_active set to %t", user.IsActive)); err != nil {
+		log.Println("Error recording audit entry:", err)
+	}
+
+	if user.IsActive && !wasActive {
+		d.enqueueWebhookEvent(ctx, webhooks.EventUserActivated, []uint{id}, webhooks.UserActivated{UserID: id})
+	}
+
 	return nil
 }
 
@@ -0,0 +1,488 @@
+package db
+
+import (
+	"PayWalletEngine/internal/events"
+	"PayWalletEngine/internal/transactions"
+	"PayWalletEngine/internal/webhooks"
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"time"
+)
+
+// WebhookEndpoint is a URL a user receives events on. Deleted endpoints are kept so their delivery log can still be
+// read.
+type WebhookEndpoint struct {
+	ID            uint                  `gorm:"primarykey"`
+	UserID        uint                  `gorm:"index;not null"`
+	URL           string                `gorm:"type:varchar(500);not null"`
+	Secret        string                `gorm:"type:varchar(100);not null"`
+	Active        bool                  `gorm:"not null;default:true"`
+	Subscriptions []WebhookSubscription `gorm:"foreignKey:EndpointID"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
+}
+
+// WebhookSubscription is one event type an endpoint receives
+type WebhookSubscription struct {
+	ID         uint   `gorm:"primarykey"`
+	EndpointID uint   `gorm:"not null;uniqueIndex:idx_webhook_subscription"`
+	EventType  string `gorm:"type:varchar(50);not null;uniqueIndex:idx_webhook_subscription;index"`
+}
+
+// WebhookDelivery is one event queued for one endpoint
+type WebhookDelivery struct {
+	ID            uint       `gorm:"primarykey"`
+	EndpointID    uint       `gorm:"not null;index"`
+	EventID       string     `gorm:"type:varchar(36);not null;index"`
+	EventType     string     `gorm:"type:varchar(50);not null"`
+	Payload       string     `gorm:"type:text;not null"`
+	Status        string     `gorm:"type:varchar(20);not null;index"`
+	Attempts      int        `gorm:"not null;default:0"`
+	NextAttemptAt *time.Time `gorm:"index"`
+	LastError     string     `gorm:"type:varchar(255)"`
+	DeliveredAt   *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// WebhookAttempt records one try at sending a delivery
+type WebhookAttempt struct {
+	ID          uint   `gorm:"primarykey"`
+	DeliveryID  uint   `gorm:"not null;index"`
+	Attempt     int    `gorm:"not null"`
+	StatusCode  int    `gorm:"not null;default:0"`
+	Error       string `gorm:"type:varchar(255)"`
+	DurationMs  int64  `gorm:"not null"`
+	AttemptedAt time.Time
+}
+
+// webhookEndpointFromModel maps an endpoint without its secret, which is only shown once on creation
+func webhookEndpointFromModel(e WebhookEndpoint) webhooks.Endpoint {
+	endpoint := webhooks.Endpoint{
+		ID:        e.ID,
+		UserID:    e.UserID,
+		URL:       e.URL,
+		Events:    []string{},
+		Active:    e.Active,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+	}
+	for _, s := range e.Subscriptions {
+		endpoint.Events = append(endpoint.Events, s.EventType)
+	}
+	return endpoint
+}
+
+func webhookDeliveryFromModel(d WebhookDelivery) webhooks.Delivery {
+	return webhooks.Delivery{
+		ID:            d.ID,
+		EndpointID:    d.EndpointID,
+		EventID:       d.EventID,
+		EventType:     d.EventType,
+		Payload:       d.Payload,
+		Status:        d.Status,
+		Attempts:      d.Attempts,
+		NextAttemptAt: d.NextAttemptAt,
+		LastError:     d.LastError,
+		DeliveredAt:   d.DeliveredAt,
+		CreatedAt:     d.CreatedAt,
+		UpdatedAt:     d.UpdatedAt,
+	}
+}
+
+func preloadSubscriptions(db *gorm.DB) *gorm.DB {
+	return db.Order("event_type")
+}
+
+// truncate cuts an error message down to what a varchar(255) column holds
+func truncate(message string) string {
+	if len(message) > 255 {
+		return message[:255]
+	}
+	return message
+}
+
+func subscriptionsFor(events []string) []WebhookSubscription {
+	subscriptions := make([]WebhookSubscription, 0, len(events))
+	for _, event := range events {
+		subscriptions = append(subscriptions, WebhookSubscription{EventType: event})
+	}
+	return subscriptions
+}
+
+func (d *Database) CreateWebhookEndpoint(ctx context.Context, endpoint *webhooks.Endpoint) error {
+	record := WebhookEndpoint{
+		UserID:        endpoint.UserID,
+		URL:           endpoint.URL,
+		Secret:        endpoint.Secret,
+		Active:        endpoint.Active,
+		Subscriptions: subscriptionsFor(endpoint.Events),
+	}
+
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.Where("id = ?", endpoint.UserID).First(&user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	secret := endpoint.Secret
+	*endpoint = webhookEndpointFromModel(record)
+	endpoint.Secret = secret
+	return nil
+}
+
+func (d *Database) GetWebhookEndpoint(ctx context.Context, id uint) (webhooks.Endpoint, error) {
+	var record WebhookEndpoint
+	err := d.Client.WithContext(ctx).Preload("Subscriptions", preloadSubscriptions).Where("id = ?", id).First(&record).Error
+	if err != nil {
+		return webhooks.Endpoint{}, err
+	}
+	return webhookEndpointFromModel(record), nil
+}
+
+func (d *Database) GetWebhookEndpointsByUserID(ctx context.Context, userID uint) ([]webhooks.Endpoint, error) {
+	var records []WebhookEndpoint
+	err := d.Client.WithContext(ctx).Preload("Subscriptions", preloadSubscriptions).Where("user_id = ?", userID).Order("id").Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	list := make([]webhooks.Endpoint, 0, len(records))
+	for _, r := range records {
+		list = append(list, webhookEndpointFromModel(r))
+	}
+	return list, nil
+}
+
+// UpdateWebhookEndpoint changes the URL, the active flag and the subscriptions of an endpoint. The secret and owner
+// stay as they are.
+func (d *Database) UpdateWebhookEndpoint(ctx context.Context, endpoint webhooks.Endpoint) (webhooks.Endpoint, error) {
+	var record WebhookEndpoint
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", endpoint.ID).First(&record).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&record).Updates(map[string]interface{}{
+			"url":    endpoint.URL,
+			"active": endpoint.Active,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("endpoint_id = ?", record.ID).Delete(&WebhookSubscription{}).Error; err != nil {
+			return err
+		}
+		record.Subscriptions = subscriptionsFor(endpoint.Events)
+		for i := range record.Subscriptions {
+			record.Subscriptions[i].EndpointID = record.ID
+		}
+		return tx.Create(&record.Subscriptions).Error
+	})
+	if err != nil {
+		return webhooks.Endpoint{}, err
+	}
+	return webhookEndpointFromModel(record), nil
+}
+
+// DeleteWebhookEndpoint deletes an endpoint and cancels the deliveries it has not received yet
+func (d *Database) DeleteWebhookEndpoint(ctx context.Context, id uint) error {
+	return d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var record WebhookEndpoint
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&record).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&WebhookDelivery{}).
+			Where("endpoint_id = ? AND status = ?", id, webhooks.DeliveryPending).
+			Updates(map[string]interface{}{"status": webhooks.DeliveryCancelled, "next_attempt_at": nil}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&record).Error
+	})
+}
+
+// GetWebhookDeliveries lists an endpoint's latest deliveries, newest first. Deleted endpoints keep their log.
+func (d *Database) GetWebhookDeliveries(ctx context.Context, endpointID uint, status string, limit int) ([]webhooks.Delivery, error) {
+	var endpoint WebhookEndpoint
+	if err := d.Client.WithContext(ctx).Unscoped().Where("id = ?", endpointID).First(&endpoint).Error; err != nil {
+		return nil, err
+	}
+
+	query := d.Client.WithContext(ctx).Where("endpoint_id = ?", endpointID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var records []WebhookDelivery
+	if err := query.Order("created_at desc, id desc").Limit(limit).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	list := make([]webhooks.Delivery, 0, len(records))
+	for _, r := range records {
+		list = append(list, webhookDeliveryFromModel(r))
+	}
+	return list, nil
+}
+
+func (d *Database) GetWebhookDeliveryAttempts(ctx context.Context, deliveryID uint) ([]webhooks.Attempt, error) {
+	var delivery WebhookDelivery
+	if err := d.Client.WithContext(ctx).Where("id = ?", deliveryID).First(&delivery).Error; err != nil {
+		return nil, err
+	}
+
+	var records []WebhookAttempt
+	if err := d.Client.WithContext(ctx).Where("delivery_id = ?", deliveryID).Order("attempted_at, id").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	list := make([]webhooks.Attempt, 0, len(records))
+	for _, r := range records {
+		list = append(list, webhooks.Attempt{
+			ID:          r.ID,
+			DeliveryID:  r.DeliveryID,
+			Attempt:     r.Attempt,
+			StatusCode:  r.StatusCode,
+			Error:       r.Error,
+			DurationMs:  r.DurationMs,
+			AttemptedAt: r.AttemptedAt,
+		})
+	}
+	return list, nil
+}
+
+// ReplayWebhookDelivery moves a dead delivery back to pending with its attempts reset, due now
+func (d *Database) ReplayWebhookDelivery(ctx context.Context, id uint, now time.Time) (webhooks.Delivery, error) {
+	var record WebhookDelivery
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(&record).Error; err != nil {
+			return err
+		}
+		if record.Status != webhooks.DeliveryDead {
+			return webhooks.ErrNotDeadLettered
+		}
+		record.Status = webhooks.DeliveryPending
+		record.Attempts = 0
+		record.NextAttemptAt = &now
+		return tx.Save(&record).Error
+	})
+	if err != nil {
+		return webhooks.Delivery{}, err
+	}
+	return webhookDeliveryFromModel(record), nil
+}
+
+// ReplayDeadWebhookDeliveries moves every dead delivery of an endpoint back to pending, due now
+func (d *Database) ReplayDeadWebhookDeliveries(ctx context.Context, endpointID uint, now time.Time) (int64, error) {
+	var replayed int64
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var endpoint WebhookEndpoint
+		if err := tx.Where("id = ?", endpointID).First(&endpoint).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&WebhookDelivery{}).
+			Where("endpoint_id = ? AND status = ?", endpointID, webhooks.DeliveryDead).
+			Updates(map[string]interface{}{"status": webhooks.DeliveryPending, "attempts": 0, "next_attempt_at": now})
+		replayed = result.RowsAffected
+		return result.Error
+	})
+	return replayed, err
+}
+
+// ClaimDueWebhookDeliveries picks the pending deliveries of active endpoints that are due, oldest first, and hides
+// them from other workers for the lease. Rows another worker has locked are skipped.
+func (d *Database) ClaimDueWebhookDeliveries(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]webhooks.Dispatch, error) {
+	var dispatches []webhooks.Dispatch
+	err := d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var records []WebhookDelivery
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", webhooks.DeliveryPending, now).
+			Where("endpoint_id IN (?)", tx.Model(&WebhookEndpoint{}).Select("id").Where("active")).
+			Order("next_attempt_at, id").
+			Limit(limit).
+			Find(&records).Error
+		if err != nil || len(records) == 0 {
+			return err
+		}
+
+		ids := make([]uint, 0, len(records))
+		endpointIDs := make([]uint, 0, len(records))
+		for _, r := range records {
+			ids = append(ids, r.ID)
+			endpointIDs = append(endpointIDs, r.EndpointID)
+		}
+		if err := tx.Model(&WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error; err != nil {
+			return err
+		}
+
+		var endpoints []WebhookEndpoint
+		if err := tx.Where("id IN ?", endpointIDs).Find(&endpoints).Error; err != nil {
+			return err
+		}
+		byID := make(map[uint]WebhookEndpoint, len(endpoints))
+		for _, e := range endpoints {
+			byID[e.ID] = e
+		}
+		for _, r := range records {
+			endpoint := byID[r.EndpointID]
+			dispatches = append(dispatches, webhooks.Dispatch{
+				Delivery: webhookDeliveryFromModel(r),
+				URL:      endpoint.URL,
+				Secret:   endpoint.Secret,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dispatches, nil
+}
+
+// RecordWebhookAttempt stores the outcome of an attempt. A delivery cancelled or replayed while it was being sent
+// keeps its new state.
+func (d *Database) RecordWebhookAttempt(ctx context.Context, delivery webhooks.Delivery, attempt webhooks.Attempt) error {
+	return d.Client.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&WebhookDelivery{}).
+			Where("id = ? AND status = ?", delivery.ID, webhooks.DeliveryPending).
+			Updates(map[string]interface{}{
+				"status":          delivery.Status,
+				"attempts":        delivery.Attempts,
+				"next_attempt_at": delivery.NextAttemptAt,
+				"last_error":      truncate(delivery.LastError),
+				"delivered_at":    delivery.DeliveredAt,
+			}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&WebhookAttempt{
+			DeliveryID:  attempt.DeliveryID,
+			Attempt:     attempt.Attempt,
+			StatusCode:  attempt.StatusCode,
+			Error:       truncate(attempt.Error),
+			DurationMs:  attempt.DurationMs,
+			AttemptedAt: attempt.AttemptedAt,
+		}).Error
+	})
+}
+
+// enqueueWebhookEvent queues an event for every active endpoint of the given users that subscribes to it. It is
+// called once the change behind the event has been committed, so an event never announces a change that was rolled
+// back. Failing to queue is logged and does not undo the change.
+func (d *Database) enqueueWebhookEvent(ctx context.Context, eventType string, userIDs []uint, data interface{}) {
+	if err := queueWebhookEvent(d.Client, ctx, eventType, userIDs, data); err != nil {
+		log.Printf("Error queueing %s event: %v", eventType, err)
+	}
+}
+
+// queueWebhookEvent queues an event for every active endpoint of the given users that subscribes to it, inside the
+// given transaction. Queued inside the transaction that makes the change, the deliveries only become visible to the
+// dispatcher once it commits, and disappear with it if it rolls back.
+func queueWebhookEvent(tx *gorm.DB, ctx context.Context, eventType string, userIDs []uint, data interface{}) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	var endpointIDs []uint
+	err := tx.WithContext(ctx).Model(&WebhookEndpoint{}).
+		Joins("JOIN webhook_subscription s ON s.endpoint_id = webhook_endpoint.id").
+		Where("webhook_endpoint.user_id IN ? AND webhook_endpoint.active AND s.event_type = ?", userIDs, eventType).
+		Order("webhook_endpoint.id").
+		Pluck("webhook_endpoint.id", &endpointIDs).Error
+	if err != nil || len(endpointIDs) == 0 {
+		return err
+	}
+
+	now := time.Now().UTC()
+	event := webhooks.Event{ID: uuid.New().String(), Type: eventType, CreatedAt: now, Data: data}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	deliveries := make([]WebhookDelivery, 0, len(endpointIDs))
+	for _, id := range endpointIDs {
+		deliveries = append(deliveries, WebhookDelivery{
+			EndpointID:    id,
+			EventID:       event.ID,
+			EventType:     eventType,
+			Payload:       string(payload),
+			Status:        webhooks.DeliveryPending,
+			NextAttemptAt: &now,
+		})
+	}
+	return tx.WithContext(ctx).Create(&deliveries).Error
+}
+
+// accountOwners returns the users holding the given account numbers. Unknown numbers, such as zero for the outside
+// side of a credit or debit, are skipped.
+func accountOwners(tx *gorm.DB, ctx context.Context, accountNumbers ...int64) ([]uint, error) {
+	var userIDs []uint
+	err := tx.WithContext(ctx).Model(&Account{}).
+		Where("account_number IN ? AND user_id <> 0", accountNumbers).
+		Distinct().
+		Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// transactionPosted announces a transaction recorded as completed inside an open transaction: it queues the
+// transaction.completed webhook for the owners of both sides and writes the domain event to the outbox, keyed by the
+// accounts involved. Every posting path calls it once the row is completed, so both are sent for every movement of
+// money, and only once the posting commits.
+func (d *Database) transactionPosted(tx *gorm.DB, ctx context.Context, t transactions.Transactions) error {
+	owners, err := accountOwners(tx, ctx, t.SenderAccountNumber, t.ReceiverAccountNumber)
+	if err != nil {
+		return err
+	}
+	if err := queueWebhookEvent(tx, ctx, webhooks.EventTransactionCompleted, owners, t); err != nil {
+		return err
+	}
+
+	var keys []string
+	for _, number := range []int64{t.SenderAccountNumber, t.ReceiverAccountNumber} {
+		if number != 0 {
+			keys = append(keys, events.AccountKey(number))
+		}
+	}
+	return writeOutbox(tx, ctx, events.TypeTransactionCompleted, keys, t)
+}
+
+// failedTransfer describes a transfer that transferInTx refused, to announce with transactionFailed once its database
+// transaction has been rolled back
+func failedTransfer(t transactions.Transactions, err error) *webhooks.FailedTransaction {
+	return &webhooks.FailedTransaction{
+		SenderAccountNumber:   t.SenderAccountNumber,
+		ReceiverAccountNumber: t.ReceiverAccountNumber,
+		Amount:                t.Amount,
+		Type:                  "Transfer",
+		PaymentMethod:         t.PaymentMethod,
+		Description:           t.Description,
+		Error:                 err.Error(),
+	}
+}
+
+// transactionFailed tells the owners of both sides of a transaction that was rolled back why it failed
+func (d *Database) transactionFailed(ctx context.Context, failed webhooks.FailedTransaction) {
+	owners, err := accountOwners(d.Client, ctx, failed.SenderAccountNumber, failed.ReceiverAccountNumber)
+	if err != nil {
+		log.Printf("Error finding owners of accounts %d and %d: %v", failed.SenderAccountNumber, failed.ReceiverAccountNumber, err)
+		return
+	}
+	d.enqueueWebhookEvent(ctx, webhooks.EventTransactionFailed, owners, failed)
+}
+
+// accountFrozen tells an account's owner that it was frozen
+func (d *Database) accountFrozen(ctx context.Context, a Account, reason string) {
+	d.enqueueWebhookEvent(ctx, webhooks.EventAccountFrozen, []uint{a.UserID}, webhooks.AccountFrozen{
+		AccountID:     a.ID,
+		AccountNumber: a.AccountNumber,
+		UserID:        a.UserID,
+		Reason:        reason,
+	})
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"PayWalletEngine/internal/batches"
+	"PayWalletEngine/internal/beneficiaries"
+	"PayWalletEngine/internal/webhooks"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// subscribeTestEndpoint registers an endpoint of the user for the transaction events
+func subscribeTestEndpoint(t *testing.T, d *Database, userID uint) uint {
+	t.Helper()
+	endpoint := webhooks.Endpoint{
+		UserID: userID,
+		URL:    "https://example.com/hooks",
+		Secret: "whsec_test",
+		Events: []string{webhooks.EventTransactionCompleted, webhooks.EventTransactionFailed},
+		Active: true,
+	}
+	if err := d.CreateWebhookEndpoint(context.Background(), &endpoint); err != nil {
+		t.Fatal(err)
+	}
+	return endpoint.ID
+}
+
+// queuedEvents returns the data of the events of a type queued for an endpoint, oldest first
+func queuedEvents(t *testing.T, d *Database, endpointID uint, eventType string) []map[string]interface{} {
+	t.Helper()
+	var deliveries []WebhookDelivery
+	err := d.Client.Where("endpoint_id = ? AND event_type = ?", endpointID, eventType).Order("id").Find(&deliveries).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data []map[string]interface{}
+	for _, delivery := range deliveries {
+		var event struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(delivery.Payload), &event); err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, event.Data)
+	}
+	return data
+}
+
+func TestBeneficiaryTransferWebhooks(t *testing.T) {
+	d := testDatabase(t)
+	ctx := context.Background()
+
+	payer := createTestUser(t, d)
+	payee := createTestUser(t, d)
+	sender := createTestAccount(t, d, payer, 100)
+	receiver := createTestAccount(t, d, payee, 0)
+	endpointID := subscribeTestEndpoint(t, d, payer)
+
+	beneficiary := beneficiaries.Beneficiary{UserID: payer, Nickname: "Landlord", AccountNumber: receiver.AccountNumber}
+	if err := d.CreateBeneficiary(ctx, &beneficiary); err != nil {
+		t.Fatal(err)
+	}
+
+	txn, err := d.TransferToBeneficiary(ctx, sender.AccountNumber, beneficiary.ID, 40, "Rent", "app transfer", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed := queuedEvents(t, d, endpointID, webhooks.EventTransactionCompleted)
+	if len(completed) != 1 || completed[0]["transaction_id"] != txn.TransactionID.String() {
+		t.Fatalf("expected one transaction.completed event for %s, got %v", txn.TransactionID, completed)
+	}
+
+	if _, err := d.TransferToBeneficiary(ctx, sender.AccountNumber, beneficiary.ID, 500, "Rent", "app transfer", 1000); err == nil {
+		t.Fatal("expected the transfer to fail for lack of funds")
+	}
+	if completed := queuedEvents(t, d, endpointID, webhooks.EventTransactionCompleted); len(completed) != 1 {
+		t.Errorf("a rolled back transfer queued a transaction.completed event: %v", completed)
+	}
+	failed := queuedEvents(t, d, endpointID, webhooks.EventTransactionFailed)
+	if len(failed) != 1 || failed[0]["amount"] != 500.0 {
+		t.Errorf("expected one transaction.failed event for 500, got %v", failed)
+	}
+}
+
+func TestAllOrNothingBatchWebhooks(t *testing.T) {
+	d := testDatabase(t)
+	ctx := context.Background()
+
+	payer := createTestUser(t, d)
+	sender := createTestAccount(t, d, payer, 100)
+	first := createTestAccount(t, d, createTestUser(t, d), 0)
+	second := createTestAccount(t, d, createTestUser(t, d), 0)
+	endpointID := subscribeTestEndpoint(t, d, payer)
+
+	batch := batches.Batch{
+		SenderAccountNumber: sender.AccountNumber,
+		Mode:                batches.ModeAllOrNothing,
+		PaymentMethod:       "batch",
+		Legs: []batches.Leg{
+			{Position: 1, ReceiverAccountNumber: first.AccountNumber, Amount: 60},
+			{Position: 2, ReceiverAccountNumber: second.AccountNumber, Amount: 60},
+		},
+	}
+	if err := d.ExecuteBatch(ctx, &batch); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first leg was posted, then rolled back with the batch, and so was its event
+	if completed := queuedEvents(t, d, endpointID, webhooks.EventTransactionCompleted); len(completed) != 0 {
+		t.Errorf("a rolled back batch queued transaction.completed events: %v", completed)
+	}
+	failed := queuedEvents(t, d, endpointID, webhooks.EventTransactionFailed)
+	if len(failed) != 1 || failed[0]["receiver_account_number"] != float64(second.AccountNumber) {
+		t.Errorf("expected one transaction.failed event for the second leg, got %v", failed)
+	}
+}
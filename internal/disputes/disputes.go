@@ -0,0 +1,295 @@
+package disputes
+
+import (
+	"PayWalletEngine/internal/transactions"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+// PaymentMethodDispute marks provisional credits, reversals and claw-backs posted for a dispute
+const PaymentMethodDispute = "dispute"
+
+// Dispute statuses. Open and under review disputes are active; the others are final.
+const (
+	StatusOpen        = "open"
+	StatusUnderReview = "under_review"
+	StatusWon         = "won"
+	StatusLost        = "lost"
+	StatusWithdrawn   = "withdrawn"
+)
+
+// Reason codes a customer can open a dispute with
+const (
+	ReasonUnauthorized    = "unauthorized"
+	ReasonNotReceived     = "not_received"
+	ReasonNotAsDescribed  = "not_as_described"
+	ReasonDuplicate       = "duplicate"
+	ReasonIncorrectAmount = "incorrect_amount"
+	ReasonOther           = "other"
+)
+
+// Parties that can attach evidence to a dispute
+const (
+	PartyCustomer = "customer"
+	PartyMerchant = "merchant"
+	PartyAgent    = "agent"
+)
+
+var (
+	ErrInvalidDispute    = errors.New("invalid dispute")
+	ErrNotParty          = errors.New("user is not a party to this dispute")
+	ErrNotAgent          = errors.New("user is not a support agent")
+	ErrDisputeExists     = errors.New("transaction has already been disputed")
+	ErrDisputeClosed     = errors.New("dispute is closed")
+	ErrAlreadyResponded  = errors.New("merchant has already responded")
+	ErrDeadlinePassed    = errors.New("dispute deadline has passed")
+	ErrNotDisputable     = errors.New("transaction cannot be disputed")
+	ErrProvisionalCredit = errors.New("provisional credit has already been posted")
+)
+
+// Dispute - a customer's claim against a transfer they sent, worked by support and answered by the merchant that
+// received it
+type Dispute struct {
+	ID                        uint       `json:"id"`
+	TransactionID             uuid.UUID  `json:"transaction_id"`
+	UserID                    uint       `json:"user_id"`
+	AccountNumber             int64      `json:"account_number"`
+	CounterpartyAccountNumber int64      `json:"counterparty_account_number"`
+	Amount                    float64    `json:"amount"`
+	ReasonCode                string     `json:"reason_code"`
+	Description               string     `json:"description"`
+	Status                    string     `json:"status"`
+	Evidence                  []Evidence `json:"evidence"`
+	MerchantResponse          string     `json:"merchant_response,omitempty"`
+	MerchantRespondedAt       *time.Time `json:"merchant_responded_at,omitempty"`
+	ResponseDueAt             time.Time  `json:"response_due_at"`
+	ResolveBy                 time.Time  `json:"resolve_by"`
+	AgentID                   *uint      `json:"agent_id,omitempty"`
+	ResolutionNote            string     `json:"resolution_note,omitempty"`
+	ProvisionalCreditID       *uuid.UUID `json:"provisional_credit_id,omitempty"`
+	SettlementID              *uuid.UUID `json:"settlement_id,omitempty"`
+	CreatedAt                 time.Time  `json:"created_at"`
+	ResolvedAt                *time.Time `json:"resolved_at,omitempty"`
+}
+
+// Evidence - a document attached to a dispute. The file itself is stored elsewhere and referenced by URL.
+type Evidence struct {
+	ID          uint      `json:"id"`
+	UserID      uint      `json:"user_id"`
+	Party       string    `json:"party"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	URL         string    `json:"url"`
+	Note        string    `json:"note"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type DisputeStore interface {
+	CreateDispute(ctx context.Context, dispute *Dispute) error
+	GetDisputeByID(ctx context.Context, disputeID uint) (Dispute, error)
+	GetDisputesByUserID(ctx context.Context, userID uint) ([]Dispute, error)
+	GetDisputesByMerchant(ctx context.Context, userID uint) ([]Dispute, error)
+	GetDisputeQueue(ctx context.Context, status string) ([]Dispute, error)
+	AddDisputeEvidence(ctx context.Context, disputeID uint, evidence Evidence, isAgent bool) (Dispute, error)
+	RespondToDispute(ctx context.Context, disputeID uint, userID uint, response string) (Dispute, error)
+	WithdrawDispute(ctx context.Context, disputeID uint, userID uint) (Dispute, error)
+	ReviewDispute(ctx context.Context, disputeID uint, agentID uint, provisionalCredit bool) (Dispute, error)
+	DecideDispute(ctx context.Context, disputeID uint, agentID *uint, outcome string, note string) (Dispute, error)
+	GetUnansweredDisputes(ctx context.Context, now time.Time) ([]uint, error)
+	GetDisputeTransactions(ctx context.Context, disputeID uint) ([]transactions.Transactions, error)
+}
+
+// DisputeService is the blueprint for the dispute logic
+type DisputeService struct {
+	Store DisputeStore
+}
+
+func NewDisputeService(store DisputeStore) DisputeService {
+	return DisputeService{
+		Store: store,
+	}
+}
+
+// OpenDispute opens a dispute against a completed transfer the customer sent. Without an amount the whole transfer
+// is disputed.
+func (s *DisputeService) OpenDispute(ctx context.Context, dispute *Dispute) error {
+	if err := Validate(*dispute); err != nil {
+		return err
+	}
+	now := time.Now()
+	dispute.Status = StatusOpen
+	dispute.ResponseDueAt = now.AddDate(0, 0, ResponseDays())
+	dispute.ResolveBy = now.AddDate(0, 0, ResolutionDays())
+
+	if err := s.Store.CreateDispute(ctx, dispute); err != nil {
+		log.Printf("Error opening dispute on transaction %v: %v", dispute.TransactionID, err)
+		return err
+	}
+	return nil
+}
+
+func (s *DisputeService) GetDisputeByID(ctx context.Context, disputeID uint) (Dispute, error) {
+	dispute, err := s.Store.GetDisputeByID(ctx, disputeID)
+	if err != nil {
+		log.Printf("Error fetching dispute %v: %v", disputeID, err)
+		return dispute, err
+	}
+	return dispute, nil
+}
+
+// GetDisputesByUserID lists the disputes a customer has opened
+func (s *DisputeService) GetDisputesByUserID(ctx context.Context, userID uint) ([]Dispute, error) {
+	list, err := s.Store.GetDisputesByUserID(ctx, userID)
+	if err != nil {
+		log.Printf("Error fetching disputes of user %v: %v", userID, err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetDisputesByMerchant lists the disputes opened against transfers into accounts the user owns
+func (s *DisputeService) GetDisputesByMerchant(ctx context.Context, userID uint) ([]Dispute, error) {
+	list, err := s.Store.GetDisputesByMerchant(ctx, userID)
+	if err != nil {
+		log.Printf("Error fetching disputes against user %v: %v", userID, err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetDisputeQueue lists the disputes support agents work, those closest to their deadline first. An empty status
+// lists every active dispute.
+func (s *DisputeService) GetDisputeQueue(ctx context.Context, agentID uint, status string) ([]Dispute, error) {
+	if !IsAgent(agentID) {
+		return nil, ErrNotAgent
+	}
+	if status != "" && !validStatus(status) {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidDispute, status)
+	}
+	list, err := s.Store.GetDisputeQueue(ctx, status)
+	if err != nil {
+		log.Printf("Error fetching dispute queue: %v", err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// AddDisputeEvidence attaches a document to an active dispute on behalf of the customer, the merchant or an agent
+func (s *DisputeService) AddDisputeEvidence(ctx context.Context, disputeID uint, evidence Evidence) (Dispute, error) {
+	if err := ValidateEvidence(evidence); err != nil {
+		return Dispute{}, err
+	}
+	dispute, err := s.Store.AddDisputeEvidence(ctx, disputeID, evidence, IsAgent(evidence.UserID))
+	if err != nil {
+		log.Printf("Error adding evidence to dispute %v: %v", disputeID, err)
+		return dispute, err
+	}
+	return dispute, nil
+}
+
+// RespondToDispute records the merchant's answer. The merchant can respond once, before the response deadline.
+func (s *DisputeService) RespondToDispute(ctx context.Context, disputeID uint, userID uint, response string) (Dispute, error) {
+	if response == "" {
+		return Dispute{}, fmt.Errorf("%w: a response is required", ErrInvalidDispute)
+	}
+	dispute, err := s.Store.RespondToDispute(ctx, disputeID, userID, response)
+	if err != nil {
+		log.Printf("Error responding to dispute %v: %v", disputeID, err)
+		return dispute, err
+	}
+	return dispute, nil
+}
+
+// WithdrawDispute closes an active dispute on behalf of the customer. Any provisional credit is taken back.
+func (s *DisputeService) WithdrawDispute(ctx context.Context, disputeID uint, userID uint) (Dispute, error) {
+	dispute, err := s.Store.WithdrawDispute(ctx, disputeID, userID)
+	if err != nil {
+		log.Printf("Error withdrawing dispute %v: %v", disputeID, err)
+		return dispute, err
+	}
+	return dispute, nil
+}
+
+// ReviewDispute assigns a dispute to an agent and, when asked, credits the customer provisionally while it is worked
+func (s *DisputeService) ReviewDispute(ctx context.Context, disputeID uint, agentID uint, provisionalCredit bool) (Dispute, error) {
+	if !IsAgent(agentID) {
+		return Dispute{}, ErrNotAgent
+	}
+	dispute, err := s.Store.ReviewDispute(ctx, disputeID, agentID, provisionalCredit)
+	if err != nil {
+		log.Printf("Error reviewing dispute %v: %v", disputeID, err)
+		return dispute, err
+	}
+	return dispute, nil
+}
+
+// DecideDispute closes an active dispute as won or lost. A won dispute reverses the transfer from the merchant; a
+// lost one takes back any provisional credit.
+func (s *DisputeService) DecideDispute(ctx context.Context, disputeID uint, agentID uint, outcome string, note string) (Dispute, error) {
+	if !IsAgent(agentID) {
+		return Dispute{}, ErrNotAgent
+	}
+	if outcome != StatusWon && outcome != StatusLost {
+		return Dispute{}, fmt.Errorf("%w: outcome must be %s or %s", ErrInvalidDispute, StatusWon, StatusLost)
+	}
+	dispute, err := s.Store.DecideDispute(ctx, disputeID, &agentID, outcome, note)
+	if err != nil {
+		log.Printf("Error deciding dispute %v: %v", disputeID, err)
+		return dispute, err
+	}
+	return dispute, nil
+}
+
+// GetDisputeTransactions lists the provisional credits, reversals and claw-backs posted for a dispute
+func (s *DisputeService) GetDisputeTransactions(ctx context.Context, disputeID uint) ([]transactions.Transactions, error) {
+	txns, err := s.Store.GetDisputeTransactions(ctx, disputeID)
+	if err != nil {
+		log.Printf("Error fetching transactions of dispute %v: %v", disputeID, err)
+		return nil, err
+	}
+	return txns, nil
+}
+
+// RunDeadlines decides disputes the merchant has not answered by the response deadline in the customer's favour,
+// once per interval until the context is cancelled
+func (s *DisputeService) RunDeadlines(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.decideUnanswered(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *DisputeService) decideUnanswered(ctx context.Context, now time.Time) {
+	ids, err := s.Store.GetUnansweredDisputes(ctx, now)
+	if err != nil {
+		log.Printf("Error fetching unanswered disputes: %v", err)
+		return
+	}
+	count := 0
+	for _, id := range ids {
+		_, err := s.Store.DecideDispute(ctx, id, nil, StatusWon, "Merchant did not respond before the deadline")
+		if err != nil {
+			// Disputes closed or answered since they were fetched are skipped
+			if !errors.Is(err, ErrDisputeClosed) && !errors.Is(err, ErrAlreadyResponded) {
+				log.Printf("Error deciding unanswered dispute %v: %v", id, err)
+			}
+			continue
+		}
+		count++
+	}
+	if count > 0 {
+		log.Printf("Decided %d disputes the merchant did not answer", count)
+	}
+}
@@ -0,0 +1,104 @@
+package disputes
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Defaults used when the DISPUTE_* deadlines are unset or invalid
+const (
+	defaultWindowDays     = 120
+	defaultResponseDays   = 10
+	defaultResolutionDays = 45
+)
+
+func envDays(name string, fallback int) int {
+	days, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || days <= 0 {
+		return fallback
+	}
+	return days
+}
+
+// WindowDays returns for how many days after a transfer its sender can dispute it
+func WindowDays() int {
+	return envDays("DISPUTE_WINDOW_DAYS", defaultWindowDays)
+}
+
+// ResponseDays returns how many days the merchant has to respond to a new dispute
+func ResponseDays() int {
+	return envDays("DISPUTE_RESPONSE_DAYS", defaultResponseDays)
+}
+
+// ResolutionDays returns how many days support has to decide a new dispute
+func ResolutionDays() int {
+	return envDays("DISPUTE_RESOLUTION_DAYS", defaultResolutionDays)
+}
+
+// IsAgent reports whether the user is one of the support agents listed in SUPPORT_AGENT_IDS
+func IsAgent(userID uint) bool {
+	if userID == 0 {
+		return false
+	}
+	for _, field := range strings.Split(os.Getenv("SUPPORT_AGENT_IDS"), ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(field), 10, 64)
+		if err == nil && uint(id) == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func validReason(reason string) bool {
+	switch reason {
+	case ReasonUnauthorized, ReasonNotReceived, ReasonNotAsDescribed, ReasonDuplicate, ReasonIncorrectAmount, ReasonOther:
+		return true
+	}
+	return false
+}
+
+func validStatus(status string) bool {
+	switch status {
+	case StatusOpen, StatusUnderReview, StatusWon, StatusLost, StatusWithdrawn:
+		return true
+	}
+	return false
+}
+
+// IsActive reports whether a dispute with the given status can still change
+func IsActive(status string) bool {
+	return status == StatusOpen || status == StatusUnderReview
+}
+
+// Validate checks a new dispute. The disputed amount is checked against the transaction when it is stored.
+func Validate(dispute Dispute) error {
+	if dispute.UserID == 0 {
+		return fmt.Errorf("%w: user_id is required", ErrInvalidDispute)
+	}
+	if !validReason(dispute.ReasonCode) {
+		return fmt.Errorf("%w: unknown reason code %q", ErrInvalidDispute, dispute.ReasonCode)
+	}
+	if dispute.Amount < 0 {
+		return fmt.Errorf("%w: amount cannot be negative", ErrInvalidDispute)
+	}
+	if dispute.ReasonCode == ReasonOther && strings.TrimSpace(dispute.Description) == "" {
+		return fmt.Errorf("%w: a description is required for reason %s", ErrInvalidDispute, ReasonOther)
+	}
+	return nil
+}
+
+// ValidateEvidence checks that an attachment names its file and where it is stored
+func ValidateEvidence(evidence Evidence) error {
+	if evidence.UserID == 0 {
+		return fmt.Errorf("%w: user_id is required", ErrInvalidDispute)
+	}
+	if strings.TrimSpace(evidence.FileName) == "" || strings.TrimSpace(evidence.URL) == "" {
+		return fmt.Errorf("%w: evidence needs a file_name and a url", ErrInvalidDispute)
+	}
+	if !strings.HasPrefix(evidence.URL, "https://") && !strings.HasPrefix(evidence.URL, "http://") {
+		return fmt.Errorf("%w: evidence url must be http or https", ErrInvalidDispute)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package escrows
+
+import (
+	"PayWalletEngine/internal/transactions"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+// PaymentMethodEscrow marks the transfers into and out of the escrow system account
+const PaymentMethodEscrow = "escrow"
+
+// Escrow statuses. A funded escrow releases milestones until nothing is held, which completes it. A disputed escrow
+// is frozen until the arbiter resolves it.
+const (
+	StatusFunded    = "funded"
+	StatusDisputed  = "disputed"
+	StatusCompleted = "completed"
+	StatusResolved  = "resolved"
+)
+
+// Milestone statuses. Milestones still pending when a dispute is resolved are cancelled.
+const (
+	MilestonePending   = "pending"
+	MilestoneReleased  = "released"
+	MilestoneCancelled = "cancelled"
+)
+
+var (
+	ErrInvalidEscrow     = errors.New("invalid escrow")
+	ErrNotParty          = errors.New("user is not allowed to act on this escrow")
+	ErrEscrowDisputed    = errors.New("escrow is disputed")
+	ErrEscrowClosed      = errors.New("escrow is no longer open")
+	ErrMilestoneReleased = errors.New("milestone has already been released")
+)
+
+// Escrow - funds a buyer has put aside for a seller, held by the engine until they are released
+type Escrow struct {
+	ID                  uint        `json:"id"`
+	BuyerUserID         uint        `json:"buyer_user_id"`
+	BuyerAccountNumber  int64       `json:"buyer_account_number"`
+	SellerAccountNumber int64       `json:"seller_account_number"`
+	ArbiterUserID       uint        `json:"arbiter_user_id"`
+	Amount              float64     `json:"amount"`
+	Held                float64     `json:"held"`
+	Description         string      `json:"description"`
+	Status              string      `json:"status"`
+	Milestones          []Milestone `json:"milestones"`
+	AutoReleaseAt       time.Time   `json:"auto_release_at"`
+	DisputedByUserID    *uint       `json:"disputed_by_user_id,omitempty"`
+	DisputeReason       string      `json:"dispute_reason,omitempty"`
+	CreatedAt           time.Time   `json:"created_at"`
+	ClosedAt            *time.Time  `json:"closed_at,omitempty"`
+}
+
+// Milestone - a part of the escrowed amount that is released to the seller on its own
+type Milestone struct {
+	ID            uint       `json:"id"`
+	Name          string     `json:"name"`
+	Amount        float64    `json:"amount"`
+	Status        string     `json:"status"`
+	TransactionID *uuid.UUID `json:"transaction_id,omitempty"`
+	ReleasedAt    *time.Time `json:"released_at,omitempty"`
+}
+
+type EscrowStore interface {
+	CreateEscrow(ctx context.Context, escrow *Escrow) error
+	GetEscrowByID(ctx context.Context, escrowID uint) (Escrow, error)
+	GetEscrowsByUserID(ctx context.Context, userID uint) ([]Escrow, error)
+	ReleaseMilestone(ctx context.Context, escrowID uint, milestoneID uint, userID uint) (Escrow, error)
+	OpenEscrowDispute(ctx context.Context, escrowID uint, userID uint, reason string) (Escrow, error)
+	ResolveEscrowDispute(ctx context.Context, escrowID uint, userID uint, sellerAmount float64) (Escrow, error)
+	AutoReleaseEscrows(ctx context.Context, now time.Time) (int, error)
+	GetEscrowTransactions(ctx context.Context, escrowID uint) ([]transactions.Transactions, error)
+}
+
+// EscrowService is the blueprint for the escrow logic
+type EscrowService struct {
+	Store EscrowStore
+}
+
+func NewEscrowService(store EscrowStore) EscrowService {
+	return EscrowService{
+		Store: store,
+	}
+}
+
+// CreateEscrow moves the amount from the buyer's account into escrow. Without milestones the whole amount is one
+// milestone, and without an auto-release time it is released after AutoReleaseDays.
+func (s *EscrowService) CreateEscrow(ctx context.Context, escrow *Escrow) error {
+	now := time.Now()
+	if escrow.AutoReleaseAt.IsZero() {
+		escrow.AutoReleaseAt = now.AddDate(0, 0, AutoReleaseDays())
+	}
+	if err := Validate(escrow, now); err != nil {
+		return err
+	}
+	escrow.Held = escrow.Amount
+	escrow.Status = StatusFunded
+
+	if err := s.Store.CreateEscrow(ctx, escrow); err != nil {
+		log.Printf("Error creating escrow for user %v: %v", escrow.BuyerUserID, err)
+		return err
+	}
+	return nil
+}
+
+func (s *EscrowService) GetEscrowByID(ctx context.Context, escrowID uint) (Escrow, error) {
+	escrow, err := s.Store.GetEscrowByID(ctx, escrowID)
+	if err != nil {
+		log.Printf("Error fetching escrow %v: %v", escrowID, err)
+		return escrow, err
+	}
+	return escrow, nil
+}
+
+// GetEscrowsByUserID lists the escrows a user takes part in as buyer, seller or arbiter
+func (s *EscrowService) GetEscrowsByUserID(ctx context.Context, userID uint) ([]Escrow, error) {
+	list, err := s.Store.GetEscrowsByUserID(ctx, userID)
+	if err != nil {
+		log.Printf("Error fetching escrows for user %v: %v", userID, err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// ReleaseMilestone pays a milestone to the seller. Only the buyer or the arbiter can release funds.
+func (s *EscrowService) ReleaseMilestone(ctx context.Context, escrowID uint, milestoneID uint, userID uint) (Escrow, error) {
+	escrow, err := s.Store.ReleaseMilestone(ctx, escrowID, milestoneID, userID)
+	if err != nil {
+		log.Printf("Error releasing milestone %v of escrow %v: %v", milestoneID, escrowID, err)
+		return escrow, err
+	}
+	return escrow, nil
+}
+
+// OpenEscrowDispute lets the buyer or the seller freeze the escrow until the arbiter resolves it
+func (s *EscrowService) OpenEscrowDispute(ctx context.Context, escrowID uint, userID uint, reason string) (Escrow, error) {
+	if reason == "" {
+		return Escrow{}, fmt.Errorf("%w: a reason is required", ErrInvalidEscrow)
+	}
+	escrow, err := s.Store.OpenEscrowDispute(ctx, escrowID, userID, reason)
+	if err != nil {
+		log.Printf("Error opening dispute on escrow %v: %v", escrowID, err)
+		return escrow, err
+	}
+	return escrow, nil
+}
+
+// ResolveEscrowDispute lets the arbiter split what is still held: sellerAmount goes to the seller and the rest
+// is refunded to the buyer
+func (s *EscrowService) ResolveEscrowDispute(ctx context.Context, escrowID uint, userID uint, sellerAmount float64) (Escrow, error) {
+	if sellerAmount < 0 {
+		return Escrow{}, fmt.Errorf("%w: seller_amount cannot be negative", ErrInvalidEscrow)
+	}
+	escrow, err := s.Store.ResolveEscrowDispute(ctx, escrowID, userID, sellerAmount)
+	if err != nil {
+		log.Printf("Error resolving dispute on escrow %v: %v", escrowID, err)
+		return escrow, err
+	}
+	return escrow, nil
+}
+
+// GetEscrowTransactions lists every transaction that moved money into or out of an escrow
+func (s *EscrowService) GetEscrowTransactions(ctx context.Context, escrowID uint) ([]transactions.Transactions, error) {
+	txns, err := s.Store.GetEscrowTransactions(ctx, escrowID)
+	if err != nil {
+		log.Printf("Error fetching transactions of escrow %v: %v", escrowID, err)
+		return nil, err
+	}
+	return txns, nil
+}
+
+// RunAutoRelease releases undisputed escrows whose timeout has passed, once per interval until the context is
+// cancelled
+func (s *EscrowService) RunAutoRelease(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		count, err := s.Store.AutoReleaseEscrows(ctx, time.Now())
+		if err != nil {
+			log.Printf("Error auto-releasing escrows: %v", err)
+		} else if count > 0 {
+			log.Printf("Auto-released %d escrows", count)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
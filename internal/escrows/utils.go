@@ -0,0 +1,55 @@
+package escrows
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultAutoReleaseDays is used when ESCROW_AUTO_RELEASE_DAYS is unset or invalid
+const defaultAutoReleaseDays = 14
+
+// AutoReleaseDays returns after how many days an undisputed escrow is released to the seller by default
+func AutoReleaseDays() int {
+	days, err := strconv.Atoi(os.Getenv("ESCROW_AUTO_RELEASE_DAYS"))
+	if err != nil || days <= 0 {
+		return defaultAutoReleaseDays
+	}
+	return days
+}
+
+// Validate checks a new escrow and gives it a single milestone for the whole amount when it has none
+func Validate(escrow *Escrow, now time.Time) error {
+	if escrow.Amount <= 0 {
+		return fmt.Errorf("%w: amount must be greater than zero", ErrInvalidEscrow)
+	}
+	if escrow.BuyerAccountNumber == escrow.SellerAccountNumber {
+		return fmt.Errorf("%w: buyer and seller accounts must differ", ErrInvalidEscrow)
+	}
+	if escrow.ArbiterUserID == 0 || escrow.ArbiterUserID == escrow.BuyerUserID {
+		return fmt.Errorf("%w: an arbiter other than the buyer is required", ErrInvalidEscrow)
+	}
+	if !escrow.AutoReleaseAt.After(now) {
+		return fmt.Errorf("%w: auto_release_at must be in the future", ErrInvalidEscrow)
+	}
+
+	if len(escrow.Milestones) == 0 {
+		escrow.Milestones = []Milestone{{Name: "Full amount", Amount: escrow.Amount}}
+	}
+	total := 0.0
+	for i := range escrow.Milestones {
+		m := &escrow.Milestones[i]
+		if strings.TrimSpace(m.Name) == "" || m.Amount <= 0 {
+			return fmt.Errorf("%w: every milestone needs a name and a positive amount", ErrInvalidEscrow)
+		}
+		m.Status = MilestonePending
+		total += m.Amount
+	}
+	if math.Abs(total-escrow.Amount) >= 0.005 {
+		return fmt.Errorf("%w: milestones add up to %.2f, not %.2f", ErrInvalidEscrow, total, escrow.Amount)
+	}
+	return nil
+}
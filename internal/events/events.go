@@ -0,0 +1,157 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Domain event types written to the outbox
+const (
+	TypeUserCreated          = "user.created"
+	TypeAccountCreated       = "account.created"
+	TypeTransactionCompleted = "transaction.completed"
+)
+
+const (
+	// relayBatchSize caps how many outbox messages a single pass of the relay publishes
+	relayBatchSize = 500
+	// maxPending caps the pending messages returned at once
+	maxPending = 100
+)
+
+var (
+	ErrUnknownPublisher = errors.New("unknown event publisher")
+	ErrPublisherClosed  = errors.New("event publisher is closed")
+	ErrNoPublisher      = errors.New("no event publisher is configured")
+	ErrNoSubscribers    = errors.New("no subscriber for the event")
+	// errKeyBlocked holds back a message whose ordering key has an earlier message that failed to publish
+	errKeyBlocked = errors.New("an earlier event with the same key has not been published yet")
+)
+
+// Message - a domain event written to the outbox in the same database transaction as the change it describes. Keys
+// name the accounts or users it concerns; messages that share a key are published in the order they were written.
+type Message struct {
+	ID          uint            `json:"id"`
+	EventID     string          `json:"event_id"`
+	Type        string          `json:"type"`
+	Keys        []string        `json:"keys"`
+	Payload     json.RawMessage `json:"payload"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"last_error,omitempty"`
+	PublishedAt *time.Time      `json:"published_at,omitempty"`
+}
+
+// UserCreated - the payload of a user.created event. It names the user by ID only: events outlive erasure in the
+// outbox and in what publishers wrote, so they carry no personal data.
+type UserCreated struct {
+	UserID uint `json:"user_id"`
+}
+
+// RelayResult - what one pass of the relay did. Busy is set when another relay held the outbox.
+type RelayResult struct {
+	Published int
+	Failed    int
+	Busy      bool
+}
+
+// EventPublisher delivers outbox messages to consumers. Publish returns once the message is handed over; a message
+// may be published more than once, so consumers must ignore event ids they have already seen.
+type EventPublisher interface {
+	Publish(ctx context.Context, message Message) error
+	Close() error
+}
+
+type OutboxStore interface {
+	RelayOutbox(ctx context.Context, limit int, publish func(Message) error) (RelayResult, error)
+	PurgeOutbox(ctx context.Context, before time.Time) (int64, error)
+	GetPendingOutbox(ctx context.Context, limit int) ([]Message, error)
+}
+
+// OutboxService is the blueprint for the outbox relay logic
+type OutboxService struct {
+	Store     OutboxStore
+	Publisher EventPublisher
+	Retention time.Duration
+}
+
+func NewOutboxService(store OutboxStore, publisher EventPublisher) OutboxService {
+	return OutboxService{
+		Store:     store,
+		Publisher: publisher,
+		Retention: Retention(),
+	}
+}
+
+// GetPending returns the messages not published yet, oldest first
+func (s *OutboxService) GetPending(ctx context.Context, limit int) ([]Message, error) {
+	if limit <= 0 || limit > maxPending {
+		limit = maxPending
+	}
+	list, err := s.Store.GetPendingOutbox(ctx, limit)
+	if err != nil {
+		log.Printf("Error fetching pending outbox messages: %v", err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// RunRelay publishes the outbox once per interval until the context is cancelled, then closes the publisher
+func (s *OutboxService) RunRelay(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer func() {
+		if err := s.Publisher.Close(); err != nil {
+			log.Printf("Error closing event publisher: %v", err)
+		}
+	}()
+
+	for {
+		if _, err := s.Relay(ctx, time.Now()); err != nil {
+			log.Printf("Error relaying outbox: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Relay publishes the unpublished messages in the order they were written and drops those published longer ago than
+// the retention. Once a message fails, later messages that share one of its keys wait for the next pass, so each
+// account sees its events in order. A message is only marked published after the publisher took it, so a crash in
+// between publishes it again.
+func (s *OutboxService) Relay(ctx context.Context, now time.Time) (RelayResult, error) {
+	blocked := make(map[string]bool)
+	result, err := s.Store.RelayOutbox(ctx, relayBatchSize, func(message Message) error {
+		for _, key := range message.Keys {
+			if blocked[key] {
+				return errKeyBlocked
+			}
+		}
+		if err := s.Publisher.Publish(ctx, message); err != nil {
+			for _, key := range message.Keys {
+				blocked[key] = true
+			}
+			return fmt.Errorf("publishing %s %s: %w", message.Type, message.EventID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	if result.Failed > 0 {
+		log.Printf("Relayed %d outbox messages, %d held back for the next pass", result.Published, result.Failed)
+	}
+
+	if _, err := s.Store.PurgeOutbox(ctx, now.Add(-s.Retention)); err != nil {
+		return result, fmt.Errorf("purging outbox: %w", err)
+	}
+	return result, nil
+}
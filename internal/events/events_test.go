@@ -0,0 +1,144 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// memoryOutbox is an OutboxStore keeping its messages in a slice, in the order they were written
+type memoryOutbox struct {
+	messages []Message
+}
+
+func (o *memoryOutbox) write(eventID string, keys ...string) {
+	o.messages = append(o.messages, Message{ID: uint(len(o.messages) + 1), EventID: eventID, Type: TypeTransactionCompleted, Keys: keys})
+}
+
+func (o *memoryOutbox) RelayOutbox(ctx context.Context, limit int, publish func(Message) error) (RelayResult, error) {
+	var result RelayResult
+	for i := range o.messages {
+		m := &o.messages[i]
+		if m.PublishedAt != nil {
+			continue
+		}
+		if limit--; limit < 0 {
+			break
+		}
+		m.Attempts++
+		if err := publish(*m); err != nil {
+			m.LastError = err.Error()
+			result.Failed++
+			continue
+		}
+		now := time.Now()
+		m.PublishedAt, m.LastError = &now, ""
+		result.Published++
+	}
+	return result, nil
+}
+
+func (o *memoryOutbox) PurgeOutbox(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (o *memoryOutbox) GetPendingOutbox(ctx context.Context, limit int) ([]Message, error) {
+	var pending []Message
+	for _, m := range o.messages {
+		if m.PublishedAt == nil && len(pending) < limit {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// flakyPublisher refuses the events in down and records the ones it takes
+type flakyPublisher struct {
+	down      map[string]bool
+	published []string
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, message Message) error {
+	if p.down[message.EventID] {
+		return errors.New("connection refused")
+	}
+	p.published = append(p.published, message.EventID)
+	return nil
+}
+
+func (p *flakyPublisher) Close() error {
+	return nil
+}
+
+func TestRelayRetriesAndKeepsKeyOrder(t *testing.T) {
+	store := &memoryOutbox{}
+	store.write("a1", AccountKey(1))
+	store.write("a2", AccountKey(1), AccountKey(2))
+	store.write("b1", AccountKey(3))
+	publisher := &flakyPublisher{down: map[string]bool{"a1": true}}
+	service := NewOutboxService(store, publisher)
+
+	result, err := service.Relay(context.Background(), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Published != 1 || result.Failed != 2 {
+		t.Errorf("first pass published %d and failed %d, want 1 and 2", result.Published, result.Failed)
+	}
+	if len(publisher.published) != 1 || publisher.published[0] != "b1" {
+		t.Errorf("first pass published %v, want only the event of the other account", publisher.published)
+	}
+	pending, _ := service.GetPending(context.Background(), 0)
+	if len(pending) != 2 || pending[0].LastError == "" || pending[1].LastError != errKeyBlocked.Error() {
+		t.Errorf("pending after the first pass: %+v", pending)
+	}
+
+	delete(publisher.down, "a1")
+	if _, err := service.Relay(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"b1", "a1", "a2"}; len(publisher.published) != 3 || publisher.published[1] != want[1] || publisher.published[2] != want[2] {
+		t.Errorf("published %v, want %v", publisher.published, want)
+	}
+	if pending, _ := service.GetPending(context.Background(), 0); len(pending) != 0 {
+		t.Errorf("still pending after the retry: %+v", pending)
+	}
+	if store.messages[0].Attempts != 2 {
+		t.Errorf("the failed event was attempted %d times, want 2", store.messages[0].Attempts)
+	}
+}
+
+func TestMemoryPublisherKeepsUnsubscribedEvents(t *testing.T) {
+	store := &memoryOutbox{}
+	store.write("a1", AccountKey(1))
+	publisher := NewMemoryPublisher()
+	service := NewOutboxService(store, publisher)
+
+	if result, _ := service.Relay(context.Background(), time.Now()); result.Published != 0 {
+		t.Fatalf("published %d events nobody subscribed to", result.Published)
+	}
+
+	var received []string
+	publisher.Subscribe(TypeTransactionCompleted, func(ctx context.Context, message Message) error {
+		received = append(received, message.EventID)
+		return nil
+	})
+	if _, err := service.Relay(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 1 || received[0] != "a1" {
+		t.Errorf("the subscriber received %v, want the event kept from before it subscribed", received)
+	}
+}
+
+func TestNewPublisherRequiresConfiguration(t *testing.T) {
+	t.Setenv("EVENT_PUBLISHER", "")
+	if _, err := NewPublisher(); !errors.Is(err, ErrNoPublisher) {
+		t.Errorf("got %v, want ErrNoPublisher", err)
+	}
+	t.Setenv("EVENT_PUBLISHER", "kafka")
+	if _, err := NewPublisher(); !errors.Is(err, ErrUnknownPublisher) {
+		t.Errorf("got %v, want ErrUnknownPublisher", err)
+	}
+}
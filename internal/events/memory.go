@@ -0,0 +1,56 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// Handler consumes a message published on the in-process bus
+type Handler func(ctx context.Context, message Message) error
+
+// MemoryPublisher is an in-process event bus. Subscribers are called in the order they subscribed, on the relay's
+// goroutine; when one returns an error the message is published again on the next pass, to every subscriber. A
+// message nobody subscribed to is refused with ErrNoSubscribers, so it stays in the outbox instead of being lost.
+type MemoryPublisher struct {
+	mu          sync.RWMutex
+	subscribers map[string][]Handler
+	closed      bool
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{subscribers: make(map[string][]Handler)}
+}
+
+// Subscribe calls handler for every message of an event type, or of every type when eventType is "*"
+func (p *MemoryPublisher) Subscribe(eventType string, handler Handler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subscribers[eventType] = append(p.subscribers[eventType], handler)
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, message Message) error {
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return ErrPublisherClosed
+	}
+	handlers := append(append([]Handler{}, p.subscribers[message.Type]...), p.subscribers["*"]...)
+	p.mu.RUnlock()
+	if len(handlers) == 0 {
+		return ErrNoSubscribers
+	}
+
+	for _, handler := range handlers {
+		if err := handler(ctx, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *MemoryPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
@@ -0,0 +1,189 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsTimeout bounds connecting to the server and each publish when the context has no deadline
+const natsTimeout = 5 * time.Second
+
+// NATSPublisher publishes every message to a NATS server, or anything speaking its client protocol, on the subject
+// "{prefix}.{type}". Each publish is followed by a PING and only succeeds once the server answers, so the server has
+// taken the message. When the server supports headers, the event id is sent as Nats-Msg-Id so a JetStream stream
+// drops duplicates. The connection is opened on the first publish and again after any error.
+type NATSPublisher struct {
+	url    string
+	prefix string
+
+	mu      sync.Mutex
+	conn    net.Conn
+	reader  *bufio.Reader
+	headers bool
+	closed  bool
+}
+
+func NewNATSPublisher(serverURL string, prefix string) *NATSPublisher {
+	return &NATSPublisher{url: serverURL, prefix: prefix}
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, message Message) error {
+	body, err := Encode(message)
+	if err != nil {
+		return err
+	}
+	subject := p.prefix + "." + message.Type
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrPublisherClosed
+	}
+	if p.conn == nil {
+		if err := p.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	var frame bytes.Buffer
+	if p.headers {
+		header := "NATS/1.0\r\nNats-Msg-Id: " + message.EventID + "\r\n\r\n"
+		fmt.Fprintf(&frame, "HPUB %s %d %d\r\n%s", subject, len(header), len(header)+len(body), header)
+	} else {
+		fmt.Fprintf(&frame, "PUB %s %d\r\n", subject, len(body))
+	}
+	frame.Write(body)
+	frame.WriteString("\r\nPING\r\n")
+
+	if err := p.roundTrip(ctx, frame.Bytes()); err != nil {
+		p.disconnect()
+		return err
+	}
+	return nil
+}
+
+func (p *NATSPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return p.disconnect()
+}
+
+// connect dials the server, reads its INFO and introduces the client
+func (p *NATSPublisher) connect(ctx context.Context) error {
+	server, err := url.Parse(p.url)
+	if err != nil || server.Host == "" {
+		return fmt.Errorf("invalid NATS_URL %q", p.url)
+	}
+	address := server.Host
+	if server.Port() == "" {
+		address = net.JoinHostPort(server.Hostname(), "4222")
+	}
+
+	dialer := net.Dialer{Timeout: natsTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	p.conn = conn
+	p.reader = bufio.NewReader(conn)
+	p.conn.SetDeadline(deadline(ctx))
+
+	line, err := p.reader.ReadString('\n')
+	if err != nil {
+		p.disconnect()
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		p.disconnect()
+		return fmt.Errorf("unexpected greeting from NATS server: %q", strings.TrimSpace(line))
+	}
+	var info struct {
+		Headers bool `json:"headers"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info); err != nil {
+		p.disconnect()
+		return fmt.Errorf("reading NATS server info: %w", err)
+	}
+	p.headers = info.Headers
+
+	options := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "PayWalletEngine",
+		"lang":     "go",
+		"version":  "1.0.0",
+		"protocol": 1,
+		"headers":  info.Headers,
+	}
+	if server.User != nil {
+		if password, ok := server.User.Password(); ok {
+			options["user"] = server.User.Username()
+			options["pass"] = password
+		} else {
+			options["auth_token"] = server.User.Username()
+		}
+	}
+	connect, err := json.Marshal(options)
+	if err != nil {
+		p.disconnect()
+		return err
+	}
+	if err := p.roundTrip(ctx, []byte("CONNECT "+string(connect)+"\r\nPING\r\n")); err != nil {
+		p.disconnect()
+		return err
+	}
+	return nil
+}
+
+// roundTrip writes a frame ending in PING and waits for the server's PONG, answering its own PINGs meanwhile
+func (p *NATSPublisher) roundTrip(ctx context.Context, frame []byte) error {
+	p.conn.SetDeadline(deadline(ctx))
+	if _, err := p.conn.Write(frame); err != nil {
+		return err
+	}
+	for {
+		line, err := p.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := p.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// +OK and asynchronous INFO lines need no answer
+	}
+}
+
+func (p *NATSPublisher) disconnect() error {
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	p.reader = nil
+	return err
+}
+
+// deadline is the context's deadline, or natsTimeout from now
+func deadline(ctx context.Context) time.Time {
+	if d, ok := ctx.Deadline(); ok {
+		return d
+	}
+	return time.Now().Add(natsTimeout)
+}
@@ -0,0 +1,219 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/nats-io/nats-server/v2/server"
+	natsTest "github.com/nats-io/nats-server/v2/test"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runNATSServer starts an embedded NATS server on a free port and stops it when the test ends
+func runNATSServer(t *testing.T, configure func(*server.Options)) *server.Server {
+	t.Helper()
+	opts := natsTest.DefaultTestOptions
+	opts.Port = -1
+	if configure != nil {
+		configure(&opts)
+	}
+	s := natsTest.RunServer(&opts)
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+// natsMessage is a message received by testSubscriber
+type natsMessage struct {
+	Subject string
+	Header  string
+	Payload string
+}
+
+// testSubscriber is a bare NATS client subscribed to one subject, so the tests check what the publisher put on the
+// wire without relying on its own protocol code
+type testSubscriber struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func subscribe(t *testing.T, s *server.Server, subject string) *testSubscriber {
+	t.Helper()
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	sub := &testSubscriber{conn: conn, reader: bufio.NewReader(conn)}
+
+	if line := sub.readLine(t); !strings.HasPrefix(line, "INFO ") {
+		t.Fatalf("unexpected greeting %q", line)
+	}
+	fmt.Fprintf(conn, "CONNECT {\"verbose\":false,\"protocol\":1,\"headers\":true}\r\nSUB %s 1\r\nPING\r\n", subject)
+	if line := sub.readLine(t); line != "PONG" {
+		t.Fatalf("subscribing: %q", line)
+	}
+	return sub
+}
+
+func (s *testSubscriber) readLine(t *testing.T) string {
+	t.Helper()
+	line, err := s.reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(line)
+}
+
+// next waits for the next message, skipping the server's PINGs
+func (s *testSubscriber) next(t *testing.T) natsMessage {
+	t.Helper()
+	for {
+		line := s.readLine(t)
+		if line == "PING" {
+			fmt.Fprint(s.conn, "PONG\r\n")
+			continue
+		}
+		fields := strings.Fields(line)
+		var message natsMessage
+		var headerSize, totalSize int
+		var err error
+		switch {
+		case fields[0] == "MSG" && len(fields) == 4:
+			totalSize, err = strconv.Atoi(fields[3])
+		case fields[0] == "HMSG" && len(fields) == 5:
+			if headerSize, err = strconv.Atoi(fields[3]); err == nil {
+				totalSize, err = strconv.Atoi(fields[4])
+			}
+		default:
+			t.Fatalf("unexpected line %q", line)
+		}
+		if err != nil {
+			t.Fatalf("unexpected line %q", line)
+		}
+		body := make([]byte, totalSize+2)
+		if _, err := io.ReadFull(s.reader, body); err != nil {
+			t.Fatal(err)
+		}
+		message.Subject = fields[1]
+		message.Header = string(body[:headerSize])
+		message.Payload = string(body[headerSize:totalSize])
+		return message
+	}
+}
+
+func testMessage(eventID string) Message {
+	return Message{
+		ID:        1,
+		EventID:   eventID,
+		Type:      TypeTransactionCompleted,
+		Keys:      []string{AccountKey(1234567890)},
+		Payload:   []byte(`{"amount":250}`),
+		CreatedAt: time.Date(2024, time.May, 2, 10, 15, 30, 0, time.UTC),
+	}
+}
+
+func natsURL(s *server.Server, user *url.Userinfo) string {
+	return (&url.URL{Scheme: "nats", User: user, Host: s.Addr().String()}).String()
+}
+
+func TestNATSPublisherPublishes(t *testing.T) {
+	for name, noHeaders := range map[string]bool{"headers": false, "no headers": true} {
+		t.Run(name, func(t *testing.T) {
+			s := runNATSServer(t, func(opts *server.Options) { opts.NoHeaderSupport = noHeaders })
+			sub := subscribe(t, s, "paywallet.>")
+			publisher := NewNATSPublisher(natsURL(s, nil), "paywallet")
+			defer publisher.Close()
+
+			message := testMessage("1f0c6a3e-8d27-4c0b-9a57-5f4c1f0d2b11")
+			if err := publisher.Publish(context.Background(), message); err != nil {
+				t.Fatal(err)
+			}
+
+			got := sub.next(t)
+			if got.Subject != "paywallet.transaction.completed" {
+				t.Errorf("published on %q", got.Subject)
+			}
+			want, _ := Encode(message)
+			if got.Payload != string(want) {
+				t.Errorf("payload %s, want %s", got.Payload, want)
+			}
+			hasID := strings.Contains(got.Header, "Nats-Msg-Id: "+message.EventID+"\r\n")
+			if hasID == noHeaders {
+				t.Errorf("header %q, expected the event id only when the server supports headers", got.Header)
+			}
+		})
+	}
+}
+
+func TestNATSPublisherAuthentication(t *testing.T) {
+	t.Run("user and password", func(t *testing.T) {
+		s := runNATSServer(t, func(opts *server.Options) { opts.Username, opts.Password = "relay", "s3cret" })
+		good := NewNATSPublisher(natsURL(s, url.UserPassword("relay", "s3cret")), "paywallet")
+		defer good.Close()
+		if err := good.Publish(context.Background(), testMessage("a")); err != nil {
+			t.Errorf("publishing with the right password: %v", err)
+		}
+		bad := NewNATSPublisher(natsURL(s, url.UserPassword("relay", "wrong")), "paywallet")
+		defer bad.Close()
+		if err := bad.Publish(context.Background(), testMessage("b")); err == nil {
+			t.Error("publishing with a wrong password succeeded")
+		}
+	})
+
+	t.Run("token", func(t *testing.T) {
+		s := runNATSServer(t, func(opts *server.Options) { opts.Authorization = "t0ken" })
+		good := NewNATSPublisher(natsURL(s, url.User("t0ken")), "paywallet")
+		defer good.Close()
+		if err := good.Publish(context.Background(), testMessage("a")); err != nil {
+			t.Errorf("publishing with the right token: %v", err)
+		}
+		bad := NewNATSPublisher(natsURL(s, nil), "paywallet")
+		defer bad.Close()
+		if err := bad.Publish(context.Background(), testMessage("b")); err == nil {
+			t.Error("publishing without the token succeeded")
+		}
+	})
+}
+
+func TestNATSPublisherReconnects(t *testing.T) {
+	first := runNATSServer(t, nil)
+	port := first.Addr().(*net.TCPAddr).Port
+	publisher := NewNATSPublisher(natsURL(first, nil), "paywallet")
+	defer publisher.Close()
+
+	if err := publisher.Publish(context.Background(), testMessage("a")); err != nil {
+		t.Fatal(err)
+	}
+	first.Shutdown()
+	first.WaitForShutdown()
+	if err := publisher.Publish(context.Background(), testMessage("b")); err == nil {
+		t.Fatal("publishing to a stopped server succeeded")
+	}
+
+	second := runNATSServer(t, func(opts *server.Options) { opts.Port = port })
+	sub := subscribe(t, second, "paywallet.>")
+	if err := publisher.Publish(context.Background(), testMessage("c")); err != nil {
+		t.Fatalf("publishing after the server came back: %v", err)
+	}
+	if got := sub.next(t); !strings.Contains(got.Payload, `"id":"c"`) {
+		t.Errorf("received %s", got.Payload)
+	}
+}
+
+func TestNATSPublisherClosed(t *testing.T) {
+	s := runNATSServer(t, nil)
+	publisher := NewNATSPublisher(natsURL(s, nil), "paywallet")
+	if err := publisher.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := publisher.Publish(context.Background(), testMessage("a")); err != ErrPublisherClosed {
+		t.Errorf("got %v, want ErrPublisherClosed", err)
+	}
+}
@@ -0,0 +1,83 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultEventsFile is used when EVENTS_FILE is unset
+	defaultEventsFile = "events.log"
+	// defaultNATSURL is used when NATS_URL is unset
+	defaultNATSURL = "nats://localhost:4222"
+	// defaultSubjectPrefix is used when EVENTS_SUBJECT_PREFIX is unset
+	defaultSubjectPrefix = "paywallet"
+	// defaultRetention is used when OUTBOX_RETENTION is unset or invalid
+	defaultRetention = 7 * 24 * time.Hour
+)
+
+// Envelope is what a publisher sends for a message: the event without its outbox bookkeeping
+type Envelope struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Keys      []string        `json:"keys"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Encode returns the JSON envelope of a message
+func Encode(message Message) ([]byte, error) {
+	return json.Marshal(Envelope{
+		ID:        message.EventID,
+		Type:      message.Type,
+		Keys:      message.Keys,
+		CreatedAt: message.CreatedAt,
+		Data:      message.Payload,
+	})
+}
+
+// AccountKey is the ordering key of the events of an account
+func AccountKey(accountNumber int64) string {
+	return fmt.Sprintf("account:%d", accountNumber)
+}
+
+// UserKey is the ordering key of the events of a user
+func UserKey(userID uint) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// Retention reads from OUTBOX_RETENTION how long published messages stay in the outbox
+func Retention() time.Duration {
+	if retention, err := time.ParseDuration(os.Getenv("OUTBOX_RETENTION")); err == nil && retention > 0 {
+		return retention
+	}
+	return defaultRetention
+}
+
+// NewPublisher builds the publisher named by EVENT_PUBLISHER: "memory" for the in-process bus, "file" to append to
+// EVENTS_FILE, or "nats" to publish to the server at NATS_URL under EVENTS_SUBJECT_PREFIX. It returns ErrNoPublisher
+// when EVENT_PUBLISHER is unset, so events are kept in the outbox rather than sent nowhere.
+func NewPublisher() (EventPublisher, error) {
+	kind := strings.ToLower(strings.TrimSpace(os.Getenv("EVENT_PUBLISHER")))
+	switch kind {
+	case "":
+		return nil, ErrNoPublisher
+	case "memory":
+		return NewMemoryPublisher(), nil
+	case "file":
+		return NewFilePublisher(env("EVENTS_FILE", defaultEventsFile))
+	case "nats":
+		return NewNATSPublisher(env("NATS_URL", defaultNATSURL), env("EVENTS_SUBJECT_PREFIX", defaultSubjectPrefix)), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownPublisher, kind)
+}
+
+func env(name string, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		return value
+	}
+	return fallback
+}
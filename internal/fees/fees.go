@@ -0,0 +1,125 @@
+package fees
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+// PaymentMethodFee marks the transactions that move a fee to the fee revenue account
+const PaymentMethodFee = "fee"
+
+// Fee kinds. Every kind can additionally be capped with MinFee and MaxFee.
+const (
+	KindFlat       = "flat"
+	KindPercentage = "percentage"
+	KindTiered     = "tiered"
+)
+
+var ErrInvalidSchedule = errors.New("invalid fee schedule")
+
+// Schedule - a fee rule. Empty keys match any value, and every active schedule that matches a transaction charges
+// its own fee, so that fees can be layered, for example a base transfer fee plus a card surcharge.
+type Schedule struct {
+	ID              uint      `json:"id"`
+	Name            string    `json:"name"`
+	TransactionType string    `json:"transaction_type"`
+	PaymentMethod   string    `json:"payment_method"`
+	AccountType     string    `json:"account_type"`
+	Currency        string    `json:"currency"`
+	Kind            string    `json:"kind"`
+	FlatAmount      float64   `json:"flat_amount"`
+	Percentage      float64   `json:"percentage"`
+	Tiers           []Tier    `json:"tiers,omitempty"`
+	MinFee          float64   `json:"min_fee"`
+	MaxFee          float64   `json:"max_fee"`
+	Active          bool      `json:"active"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Tier - the fee for amounts up to UpTo. The last tier may leave UpTo at zero to cover every larger amount.
+type Tier struct {
+	UpTo       float64 `json:"up_to"`
+	FlatAmount float64 `json:"flat_amount"`
+	Percentage float64 `json:"percentage"`
+}
+
+// Item - one fee charged on a transaction
+type Item struct {
+	ScheduleID    uint       `json:"schedule_id"`
+	Name          string     `json:"name"`
+	Amount        float64    `json:"amount"`
+	TransactionID *uuid.UUID `json:"transaction_id,omitempty"`
+}
+
+// Context - the attributes of a transaction that fee schedules are keyed by
+type Context struct {
+	TransactionType string  `json:"transaction_type"`
+	PaymentMethod   string  `json:"payment_method"`
+	AccountType     string  `json:"account_type"`
+	Currency        string  `json:"currency"`
+	Amount          float64 `json:"amount"`
+}
+
+// Quote - the fees a transaction would be charged
+type Quote struct {
+	Context
+	Fees     []Item  `json:"fees"`
+	TotalFee float64 `json:"total_fee"`
+}
+
+type FeeStore interface {
+	CreateFeeSchedule(ctx context.Context, schedule *Schedule) error
+	GetFeeSchedules(ctx context.Context) ([]Schedule, error)
+	UpdateFeeSchedule(ctx context.Context, schedule Schedule) (Schedule, error)
+}
+
+// FeeService is the blueprint for managing fee schedules
+type FeeService struct {
+	Store FeeStore
+}
+
+func NewFeeService(store FeeStore) FeeService {
+	return FeeService{
+		Store: store,
+	}
+}
+
+// CreateFeeSchedule validates and stores a new fee schedule
+func (s *FeeService) CreateFeeSchedule(ctx context.Context, schedule *Schedule) error {
+	if err := Validate(*schedule); err != nil {
+		return err
+	}
+	if err := s.Store.CreateFeeSchedule(ctx, schedule); err != nil {
+		log.Printf("Error creating fee schedule: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetFeeSchedules lists every fee schedule, active or not
+func (s *FeeService) GetFeeSchedules(ctx context.Context) ([]Schedule, error) {
+	list, err := s.Store.GetFeeSchedules(ctx)
+	if err != nil {
+		log.Printf("Error fetching fee schedules: %v", err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// UpdateFeeSchedule replaces a fee schedule. Deactivate a schedule rather than deleting it, so that past fee
+// transactions keep pointing at the rule that charged them.
+func (s *FeeService) UpdateFeeSchedule(ctx context.Context, schedule Schedule) (Schedule, error) {
+	if err := Validate(schedule); err != nil {
+		return Schedule{}, err
+	}
+	updated, err := s.Store.UpdateFeeSchedule(ctx, schedule)
+	if err != nil {
+		log.Printf("Error updating fee schedule %v: %v", schedule.ID, err)
+		return updated, err
+	}
+	return updated, nil
+}
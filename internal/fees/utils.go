@@ -0,0 +1,114 @@
+package fees
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// defaultCurrency is used when CURRENCY is unset
+const defaultCurrency = "USD"
+
+// Currency returns the currency the engine holds balances in. Accounts carry no currency of their own yet.
+func Currency() string {
+	if currency := strings.ToUpper(strings.TrimSpace(os.Getenv("CURRENCY"))); currency != "" {
+		return currency
+	}
+	return defaultCurrency
+}
+
+// Validate checks that a fee schedule describes a fee that can be computed
+func Validate(schedule Schedule) error {
+	if strings.TrimSpace(schedule.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSchedule)
+	}
+	if schedule.FlatAmount < 0 || schedule.Percentage < 0 || schedule.MinFee < 0 || schedule.MaxFee < 0 {
+		return fmt.Errorf("%w: amounts and percentages must not be negative", ErrInvalidSchedule)
+	}
+	if schedule.MaxFee > 0 && schedule.MinFee > schedule.MaxFee {
+		return fmt.Errorf("%w: min_fee is above max_fee", ErrInvalidSchedule)
+	}
+
+	switch schedule.Kind {
+	case KindFlat, KindPercentage:
+		if len(schedule.Tiers) > 0 {
+			return fmt.Errorf("%w: only tiered schedules take tiers", ErrInvalidSchedule)
+		}
+	case KindTiered:
+		if len(schedule.Tiers) == 0 {
+			return fmt.Errorf("%w: tiered schedules need at least one tier", ErrInvalidSchedule)
+		}
+		previous := 0.0
+		for i, tier := range schedule.Tiers {
+			last := i == len(schedule.Tiers)-1
+			if tier.FlatAmount < 0 || tier.Percentage < 0 {
+				return fmt.Errorf("%w: tier %d has a negative fee", ErrInvalidSchedule, i+1)
+			}
+			if tier.UpTo == 0 && !last {
+				return fmt.Errorf("%w: only the last tier may be unbounded", ErrInvalidSchedule)
+			}
+			if tier.UpTo != 0 && tier.UpTo <= previous {
+				return fmt.Errorf("%w: tier bounds must increase", ErrInvalidSchedule)
+			}
+			previous = tier.UpTo
+		}
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidSchedule, schedule.Kind)
+	}
+	return nil
+}
+
+// Matches reports whether a schedule applies to a transaction. Empty keys match anything.
+func Matches(schedule Schedule, c Context) bool {
+	return schedule.Active &&
+		(schedule.TransactionType == "" || schedule.TransactionType == c.TransactionType) &&
+		(schedule.PaymentMethod == "" || schedule.PaymentMethod == c.PaymentMethod) &&
+		(schedule.AccountType == "" || schedule.AccountType == c.AccountType) &&
+		(schedule.Currency == "" || strings.EqualFold(schedule.Currency, c.Currency))
+}
+
+// Compute returns the fee a schedule charges on an amount, rounded to cents and capped by MinFee and MaxFee
+func Compute(schedule Schedule, amount float64) float64 {
+	var fee float64
+	switch schedule.Kind {
+	case KindFlat:
+		fee = schedule.FlatAmount
+	case KindPercentage:
+		fee = amount * schedule.Percentage / 100
+	case KindTiered:
+		// The tier containing the amount sets the whole fee
+		for _, tier := range schedule.Tiers {
+			if tier.UpTo == 0 || amount <= tier.UpTo {
+				fee = tier.FlatAmount + amount*tier.Percentage/100
+				break
+			}
+		}
+	}
+
+	if fee < schedule.MinFee {
+		fee = schedule.MinFee
+	}
+	if schedule.MaxFee > 0 && fee > schedule.MaxFee {
+		fee = schedule.MaxFee
+	}
+	return math.Round(fee*100) / 100
+}
+
+// Calculate quotes the fees every matching schedule charges on a transaction
+func Calculate(schedules []Schedule, c Context) Quote {
+	quote := Quote{Context: c, Fees: []Item{}}
+	for _, schedule := range schedules {
+		if !Matches(schedule, c) {
+			continue
+		}
+		fee := Compute(schedule, c.Amount)
+		if fee <= 0 {
+			continue
+		}
+		quote.Fees = append(quote.Fees, Item{ScheduleID: schedule.ID, Name: schedule.Name, Amount: fee})
+		quote.TotalFee += fee
+	}
+	quote.TotalFee = math.Round(quote.TotalFee*100) / 100
+	return quote
+}
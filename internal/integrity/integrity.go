@@ -0,0 +1,121 @@
+package integrity
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Discrepancy kinds
+const (
+	// KindAccountBalance - an account's stored balance differs from the net of its completed transactions
+	KindAccountBalance = "account_balance"
+	// KindPotBalance - a pot's stored balance differs from the net of its completed movements
+	KindPotBalance = "pot_balance"
+	// KindLedgerTotal - the balances held across all accounts and pots differ from the money that came in from
+	// outside less the money that went out
+	KindLedgerTotal = "ledger_total"
+)
+
+// Tolerance is the smallest difference reported. Amounts are kept to the cent, so anything below half a cent is
+// rounding noise from summing decimals as floats.
+const Tolerance = 0.005
+
+// Discrepancy - one balance that does not agree with the history that should explain it
+type Discrepancy struct {
+	ID              uint    `json:"id"`
+	Kind            string  `json:"kind"`
+	AccountID       uint    `json:"account_id,omitempty"`
+	AccountNumber   int64   `json:"account_number,omitempty"`
+	PotID           uint    `json:"pot_id,omitempty"`
+	StoredBalance   float64 `json:"stored_balance"`
+	ComputedBalance float64 `json:"computed_balance"`
+	Difference      float64 `json:"difference"`
+	Frozen          bool    `json:"frozen"`
+}
+
+// Report - the outcome of one verification run. Healthy is true when no discrepancy was found.
+type Report struct {
+	ID              uint          `json:"id"`
+	StartedAt       time.Time     `json:"started_at"`
+	CompletedAt     time.Time     `json:"completed_at"`
+	AccountsChecked int           `json:"accounts_checked"`
+	PotsChecked     int           `json:"pots_checked"`
+	TotalBalances   float64       `json:"total_balances"`
+	ExternalNet     float64       `json:"external_net"`
+	Healthy         bool          `json:"healthy"`
+	FrozenAccounts  int           `json:"frozen_accounts"`
+	Discrepancies   []Discrepancy `json:"discrepancies"`
+}
+
+type IntegrityStore interface {
+	VerifyBalances(ctx context.Context, freeze bool) (Report, error)
+	GetIntegrityReports(ctx context.Context, limit int) ([]Report, error)
+	GetIntegrityReport(ctx context.Context, id uint) (Report, error)
+}
+
+// IntegrityService is the blueprint for the balance integrity checks
+type IntegrityService struct {
+	Store IntegrityStore
+}
+
+func NewIntegrityService(store IntegrityStore) IntegrityService {
+	return IntegrityService{
+		Store: store,
+	}
+}
+
+// Verify recomputes every balance from its history and stores the report. When freeze is set, customer accounts
+// whose balance disagrees are frozen until someone has looked at them.
+func (s *IntegrityService) Verify(ctx context.Context, freeze bool) (Report, error) {
+	report, err := s.Store.VerifyBalances(ctx, freeze)
+	if err != nil {
+		log.Printf("Error verifying balances: %v", err)
+		return report, err
+	}
+	if !report.Healthy {
+		log.Printf("Balance integrity check %v found %d discrepancies, froze %d accounts", report.ID, len(report.Discrepancies), report.FrozenAccounts)
+	}
+	return report, nil
+}
+
+// GetReports lists the most recent verification reports, newest first, without their discrepancies
+func (s *IntegrityService) GetReports(ctx context.Context, limit int) ([]Report, error) {
+	if limit <= 0 || limit > maxReports {
+		limit = maxReports
+	}
+	reports, err := s.Store.GetIntegrityReports(ctx, limit)
+	if err != nil {
+		log.Printf("Error fetching integrity reports: %v", err)
+		return nil, err
+	}
+	return reports, nil
+}
+
+// GetReport returns one verification report with its discrepancies
+func (s *IntegrityService) GetReport(ctx context.Context, id uint) (Report, error) {
+	report, err := s.Store.GetIntegrityReport(ctx, id)
+	if err != nil {
+		log.Printf("Error fetching integrity report %v: %v", id, err)
+		return report, err
+	}
+	return report, nil
+}
+
+// RunVerification checks balances once per interval until the context is cancelled, freezing affected accounts
+// when INTEGRITY_AUTO_FREEZE is set
+func (s *IntegrityService) RunVerification(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Verify logs both failures and discrepancies
+		_, _ = s.Verify(ctx, AutoFreeze())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
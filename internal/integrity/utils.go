@@ -0,0 +1,27 @@
+package integrity
+
+import (
+	"math"
+	"os"
+	"strconv"
+)
+
+// maxReports bounds how many reports are listed at once
+const maxReports = 100
+
+// AutoFreeze reports whether the scheduled check freezes the accounts it finds discrepancies on, read from
+// INTEGRITY_AUTO_FREEZE. It is off unless set to a true value.
+func AutoFreeze() bool {
+	freeze, err := strconv.ParseBool(os.Getenv("INTEGRITY_AUTO_FREEZE"))
+	return err == nil && freeze
+}
+
+// Disagrees reports whether a stored and a computed balance differ by more than rounding
+func Disagrees(stored float64, computed float64) bool {
+	return math.Abs(stored-computed) >= Tolerance
+}
+
+// Round rounds an amount to the cent
+func Round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
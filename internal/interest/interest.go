@@ -0,0 +1,198 @@
+package interest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+// PaymentMethodInterest marks the transactions that capitalize accrued interest and overdraft interest
+const PaymentMethodInterest = "interest"
+
+// Day-count conventions, deciding which fraction of the annual rate one day earns
+const (
+	DayCountActual365    = "ACT/365"
+	DayCountActual360    = "ACT/360"
+	DayCountActualActual = "ACT/ACT"
+	DayCount30360        = "30/360"
+)
+
+// maxCatchUpDays bounds how many missed days a single run of the job accrues
+const maxCatchUpDays = 31
+
+var (
+	ErrInvalidPlan = errors.New("invalid interest plan")
+	ErrPlanExists  = errors.New("an active interest plan already exists for this account type")
+)
+
+// Plan - the interest rate paid on every account of one account type, and the overdraft rate charged when one of
+// those accounts ends the day below zero
+type Plan struct {
+	ID            uint      `json:"id"`
+	Name          string    `json:"name"`
+	AccountType   string    `json:"account_type"`
+	AnnualRate    float64   `json:"annual_rate"`
+	OverdraftRate float64   `json:"overdraft_rate"`
+	DayCount      string    `json:"day_count"`
+	Active        bool      `json:"active"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Accrual - the interest one account earned on one day, negative when it was charged overdraft interest
+type Accrual struct {
+	ID        uint      `json:"id"`
+	AccountID uint      `json:"account_id"`
+	PlanID    uint      `json:"plan_id"`
+	Date      time.Time `json:"date"`
+	Balance   float64   `json:"balance"`
+	Rate      float64   `json:"rate"`
+	Amount    float64   `json:"amount"`
+	PayoutID  *uint     `json:"payout_id,omitempty"`
+}
+
+// Payout - the accrued interest of one month credited to an account, or debited when it is negative
+type Payout struct {
+	ID            uint       `json:"id"`
+	AccountID     uint       `json:"account_id"`
+	Period        string     `json:"period"`
+	Amount        float64    `json:"amount"`
+	TransactionID *uuid.UUID `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Summary - the interest position of an account
+type Summary struct {
+	AccountID      uint      `json:"account_id"`
+	AccruedUnpaid  float64   `json:"accrued_unpaid"`
+	RecentAccruals []Accrual `json:"recent_accruals"`
+	Payouts        []Payout  `json:"payouts"`
+}
+
+type InterestStore interface {
+	CreateInterestPlan(ctx context.Context, plan *Plan) error
+	GetInterestPlans(ctx context.Context) ([]Plan, error)
+	UpdateInterestPlan(ctx context.Context, plan Plan) (Plan, error)
+	LastAccrualDate(ctx context.Context) (*time.Time, error)
+	AccrueInterest(ctx context.Context, date time.Time) (int, error)
+	CapitalizeInterest(ctx context.Context, before time.Time) (int, error)
+	GetInterestSummary(ctx context.Context, accountID uint) (Summary, error)
+}
+
+// InterestService is the blueprint for the interest logic
+type InterestService struct {
+	Store InterestStore
+}
+
+func NewInterestService(store InterestStore) InterestService {
+	return InterestService{
+		Store: store,
+	}
+}
+
+// CreateInterestPlan validates and stores a plan. A zero day count takes the configured default.
+func (s *InterestService) CreateInterestPlan(ctx context.Context, plan *Plan) error {
+	if plan.DayCount == "" {
+		plan.DayCount = DefaultDayCount()
+	}
+	if err := Validate(*plan); err != nil {
+		return err
+	}
+	if err := s.Store.CreateInterestPlan(ctx, plan); err != nil {
+		log.Printf("Error creating interest plan: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s *InterestService) GetInterestPlans(ctx context.Context) ([]Plan, error) {
+	plans, err := s.Store.GetInterestPlans(ctx)
+	if err != nil {
+		log.Printf("Error fetching interest plans: %v", err)
+		return nil, err
+	}
+	return plans, nil
+}
+
+// UpdateInterestPlan replaces a plan. Rate changes apply from the next day accrued.
+func (s *InterestService) UpdateInterestPlan(ctx context.Context, plan Plan) (Plan, error) {
+	if plan.DayCount == "" {
+		plan.DayCount = DefaultDayCount()
+	}
+	if err := Validate(plan); err != nil {
+		return Plan{}, err
+	}
+	updated, err := s.Store.UpdateInterestPlan(ctx, plan)
+	if err != nil {
+		log.Printf("Error updating interest plan %v: %v", plan.ID, err)
+		return updated, err
+	}
+	return updated, nil
+}
+
+// GetInterestSummary returns the accrued but unpaid interest, recent accruals and payouts of an account
+func (s *InterestService) GetInterestSummary(ctx context.Context, accountID uint) (Summary, error) {
+	summary, err := s.Store.GetInterestSummary(ctx, accountID)
+	if err != nil {
+		log.Printf("Error fetching interest summary of account %v: %v", accountID, err)
+		return summary, err
+	}
+	return summary, nil
+}
+
+// RunInterestJob accrues interest and capitalizes finished months once per interval until the context is cancelled
+func (s *InterestService) RunInterestJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.ProcessInterest(ctx, time.Now()); err != nil {
+			log.Printf("Error processing interest: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessInterest accrues every day that has ended since the last accrued day, then credits the interest of every
+// month that has ended. Both steps are idempotent, so running it again after a crash is safe.
+func (s *InterestService) ProcessInterest(ctx context.Context, now time.Time) error {
+	yesterday := StartOfDay(now).AddDate(0, 0, -1)
+
+	from := yesterday
+	last, err := s.Store.LastAccrualDate(ctx)
+	if err != nil {
+		return fmt.Errorf("finding last accrual date: %w", err)
+	}
+	if last != nil {
+		from = StartOfDay(*last).AddDate(0, 0, 1)
+		if earliest := yesterday.AddDate(0, 0, -maxCatchUpDays+1); from.Before(earliest) {
+			log.Printf("Interest accrual is more than %d days behind, resuming from %s", maxCatchUpDays, earliest.Format("2006-01-02"))
+			from = earliest
+		}
+	}
+
+	for day := from; !day.After(yesterday); day = day.AddDate(0, 0, 1) {
+		count, err := s.Store.AccrueInterest(ctx, day)
+		if err != nil {
+			return fmt.Errorf("accruing interest for %s: %w", day.Format("2006-01-02"), err)
+		}
+		log.Printf("Accrued interest on %d accounts for %s", count, day.Format("2006-01-02"))
+	}
+
+	count, err := s.Store.CapitalizeInterest(ctx, StartOfMonth(now))
+	if err != nil {
+		return fmt.Errorf("capitalizing interest: %w", err)
+	}
+	if count > 0 {
+		log.Printf("Capitalized interest on %d accounts", count)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package interest
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultDayCount returns the day-count convention for plans that do not name one, read from INTEREST_DAY_COUNT
+func DefaultDayCount() string {
+	convention := strings.ToUpper(strings.TrimSpace(os.Getenv("INTEREST_DAY_COUNT")))
+	if validDayCount(convention) {
+		return convention
+	}
+	return DayCountActual365
+}
+
+func validDayCount(convention string) bool {
+	switch convention {
+	case DayCountActual365, DayCountActual360, DayCountActualActual, DayCount30360:
+		return true
+	}
+	return false
+}
+
+// Validate checks that a plan can be accrued
+func Validate(plan Plan) error {
+	if strings.TrimSpace(plan.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidPlan)
+	}
+	if err := accounts.ValidateAccountType(plan.AccountType); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPlan, err)
+	}
+	if plan.AnnualRate < 0 || plan.AnnualRate > 100 {
+		return fmt.Errorf("%w: annual_rate must be between 0 and 100", ErrInvalidPlan)
+	}
+	if plan.OverdraftRate < 0 || plan.OverdraftRate > 100 {
+		return fmt.Errorf("%w: overdraft_rate must be between 0 and 100", ErrInvalidPlan)
+	}
+	if !validDayCount(plan.DayCount) {
+		return fmt.Errorf("%w: unknown day count %q", ErrInvalidPlan, plan.DayCount)
+	}
+	return nil
+}
+
+// StartOfDay truncates t to midnight UTC. Interest days follow the UTC calendar.
+func StartOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// StartOfMonth truncates t to the first of its month, at midnight UTC
+func StartOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// DayFraction returns the fraction of a year that the given day counts for under a day-count convention. Under
+// 30/360 every month counts as 30 days, so the 31st earns nothing and the last day of February makes up the difference.
+func DayFraction(convention string, day time.Time) float64 {
+	switch convention {
+	case DayCountActual360:
+		return 1.0 / 360
+	case DayCountActualActual:
+		daysInYear := time.Date(day.Year(), time.December, 31, 0, 0, 0, 0, time.UTC).YearDay()
+		return 1.0 / float64(daysInYear)
+	case DayCount30360:
+		lastDay := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		switch {
+		case day.Day() == 31:
+			return 0
+		case day.Month() == time.February && day.Day() == lastDay:
+			return float64(1+30-lastDay) / 360
+		}
+		return 1.0 / 360
+	default:
+		return 1.0 / 365
+	}
+}
+
+// DailyRate returns the annual rate that applies to an end-of-day balance
+func DailyRate(balance float64, plan Plan) float64 {
+	if balance < 0 {
+		return plan.OverdraftRate
+	}
+	return plan.AnnualRate
+}
+
+// DailyInterest returns the unrounded interest an end-of-day balance earns on a day. A negative balance is charged
+// overdraft interest, which is returned as a negative amount.
+func DailyInterest(balance float64, plan Plan, day time.Time) float64 {
+	return balance * DailyRate(balance, plan) / 100 * DayFraction(plan.DayCount, day)
+}
@@ -0,0 +1,290 @@
+package ledger
+
+import (
+	"PayWalletEngine/internal/fees"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// Journal export formats
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// GL account categories. Assets and expenses carry debit balances; liabilities, equity and income carry credit
+// balances.
+const (
+	CategoryAsset     = "asset"
+	CategoryLiability = "liability"
+	CategoryEquity    = "equity"
+	CategoryIncome    = "income"
+	CategoryExpense   = "expense"
+)
+
+// maxJournalDays bounds the period of one journal export
+const maxJournalDays = 366
+
+var (
+	ErrInvalidGLAccount = errors.New("invalid GL account")
+	ErrInvalidMapping   = errors.New("invalid GL mapping")
+	ErrInvalidJournal   = errors.New("invalid journal request")
+	ErrGLAccountExists  = errors.New("a GL account with this code already exists")
+	ErrMappingExists    = errors.New("a GL mapping with these keys already exists")
+	ErrUnknownGLAccount = errors.New("GL account is not in the chart of accounts")
+)
+
+// GLAccount - an account of the chart of accounts that wallet activity is posted to
+type GLAccount struct {
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	Category  string    `json:"category"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Mapping - the GL accounts a kind of transaction is debited and credited to. Empty keys match any value; the fee
+// type is the fee schedule that charged a fee, zero for any. When several mappings match a transaction, the one with
+// the most keys set wins.
+type Mapping struct {
+	ID              uint      `json:"id"`
+	TransactionType string    `json:"transaction_type"`
+	PaymentMethod   string    `json:"payment_method"`
+	FeeScheduleID   uint      `json:"fee_schedule_id"`
+	DebitCode       string    `json:"debit_gl"`
+	CreditCode      string    `json:"credit_gl"`
+	Memo            string    `json:"memo"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// PostingSummary - the completed transactions of one day with the same type, payment method and fee schedule, added
+// up
+type PostingSummary struct {
+	Date            time.Time
+	TransactionType string
+	PaymentMethod   string
+	FeeScheduleID   uint
+	Count           int
+	Amount          float64
+}
+
+// JournalEntry - one line of the daily summarized journal
+type JournalEntry struct {
+	Date         time.Time `json:"date"`
+	DebitCode    string    `json:"debit_gl"`
+	CreditCode   string    `json:"credit_gl"`
+	Amount       float64   `json:"amount"`
+	Currency     string    `json:"currency"`
+	Memo         string    `json:"memo"`
+	Transactions int       `json:"transactions"`
+}
+
+// Journal - the summarized journal of a period [From, To)
+type Journal struct {
+	From    time.Time      `json:"from"`
+	To      time.Time      `json:"to"`
+	Entries []JournalEntry `json:"entries"`
+}
+
+// TrialBalanceLine - the debits and credits posted to one GL account. Balance is debits less credits.
+type TrialBalanceLine struct {
+	Code     string  `json:"code"`
+	Name     string  `json:"name"`
+	Category string  `json:"category"`
+	Debits   float64 `json:"debits"`
+	Credits  float64 `json:"credits"`
+	Balance  float64 `json:"balance"`
+}
+
+// TrialBalance - every GL account's debits and credits up to AsOf (exclusive). Debits and credits always agree, since
+// every journal entry posts both sides.
+type TrialBalance struct {
+	AsOf         time.Time          `json:"as_of"`
+	Currency     string             `json:"currency"`
+	Lines        []TrialBalanceLine `json:"lines"`
+	TotalDebits  float64            `json:"total_debits"`
+	TotalCredits float64            `json:"total_credits"`
+}
+
+type LedgerStore interface {
+	CreateGLAccount(ctx context.Context, account *GLAccount) error
+	GetGLAccounts(ctx context.Context) ([]GLAccount, error)
+	UpdateGLAccount(ctx context.Context, account GLAccount) (GLAccount, error)
+	CreateGLMapping(ctx context.Context, mapping *Mapping) error
+	GetGLMappings(ctx context.Context) ([]Mapping, error)
+	UpdateGLMapping(ctx context.Context, mapping Mapping) (Mapping, error)
+	DeleteGLMapping(ctx context.Context, id uint) error
+	GetPostingSummaries(ctx context.Context, from time.Time, to time.Time) ([]PostingSummary, error)
+}
+
+// LedgerService is the blueprint for the general ledger logic
+type LedgerService struct {
+	Store LedgerStore
+}
+
+func NewLedgerService(store LedgerStore) LedgerService {
+	return LedgerService{
+		Store: store,
+	}
+}
+
+func (s *LedgerService) CreateGLAccount(ctx context.Context, account *GLAccount) error {
+	if err := ValidateGLAccount(*account); err != nil {
+		return err
+	}
+	if err := s.Store.CreateGLAccount(ctx, account); err != nil {
+		log.Printf("Error creating GL account: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s *LedgerService) GetGLAccounts(ctx context.Context) ([]GLAccount, error) {
+	list, err := s.Store.GetGLAccounts(ctx)
+	if err != nil {
+		log.Printf("Error fetching GL accounts: %v", err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// UpdateGLAccount renames or recategorizes a GL account. Its code can't change.
+func (s *LedgerService) UpdateGLAccount(ctx context.Context, account GLAccount) (GLAccount, error) {
+	if err := ValidateGLAccount(account); err != nil {
+		return GLAccount{}, err
+	}
+	updated, err := s.Store.UpdateGLAccount(ctx, account)
+	if err != nil {
+		log.Printf("Error updating GL account %v: %v", account.Code, err)
+		return updated, err
+	}
+	return updated, nil
+}
+
+func (s *LedgerService) CreateGLMapping(ctx context.Context, mapping *Mapping) error {
+	if err := ValidateMapping(*mapping); err != nil {
+		return err
+	}
+	if err := s.Store.CreateGLMapping(ctx, mapping); err != nil {
+		log.Printf("Error creating GL mapping: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s *LedgerService) GetGLMappings(ctx context.Context) ([]Mapping, error) {
+	list, err := s.Store.GetGLMappings(ctx)
+	if err != nil {
+		log.Printf("Error fetching GL mappings: %v", err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// UpdateGLMapping replaces a mapping. It applies to every journal exported from then on, past days included.
+func (s *LedgerService) UpdateGLMapping(ctx context.Context, mapping Mapping) (Mapping, error) {
+	if err := ValidateMapping(mapping); err != nil {
+		return Mapping{}, err
+	}
+	updated, err := s.Store.UpdateGLMapping(ctx, mapping)
+	if err != nil {
+		log.Printf("Error updating GL mapping %v: %v", mapping.ID, err)
+		return updated, err
+	}
+	return updated, nil
+}
+
+func (s *LedgerService) DeleteGLMapping(ctx context.Context, id uint) error {
+	if err := s.Store.DeleteGLMapping(ctx, id); err != nil {
+		log.Printf("Error deleting GL mapping %v: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+// GetJournal builds the summarized journal of the days from from up to to: one entry per day, GL pair and memo
+func (s *LedgerService) GetJournal(ctx context.Context, from time.Time, to time.Time) (Journal, error) {
+	if !from.Before(to) {
+		return Journal{}, fmt.Errorf("%w: from must not be after to", ErrInvalidJournal)
+	}
+	if to.Sub(from) > maxJournalDays*24*time.Hour {
+		return Journal{}, fmt.Errorf("%w: a journal covers at most %d days", ErrInvalidJournal, maxJournalDays)
+	}
+
+	entries, err := s.journalEntries(ctx, from, to)
+	if err != nil {
+		log.Printf("Error building journal: %v", err)
+		return Journal{}, err
+	}
+	return Journal{From: from, To: to, Entries: entries}, nil
+}
+
+// GetTrialBalance adds up every journal entry before asOf by GL account
+func (s *LedgerService) GetTrialBalance(ctx context.Context, asOf time.Time) (TrialBalance, error) {
+	entries, err := s.journalEntries(ctx, time.Time{}, asOf)
+	if err != nil {
+		log.Printf("Error building trial balance: %v", err)
+		return TrialBalance{}, err
+	}
+	chart, err := s.Store.GetGLAccounts(ctx)
+	if err != nil {
+		log.Printf("Error fetching GL accounts: %v", err)
+		return TrialBalance{}, err
+	}
+	return BuildTrialBalance(asOf, fees.Currency(), chart, entries), nil
+}
+
+// journalEntries maps the posting summaries of a period onto GL accounts and merges those that land on the same day,
+// GL pair and memo
+func (s *LedgerService) journalEntries(ctx context.Context, from time.Time, to time.Time) ([]JournalEntry, error) {
+	mappings, err := s.Store.GetGLMappings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	summaries, err := s.Store.GetPostingSummaries(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	currency := fees.Currency()
+	index := make(map[string]int)
+	entries := []JournalEntry{}
+	for _, summary := range summaries {
+		debit, credit, memo := Resolve(mappings, summary)
+		key := summary.Date.Format("2006-01-02") + "|" + debit + "|" + credit + "|" + memo
+		if i, ok := index[key]; ok {
+			entries[i].Amount = Round(entries[i].Amount + summary.Amount)
+			entries[i].Transactions += summary.Count
+			continue
+		}
+		index[key] = len(entries)
+		entries = append(entries, JournalEntry{
+			Date:         summary.Date,
+			DebitCode:    debit,
+			CreditCode:   credit,
+			Amount:       Round(summary.Amount),
+			Currency:     currency,
+			Memo:         memo,
+			Transactions: summary.Count,
+		})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.DebitCode != b.DebitCode {
+			return a.DebitCode < b.DebitCode
+		}
+		if a.CreditCode != b.CreditCode {
+			return a.CreditCode < b.CreditCode
+		}
+		return a.Memo < b.Memo
+	})
+	return entries, nil
+}
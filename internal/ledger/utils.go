@@ -0,0 +1,193 @@
+package ledger
+
+import (
+	"PayWalletEngine/internal/interest"
+	"PayWalletEngine/internal/pots"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultSuspenseCode is used when GL_SUSPENSE_ACCOUNT is unset
+const defaultSuspenseCode = "9999"
+
+var glCode = regexp.MustCompile(`^[A-Za-z0-9.\-]{1,20}$`)
+
+// transactionTypes are the transaction types a mapping can be keyed by
+var transactionTypes = []string{"Credit", "Debit", "Transfer", "Fee"}
+
+// SuspenseCode returns the GL account that transactions without a mapping are posted to on both sides, read from
+// GL_SUSPENSE_ACCOUNT
+func SuspenseCode() string {
+	if code := strings.TrimSpace(os.Getenv("GL_SUSPENSE_ACCOUNT")); code != "" {
+		return code
+	}
+	return defaultSuspenseCode
+}
+
+// ValidFormat reports whether the journal can be exported in a format
+func ValidFormat(format string) bool {
+	return format == FormatJSON || format == FormatCSV
+}
+
+// ValidateGLAccount checks the code, name and category of a GL account
+func ValidateGLAccount(account GLAccount) error {
+	if !glCode.MatchString(account.Code) {
+		return fmt.Errorf("%w: code must be 1 to 20 letters, digits, dots or dashes", ErrInvalidGLAccount)
+	}
+	if name := strings.TrimSpace(account.Name); name == "" || len(name) > 100 {
+		return fmt.Errorf("%w: name is required and at most 100 characters", ErrInvalidGLAccount)
+	}
+	switch account.Category {
+	case CategoryAsset, CategoryLiability, CategoryEquity, CategoryIncome, CategoryExpense:
+		return nil
+	}
+	return fmt.Errorf("%w: category must be asset, liability, equity, income or expense", ErrInvalidGLAccount)
+}
+
+// ValidateMapping checks that a mapping names a known transaction type, if any, and both GL accounts
+func ValidateMapping(mapping Mapping) error {
+	if mapping.TransactionType != "" {
+		known := false
+		for _, t := range transactionTypes {
+			known = known || t == mapping.TransactionType
+		}
+		if !known {
+			return fmt.Errorf("%w: transaction_type must be Credit, Debit, Transfer or Fee", ErrInvalidMapping)
+		}
+	}
+	if len(mapping.PaymentMethod) > 50 {
+		return fmt.Errorf("%w: payment_method is at most 50 characters", ErrInvalidMapping)
+	}
+	if !glCode.MatchString(mapping.DebitCode) || !glCode.MatchString(mapping.CreditCode) {
+		return fmt.Errorf("%w: debit_gl and credit_gl are required", ErrInvalidMapping)
+	}
+	if len(mapping.Memo) > 255 {
+		return fmt.Errorf("%w: memo is at most 255 characters", ErrInvalidMapping)
+	}
+	return nil
+}
+
+// Resolve finds the GL accounts and memo of a posting summary. The mapping with the most keys set wins, and the
+// earliest one among equals. Postings no mapping covers go to the suspense account on both sides.
+func Resolve(mappings []Mapping, summary PostingSummary) (string, string, string) {
+	var best *Mapping
+	bestScore := -1
+	for i := range mappings {
+		m := &mappings[i]
+		if (m.TransactionType != "" && m.TransactionType != summary.TransactionType) ||
+			(m.PaymentMethod != "" && m.PaymentMethod != summary.PaymentMethod) ||
+			(m.FeeScheduleID != 0 && m.FeeScheduleID != summary.FeeScheduleID) {
+			continue
+		}
+		score := 0
+		for _, set := range []bool{m.TransactionType != "", m.PaymentMethod != "", m.FeeScheduleID != 0} {
+			if set {
+				score++
+			}
+		}
+		if score > bestScore || (score == bestScore && m.ID < best.ID) {
+			best, bestScore = m, score
+		}
+	}
+
+	if best == nil {
+		suspense := SuspenseCode()
+		return suspense, suspense, fmt.Sprintf("Unmapped %s via %s", summary.TransactionType, summary.PaymentMethod)
+	}
+	memo := best.Memo
+	if memo == "" {
+		memo = fmt.Sprintf("%s via %s", summary.TransactionType, summary.PaymentMethod)
+	}
+	return best.DebitCode, best.CreditCode, memo
+}
+
+// BuildTrialBalance adds up journal entries by GL account. Every account of the chart is listed, and so is any code
+// posted to that is not in it, such as the suspense account.
+func BuildTrialBalance(asOf time.Time, currency string, chart []GLAccount, entries []JournalEntry) TrialBalance {
+	lines := make(map[string]*TrialBalanceLine)
+	for _, account := range chart {
+		lines[account.Code] = &TrialBalanceLine{Code: account.Code, Name: account.Name, Category: account.Category}
+	}
+	line := func(code string) *TrialBalanceLine {
+		if lines[code] == nil {
+			lines[code] = &TrialBalanceLine{Code: code}
+		}
+		return lines[code]
+	}
+
+	trial := TrialBalance{AsOf: asOf, Currency: currency, Lines: []TrialBalanceLine{}}
+	for _, entry := range entries {
+		line(entry.DebitCode).Debits += entry.Amount
+		line(entry.CreditCode).Credits += entry.Amount
+		trial.TotalDebits += entry.Amount
+		trial.TotalCredits += entry.Amount
+	}
+	for _, l := range lines {
+		l.Debits = Round(l.Debits)
+		l.Credits = Round(l.Credits)
+		l.Balance = Round(l.Debits - l.Credits)
+		trial.Lines = append(trial.Lines, *l)
+	}
+	sort.Slice(trial.Lines, func(i, j int) bool { return trial.Lines[i].Code < trial.Lines[j].Code })
+	trial.TotalDebits = Round(trial.TotalDebits)
+	trial.TotalCredits = Round(trial.TotalCredits)
+	return trial
+}
+
+// WriteJournalCSV writes a journal as CSV, one row per entry
+func WriteJournalCSV(w io.Writer, journal Journal) error {
+	writer := csv.NewWriter(w)
+	rows := [][]string{{"date", "debit_gl", "credit_gl", "amount", "currency", "memo", "transactions"}}
+	for _, entry := range journal.Entries {
+		rows = append(rows, []string{
+			entry.Date.Format("2006-01-02"),
+			entry.DebitCode,
+			entry.CreditCode,
+			strconv.FormatFloat(entry.Amount, 'f', 2, 64),
+			entry.Currency,
+			entry.Memo,
+			strconv.Itoa(entry.Transactions),
+		})
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// Round rounds an amount to the cent
+func Round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// DefaultChart is the chart of accounts a new ledger starts with
+var DefaultChart = []GLAccount{
+	{Code: "1000", Name: "Bank accounts", Category: CategoryAsset},
+	{Code: "2000", Name: "Customer wallets", Category: CategoryLiability},
+	{Code: "2100", Name: "Customer pots", Category: CategoryLiability},
+	{Code: "4000", Name: "Fee income", Category: CategoryIncome},
+	{Code: "4100", Name: "Interest income", Category: CategoryIncome},
+	{Code: "5000", Name: "Interest expense", Category: CategoryExpense},
+	{Code: defaultSuspenseCode, Name: "Suspense", Category: CategoryAsset},
+}
+
+// DefaultMappings are the mappings a new ledger starts with. Money enters and leaves the wallets through the bank
+// accounts; transfers, including those through the escrow and disputes system accounts, stay within the wallets.
+var DefaultMappings = []Mapping{
+	{TransactionType: "Credit", DebitCode: "1000", CreditCode: "2000", Memo: "Wallet funding"},
+	{TransactionType: "Debit", DebitCode: "2000", CreditCode: "1000", Memo: "Wallet withdrawals"},
+	{TransactionType: "Transfer", DebitCode: "2000", CreditCode: "2000", Memo: "Transfers between wallets"},
+	{TransactionType: "Fee", DebitCode: "2000", CreditCode: "4000", Memo: "Fees charged"},
+	{TransactionType: "Credit", PaymentMethod: interest.PaymentMethodInterest, DebitCode: "5000", CreditCode: "2000", Memo: "Interest paid"},
+	{TransactionType: "Debit", PaymentMethod: interest.PaymentMethodInterest, DebitCode: "2000", CreditCode: "4100", Memo: "Overdraft interest charged"},
+	{TransactionType: "Debit", PaymentMethod: pots.PaymentMethodPot, DebitCode: "2000", CreditCode: "2100", Memo: "Moved to pots"},
+	{TransactionType: "Credit", PaymentMethod: pots.PaymentMethodPot, DebitCode: "2100", CreditCode: "2000", Memo: "Moved from pots"},
+}
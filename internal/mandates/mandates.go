@@ -0,0 +1,179 @@
+package mandates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+// PaymentMethodDirectDebit marks transfers pulled by a merchant under a mandate
+const PaymentMethodDirectDebit = "direct debit"
+
+// Periods over which a mandate's maximum amount applies. Periods follow the calendar in UTC, weeks start on Monday.
+const (
+	PeriodDaily   = "daily"
+	PeriodWeekly  = "weekly"
+	PeriodMonthly = "monthly"
+	PeriodYearly  = "yearly"
+)
+
+// Mandate statuses
+const (
+	StatusActive  = "active"
+	StatusRevoked = "revoked"
+)
+
+// Pull statuses. Rejected pulls are kept so that merchants and customers can see attempts outside the mandate.
+const (
+	PullCompleted = "completed"
+	PullRejected  = "rejected"
+)
+
+var (
+	ErrInvalidMandate  = errors.New("invalid mandate")
+	ErrNotOwner        = errors.New("mandate does not belong to the user")
+	ErrNotMerchant     = errors.New("mandate was not granted to this merchant account")
+	ErrMandateRevoked  = errors.New("mandate has been revoked")
+	ErrOutsideValidity = errors.New("mandate is not valid at this time")
+	ErrLimitExceeded   = errors.New("pull exceeds the mandate's maximum for the period")
+)
+
+// Mandate - a customer's authority for a merchant account to pull funds from one of their accounts
+type Mandate struct {
+	ID                    uint       `json:"id"`
+	CustomerUserID        uint       `json:"customer_user_id"`
+	CustomerAccountNumber int64      `json:"customer_account_number"`
+	MerchantAccountNumber int64      `json:"merchant_account_number"`
+	Reference             string     `json:"reference"`
+	MaxAmount             float64    `json:"max_amount"`
+	Period                string     `json:"period"`
+	ValidFrom             time.Time  `json:"valid_from"`
+	ValidUntil            *time.Time `json:"valid_until,omitempty"`
+	Status                string     `json:"status"`
+	RevokedAt             *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+}
+
+// Pull - a merchant's attempt to collect funds under a mandate
+type Pull struct {
+	ID            uint       `json:"id"`
+	MandateID     uint       `json:"mandate_id"`
+	Amount        float64    `json:"amount"`
+	Description   string     `json:"description"`
+	Status        string     `json:"status"`
+	Reason        string     `json:"reason,omitempty"`
+	TransactionID *uuid.UUID `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type MandateStore interface {
+	CreateMandate(ctx context.Context, mandate *Mandate) error
+	GetMandateByID(ctx context.Context, mandateID uint) (Mandate, error)
+	GetMandatesByUserID(ctx context.Context, userID uint) ([]Mandate, error)
+	GetMandatesByMerchant(ctx context.Context, merchantAccountNumber int64) ([]Mandate, error)
+	RevokeMandate(ctx context.Context, mandateID uint, userID uint) (Mandate, error)
+	PullFunds(ctx context.Context, mandateID uint, merchantAccountNumber int64, amount float64, description string) (Pull, error)
+	GetMandatePulls(ctx context.Context, mandateID uint) ([]Pull, error)
+}
+
+// MandateService is the blueprint for the direct debit logic
+type MandateService struct {
+	Store MandateStore
+}
+
+func NewMandateService(store MandateStore) MandateService {
+	return MandateService{
+		Store: store,
+	}
+}
+
+// CreateMandate records a customer's authorisation. A zero ValidFrom starts the mandate immediately.
+func (s *MandateService) CreateMandate(ctx context.Context, mandate *Mandate) error {
+	if mandate.MaxAmount <= 0 {
+		return fmt.Errorf("%w: max_amount must be greater than zero", ErrInvalidMandate)
+	}
+	if !ValidPeriod(mandate.Period) {
+		return fmt.Errorf("%w: unknown period %q", ErrInvalidMandate, mandate.Period)
+	}
+	if mandate.CustomerAccountNumber == mandate.MerchantAccountNumber {
+		return fmt.Errorf("%w: customer and merchant accounts must differ", ErrInvalidMandate)
+	}
+	if mandate.ValidFrom.IsZero() {
+		mandate.ValidFrom = time.Now()
+	}
+	if mandate.ValidUntil != nil && !mandate.ValidUntil.After(mandate.ValidFrom) {
+		return fmt.Errorf("%w: valid_until must be after valid_from", ErrInvalidMandate)
+	}
+	mandate.Status = StatusActive
+
+	if err := s.Store.CreateMandate(ctx, mandate); err != nil {
+		log.Printf("Error creating mandate: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s *MandateService) GetMandateByID(ctx context.Context, mandateID uint) (Mandate, error) {
+	mandate, err := s.Store.GetMandateByID(ctx, mandateID)
+	if err != nil {
+		log.Printf("Error fetching mandate %v: %v", mandateID, err)
+		return mandate, err
+	}
+	return mandate, nil
+}
+
+// GetMandatesByUserID lists the mandates a customer has granted
+func (s *MandateService) GetMandatesByUserID(ctx context.Context, userID uint) ([]Mandate, error) {
+	list, err := s.Store.GetMandatesByUserID(ctx, userID)
+	if err != nil {
+		log.Printf("Error fetching mandates for user %v: %v", userID, err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetMandatesByMerchant lists the mandates granted to a merchant account
+func (s *MandateService) GetMandatesByMerchant(ctx context.Context, merchantAccountNumber int64) ([]Mandate, error) {
+	list, err := s.Store.GetMandatesByMerchant(ctx, merchantAccountNumber)
+	if err != nil {
+		log.Printf("Error fetching mandates for merchant account %v: %v", merchantAccountNumber, err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// RevokeMandate lets the customer withdraw a mandate. No further pulls are accepted.
+func (s *MandateService) RevokeMandate(ctx context.Context, mandateID uint, userID uint) (Mandate, error) {
+	mandate, err := s.Store.RevokeMandate(ctx, mandateID, userID)
+	if err != nil {
+		log.Printf("Error revoking mandate %v: %v", mandateID, err)
+		return mandate, err
+	}
+	return mandate, nil
+}
+
+// PullFunds transfers an amount from the customer to the merchant if the mandate's terms allow it
+func (s *MandateService) PullFunds(ctx context.Context, mandateID uint, merchantAccountNumber int64, amount float64, description string) (Pull, error) {
+	if amount <= 0 {
+		return Pull{}, fmt.Errorf("%w: amount must be greater than zero", ErrInvalidMandate)
+	}
+	pull, err := s.Store.PullFunds(ctx, mandateID, merchantAccountNumber, amount, description)
+	if err != nil {
+		log.Printf("Error pulling funds under mandate %v: %v", mandateID, err)
+		return pull, err
+	}
+	return pull, nil
+}
+
+// GetMandatePulls lists every pull attempted under a mandate, including rejected ones
+func (s *MandateService) GetMandatePulls(ctx context.Context, mandateID uint) ([]Pull, error) {
+	pulls, err := s.Store.GetMandatePulls(ctx, mandateID)
+	if err != nil {
+		log.Printf("Error fetching pulls of mandate %v: %v", mandateID, err)
+		return nil, err
+	}
+	return pulls, nil
+}
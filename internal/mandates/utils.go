@@ -0,0 +1,54 @@
+package mandates
+
+import (
+	"errors"
+	"time"
+)
+
+// ValidPeriod reports whether period is one of the supported mandate periods
+func ValidPeriod(period string) bool {
+	switch period {
+	case PeriodDaily, PeriodWeekly, PeriodMonthly, PeriodYearly:
+		return true
+	}
+	return false
+}
+
+// PeriodStart returns the start of the calendar period that contains t
+func PeriodStart(period string, t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case PeriodWeekly:
+		// time.Weekday counts from Sunday, mandate weeks start on Monday
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case PeriodMonthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case PeriodYearly:
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// CheckTerms verifies that a pull of amount at time now fits a mandate, given what has already been pulled in the
+// current period
+func CheckTerms(mandate Mandate, amount float64, pulledInPeriod float64, now time.Time) error {
+	if mandate.Status == StatusRevoked {
+		return ErrMandateRevoked
+	}
+	if now.Before(mandate.ValidFrom) || (mandate.ValidUntil != nil && now.After(*mandate.ValidUntil)) {
+		return ErrOutsideValidity
+	}
+	if pulledInPeriod+amount > mandate.MaxAmount {
+		return ErrLimitExceeded
+	}
+	return nil
+}
+
+// IsTermsViolation reports whether err rejects a pull on the mandate's terms rather than failing it for another reason
+func IsTermsViolation(err error) bool {
+	return errors.Is(err, ErrMandateRevoked) || errors.Is(err, ErrOutsideValidity) ||
+		errors.Is(err, ErrLimitExceeded) || errors.Is(err, ErrNotMerchant)
+}
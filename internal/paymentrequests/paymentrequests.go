@@ -0,0 +1,194 @@
+package paymentrequests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+// Payment request statuses. Only pending requests can change status.
+const (
+	StatusPending   = "pending"
+	StatusPaid      = "paid"
+	StatusDeclined  = "declined"
+	StatusCancelled = "cancelled"
+	StatusExpired   = "expired"
+)
+
+const (
+	// DefaultExpiry applies when a request is created without an expiry
+	DefaultExpiry = 7 * 24 * time.Hour
+	// MaxExpiry is the longest a request may stay open
+	MaxExpiry = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidRequest = errors.New("invalid payment request")
+	ErrNotPending     = errors.New("payment request is no longer pending")
+	ErrExpired        = errors.New("payment request has expired")
+	ErrNotPayer       = errors.New("only the payer can pay or decline a payment request")
+	ErrNotRequester   = errors.New("only the requester can cancel a payment request")
+)
+
+// PaymentRequest - a request from one user to another to be paid an amount
+type PaymentRequest struct {
+	ID                     uint       `json:"id"`
+	RequesterUserID        uint       `json:"requester_user_id"`
+	RequesterAccountNumber int64      `json:"requester_account_number"`
+	PayerUserID            uint       `json:"payer_user_id"`
+	PayerAccountNumber     int64      `json:"payer_account_number"`
+	Amount                 float64    `json:"amount"`
+	Note                   string     `json:"note"`
+	Status                 string     `json:"status"`
+	ExpiresAt              time.Time  `json:"expires_at"`
+	TransactionID          *uuid.UUID `json:"transaction_id,omitempty"`
+	CreatedAt              time.Time  `json:"created_at"`
+	UpdatedAt              time.Time  `json:"updated_at"`
+}
+
+type PaymentRequestStore interface {
+	CreatePaymentRequest(ctx context.Context, request *PaymentRequest) error
+	GetPaymentRequestByID(ctx context.Context, requestID uint) (PaymentRequest, error)
+	GetIncomingPaymentRequests(ctx context.Context, userID uint, status string) ([]PaymentRequest, error)
+	GetOutgoingPaymentRequests(ctx context.Context, userID uint, status string) ([]PaymentRequest, error)
+	PayPaymentRequest(ctx context.Context, requestID uint, userID uint) (PaymentRequest, error)
+	ChangePaymentRequestStatus(ctx context.Context, requestID uint, userID uint, status string) (PaymentRequest, error)
+	ExpirePaymentRequests(ctx context.Context, now time.Time) ([]PaymentRequest, error)
+}
+
+// Notifier is told about every payment request state change, after it has been committed
+type Notifier interface {
+	PaymentRequestChanged(ctx context.Context, request PaymentRequest)
+}
+
+// LogNotifier writes payment request state changes to the server log
+type LogNotifier struct{}
+
+func (LogNotifier) PaymentRequestChanged(ctx context.Context, request PaymentRequest) {
+	log.Printf("Payment request %d for %.2f from user %d to user %d is now %s",
+		request.ID, request.Amount, request.RequesterUserID, request.PayerUserID, request.Status)
+}
+
+// PaymentRequestService is the blueprint for the request-to-pay logic
+type PaymentRequestService struct {
+	Store    PaymentRequestStore
+	Notifier Notifier
+}
+
+func NewPaymentRequestService(store PaymentRequestStore, notifier Notifier) PaymentRequestService {
+	return PaymentRequestService{
+		Store:    store,
+		Notifier: notifier,
+	}
+}
+
+// CreatePaymentRequest opens a pending request. A zero expiry defaults to DefaultExpiry from now.
+func (s *PaymentRequestService) CreatePaymentRequest(ctx context.Context, request *PaymentRequest) error {
+	if request.Amount <= 0 {
+		return fmt.Errorf("%w: amount must be greater than zero", ErrInvalidRequest)
+	}
+	if request.RequesterAccountNumber == request.PayerAccountNumber {
+		return fmt.Errorf("%w: cannot request money from the same account", ErrInvalidRequest)
+	}
+
+	now := time.Now()
+	if request.ExpiresAt.IsZero() {
+		request.ExpiresAt = now.Add(DefaultExpiry)
+	}
+	if !request.ExpiresAt.After(now) || request.ExpiresAt.After(now.Add(MaxExpiry)) {
+		return fmt.Errorf("%w: expiry must be in the future and within 30 days", ErrInvalidRequest)
+	}
+	request.Status = StatusPending
+
+	if err := s.Store.CreatePaymentRequest(ctx, request); err != nil {
+		log.Printf("Error creating payment request: %v", err)
+		return err
+	}
+	s.Notifier.PaymentRequestChanged(ctx, *request)
+	return nil
+}
+
+func (s *PaymentRequestService) GetPaymentRequestByID(ctx context.Context, requestID uint) (PaymentRequest, error) {
+	request, err := s.Store.GetPaymentRequestByID(ctx, requestID)
+	if err != nil {
+		log.Printf("Error fetching payment request %v: %v", requestID, err)
+		return request, err
+	}
+	return request, nil
+}
+
+// GetIncomingPaymentRequests lists requests the user has been asked to pay, optionally filtered by status
+func (s *PaymentRequestService) GetIncomingPaymentRequests(ctx context.Context, userID uint, status string) ([]PaymentRequest, error) {
+	requests, err := s.Store.GetIncomingPaymentRequests(ctx, userID, status)
+	if err != nil {
+		log.Printf("Error fetching incoming payment requests for user %v: %v", userID, err)
+		return nil, err
+	}
+	return requests, nil
+}
+
+// GetOutgoingPaymentRequests lists requests the user has sent, optionally filtered by status
+func (s *PaymentRequestService) GetOutgoingPaymentRequests(ctx context.Context, userID uint, status string) ([]PaymentRequest, error) {
+	requests, err := s.Store.GetOutgoingPaymentRequests(ctx, userID, status)
+	if err != nil {
+		log.Printf("Error fetching outgoing payment requests for user %v: %v", userID, err)
+		return nil, err
+	}
+	return requests, nil
+}
+
+// PayPaymentRequest transfers the requested amount from the payer to the requester and links the transaction
+func (s *PaymentRequestService) PayPaymentRequest(ctx context.Context, requestID uint, userID uint) (PaymentRequest, error) {
+	request, err := s.Store.PayPaymentRequest(ctx, requestID, userID)
+	if err != nil {
+		log.Printf("Error paying payment request %v: %v", requestID, err)
+		return request, err
+	}
+	s.Notifier.PaymentRequestChanged(ctx, request)
+	return request, nil
+}
+
+// DeclinePaymentRequest lets the payer refuse a pending request
+func (s *PaymentRequestService) DeclinePaymentRequest(ctx context.Context, requestID uint, userID uint) (PaymentRequest, error) {
+	return s.changeStatus(ctx, requestID, userID, StatusDeclined)
+}
+
+// CancelPaymentRequest lets the requester withdraw a pending request
+func (s *PaymentRequestService) CancelPaymentRequest(ctx context.Context, requestID uint, userID uint) (PaymentRequest, error) {
+	return s.changeStatus(ctx, requestID, userID, StatusCancelled)
+}
+
+func (s *PaymentRequestService) changeStatus(ctx context.Context, requestID uint, userID uint, status string) (PaymentRequest, error) {
+	request, err := s.Store.ChangePaymentRequestStatus(ctx, requestID, userID, status)
+	if err != nil {
+		log.Printf("Error setting payment request %v to %s: %v", requestID, status, err)
+		return request, err
+	}
+	s.Notifier.PaymentRequestChanged(ctx, request)
+	return request, nil
+}
+
+// RunExpirySweep expires pending requests past their expiry once per interval until the context is cancelled
+func (s *PaymentRequestService) RunExpirySweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := s.Store.ExpirePaymentRequests(ctx, time.Now())
+		if err != nil {
+			log.Printf("Error expiring payment requests: %v", err)
+		}
+		for _, request := range expired {
+			s.Notifier.PaymentRequestChanged(ctx, request)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package pots
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+// PaymentMethodPot marks the transactions that move money between an account and one of its pots
+const PaymentMethodPot = "pot"
+
+// Pot statuses
+const (
+	StatusActive = "active"
+	StatusClosed = "closed"
+)
+
+// Auto-save rule kinds. A round-up rule saves the change of every debit from the pot's account, a weekly rule moves
+// a fixed amount once a week.
+const (
+	RuleRoundUp = "round_up"
+	RuleWeekly  = "weekly"
+)
+
+// Movement kinds
+const (
+	MovementDeposit    = "deposit"
+	MovementWithdrawal = "withdrawal"
+	MovementRoundUp    = "round_up"
+	MovementSweep      = "sweep"
+)
+
+// Movement statuses. Auto-save movements that could not be funded are kept as skipped and not retried.
+const (
+	MovementCompleted = "completed"
+	MovementSkipped   = "skipped"
+)
+
+// roundUpBatchSize bounds how many debits a round-up rule processes per run
+const roundUpBatchSize = 100
+
+var (
+	ErrInvalidPot           = errors.New("invalid pot")
+	ErrInvalidRule          = errors.New("invalid auto-save rule")
+	ErrNotOwner             = errors.New("pot does not belong to the user")
+	ErrPotLocked            = errors.New("pot is locked")
+	ErrPotClosed            = errors.New("pot is closed")
+	ErrInsufficientPotFunds = errors.New("amount exceeds the pot balance")
+)
+
+// Pot - a named savings goal holding money set aside from one of a user's accounts
+type Pot struct {
+	ID            uint       `json:"id"`
+	UserID        uint       `json:"user_id"`
+	AccountNumber int64      `json:"account_number"`
+	Name          string     `json:"name"`
+	TargetAmount  float64    `json:"target_amount"`
+	TargetDate    *time.Time `json:"target_date,omitempty"`
+	Balance       float64    `json:"balance"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+	Status        string     `json:"status"`
+	Rules         []Rule     `json:"rules"`
+	CreatedAt     time.Time  `json:"created_at"`
+	ClosedAt      *time.Time `json:"closed_at,omitempty"`
+}
+
+// Rule - an auto-save rule that funds a pot from its account
+type Rule struct {
+	ID        uint       `json:"id"`
+	PotID     uint       `json:"pot_id"`
+	Kind      string     `json:"kind"`
+	Amount    float64    `json:"amount,omitempty"`
+	RoundTo   float64    `json:"round_to,omitempty"`
+	NextRunAt *time.Time `json:"next_run_at,omitempty"`
+	Active    bool       `json:"active"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Movement - money moved into or out of a pot
+type Movement struct {
+	ID                  uint       `json:"id"`
+	PotID               uint       `json:"pot_id"`
+	RuleID              *uint      `json:"rule_id,omitempty"`
+	Kind                string     `json:"kind"`
+	Amount              float64    `json:"amount"`
+	Status              string     `json:"status"`
+	Reason              string     `json:"reason,omitempty"`
+	TransactionID       *uuid.UUID `json:"transaction_id,omitempty"`
+	SourceTransactionID *uuid.UUID `json:"source_transaction_id,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+type PotStore interface {
+	CreatePot(ctx context.Context, pot *Pot) error
+	GetPotByID(ctx context.Context, potID uint) (Pot, error)
+	GetPotsByUserID(ctx context.Context, userID uint) ([]Pot, error)
+	MovePotFunds(ctx context.Context, potID uint, userID uint, kind string, amount float64) (Movement, error)
+	LockPot(ctx context.Context, potID uint, userID uint, until time.Time) (Pot, error)
+	ClosePot(ctx context.Context, potID uint, userID uint) (Pot, error)
+	AddPotRule(ctx context.Context, userID uint, rule *Rule) error
+	DisablePotRule(ctx context.Context, potID uint, ruleID uint, userID uint) (Rule, error)
+	GetPotMovements(ctx context.Context, potID uint) ([]Movement, error)
+	ApplyRoundUps(ctx context.Context, limit int) (int, error)
+	RunWeeklySweeps(ctx context.Context, now time.Time) (int, error)
+}
+
+// PotService is the blueprint for the savings pot logic
+type PotService struct {
+	Store PotStore
+}
+
+func NewPotService(store PotStore) PotService {
+	return PotService{
+		Store: store,
+	}
+}
+
+// CreatePot opens an empty pot on one of the user's accounts
+func (s *PotService) CreatePot(ctx context.Context, pot *Pot) error {
+	if err := Validate(*pot, time.Now()); err != nil {
+		return err
+	}
+	pot.Balance = 0
+	pot.Status = StatusActive
+
+	if err := s.Store.CreatePot(ctx, pot); err != nil {
+		log.Printf("Error creating pot for user %v: %v", pot.UserID, err)
+		return err
+	}
+	return nil
+}
+
+func (s *PotService) GetPotByID(ctx context.Context, potID uint) (Pot, error) {
+	pot, err := s.Store.GetPotByID(ctx, potID)
+	if err != nil {
+		log.Printf("Error fetching pot %v: %v", potID, err)
+		return pot, err
+	}
+	return pot, nil
+}
+
+func (s *PotService) GetPotsByUserID(ctx context.Context, userID uint) ([]Pot, error) {
+	list, err := s.Store.GetPotsByUserID(ctx, userID)
+	if err != nil {
+		log.Printf("Error fetching pots for user %v: %v", userID, err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// Deposit moves money from the pot's account into the pot. Pots cannot be funded from an overdraft.
+func (s *PotService) Deposit(ctx context.Context, potID uint, userID uint, amount float64) (Movement, error) {
+	return s.move(ctx, potID, userID, MovementDeposit, amount)
+}
+
+// Withdraw moves money from the pot back to its account, unless the pot is locked
+func (s *PotService) Withdraw(ctx context.Context, potID uint, userID uint, amount float64) (Movement, error) {
+	return s.move(ctx, potID, userID, MovementWithdrawal, amount)
+}
+
+func (s *PotService) move(ctx context.Context, potID uint, userID uint, kind string, amount float64) (Movement, error) {
+	if amount <= 0 {
+		return Movement{}, fmt.Errorf("%w: amount must be greater than zero", ErrInvalidPot)
+	}
+	movement, err := s.Store.MovePotFunds(ctx, potID, userID, kind, amount)
+	if err != nil {
+		log.Printf("Error moving funds for pot %v: %v", potID, err)
+		return movement, err
+	}
+	return movement, nil
+}
+
+// LockPot blocks withdrawals until the given time. A lock can be extended but not shortened.
+func (s *PotService) LockPot(ctx context.Context, potID uint, userID uint, until time.Time) (Pot, error) {
+	if !until.After(time.Now()) {
+		return Pot{}, fmt.Errorf("%w: locked_until must be in the future", ErrInvalidPot)
+	}
+	pot, err := s.Store.LockPot(ctx, potID, userID, until)
+	if err != nil {
+		log.Printf("Error locking pot %v: %v", potID, err)
+		return pot, err
+	}
+	return pot, nil
+}
+
+// ClosePot returns the pot's balance to its account and stops its auto-save rules
+func (s *PotService) ClosePot(ctx context.Context, potID uint, userID uint) (Pot, error) {
+	pot, err := s.Store.ClosePot(ctx, potID, userID)
+	if err != nil {
+		log.Printf("Error closing pot %v: %v", potID, err)
+		return pot, err
+	}
+	return pot, nil
+}
+
+// AddPotRule attaches an auto-save rule to a pot. A weekly rule without a first run date starts on the next run of
+// the auto-save job.
+func (s *PotService) AddPotRule(ctx context.Context, userID uint, rule *Rule) error {
+	now := time.Now()
+	if err := ValidateRule(rule, now); err != nil {
+		return err
+	}
+	rule.Active = true
+
+	if err := s.Store.AddPotRule(ctx, userID, rule); err != nil {
+		log.Printf("Error adding auto-save rule to pot %v: %v", rule.PotID, err)
+		return err
+	}
+	return nil
+}
+
+func (s *PotService) DisablePotRule(ctx context.Context, potID uint, ruleID uint, userID uint) (Rule, error) {
+	rule, err := s.Store.DisablePotRule(ctx, potID, ruleID, userID)
+	if err != nil {
+		log.Printf("Error disabling auto-save rule %v: %v", ruleID, err)
+		return rule, err
+	}
+	return rule, nil
+}
+
+// GetPotMovements lists the money moved into and out of a pot, including skipped auto-saves
+func (s *PotService) GetPotMovements(ctx context.Context, potID uint) ([]Movement, error) {
+	movements, err := s.Store.GetPotMovements(ctx, potID)
+	if err != nil {
+		log.Printf("Error fetching movements of pot %v: %v", potID, err)
+		return nil, err
+	}
+	return movements, nil
+}
+
+// RunAutoSave applies round-ups and due weekly sweeps once per interval until the context is cancelled
+func (s *PotService) RunAutoSave(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if count, err := s.Store.ApplyRoundUps(ctx, roundUpBatchSize); err != nil {
+			log.Printf("Error applying round-ups: %v", err)
+		} else if count > 0 {
+			log.Printf("Applied %d round-ups", count)
+		}
+		if count, err := s.Store.RunWeeklySweeps(ctx, time.Now()); err != nil {
+			log.Printf("Error running weekly sweeps: %v", err)
+		} else if count > 0 {
+			log.Printf("Ran %d weekly sweeps", count)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
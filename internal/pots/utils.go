@@ -0,0 +1,77 @@
+package pots
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// defaultRoundTo is the unit debits are rounded up to when a round-up rule does not name one
+const defaultRoundTo = 1.00
+
+// Validate checks the user-supplied fields of a new pot
+func Validate(pot Pot, now time.Time) error {
+	if strings.TrimSpace(pot.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidPot)
+	}
+	if pot.TargetAmount < 0 {
+		return fmt.Errorf("%w: target_amount cannot be negative", ErrInvalidPot)
+	}
+	if pot.TargetDate != nil && !pot.TargetDate.After(now) {
+		return fmt.Errorf("%w: target_date must be in the future", ErrInvalidPot)
+	}
+	if pot.LockedUntil != nil && !pot.LockedUntil.After(now) {
+		return fmt.Errorf("%w: locked_until must be in the future", ErrInvalidPot)
+	}
+	return nil
+}
+
+// ValidateRule checks an auto-save rule and fills in its defaults
+func ValidateRule(rule *Rule, now time.Time) error {
+	switch rule.Kind {
+	case RuleRoundUp:
+		if rule.RoundTo == 0 {
+			rule.RoundTo = defaultRoundTo
+		}
+		if rule.RoundTo < 0.01 {
+			return fmt.Errorf("%w: round_to must be at least 0.01", ErrInvalidRule)
+		}
+		rule.Amount = 0
+		rule.NextRunAt = nil
+	case RuleWeekly:
+		if rule.Amount <= 0 {
+			return fmt.Errorf("%w: amount must be greater than zero", ErrInvalidRule)
+		}
+		if rule.NextRunAt == nil {
+			rule.NextRunAt = &now
+		}
+		rule.RoundTo = 0
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidRule, rule.Kind)
+	}
+	return nil
+}
+
+// IsLocked reports whether withdrawals from the pot are blocked at the given time
+func IsLocked(pot Pot, now time.Time) bool {
+	return pot.LockedUntil != nil && now.Before(*pot.LockedUntil)
+}
+
+// RoundUp returns the change needed to round amount up to the next multiple of roundTo, worked out in cents
+func RoundUp(amount float64, roundTo float64) float64 {
+	cents := math.Round(amount * 100)
+	unit := math.Round(roundTo * 100)
+	if unit <= 0 {
+		return 0
+	}
+	return (math.Ceil(cents/unit)*unit - cents) / 100
+}
+
+// NextSweep returns the first weekly run after now, skipping any weeks that were missed
+func NextSweep(next time.Time, now time.Time) time.Time {
+	for !next.After(now) {
+		next = next.AddDate(0, 0, 7)
+	}
+	return next
+}
@@ -0,0 +1,79 @@
+package privacy
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/aliases"
+	"PayWalletEngine/internal/audit"
+	"PayWalletEngine/internal/transactions"
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+var (
+	ErrAlreadyErased      = errors.New("user data has already been erased")
+	ErrOutstandingBalance = errors.New("user still holds a non-zero balance")
+	ErrOpenHolds          = errors.New("user still has open holds on their accounts")
+)
+
+// Profile - the personal data held about a user, without credentials
+type Profile struct {
+	ID        uint       `json:"id"`
+	Username  string     `json:"username"`
+	Email     string     `json:"email"`
+	IsActive  bool       `json:"is_active"`
+	CreatedAt time.Time  `json:"created_at"`
+	ErasedAt  *time.Time `json:"erased_at,omitempty"`
+}
+
+// Export - everything the engine holds about a single user
+type Export struct {
+	GeneratedAt  time.Time                   `json:"generated_at"`
+	Profile      Profile                     `json:"profile"`
+	Accounts     []accounts.Account          `json:"accounts"`
+	Aliases      []aliases.Alias             `json:"aliases"`
+	Transactions []transactions.Transactions `json:"transactions"`
+	AuditEntries []audit.Entry               `json:"audit_entries"`
+}
+
+type PrivacyStore interface {
+	GetUserDataExport(ctx context.Context, userID uint) (*Export, error)
+	EraseUser(ctx context.Context, userID uint) error
+}
+
+// PrivacyService is the blueprint for the data subject request logic
+type PrivacyService struct {
+	Store PrivacyStore
+}
+
+func NewPrivacyService(store PrivacyStore) PrivacyService {
+	return PrivacyService{
+		Store: store,
+	}
+}
+
+// ExportUserData gathers the user's data and packages it as a zip archive of JSON and CSV files
+func (s *PrivacyService) ExportUserData(ctx context.Context, userID uint) ([]byte, error) {
+	export, err := s.Store.GetUserDataExport(ctx, userID)
+	if err != nil {
+		log.Printf("Error gathering data export for user %v: %v", userID, err)
+		return nil, err
+	}
+
+	archive, err := BuildArchive(export)
+	if err != nil {
+		log.Printf("Error building data export archive for user %v: %v", userID, err)
+		return nil, err
+	}
+	return archive, nil
+}
+
+// EraseUser pseudonymizes the user's personal data while keeping their ledger history
+func (s *PrivacyService) EraseUser(ctx context.Context, userID uint) error {
+	if err := s.Store.EraseUser(ctx, userID); err != nil {
+		log.Printf("Error erasing user %v: %v", userID, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package privacy
+
+import (
+	"archive/zip"
+	"bytes"
+	crypto "crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Pseudonymize returns the replacement username, email and password for an erased user.
+// The password is random and not a valid bcrypt hash, so the user can no longer log in.
+func Pseudonymize(userID uint) (string, string, string, error) {
+	buf := make([]byte, 16)
+	if _, err := crypto.Read(buf); err != nil {
+		return "", "", "", err
+	}
+	username := fmt.Sprintf("erased-user-%d", userID)
+	email := fmt.Sprintf("erased-user-%d@erased.invalid", userID)
+	return username, email, hex.EncodeToString(buf), nil
+}
+
+// BuildArchive writes the export as export.json plus one CSV file per section into a zip archive
+func BuildArchive(export *Export) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	jsonFile, err := zw.Create("export.json")
+	if err != nil {
+		return nil, err
+	}
+	encoder := json.NewEncoder(jsonFile)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		return nil, err
+	}
+
+	profile := export.Profile
+	erasedAt := ""
+	if profile.ErasedAt != nil {
+		erasedAt = profile.ErasedAt.Format(time.RFC3339)
+	}
+	if err := writeCSV(zw, "profile.csv",
+		[]string{"id", "username", "email", "is_active", "created_at", "erased_at"},
+		[][]string{{
+			strconv.FormatUint(uint64(profile.ID), 10),
+			profile.Username,
+			profile.Email,
+			strconv.FormatBool(profile.IsActive),
+			profile.CreatedAt.Format(time.RFC3339),
+			erasedAt,
+		}}); err != nil {
+		return nil, err
+	}
+
+	var accountRows [][]string
+	for _, a := range export.Accounts {
+		accountRows = append(accountRows, []string{
+			strconv.FormatUint(uint64(a.ID), 10),
+			strconv.FormatInt(a.AccountNumber, 10),
+			a.AccountType,
+			strconv.FormatFloat(a.Balance, 'f', 2, 64),
+		})
+	}
+	if err := writeCSV(zw, "accounts.csv", []string{"id", "account_number", "account_type", "balance"}, accountRows); err != nil {
+		return nil, err
+	}
+
+	var aliasRows [][]string
+	for _, a := range export.Aliases {
+		aliasRows = append(aliasRows, []string{
+			strconv.FormatUint(uint64(a.ID), 10),
+			a.Type,
+			a.Value,
+			strconv.FormatBool(a.Verified),
+		})
+	}
+	if err := writeCSV(zw, "aliases.csv", []string{"id", "type", "value", "verified"}, aliasRows); err != nil {
+		return nil, err
+	}
+
+	var transactionRows [][]string
+	for _, t := range export.Transactions {
+		transactionRows = append(transactionRows, []string{
+			t.TransactionID.String(),
+			t.Reference,
+			t.Type,
+			t.Status,
+			t.PaymentMethod,
+			strconv.FormatFloat(t.Amount, 'f', 2, 64),
+			strconv.FormatInt(t.SenderAccountNumber, 10),
+			strconv.FormatInt(t.ReceiverAccountNumber, 10),
+			t.Description,
+		})
+	}
+	if err := writeCSV(zw, "transactions.csv",
+		[]string{"transaction_id", "reference", "type", "status", "payment_method", "amount", "sender_account_number", "receiver_account_number", "description"},
+		transactionRows); err != nil {
+		return nil, err
+	}
+
+	var auditRows [][]string
+	for _, e := range export.AuditEntries {
+		auditRows = append(auditRows, []string{
+			strconv.FormatUint(uint64(e.ID), 10),
+			e.Action,
+			e.Details,
+			e.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	if err := writeCSV(zw, "audit.csv", []string{"id", "action", "details", "created_at"}, auditRows); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeCSV(zw *zip.Writer, name string, header []string, rows [][]string) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return err
+	}
+	return w.Error()
+}
@@ -0,0 +1,306 @@
+package reconciliation
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Statement - the bookings read from a bank statement file, before they are reconciled
+type Statement struct {
+	Reference string
+	Currency  string
+	Entries   []Entry
+}
+
+// Entry - one booking on the bank account. Credits are positive, debits negative.
+type Entry struct {
+	Date        time.Time
+	Amount      float64
+	Currency    string
+	Reference   string
+	Description string
+}
+
+// Parse reads a bank statement in one of the import formats
+func Parse(format string, data []byte) (Statement, error) {
+	switch format {
+	case FormatCSV:
+		return ParseCSV(bytes.NewReader(data))
+	case FormatMT940:
+		return ParseMT940(data)
+	case FormatCamt053:
+		return ParseCamt053(data)
+	}
+	return Statement{}, fmt.Errorf("%w: format must be csv, mt940 or camt053", ErrInvalidImport)
+}
+
+// ParseCSV reads bookings from CSV with a header row naming the date (YYYY-MM-DD) and signed amount columns and,
+// optionally, the reference, description and currency columns
+func ParseCSV(r io.Reader) (Statement, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return Statement{}, fmt.Errorf("%w: missing CSV header: %v", ErrInvalidImport, err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	dateColumn, hasDate := columns["date"]
+	amountColumn, hasAmount := columns["amount"]
+	if !hasDate || !hasAmount {
+		return Statement{}, fmt.Errorf("%w: CSV header must name date and amount", ErrInvalidImport)
+	}
+	optional := func(record []string, name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var statement Statement
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Statement{}, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+		date, err := time.Parse("2006-01-02", strings.TrimSpace(record[dateColumn]))
+		if err != nil {
+			return Statement{}, fmt.Errorf("%w: line %d: date must be YYYY-MM-DD", ErrInvalidImport, line)
+		}
+		amount, err := strconv.ParseFloat(strings.TrimSpace(record[amountColumn]), 64)
+		if err != nil {
+			return Statement{}, fmt.Errorf("%w: line %d: invalid amount", ErrInvalidImport, line)
+		}
+		statement.Entries = append(statement.Entries, Entry{
+			Date:        date,
+			Amount:      amount,
+			Currency:    strings.ToUpper(optional(record, "currency")),
+			Reference:   optional(record, "reference"),
+			Description: optional(record, "description"),
+		})
+	}
+	return statement, nil
+}
+
+var (
+	mt940Field = regexp.MustCompile(`^:(\d{2}[A-Z]?):(.*)$`)
+	// value date, optional entry date, mark, optional funds code, amount, transaction type, owner reference and
+	// optional servicer reference
+	mt940Entry   = regexp.MustCompile(`^(\d{6})(\d{4})?(R?[CD])([A-Z])?(\d+,\d{0,2})([A-Z][A-Z0-9]{3})([^/]*?)(?://(.*))?$`)
+	mt940Balance = regexp.MustCompile(`^[CD](\d{6})([A-Z]{3})(\d+,\d{0,2})$`)
+)
+
+// ParseMT940 reads the :61: bookings of SWIFT MT940 messages. The customer's reference of a booking is its owner
+// reference, or its servicer reference when the owner gave none. The supplementary details and the :86: narrative
+// make up its description.
+func ParseMT940(data []byte) (Statement, error) {
+	type field struct {
+		tag   string
+		value string
+	}
+	var fields []field
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	for _, line := range strings.Split(text, "\n") {
+		if match := mt940Field.FindStringSubmatch(line); match != nil {
+			fields = append(fields, field{tag: match[1], value: match[2]})
+			continue
+		}
+		// block markers, the end of a message and blank lines carry no data
+		if line == "" || line == "-" || strings.HasPrefix(line, "{") || strings.HasPrefix(line, "-}") {
+			continue
+		}
+		if len(fields) > 0 {
+			fields[len(fields)-1].value += "\n" + line
+		}
+	}
+
+	var statement Statement
+	var current *Entry
+	for _, f := range fields {
+		switch f.tag {
+		case "20":
+			if statement.Reference == "" {
+				statement.Reference = strings.TrimSpace(f.value)
+			}
+		case "60F", "60M":
+			match := mt940Balance.FindStringSubmatch(strings.TrimSpace(f.value))
+			if match == nil {
+				return Statement{}, fmt.Errorf("%w: invalid opening balance %q", ErrInvalidImport, f.value)
+			}
+			if statement.Currency == "" {
+				statement.Currency = match[2]
+			}
+		case "61":
+			lines := strings.SplitN(f.value, "\n", 2)
+			match := mt940Entry.FindStringSubmatch(strings.TrimSpace(lines[0]))
+			if match == nil {
+				return Statement{}, fmt.Errorf("%w: invalid :61: booking %q", ErrInvalidImport, lines[0])
+			}
+			date, err := time.Parse("060102", match[1])
+			if err != nil {
+				return Statement{}, fmt.Errorf("%w: invalid :61: value date %q", ErrInvalidImport, match[1])
+			}
+			amount, err := strconv.ParseFloat(strings.Replace(match[5], ",", ".", 1), 64)
+			if err != nil {
+				return Statement{}, fmt.Errorf("%w: invalid :61: amount %q", ErrInvalidImport, match[5])
+			}
+			// debits and reversed credits take money off the account
+			if match[3] == "D" || match[3] == "RC" {
+				amount = -amount
+			}
+			reference := strings.TrimSpace(match[7])
+			if reference == "" || reference == "NONREF" {
+				reference = strings.TrimSpace(match[8])
+			}
+			entry := Entry{Date: date, Amount: amount, Currency: statement.Currency, Reference: reference}
+			if len(lines) > 1 {
+				entry.Description = strings.TrimSpace(lines[1])
+			}
+			statement.Entries = append(statement.Entries, entry)
+			current = &statement.Entries[len(statement.Entries)-1]
+		case "86":
+			if current != nil {
+				narrative := strings.Join(strings.Fields(f.value), " ")
+				current.Description = strings.TrimSpace(current.Description + " " + narrative)
+			}
+		}
+	}
+	return statement, nil
+}
+
+// camtImport holds what a camt.053 import reads. Elements are matched by local name, so every version of the
+// schema is read the same way.
+type camtImport struct {
+	Statements []struct {
+		Id   string `xml:"Id"`
+		Ccy  string `xml:"Acct>Ccy"`
+		Ntry []struct {
+			NtryRef string `xml:"NtryRef"`
+			Amt     struct {
+				Ccy   string `xml:"Ccy,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"Amt"`
+			CdtDbtInd string `xml:"CdtDbtInd"`
+			RvslInd   bool   `xml:"RvslInd"`
+			// the status is text up to camt.053.001.04 and a code element from then on
+			Sts struct {
+				Text string `xml:",chardata"`
+				Cd   string `xml:"Cd"`
+			} `xml:"Sts"`
+			BookgDt     camtDate `xml:"BookgDt"`
+			ValDt       camtDate `xml:"ValDt"`
+			AcctSvcrRef string   `xml:"AcctSvcrRef"`
+			TxDtls      []struct {
+				EndToEndId string   `xml:"Refs>EndToEndId"`
+				CdtrRef    string   `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+				Ustrd      []string `xml:"RmtInf>Ustrd"`
+			} `xml:"NtryDtls>TxDtls"`
+			AddtlNtryInf string `xml:"AddtlNtryInf"`
+		} `xml:"Ntry"`
+	} `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtDate struct {
+	Dt   string `xml:"Dt"`
+	DtTm string `xml:"DtTm"`
+}
+
+func (d camtDate) time() (time.Time, bool) {
+	if d.Dt != "" {
+		t, err := time.Parse("2006-01-02", strings.TrimSpace(d.Dt))
+		return t, err == nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(d.DtTm)); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// ParseCamt053 reads the booked entries of an ISO 20022 camt.053 statement. The customer's reference of an entry is
+// its structured creditor reference, else its end-to-end ID, else the entry's own reference. The remittance
+// information and additional entry information make up its description.
+func ParseCamt053(data []byte) (Statement, error) {
+	var doc camtImport
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return Statement{}, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	if len(doc.Statements) == 0 {
+		return Statement{}, fmt.Errorf("%w: no BkToCstmrStmt/Stmt element", ErrInvalidImport)
+	}
+
+	statement := Statement{Reference: strings.TrimSpace(doc.Statements[0].Id), Currency: strings.TrimSpace(doc.Statements[0].Ccy)}
+	for _, stmt := range doc.Statements {
+		for _, ntry := range stmt.Ntry {
+			status := strings.TrimSpace(ntry.Sts.Cd + ntry.Sts.Text)
+			if status != "" && status != "BOOK" {
+				continue
+			}
+			amount, err := strconv.ParseFloat(strings.TrimSpace(ntry.Amt.Value), 64)
+			if err != nil {
+				return Statement{}, fmt.Errorf("%w: invalid entry amount %q", ErrInvalidImport, ntry.Amt.Value)
+			}
+			credit := ntry.CdtDbtInd == "CRDT"
+			if ntry.RvslInd {
+				credit = !credit
+			}
+			if !credit {
+				amount = -amount
+			}
+			date, ok := ntry.BookgDt.time()
+			if !ok {
+				if date, ok = ntry.ValDt.time(); !ok {
+					return Statement{}, fmt.Errorf("%w: entry %q has no booking date", ErrInvalidImport, ntry.NtryRef)
+				}
+			}
+
+			var reference string
+			var description []string
+			for _, tx := range ntry.TxDtls {
+				for _, candidate := range []string{tx.CdtrRef, tx.EndToEndId} {
+					candidate = strings.TrimSpace(candidate)
+					if reference == "" && candidate != "" && candidate != "NOTPROVIDED" {
+						reference = candidate
+					}
+				}
+				for _, text := range tx.Ustrd {
+					if text = strings.TrimSpace(text); text != "" {
+						description = append(description, text)
+					}
+				}
+			}
+			if reference == "" {
+				reference = strings.TrimSpace(ntry.NtryRef)
+			}
+			if reference == "" {
+				reference = strings.TrimSpace(ntry.AcctSvcrRef)
+			}
+			if info := strings.TrimSpace(ntry.AddtlNtryInf); info != "" {
+				description = append(description, info)
+			}
+
+			statement.Entries = append(statement.Entries, Entry{
+				Date:        date,
+				Amount:      amount,
+				Currency:    strings.TrimSpace(ntry.Amt.Ccy),
+				Reference:   reference,
+				Description: strings.Join(description, " "),
+			})
+		}
+	}
+	return statement, nil
+}
@@ -0,0 +1,273 @@
+package reconciliation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+// PaymentMethodBankTransfer marks the credits posted for funding received on the bank account
+const PaymentMethodBankTransfer = "bank_transfer"
+
+// Bank statement formats that can be imported
+const (
+	FormatCSV     = "csv"
+	FormatMT940   = "mt940"
+	FormatCamt053 = "camt053"
+)
+
+// Line statuses. Unmatched lines and discrepancies make up the exception queue until they are matched or ignored.
+const (
+	LineMatched     = "matched"
+	LineUnmatched   = "unmatched"
+	LineDiscrepancy = "discrepancy"
+	LineIgnored     = "ignored"
+)
+
+// How a line was matched: a posted line had a credit posted to the wallet for it, a confirmed line is the funding of
+// a credit that had already been posted by hand
+const (
+	MatchPosted    = "posted"
+	MatchConfirmed = "confirmed"
+)
+
+// Expected credit statuses
+const (
+	ExpectedPending   = "pending"
+	ExpectedMatched   = "matched"
+	ExpectedCancelled = "cancelled"
+)
+
+var (
+	ErrInvalidImport         = errors.New("invalid bank statement")
+	ErrInvalidExpectedCredit = errors.New("invalid expected credit")
+	ErrInvalidMatch          = errors.New("invalid match")
+	ErrDuplicateImport       = errors.New("bank statement has already been imported")
+	ErrExpectedCreditExists  = errors.New("a pending expected credit already has this reference")
+	ErrExpectedCreditClosed  = errors.New("expected credit is no longer pending")
+	ErrLineResolved          = errors.New("bank statement line is already resolved")
+	ErrAlreadyReconciled     = errors.New("transaction is already reconciled")
+)
+
+// Import - one bank statement file and what its import did
+type Import struct {
+	ID                 uint      `json:"id"`
+	Format             string    `json:"format"`
+	Digest             string    `json:"-"`
+	StatementReference string    `json:"statement_reference"`
+	Currency           string    `json:"currency"`
+	LineCount          int       `json:"line_count"`
+	DuplicateLines     int       `json:"duplicate_lines"`
+	SkippedDebits      int       `json:"skipped_debits"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// Line - one credit on the bank account, and the wallet credit it was matched with
+type Line struct {
+	ID                     uint       `json:"id"`
+	ImportID               uint       `json:"import_id"`
+	Date                   time.Time  `json:"date"`
+	Amount                 float64    `json:"amount"`
+	Reference              string     `json:"reference"`
+	Description            string     `json:"description"`
+	Fingerprint            string     `json:"-"`
+	Status                 string     `json:"status"`
+	MatchKind              string     `json:"match_kind,omitempty"`
+	ExpectedCreditID       *uint      `json:"expected_credit_id,omitempty"`
+	TransactionID          *uuid.UUID `json:"transaction_id,omitempty"`
+	CandidateTransactionID *uuid.UUID `json:"candidate_transaction_id,omitempty"`
+	Difference             float64    `json:"difference,omitempty"`
+	Note                   string     `json:"note,omitempty"`
+	MatchedAt              *time.Time `json:"matched_at,omitempty"`
+	CreatedAt              time.Time  `json:"created_at"`
+}
+
+// ExpectedCredit - funding announced for a wallet account, credited once the bank statement shows it arrived
+type ExpectedCredit struct {
+	ID            uint       `json:"id"`
+	AccountNumber int64      `json:"account_number"`
+	Amount        float64    `json:"amount"`
+	Reference     string     `json:"reference"`
+	Description   string     `json:"description"`
+	ExpectedDate  time.Time  `json:"expected_date"`
+	Status        string     `json:"status"`
+	LineID        *uint      `json:"line_id,omitempty"`
+	TransactionID *uuid.UUID `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	MatchedAt     *time.Time `json:"matched_at,omitempty"`
+}
+
+// Match - how an agent resolves an exception: by posting it against an expected credit, confirming it as the funding
+// of an existing credit, or posting it to an account. Exactly one of them is given.
+type Match struct {
+	ExpectedCreditID *uint      `json:"expected_credit_id,omitempty"`
+	TransactionID    *uuid.UUID `json:"transaction_id,omitempty"`
+	AccountNumber    int64      `json:"account_number,omitempty"`
+	Note             string     `json:"note"`
+}
+
+// Total - the number and sum of a group of lines
+type Total struct {
+	Count  int     `json:"count"`
+	Amount float64 `json:"amount"`
+}
+
+// Report - the reconciliation of one import: its lines grouped by outcome, with totals
+type Report struct {
+	Import           Import `json:"import"`
+	Matched          Total  `json:"matched"`
+	Posted           Total  `json:"posted"`
+	Confirmed        Total  `json:"confirmed"`
+	Unmatched        Total  `json:"unmatched"`
+	Discrepancies    Total  `json:"discrepancies"`
+	Ignored          Total  `json:"ignored"`
+	MatchedLines     []Line `json:"matched_lines"`
+	UnmatchedLines   []Line `json:"unmatched_lines"`
+	DiscrepancyLines []Line `json:"discrepancy_lines"`
+	IgnoredLines     []Line `json:"ignored_lines"`
+}
+
+type ReconciliationStore interface {
+	CreateExpectedCredit(ctx context.Context, credit *ExpectedCredit) error
+	GetExpectedCredits(ctx context.Context, status string) ([]ExpectedCredit, error)
+	CancelExpectedCredit(ctx context.Context, creditID uint) (ExpectedCredit, error)
+	ImportBankStatement(ctx context.Context, imp *Import, lines []Line, toleranceDays int) (Report, error)
+	GetImports(ctx context.Context) ([]Import, error)
+	GetReconciliationReport(ctx context.Context, importID uint) (Report, error)
+	GetExceptions(ctx context.Context) ([]Line, error)
+	MatchLine(ctx context.Context, lineID uint, match Match) (Line, error)
+	IgnoreLine(ctx context.Context, lineID uint, note string) (Line, error)
+}
+
+// ReconciliationService is the blueprint for the bank reconciliation logic
+type ReconciliationService struct {
+	Store ReconciliationStore
+}
+
+func NewReconciliationService(store ReconciliationStore) ReconciliationService {
+	return ReconciliationService{
+		Store: store,
+	}
+}
+
+// CreateExpectedCredit announces funding that the next bank statements should show
+func (s *ReconciliationService) CreateExpectedCredit(ctx context.Context, credit *ExpectedCredit) error {
+	if credit.ExpectedDate.IsZero() {
+		credit.ExpectedDate = time.Now().Truncate(24 * time.Hour)
+	}
+	if err := ValidateExpectedCredit(*credit); err != nil {
+		return err
+	}
+	credit.Status = ExpectedPending
+	if err := s.Store.CreateExpectedCredit(ctx, credit); err != nil {
+		log.Printf("Error creating expected credit for account %v: %v", credit.AccountNumber, err)
+		return err
+	}
+	return nil
+}
+
+// GetExpectedCredits lists expected credits, optionally only those with the status
+func (s *ReconciliationService) GetExpectedCredits(ctx context.Context, status string) ([]ExpectedCredit, error) {
+	switch status {
+	case "", ExpectedPending, ExpectedMatched, ExpectedCancelled:
+	default:
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidExpectedCredit, status)
+	}
+	list, err := s.Store.GetExpectedCredits(ctx, status)
+	if err != nil {
+		log.Printf("Error fetching expected credits: %v", err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// CancelExpectedCredit withdraws a pending expected credit so no bank line is matched with it
+func (s *ReconciliationService) CancelExpectedCredit(ctx context.Context, creditID uint) (ExpectedCredit, error) {
+	credit, err := s.Store.CancelExpectedCredit(ctx, creditID)
+	if err != nil {
+		log.Printf("Error cancelling expected credit %v: %v", creditID, err)
+		return credit, err
+	}
+	return credit, nil
+}
+
+// ImportBankStatement parses a bank statement and reconciles its credits. Each credit is matched by reference, or
+// else by amount within the date tolerance, with a pending expected credit, which is then posted, or with a credit
+// already posted by hand, which is then confirmed. Lines seen in an earlier import are skipped, and the rest go to
+// the exception queue.
+func (s *ReconciliationService) ImportBankStatement(ctx context.Context, format string, data []byte) (Report, error) {
+	statement, err := Parse(format, data)
+	if err != nil {
+		return Report{}, err
+	}
+	imp, lines, err := prepareImport(format, data, statement)
+	if err != nil {
+		return Report{}, err
+	}
+	report, err := s.Store.ImportBankStatement(ctx, &imp, lines, DateToleranceDays())
+	if err != nil {
+		log.Printf("Error importing %v bank statement %q: %v", format, statement.Reference, err)
+		return Report{}, err
+	}
+	return report, nil
+}
+
+func (s *ReconciliationService) GetImports(ctx context.Context) ([]Import, error) {
+	list, err := s.Store.GetImports(ctx)
+	if err != nil {
+		log.Printf("Error fetching bank statement imports: %v", err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetReconciliationReport shows how the lines of an import were matched, which are unmatched and which disagree
+// with the credit they were matched to
+func (s *ReconciliationService) GetReconciliationReport(ctx context.Context, importID uint) (Report, error) {
+	report, err := s.Store.GetReconciliationReport(ctx, importID)
+	if err != nil {
+		log.Printf("Error fetching reconciliation report of import %v: %v", importID, err)
+		return report, err
+	}
+	return report, nil
+}
+
+// GetExceptions lists the unmatched lines and discrepancies of every import, oldest first
+func (s *ReconciliationService) GetExceptions(ctx context.Context) ([]Line, error) {
+	list, err := s.Store.GetExceptions(ctx)
+	if err != nil {
+		log.Printf("Error fetching reconciliation exceptions: %v", err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// MatchLine resolves an exception by hand, for the amount the bank received
+func (s *ReconciliationService) MatchLine(ctx context.Context, lineID uint, match Match) (Line, error) {
+	if err := ValidateMatch(match); err != nil {
+		return Line{}, err
+	}
+	line, err := s.Store.MatchLine(ctx, lineID, match)
+	if err != nil {
+		log.Printf("Error matching bank statement line %v: %v", lineID, err)
+		return line, err
+	}
+	return line, nil
+}
+
+// IgnoreLine takes an exception out of the queue without crediting anyone, e.g. for a refund or an interest payment
+// from the bank
+func (s *ReconciliationService) IgnoreLine(ctx context.Context, lineID uint, note string) (Line, error) {
+	if note == "" {
+		return Line{}, fmt.Errorf("%w: a note is required", ErrInvalidMatch)
+	}
+	line, err := s.Store.IgnoreLine(ctx, lineID, note)
+	if err != nil {
+		log.Printf("Error ignoring bank statement line %v: %v", lineID, err)
+		return line, err
+	}
+	return line, nil
+}
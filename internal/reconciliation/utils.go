@@ -0,0 +1,118 @@
+package reconciliation
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/fees"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultDateToleranceDays is used when RECONCILIATION_DATE_TOLERANCE_DAYS is unset or invalid
+const defaultDateToleranceDays = 3
+
+// DateToleranceDays returns how many days a bank line may be booked before or after the credit it is matched to by
+// amount, read from RECONCILIATION_DATE_TOLERANCE_DAYS
+func DateToleranceDays() int {
+	days, err := strconv.Atoi(os.Getenv("RECONCILIATION_DATE_TOLERANCE_DAYS"))
+	if err != nil || days < 0 {
+		return defaultDateToleranceDays
+	}
+	return days
+}
+
+// ValidateExpectedCredit checks that an expected credit names the account, amount and reference to match on
+func ValidateExpectedCredit(credit ExpectedCredit) error {
+	if err := accounts.ValidateAccountNumber(credit.AccountNumber); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidExpectedCredit, err)
+	}
+	if credit.Amount <= 0 || math.Round(credit.Amount*100) != credit.Amount*100 {
+		return fmt.Errorf("%w: amount must be positive with at most two decimals", ErrInvalidExpectedCredit)
+	}
+	reference := strings.TrimSpace(credit.Reference)
+	if reference == "" || len(reference) > 100 {
+		return fmt.Errorf("%w: reference is required and at most 100 characters", ErrInvalidExpectedCredit)
+	}
+	return nil
+}
+
+// ValidateMatch checks that a manual match names exactly one thing to match the line with
+func ValidateMatch(match Match) error {
+	given := 0
+	if match.ExpectedCreditID != nil {
+		given++
+	}
+	if match.TransactionID != nil {
+		given++
+	}
+	if match.AccountNumber != 0 {
+		given++
+		if err := accounts.ValidateAccountNumber(match.AccountNumber); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidMatch, err)
+		}
+	}
+	if given != 1 {
+		return fmt.Errorf("%w: give exactly one of expected_credit_id, transaction_id and account_number", ErrInvalidMatch)
+	}
+	return nil
+}
+
+// clip cuts s to the length of the column it is stored in
+func clip(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+	return string(runes[:length])
+}
+
+// prepareImport turns the credits of a parsed statement into lines to reconcile. Debits leave the bank account for
+// other reasons and are only counted. Each line gets a fingerprint from its booking, so re-importing a statement that
+// overlaps an earlier one skips the lines already seen; identical bookings within one file are told apart by their
+// order.
+func prepareImport(format string, data []byte, statement Statement) (Import, []Line, error) {
+	currency := fees.Currency()
+	if statement.Currency != "" && statement.Currency != currency {
+		return Import{}, nil, fmt.Errorf("%w: statement is in %s, wallets are in %s", ErrInvalidImport, statement.Currency, currency)
+	}
+	if len(statement.Entries) == 0 {
+		return Import{}, nil, fmt.Errorf("%w: statement has no entries", ErrInvalidImport)
+	}
+
+	digest := sha256.Sum256(data)
+	imp := Import{
+		Format:             format,
+		Digest:             hex.EncodeToString(digest[:]),
+		StatementReference: clip(statement.Reference, 100),
+		Currency:           currency,
+	}
+
+	var lines []Line
+	seen := make(map[string]int)
+	for _, entry := range statement.Entries {
+		if entry.Currency != "" && entry.Currency != currency {
+			return Import{}, nil, fmt.Errorf("%w: entry %q is in %s, wallets are in %s", ErrInvalidImport, entry.Reference, entry.Currency, currency)
+		}
+		if entry.Amount <= 0 {
+			imp.SkippedDebits++
+			continue
+		}
+		amount := math.Round(entry.Amount*100) / 100
+		key := fmt.Sprintf("%s|%.2f|%s|%s", entry.Date.Format("2006-01-02"), amount, entry.Reference, entry.Description)
+		seen[key]++
+		fingerprint := sha256.Sum256([]byte(fmt.Sprintf("%s#%d", key, seen[key])))
+		lines = append(lines, Line{
+			Date:        entry.Date,
+			Amount:      amount,
+			Reference:   clip(entry.Reference, 100),
+			Description: clip(entry.Description, 255),
+			Fingerprint: hex.EncodeToString(fingerprint[:]),
+			Status:      LineUnmatched,
+		})
+	}
+	return imp, lines, nil
+}
@@ -0,0 +1,271 @@
+package schedules
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/transactions"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+// PaymentMethodStandingOrder marks transfers made by the schedule worker
+const PaymentMethodStandingOrder = "standing order"
+
+// Recurrence frequencies. A schedule with FrequencyOnce runs a single time at StartAt.
+const (
+	FrequencyOnce    = "once"
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+)
+
+// Schedule statuses. Completed schedules have no occurrences left.
+const (
+	StatusActive    = "active"
+	StatusPaused    = "paused"
+	StatusCancelled = "cancelled"
+	StatusCompleted = "completed"
+)
+
+// Run statuses. A processing run has claimed its occurrence and a retrying run is waiting for its next attempt.
+const (
+	RunProcessing = "processing"
+	RunRetrying   = "retrying"
+	RunCompleted  = "completed"
+	RunFailed     = "failed"
+)
+
+var (
+	ErrInvalidSchedule         = errors.New("invalid schedule")
+	ErrInvalidStatusTransition = errors.New("invalid schedule status transition")
+	ErrNotOwner                = errors.New("schedule does not belong to the user")
+)
+
+// Schedule - a one-off future transfer or a standing order
+type Schedule struct {
+	ID                    uint       `json:"id"`
+	UserID                uint       `json:"user_id"`
+	SenderAccountNumber   int64      `json:"sender_account_number"`
+	ReceiverAccountNumber int64      `json:"receiver_account_number"`
+	Amount                float64    `json:"amount"`
+	Description           string     `json:"description"`
+	Frequency             string     `json:"frequency"`
+	Interval              int        `json:"interval"`
+	DayOfMonth            int        `json:"day_of_month,omitempty"`
+	StartAt               time.Time  `json:"start_at"`
+	EndAt                 *time.Time `json:"end_at,omitempty"`
+	Count                 int        `json:"count,omitempty"`
+	Occurrences           int        `json:"occurrences"`
+	NextRunAt             *time.Time `json:"next_run_at"`
+	Status                string     `json:"status"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+// Run - one attempt, or series of retried attempts, at executing a schedule occurrence
+type Run struct {
+	ID            uint       `json:"id"`
+	ScheduleID    uint       `json:"schedule_id"`
+	OccurrenceAt  time.Time  `json:"occurrence_at"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	TransactionID *uuid.UUID `json:"transaction_id,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+type ScheduleStore interface {
+	CreateSchedule(ctx context.Context, schedule *Schedule) error
+	GetScheduleByID(ctx context.Context, scheduleID uint) (Schedule, error)
+	GetSchedulesByUserID(ctx context.Context, userID uint) ([]Schedule, error)
+	ChangeScheduleStatus(ctx context.Context, scheduleID uint, userID uint, status string) (Schedule, error)
+	GetDueSchedules(ctx context.Context, now time.Time, limit int) ([]Schedule, error)
+	ClaimOccurrence(ctx context.Context, scheduleID uint, occurrenceAt time.Time, now time.Time) (Run, bool, error)
+	FinishRun(ctx context.Context, run Run) (Schedule, error)
+	GetScheduleRuns(ctx context.Context, scheduleID uint) ([]Run, error)
+}
+
+// Transferer executes the transfer for a schedule occurrence
+type Transferer interface {
+	TransferFunds(ctx context.Context, senderAccountNumber int64, receiverAccountNumber int64, amount float64, description string, paymentMethod string) (*transactions.Transactions, error)
+}
+
+// Notifier is told when a schedule occurrence fails, whether or not it will be retried
+type Notifier interface {
+	ScheduleRunFailed(ctx context.Context, schedule Schedule, run Run)
+}
+
+// LogNotifier writes failed schedule runs to the server log
+type LogNotifier struct{}
+
+func (LogNotifier) ScheduleRunFailed(ctx context.Context, schedule Schedule, run Run) {
+	log.Printf("Schedule %d for user %d failed attempt %d of its %s occurrence (%s): %s",
+		schedule.ID, schedule.UserID, run.Attempts, run.OccurrenceAt.Format(time.RFC3339), run.Status, run.Error)
+}
+
+// ScheduleService is the blueprint for the scheduled transfer logic
+type ScheduleService struct {
+	Store     ScheduleStore
+	Transfers Transferer
+	Notifier  Notifier
+	Retry     RetryPolicy
+}
+
+func NewScheduleService(store ScheduleStore, transfers Transferer, notifier Notifier) ScheduleService {
+	return ScheduleService{
+		Store:     store,
+		Transfers: transfers,
+		Notifier:  notifier,
+		Retry:     ConfiguredRetryPolicy(),
+	}
+}
+
+// CreateSchedule validates the recurrence and stores an active schedule with its first run time
+func (s *ScheduleService) CreateSchedule(ctx context.Context, schedule *Schedule) error {
+	if schedule.Amount <= 0 {
+		return fmt.Errorf("%w: amount must be greater than zero", ErrInvalidSchedule)
+	}
+	if schedule.SenderAccountNumber == schedule.ReceiverAccountNumber {
+		return fmt.Errorf("%w: sender and receiver must differ", ErrInvalidSchedule)
+	}
+	if err := Normalize(schedule, time.Now()); err != nil {
+		return err
+	}
+
+	if err := s.Store.CreateSchedule(ctx, schedule); err != nil {
+		log.Printf("Error creating schedule: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s *ScheduleService) GetScheduleByID(ctx context.Context, scheduleID uint) (Schedule, error) {
+	schedule, err := s.Store.GetScheduleByID(ctx, scheduleID)
+	if err != nil {
+		log.Printf("Error fetching schedule %v: %v", scheduleID, err)
+		return schedule, err
+	}
+	return schedule, nil
+}
+
+func (s *ScheduleService) GetSchedulesByUserID(ctx context.Context, userID uint) ([]Schedule, error) {
+	list, err := s.Store.GetSchedulesByUserID(ctx, userID)
+	if err != nil {
+		log.Printf("Error fetching schedules for user %v: %v", userID, err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetScheduleRuns lists the executed and retrying occurrences of a schedule
+func (s *ScheduleService) GetScheduleRuns(ctx context.Context, scheduleID uint) ([]Run, error) {
+	runs, err := s.Store.GetScheduleRuns(ctx, scheduleID)
+	if err != nil {
+		log.Printf("Error fetching runs of schedule %v: %v", scheduleID, err)
+		return nil, err
+	}
+	return runs, nil
+}
+
+// PauseSchedule stops an active schedule from running until it is resumed
+func (s *ScheduleService) PauseSchedule(ctx context.Context, scheduleID uint, userID uint) (Schedule, error) {
+	return s.changeStatus(ctx, scheduleID, userID, StatusPaused)
+}
+
+// ResumeSchedule reactivates a paused schedule. Occurrences that fell due while it was paused are skipped.
+func (s *ScheduleService) ResumeSchedule(ctx context.Context, scheduleID uint, userID uint) (Schedule, error) {
+	return s.changeStatus(ctx, scheduleID, userID, StatusActive)
+}
+
+// CancelSchedule stops a schedule for good
+func (s *ScheduleService) CancelSchedule(ctx context.Context, scheduleID uint, userID uint) (Schedule, error) {
+	return s.changeStatus(ctx, scheduleID, userID, StatusCancelled)
+}
+
+func (s *ScheduleService) changeStatus(ctx context.Context, scheduleID uint, userID uint, status string) (Schedule, error) {
+	schedule, err := s.Store.ChangeScheduleStatus(ctx, scheduleID, userID, status)
+	if err != nil {
+		log.Printf("Error setting schedule %v to %s: %v", scheduleID, status, err)
+		return schedule, err
+	}
+	return schedule, nil
+}
+
+// RunScheduler executes due schedules once per interval until the context is cancelled
+func (s *ScheduleService) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.ExecuteDueSchedules(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dueBatchSize caps how many schedules a single pass of the worker picks up
+const dueBatchSize = 100
+
+// ExecuteDueSchedules runs every active schedule whose next occurrence is at or before now
+func (s *ScheduleService) ExecuteDueSchedules(ctx context.Context, now time.Time) {
+	due, err := s.Store.GetDueSchedules(ctx, now, dueBatchSize)
+	if err != nil {
+		log.Printf("Error fetching due schedules: %v", err)
+		return
+	}
+	for _, schedule := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		s.executeOccurrence(ctx, schedule, now)
+	}
+}
+
+// executeOccurrence claims the schedule's next occurrence and transfers the funds. Each occurrence is claimed at most
+// once per attempt, so a transfer is never repeated for an occurrence that already completed.
+func (s *ScheduleService) executeOccurrence(ctx context.Context, schedule Schedule, now time.Time) {
+	run, claimed, err := s.Store.ClaimOccurrence(ctx, schedule.ID, *schedule.NextRunAt, now)
+	if err != nil {
+		log.Printf("Error claiming occurrence of schedule %v: %v", schedule.ID, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	txn, err := s.Transfers.TransferFunds(ctx, schedule.SenderAccountNumber, schedule.ReceiverAccountNumber, schedule.Amount, schedule.Description, PaymentMethodStandingOrder)
+	switch {
+	case err == nil:
+		run.Status = RunCompleted
+		run.TransactionID = &txn.TransactionID
+		run.Error = ""
+		run.NextAttemptAt = nil
+	case errors.Is(err, accounts.ErrInsufficientFunds) && run.Attempts < s.Retry.MaxAttempts:
+		next := now.Add(s.Retry.Backoff)
+		run.Status = RunRetrying
+		run.Error = err.Error()
+		run.NextAttemptAt = &next
+	default:
+		run.Status = RunFailed
+		run.Error = err.Error()
+		run.NextAttemptAt = nil
+	}
+
+	updated, finishErr := s.Store.FinishRun(ctx, run)
+	if finishErr != nil {
+		log.Printf("Error recording run %v of schedule %v: %v", run.ID, schedule.ID, finishErr)
+		return
+	}
+	if err != nil {
+		s.Notifier.ScheduleRunFailed(ctx, updated, run)
+	}
+}
@@ -0,0 +1,149 @@
+package schedules
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultRetryAttempts is used when SCHEDULE_RETRY_ATTEMPTS is unset or invalid
+	defaultRetryAttempts = 3
+	// defaultRetryBackoff is used when SCHEDULE_RETRY_BACKOFF is unset or invalid
+	defaultRetryBackoff = time.Hour
+)
+
+// RetryPolicy decides how often an occurrence that failed for insufficient funds is attempted again
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first
+	MaxAttempts int
+	// Backoff is the wait between attempts
+	Backoff time.Duration
+}
+
+// ConfiguredRetryPolicy reads the retry policy from SCHEDULE_RETRY_ATTEMPTS and SCHEDULE_RETRY_BACKOFF
+func ConfiguredRetryPolicy() RetryPolicy {
+	policy := RetryPolicy{MaxAttempts: defaultRetryAttempts, Backoff: defaultRetryBackoff}
+	if attempts, err := strconv.Atoi(os.Getenv("SCHEDULE_RETRY_ATTEMPTS")); err == nil && attempts > 0 {
+		policy.MaxAttempts = attempts
+	}
+	if backoff, err := time.ParseDuration(os.Getenv("SCHEDULE_RETRY_BACKOFF")); err == nil && backoff > 0 {
+		policy.Backoff = backoff
+	}
+	return policy
+}
+
+// Normalize validates a new schedule's recurrence, fills in defaults and sets its status and first run time
+func Normalize(schedule *Schedule, now time.Time) error {
+	switch schedule.Frequency {
+	case FrequencyOnce, FrequencyDaily, FrequencyWeekly, FrequencyMonthly:
+	case "":
+		schedule.Frequency = FrequencyOnce
+	default:
+		return fmt.Errorf("%w: unknown frequency %q", ErrInvalidSchedule, schedule.Frequency)
+	}
+	if schedule.Interval == 0 {
+		schedule.Interval = 1
+	}
+	if schedule.Interval < 0 || schedule.Count < 0 {
+		return fmt.Errorf("%w: interval and count must not be negative", ErrInvalidSchedule)
+	}
+	if schedule.StartAt.IsZero() || schedule.StartAt.Before(now) {
+		return fmt.Errorf("%w: start_at must be in the future", ErrInvalidSchedule)
+	}
+	if schedule.Frequency == FrequencyOnce && (schedule.EndAt != nil || schedule.Count > 1) {
+		return fmt.Errorf("%w: one-off schedules take no end date or count", ErrInvalidSchedule)
+	}
+
+	if schedule.Frequency == FrequencyMonthly {
+		if schedule.DayOfMonth < 0 || schedule.DayOfMonth > 31 {
+			return fmt.Errorf("%w: day_of_month must be between 1 and 31", ErrInvalidSchedule)
+		}
+		if schedule.DayOfMonth == 0 {
+			schedule.DayOfMonth = schedule.StartAt.Day()
+		}
+		// Move the start onto the first matching day so that every occurrence is counted from it
+		first := monthlyOccurrence(schedule.StartAt, schedule.DayOfMonth, 0)
+		if first.Before(schedule.StartAt) {
+			first = monthlyOccurrence(schedule.StartAt, schedule.DayOfMonth, 1)
+		}
+		schedule.StartAt = first
+	} else {
+		schedule.DayOfMonth = 0
+	}
+	if schedule.EndAt != nil && schedule.EndAt.Before(schedule.StartAt) {
+		return fmt.Errorf("%w: end_at is before the first occurrence", ErrInvalidSchedule)
+	}
+
+	start := schedule.StartAt
+	schedule.Occurrences = 0
+	schedule.NextRunAt = &start
+	schedule.Status = StatusActive
+	return nil
+}
+
+// Occurrence returns the time of the schedule's n-th occurrence, counting from zero
+func Occurrence(schedule Schedule, n int) time.Time {
+	step := n * schedule.Interval
+	switch schedule.Frequency {
+	case FrequencyDaily:
+		return schedule.StartAt.AddDate(0, 0, step)
+	case FrequencyWeekly:
+		return schedule.StartAt.AddDate(0, 0, 7*step)
+	case FrequencyMonthly:
+		return monthlyOccurrence(schedule.StartAt, schedule.DayOfMonth, step)
+	default:
+		return schedule.StartAt
+	}
+}
+
+// monthlyOccurrence returns the given day of the month that is months after start, keeping start's time of day. Days
+// past the end of a short month fall on its last day.
+func monthlyOccurrence(start time.Time, day int, months int) time.Time {
+	firstOfMonth := time.Date(start.Year(), start.Month(), 1, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+	firstOfMonth = firstOfMonth.AddDate(0, months, 0)
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return firstOfMonth.AddDate(0, 0, day-1)
+}
+
+// Advance marks the current occurrence as used and moves NextRunAt to the following one. When none is left the
+// schedule is completed and NextRunAt is cleared.
+func Advance(schedule *Schedule) {
+	schedule.Occurrences++
+	if schedule.Frequency == FrequencyOnce || (schedule.Count > 0 && schedule.Occurrences >= schedule.Count) {
+		schedule.NextRunAt = nil
+		schedule.Status = StatusCompleted
+		return
+	}
+
+	next := Occurrence(*schedule, schedule.Occurrences)
+	if schedule.EndAt != nil && next.After(*schedule.EndAt) {
+		schedule.NextRunAt = nil
+		schedule.Status = StatusCompleted
+		return
+	}
+	schedule.NextRunAt = &next
+}
+
+// SkipMissed advances a schedule past every occurrence before now. Skipped occurrences count towards Count.
+func SkipMissed(schedule *Schedule, now time.Time) {
+	for schedule.NextRunAt != nil && schedule.NextRunAt.Before(now) {
+		Advance(schedule)
+	}
+}
+
+// CanTransition reports whether a schedule may move from one status to another
+func CanTransition(from, to string) bool {
+	switch from {
+	case StatusActive:
+		return to == StatusPaused || to == StatusCancelled
+	case StatusPaused:
+		return to == StatusActive || to == StatusCancelled
+	default:
+		return false
+	}
+}
@@ -0,0 +1,289 @@
+package statements
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Balance type and credit/debit codes of camt.053
+const (
+	camtOpeningBooked = "OPBD"
+	camtClosingBooked = "CLBD"
+	camtCredit        = "CRDT"
+	camtDebit         = "DBIT"
+	camtBooked        = "BOOK"
+)
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// camtDocument is a camt.053.001.08 document, the ISO 20022 bank-to-customer statement. Field order follows the
+// schema's sequences; testdata holds the schema the output is validated against.
+type camtDocument struct {
+	XMLName xml.Name      `xml:"urn:iso:std:iso:20022:tech:xsd:camt.053.001.08 Document"`
+	Stmt    camtStatement `xml:"BkToCstmrStmt"`
+}
+
+type camtStatement struct {
+	GrpHdr camtGroupHeader `xml:"GrpHdr"`
+	Stmt   camtAccountStmt `xml:"Stmt"`
+}
+
+type camtGroupHeader struct {
+	MsgId   string `xml:"MsgId"`
+	CreDtTm string `xml:"CreDtTm"`
+}
+
+type camtAccountStmt struct {
+	Id        string      `xml:"Id"`
+	CreDtTm   string      `xml:"CreDtTm"`
+	FrToDt    camtPeriod  `xml:"FrToDt"`
+	Acct      camtAccount `xml:"Acct"`
+	Bal       []camtBal   `xml:"Bal"`
+	TxsSummry camtSummary `xml:"TxsSummry"`
+	Ntry      []camtEntry `xml:"Ntry"`
+}
+
+type camtPeriod struct {
+	FrDtTm string `xml:"FrDtTm"`
+	ToDtTm string `xml:"ToDtTm"`
+}
+
+type camtAccount struct {
+	Id  camtAccountID `xml:"Id"`
+	Ccy string        `xml:"Ccy,omitempty"`
+	Nm  string        `xml:"Nm,omitempty"`
+}
+
+type camtAccountID struct {
+	Id string `xml:"Othr>Id"`
+}
+
+type camtAmount struct {
+	Ccy   string `xml:"Ccy,attr"`
+	Value string `xml:",chardata"`
+}
+
+type camtBal struct {
+	Cd        string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amt       camtAmount `xml:"Amt"`
+	CdtDbtInd string     `xml:"CdtDbtInd"`
+	Dt        string     `xml:"Dt>Dt"`
+}
+
+type camtSummary struct {
+	TtlNtries    camtTotal      `xml:"TtlNtries"`
+	TtlCdtNtries camtTotalSided `xml:"TtlCdtNtries"`
+	TtlDbtNtries camtTotalSided `xml:"TtlDbtNtries"`
+}
+
+type camtTotal struct {
+	NbOfNtries    string `xml:"NbOfNtries"`
+	Sum           string `xml:"Sum"`
+	TtlNetNtryAmt string `xml:"TtlNetNtry>Amt"`
+	CdtDbtInd     string `xml:"TtlNetNtry>CdtDbtInd"`
+}
+
+type camtTotalSided struct {
+	NbOfNtries string `xml:"NbOfNtries"`
+	Sum        string `xml:"Sum"`
+}
+
+type camtEntry struct {
+	NtryRef     string          `xml:"NtryRef"`
+	Amt         camtAmount      `xml:"Amt"`
+	CdtDbtInd   string          `xml:"CdtDbtInd"`
+	Sts         string          `xml:"Sts>Cd"`
+	BookgDt     string          `xml:"BookgDt>DtTm"`
+	ValDt       string          `xml:"ValDt>Dt"`
+	AcctSvcrRef string          `xml:"AcctSvcrRef"`
+	BkTxCd      string          `xml:"BkTxCd>Prtry>Cd"`
+	TxDtls      camtTransaction `xml:"NtryDtls>TxDtls"`
+}
+
+type camtTransaction struct {
+	AcctSvcrRef string            `xml:"Refs>AcctSvcrRef"`
+	EndToEndId  string            `xml:"Refs>EndToEndId"`
+	RltdPties   *camtRelatedParty `xml:"RltdPties,omitempty"`
+	RmtInf      *camtRemittance   `xml:"RmtInf,omitempty"`
+}
+
+type camtRemittance struct {
+	Ustrd string `xml:"Ustrd"`
+}
+
+// camtRelatedParty names the account on the other side: the debtor's of a credit, the creditor's of a debit
+type camtRelatedParty struct {
+	DbtrAcct *camtAccount `xml:"DbtrAcct,omitempty"`
+	CdtrAcct *camtAccount `xml:"CdtrAcct,omitempty"`
+}
+
+// camtAmountText formats a non-negative amount with the two decimals of the statement currency
+func camtAmountText(amount float64) string {
+	return strconv.FormatFloat(math.Abs(amount), 'f', 2, 64)
+}
+
+// camtSide returns the credit/debit indicator of a signed balance
+func camtSide(amount float64) string {
+	if amount < 0 {
+		return camtDebit
+	}
+	return camtCredit
+}
+
+// maxText cuts s to the length of an ISO 20022 MaxNText type
+func maxText(s string, length int) string {
+	s = strings.TrimSpace(s)
+	if utf8.RuneCountInString(s) <= length {
+		return s
+	}
+	return string([]rune(s)[:length])
+}
+
+// StatementID identifies a statement in the bank formats: the account and the first and last day of the period
+func StatementID(s Statement) string {
+	return fmt.Sprintf("%d-%s-%s", s.AccountNumber, s.From.Format("060102"), LastDay(s).Format("060102"))
+}
+
+// WriteCamt053 renders a statement as an ISO 20022 camt.053.001.08 bank-to-customer statement. Each transaction
+// becomes a booked entry whose entry and servicer references are its Reference, and the opening and closing balances
+// become the OPBD and CLBD balances.
+func WriteCamt053(w io.Writer, s Statement) error {
+	created := s.GeneratedAt.UTC().Format("2006-01-02T15:04:05")
+	net := s.TotalCredits - s.TotalDebits
+	doc := camtDocument{Stmt: camtStatement{
+		GrpHdr: camtGroupHeader{MsgId: maxText(StatementID(s), 35), CreDtTm: created},
+		Stmt: camtAccountStmt{
+			Id:      maxText(StatementID(s), 35),
+			CreDtTm: created,
+			FrToDt: camtPeriod{
+				FrDtTm: s.From.UTC().Format("2006-01-02T15:04:05"),
+				ToDtTm: LastDay(s).UTC().Format("2006-01-02T15:04:05"),
+			},
+			Acct: camtAccount{
+				Id:  camtAccountID{Id: strconv.FormatInt(s.AccountNumber, 10)},
+				Ccy: s.Currency,
+				Nm:  maxText(s.Nickname, 70),
+			},
+			Bal: []camtBal{
+				{Cd: camtOpeningBooked, Amt: camtAmount{Ccy: s.Currency, Value: camtAmountText(s.OpeningBalance)}, CdtDbtInd: camtSide(s.OpeningBalance), Dt: s.From.Format("2006-01-02")},
+				{Cd: camtClosingBooked, Amt: camtAmount{Ccy: s.Currency, Value: camtAmountText(s.ClosingBalance)}, CdtDbtInd: camtSide(s.ClosingBalance), Dt: LastDay(s).Format("2006-01-02")},
+			},
+			TxsSummry: camtSummary{
+				TtlNtries: camtTotal{
+					NbOfNtries:    strconv.Itoa(len(s.Lines)),
+					Sum:           camtAmountText(s.TotalCredits + s.TotalDebits),
+					TtlNetNtryAmt: camtAmountText(net),
+					CdtDbtInd:     camtSide(net),
+				},
+			},
+		},
+	}}
+
+	var credits, debits int
+	for _, line := range s.Lines {
+		reference := maxText(line.Reference, 35)
+		entry := camtEntry{
+			NtryRef:     reference,
+			Sts:         camtBooked,
+			BookgDt:     line.Date.UTC().Format("2006-01-02T15:04:05"),
+			ValDt:       line.Date.UTC().Format("2006-01-02"),
+			AcctSvcrRef: reference,
+			BkTxCd:      maxText(line.Type, 35),
+			TxDtls: camtTransaction{
+				AcctSvcrRef: reference,
+				EndToEndId:  strings.ReplaceAll(line.TransactionID.String(), "-", ""),
+			},
+		}
+		if description := maxText(line.Description, 140); description != "" {
+			entry.TxDtls.RmtInf = &camtRemittance{Ustrd: description}
+		}
+		var counterparty *camtAccount
+		if line.Counterparty != 0 {
+			counterparty = &camtAccount{Id: camtAccountID{Id: strconv.FormatInt(line.Counterparty, 10)}}
+		}
+		if line.Credit != 0 {
+			credits++
+			entry.Amt = camtAmount{Ccy: s.Currency, Value: camtAmountText(line.Credit)}
+			entry.CdtDbtInd = camtCredit
+			if counterparty != nil {
+				entry.TxDtls.RltdPties = &camtRelatedParty{DbtrAcct: counterparty}
+			}
+		} else {
+			debits++
+			entry.Amt = camtAmount{Ccy: s.Currency, Value: camtAmountText(line.Debit)}
+			entry.CdtDbtInd = camtDebit
+			if counterparty != nil {
+				entry.TxDtls.RltdPties = &camtRelatedParty{CdtrAcct: counterparty}
+			}
+		}
+		doc.Stmt.Stmt.Ntry = append(doc.Stmt.Stmt.Ntry, entry)
+	}
+	doc.Stmt.Stmt.TxsSummry.TtlCdtNtries = camtTotalSided{NbOfNtries: strconv.Itoa(credits), Sum: camtAmountText(s.TotalCredits)}
+	doc.Stmt.Stmt.TxsSummry.TtlDbtNtries = camtTotalSided{NbOfNtries: strconv.Itoa(debits), Sum: camtAmountText(s.TotalDebits)}
+
+	if err := validateCamt053(doc); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// validateCamt053 checks the facets of the camt.053.001.08 schema that statement data can break before the document
+// is written: text lengths, currency codes, amount digits and the balances and entries the schema requires. It is a
+// guard against bad data, not a schema validation; the tests validate the output against the schema itself.
+func validateCamt053(doc camtDocument) error {
+	stmt := doc.Stmt.Stmt
+	texts := map[string]string{
+		"GrpHdr/MsgId":    doc.Stmt.GrpHdr.MsgId,
+		"Stmt/Id":         stmt.Id,
+		"Acct/Id/Othr/Id": stmt.Acct.Id.Id,
+	}
+	for path, text := range texts {
+		if text == "" {
+			return fmt.Errorf("%w: camt.053 %s is required", ErrInvalidStatement, path)
+		}
+	}
+	if utf8.RuneCountInString(stmt.Acct.Id.Id) > 34 {
+		return fmt.Errorf("%w: camt.053 account identification exceeds 34 characters", ErrInvalidStatement)
+	}
+	if !currencyCode.MatchString(stmt.Acct.Ccy) {
+		return fmt.Errorf("%w: camt.053 currency %q is not an ISO 4217 code", ErrInvalidStatement, stmt.Acct.Ccy)
+	}
+	if len(stmt.Bal) == 0 {
+		return fmt.Errorf("%w: camt.053 statement needs at least one balance", ErrInvalidStatement)
+	}
+
+	amounts := []string{stmt.TxsSummry.TtlNtries.Sum, stmt.TxsSummry.TtlNtries.TtlNetNtryAmt}
+	for _, balance := range stmt.Bal {
+		amounts = append(amounts, balance.Amt.Value)
+	}
+	for _, entry := range stmt.Ntry {
+		if entry.NtryRef == "" || entry.BkTxCd == "" {
+			return fmt.Errorf("%w: camt.053 entries need a reference and a bank transaction code", ErrInvalidStatement)
+		}
+		amounts = append(amounts, entry.Amt.Value)
+	}
+	for _, amount := range amounts {
+		// ActiveOrHistoricCurrencyAndAmount allows 18 digits, at most 5 of them fractional, and no sign
+		digits := strings.Replace(amount, ".", "", 1)
+		if strings.HasPrefix(amount, "-") || len(digits) > 18 {
+			return fmt.Errorf("%w: camt.053 amount %s is out of range", ErrInvalidStatement, amount)
+		}
+	}
+	return nil
+}
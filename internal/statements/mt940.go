@@ -0,0 +1,114 @@
+package statements
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Lengths of the MT940 fields that carry free text
+const (
+	mt940ReferenceLength     = 16
+	mt940SupplementaryLength = 34
+	mt940NarrativeLine       = 65
+	mt940NarrativeLines      = 6
+)
+
+// mt940Text keeps the characters of the SWIFT X character set, replacing the others with a space, and cuts the text
+// to length when length is positive
+func mt940Text(s string, length int) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case strings.ContainsRune("/-?:().,'+ ", r):
+			b.WriteRune(r)
+		default:
+			b.WriteByte(' ')
+		}
+	}
+	text := strings.Join(strings.Fields(b.String()), " ")
+	// a field line must not start with ':' or '-', which would read as a new field or the end of the message
+	text = strings.TrimLeft(text, ":-")
+	if length > 0 && utf8.RuneCountInString(text) > length {
+		text = text[:length]
+	}
+	return text
+}
+
+// mt940Amount formats an amount the SWIFT way, with a comma as the decimal separator
+func mt940Amount(amount float64) string {
+	return strings.Replace(strconv.FormatFloat(math.Abs(amount), 'f', 2, 64), ".", ",", 1)
+}
+
+// mt940Balance renders a balance field: debit or credit mark, date, currency and amount
+func mt940Balance(amount float64, date string, currency string) string {
+	mark := "C"
+	if amount < 0 {
+		mark = "D"
+	}
+	return mark + date + currency + mt940Amount(amount)
+}
+
+// WriteMT940 renders a statement as a SWIFT MT940 customer statement message. The opening and closing balances are
+// the :60F: and :62F: fields. Each transaction is a :61: line whose supplementary details carry its Reference, which
+// is longer than the 16 characters the reference subfields allow, followed by a :86: narrative repeating the
+// reference with the description and counterparty.
+func WriteMT940(w io.Writer, s Statement) error {
+	if !currencyCode.MatchString(s.Currency) {
+		return fmt.Errorf("%w: MT940 currency %q is not an ISO 4217 code", ErrInvalidStatement, s.Currency)
+	}
+
+	lines := []string{
+		":20:" + mt940Text("STMT"+s.From.Format("060102")+LastDay(s).Format("060102"), mt940ReferenceLength),
+		":25:" + strconv.FormatInt(s.AccountNumber, 10),
+		":28C:1/1",
+		":60F:" + mt940Balance(s.OpeningBalance, s.From.Format("060102"), s.Currency),
+	}
+	for _, line := range s.Lines {
+		mark, amount := "C", line.Credit
+		if line.Credit == 0 {
+			mark, amount = "D", line.Debit
+		}
+		date := line.Date.UTC()
+		// the servicer's reference is the transaction ID, which is unique, cut to the 16 characters allowed
+		servicerReference := strings.ReplaceAll(line.TransactionID.String(), "-", "")[:mt940ReferenceLength]
+		lines = append(lines,
+			fmt.Sprintf(":61:%s%s%s%sNTRFNONREF//%s", date.Format("060102"), date.Format("0102"), mark, mt940Amount(amount), servicerReference),
+			mt940Text(line.Reference, mt940SupplementaryLength),
+		)
+
+		narrative := []string{mt940Text(line.Reference, mt940NarrativeLine), mt940Text(line.Type, mt940NarrativeLine)}
+		if line.Counterparty != 0 {
+			narrative = append(narrative, "ACCOUNT "+strconv.FormatInt(line.Counterparty, 10))
+		}
+		description := mt940Text(line.Description, 0)
+		for description != "" && len(narrative) < mt940NarrativeLines {
+			cut := len(description)
+			if cut > mt940NarrativeLine {
+				cut = mt940NarrativeLine
+			}
+			if part := mt940Text(description[:cut], 0); part != "" {
+				narrative = append(narrative, part)
+			}
+			description = description[cut:]
+		}
+		lines = append(lines, ":86:"+narrative[0])
+		for _, part := range narrative[1:] {
+			if part != "" {
+				lines = append(lines, part)
+			}
+		}
+	}
+	lines = append(lines,
+		":62F:"+mt940Balance(s.ClosingBalance, LastDay(s).Format("060102"), s.Currency),
+		"-",
+	)
+
+	_, err := io.WriteString(w, strings.Join(lines, "\r\n")+"\r\n")
+	return err
+}
@@ -0,0 +1,223 @@
+package statements
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A4 page layout of the PDF statement, in points
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	pageMargin   = 40
+	lineHeight   = 13
+	bodyFontSize = 8
+)
+
+// Right edges of the amount columns and left edges of the text columns of the transaction table
+const (
+	columnDate        = pageMargin
+	columnReference   = 95
+	columnDescription = 220
+	columnDebit       = 420
+	columnCredit      = 485
+	columnBalance     = pageWidth - pageMargin
+)
+
+// maxDescriptionLength keeps descriptions inside their column
+const maxDescriptionLength = 34
+
+// pdfDocument lays text out on pages using the standard Helvetica fonts, which every PDF reader has built in, so the
+// statement needs no embedded fonts or third-party libraries
+type pdfDocument struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (d *pdfDocument) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pageHeight - pageMargin
+}
+
+func (d *pdfDocument) page() *bytes.Buffer {
+	return d.pages[len(d.pages)-1]
+}
+
+// text writes s with its left edge at x
+func (d *pdfDocument) text(x float64, y float64, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.page(), "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfString(s))
+}
+
+// rightText writes s with its right edge at x
+func (d *pdfDocument) rightText(x float64, y float64, size float64, bold bool, s string) {
+	d.text(x-textWidth(s, size), y, size, bold, s)
+}
+
+// rule draws a horizontal line across the page at y
+func (d *pdfDocument) rule(y float64) {
+	fmt.Fprintf(d.page(), "0.5 w %d %.2f m %d %.2f l S\n", pageMargin, y, pageWidth-pageMargin, y)
+}
+
+// textWidth approximates the width of s in Helvetica. It is exact for the digits, separators and signs that amounts
+// are made of, which are the only texts that get right-aligned.
+func textWidth(s string, size float64) float64 {
+	var units int
+	for _, r := range s {
+		switch r {
+		case '.', ',', ' ':
+			units += 278
+		case '-':
+			units += 333
+		default:
+			units += 556
+		}
+	}
+	return float64(units) * size / 1000
+}
+
+// pdfString escapes s for a PDF literal string in WinAnsiEncoding, replacing what the encoding cannot show
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32:
+			b.WriteByte(' ')
+		case r < 127 || (r >= 160 && r <= 255):
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func truncate(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+	return string(runes[:length-3]) + "..."
+}
+
+func money(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+// tableHeader starts the transaction table on the current page
+func (d *pdfDocument) tableHeader() {
+	d.text(columnDate, d.y, bodyFontSize, true, "Date")
+	d.text(columnReference, d.y, bodyFontSize, true, "Reference")
+	d.text(columnDescription, d.y, bodyFontSize, true, "Description")
+	d.rightText(columnDebit, d.y, bodyFontSize, true, "Debit")
+	d.rightText(columnCredit, d.y, bodyFontSize, true, "Credit")
+	d.rightText(columnBalance, d.y, bodyFontSize, true, "Balance")
+	d.rule(d.y - 4)
+	d.y -= lineHeight + 2
+}
+
+// row writes one row of the transaction table, moving to a new page when the current one is full
+func (d *pdfDocument) row(date string, reference string, description string, debit string, credit string, balance string, bold bool) {
+	if d.y < pageMargin+lineHeight*2 {
+		d.newPage()
+		d.tableHeader()
+	}
+	d.text(columnDate, d.y, bodyFontSize, bold, date)
+	d.text(columnReference, d.y, bodyFontSize, bold, reference)
+	d.text(columnDescription, d.y, bodyFontSize, bold, truncate(description, maxDescriptionLength))
+	d.rightText(columnDebit, d.y, bodyFontSize, bold, debit)
+	d.rightText(columnCredit, d.y, bodyFontSize, bold, credit)
+	d.rightText(columnBalance, d.y, bodyFontSize, bold, balance)
+	d.y -= lineHeight
+}
+
+// WritePDF renders a statement as a PDF document: a header with the account and the period, a summary of the
+// balances and totals, then the transactions with their running balance
+func WritePDF(w io.Writer, s Statement) error {
+	d := &pdfDocument{}
+	d.newPage()
+
+	d.text(pageMargin, d.y, 16, true, "Account statement")
+	d.y -= 24
+	account := fmt.Sprintf("Account %d (%s)", s.AccountNumber, s.AccountType)
+	if s.Nickname != "" {
+		account += " - " + s.Nickname
+	}
+	d.text(pageMargin, d.y, 10, false, account)
+	d.y -= lineHeight + 1
+	d.text(pageMargin, d.y, 10, false, fmt.Sprintf("Period %s to %s, amounts in %s", s.From.Format("2006-01-02"), LastDay(s).Format("2006-01-02"), s.Currency))
+	d.y -= lineHeight + 1
+	d.text(pageMargin, d.y, 10, false, "Generated "+s.GeneratedAt.UTC().Format("2006-01-02 15:04 MST"))
+	d.y -= lineHeight * 2
+
+	summary := [][2]string{
+		{"Opening balance", money(s.OpeningBalance)},
+		{"Total credits", money(s.TotalCredits)},
+		{"Total debits", money(s.TotalDebits)},
+		{"Closing balance", money(s.ClosingBalance)},
+	}
+	for _, item := range summary {
+		d.text(pageMargin, d.y, 10, false, item[0])
+		d.rightText(220, d.y, 10, true, item[1])
+		d.y -= lineHeight + 1
+	}
+	d.y -= lineHeight
+
+	d.tableHeader()
+	d.row(s.From.Format("2006-01-02"), "", "Opening balance", "", "", money(s.OpeningBalance), true)
+	for _, line := range s.Lines {
+		d.row(line.Date.UTC().Format("2006-01-02"), line.Reference, line.Description, formatAmount(line.Debit), formatAmount(line.Credit), money(line.BalanceAfter), false)
+	}
+	d.row(LastDay(s).Format("2006-01-02"), "", "Closing balance", money(s.TotalDebits), money(s.TotalCredits), money(s.ClosingBalance), true)
+
+	for i, page := range d.pages {
+		label := fmt.Sprintf("Page %d of %d", i+1, len(d.pages))
+		fmt.Fprintf(page, "BT /F1 8.0 Tf %.2f %d Td (%s) Tj ET\n", columnBalance-textWidth(label, 8), pageMargin/2, label)
+	}
+	return writePDFFile(w, d.pages)
+}
+
+// writePDFFile writes the catalog, fonts and pages as PDF objects, followed by the cross-reference table that locates
+// them
+func writePDFFile(w io.Writer, pages []*bytes.Buffer) error {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		// each page is followed by its content stream, after the catalog, page tree and the two fonts
+		kids[i] = fmt.Sprintf("%d 0 R", 5+i*2)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pageWidth, pageHeight, 6+i*2))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,87 @@
+package statements
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"time"
+)
+
+// Statement formats
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatPDF  = "pdf"
+	// bank formats for accounting systems
+	FormatCamt053 = "camt053"
+	FormatMT940   = "mt940"
+)
+
+// maxPeriodDays bounds the period a single statement covers
+const maxPeriodDays = 366
+
+var ErrInvalidStatement = errors.New("invalid statement request")
+
+// Statement - an account's movements over a period, between its opening and closing balances. From is inclusive and
+// To exclusive, so consecutive statements never share a transaction.
+type Statement struct {
+	AccountID      uint      `json:"account_id"`
+	AccountNumber  int64     `json:"account_number"`
+	AccountType    string    `json:"account_type"`
+	Nickname       string    `json:"nickname,omitempty"`
+	Currency       string    `json:"currency"`
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	OpeningBalance float64   `json:"opening_balance"`
+	ClosingBalance float64   `json:"closing_balance"`
+	TotalCredits   float64   `json:"total_credits"`
+	TotalDebits    float64   `json:"total_debits"`
+	Lines          []Line    `json:"lines"`
+	GeneratedAt    time.Time `json:"generated_at"`
+}
+
+// Line - one transaction on a statement and the balance it left the account with. Exactly one of Credit and Debit is
+// set.
+type Line struct {
+	TransactionID uuid.UUID `json:"transaction_id"`
+	Date          time.Time `json:"date"`
+	Reference     string    `json:"reference"`
+	Type          string    `json:"type"`
+	Description   string    `json:"description"`
+	Counterparty  int64     `json:"counterparty_account_number,omitempty"`
+	Credit        float64   `json:"credit"`
+	Debit         float64   `json:"debit"`
+	BalanceAfter  float64   `json:"balance_after"`
+}
+
+type StatementStore interface {
+	GetStatement(ctx context.Context, accountID uint, from time.Time, to time.Time) (Statement, error)
+}
+
+type StatementService struct {
+	Store StatementStore
+}
+
+func NewStatementService(store StatementStore) StatementService {
+	return StatementService{
+		Store: store,
+	}
+}
+
+// GetStatement builds the statement of an account for the period [from, to).
+func (s *StatementService) GetStatement(ctx context.Context, accountID uint, from time.Time, to time.Time) (Statement, error) {
+	if !from.Before(to) {
+		return Statement{}, fmt.Errorf("%w: from must be before to", ErrInvalidStatement)
+	}
+	if to.Sub(from) > maxPeriodDays*24*time.Hour {
+		return Statement{}, fmt.Errorf("%w: a statement covers at most %d days", ErrInvalidStatement, maxPeriodDays)
+	}
+	statement, err := s.Store.GetStatement(ctx, accountID, from, to)
+	if err != nil {
+		log.Printf("Error building statement of account %v: %v", accountID, err)
+		return Statement{}, err
+	}
+	return statement, nil
+}
@@ -0,0 +1,128 @@
+package statements
+
+import (
+	"bytes"
+	"flag"
+	"github.com/google/uuid"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// testStatement is a month with a credit, a debit that overdraws the account, a line without a counterparty and
+// descriptions that need cutting or replacing in the bank formats
+func testStatement() Statement {
+	from := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	return Statement{
+		AccountID:      7,
+		AccountNumber:  5867466691,
+		AccountType:    "main",
+		Nickname:       "Household",
+		Currency:       "EUR",
+		From:           from,
+		To:             from.AddDate(0, 1, 0),
+		OpeningBalance: 120.5,
+		ClosingBalance: -42.25,
+		TotalCredits:   1250,
+		TotalDebits:    1412.75,
+		Lines: []Line{
+			{
+				TransactionID: uuid.MustParse("3f1c2b6e-9a4d-4e1f-8b7a-2c5d6e7f8a90"),
+				Date:          time.Date(2024, time.March, 4, 9, 30, 0, 0, time.UTC),
+				Reference:     "TXN-20240304-0001-SALARY",
+				Type:          "Transfer",
+				Description:   "March salary",
+				Counterparty:  1677203234,
+				Credit:        1250,
+				BalanceAfter:  1370.5,
+			},
+			{
+				TransactionID: uuid.MustParse("b2a1c3d4-5e6f-4a7b-8c9d-0e1f2a3b4c5d"),
+				Date:          time.Date(2024, time.March, 15, 18, 5, 12, 0, time.UTC),
+				Reference:     "TXN-20240315-0002-RENT",
+				Type:          "Transfer",
+				Description:   "Rent for flat 3 – Müllerstraße 12, including service charges for the quarter and parking space rental",
+				Counterparty:  1677203242,
+				Debit:         1400,
+				BalanceAfter:  -29.5,
+			},
+			{
+				TransactionID: uuid.MustParse("0c9d8e7f-6a5b-4c3d-9e2f-1a0b9c8d7e6f"),
+				Date:          time.Date(2024, time.March, 31, 23, 59, 59, 0, time.UTC),
+				Reference:     "TXN-20240331-0003-FEE",
+				Type:          "Debit",
+				Description:   ":monthly fee",
+				Debit:         12.75,
+				BalanceAfter:  -42.25,
+			},
+		},
+		GeneratedAt: time.Date(2024, time.April, 1, 6, 0, 0, 0, time.UTC),
+	}
+}
+
+// compareGolden compares output byte for byte with a file in testdata, or rewrites the file with -update
+func compareGolden(t *testing.T, name string, output []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, output, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, want) {
+		t.Errorf("output differs from %s, run go test -update to rewrite it\ngot:\n%s\nwant:\n%s", path, output, want)
+	}
+}
+
+func TestWriteCamt053Golden(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCamt053(&buf, testStatement()); err != nil {
+		t.Fatal(err)
+	}
+	compareGolden(t, "statement.camt053.xml", buf.Bytes())
+}
+
+func TestWriteCamt053Schema(t *testing.T) {
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint is not installed")
+	}
+
+	empty := testStatement()
+	empty.Lines = nil
+	empty.TotalCredits, empty.TotalDebits = 0, 0
+	empty.ClosingBalance = empty.OpeningBalance
+
+	for name, statement := range map[string]Statement{"transactions": testStatement(), "empty": empty} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteCamt053(&buf, statement); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "statement.xml")
+			if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			output, err := exec.Command(xmllint, "--noout", "--schema", filepath.Join("testdata", "camt.053.001.08.xsd"), path).CombinedOutput()
+			if err != nil {
+				t.Errorf("statement does not validate against camt.053.001.08: %v\n%s", err, output)
+			}
+		})
+	}
+}
+
+func TestWriteMT940Golden(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteMT940(&buf, testStatement()); err != nil {
+		t.Fatal(err)
+	}
+	compareGolden(t, "statement.mt940.sta", buf.Bytes())
+}
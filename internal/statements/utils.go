@@ -0,0 +1,75 @@
+package statements
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ValidFormat reports whether a statement can be rendered in the format
+func ValidFormat(format string) bool {
+	switch format {
+	case FormatJSON, FormatCSV, FormatPDF, FormatCamt053, FormatMT940:
+		return true
+	}
+	return false
+}
+
+// FileExtension returns the extension of a statement file in the format
+func FileExtension(format string) string {
+	switch format {
+	case FormatCamt053:
+		return "xml"
+	case FormatMT940:
+		return "sta"
+	}
+	return format
+}
+
+// LastDay returns the last day a statement covers, since its To is exclusive
+func LastDay(s Statement) time.Time {
+	return s.To.Add(-time.Nanosecond)
+}
+
+// formatAmount renders an amount with two decimals, leaving zero amounts blank
+func formatAmount(amount float64) string {
+	if amount == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+// WriteCSV renders a statement as CSV: one row per transaction, preceded by an opening balance row and followed by
+// the totals and the closing balance
+func WriteCSV(w io.Writer, s Statement) error {
+	writer := csv.NewWriter(w)
+	rows := [][]string{
+		{"date", "reference", "type", "description", "counterparty_account_number", "debit", "credit", "balance"},
+		{s.From.Format("2006-01-02"), "", "", "Opening balance", "", "", "", strconv.FormatFloat(s.OpeningBalance, 'f', 2, 64)},
+	}
+	for _, line := range s.Lines {
+		counterparty := ""
+		if line.Counterparty != 0 {
+			counterparty = strconv.FormatInt(line.Counterparty, 10)
+		}
+		rows = append(rows, []string{
+			line.Date.Format(time.RFC3339),
+			line.Reference,
+			line.Type,
+			line.Description,
+			counterparty,
+			formatAmount(line.Debit),
+			formatAmount(line.Credit),
+			strconv.FormatFloat(line.BalanceAfter, 'f', 2, 64),
+		})
+	}
+	rows = append(rows,
+		[]string{LastDay(s).Format("2006-01-02"), "", "", "Totals", "", strconv.FormatFloat(s.TotalDebits, 'f', 2, 64), strconv.FormatFloat(s.TotalCredits, 'f', 2, 64), ""},
+		[]string{LastDay(s).Format("2006-01-02"), "", "", "Closing balance", "", "", "", strconv.FormatFloat(s.ClosingBalance, 'f', 2, 64)},
+	)
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
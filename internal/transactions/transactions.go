@@ -2,32 +2,112 @@ package transactions
 
 import (
 	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/fees"
 	"PayWalletEngine/internal/users"
 	"context"
+	"errors"
 	"github.com/google/uuid"
 	"log"
+	"time"
+)
+
+// PaymentMethodInternal marks movements between wallets of the same user
+const PaymentMethodInternal = "internal"
+
+// Directions of a transaction relative to the account whose history is read
+const (
+	DirectionIncoming = "incoming"
+	DirectionOutgoing = "outgoing"
+)
+
+// Sort orders of the transaction history. Ties are broken by transaction ID so that pages never overlap.
+const (
+	SortNewest   = "created_at_desc"
+	SortOldest   = "created_at_asc"
+	SortLargest  = "amount_desc"
+	SortSmallest = "amount_asc"
+)
+
+// Page sizes of the transaction history
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+var (
+	ErrNotOwnAccounts = errors.New("both wallets must belong to the user")
+	ErrInvalidAmount  = errors.New("amount must be greater than zero")
+	ErrInvalidQuery   = errors.New("invalid transaction history query")
 )
 
 type Transactions struct {
-	TransactionID         uuid.UUID `json:"transaction_id"`
-	Amount                float64   `json:"amount"`
-	PaymentMethod         string    `json:"paymentMethod"`
-	Type                  string    `json:"type"`
-	Status                string    `json:"status"`
-	Description           string    `json:"description"`
-	Reference             string    `json:"reference"`
-	SenderAccountNumber   int64     `json:"sender_account_number"`
-	ReceiverAccountNumber int64     `json:"receiver_account_number"`
+	TransactionID         uuid.UUID   `json:"transaction_id"`
+	Amount                float64     `json:"amount"`
+	PaymentMethod         string      `json:"paymentMethod"`
+	Type                  string      `json:"type"`
+	Status                string      `json:"status"`
+	Description           string      `json:"description"`
+	Reference             string      `json:"reference"`
+	SenderAccountNumber   int64       `json:"sender_account_number"`
+	ReceiverAccountNumber int64       `json:"receiver_account_number"`
+	BeneficiaryID         *uint       `json:"beneficiary_id,omitempty"`
+	BeneficiaryName       string      `json:"beneficiary_name,omitempty" gorm:"-"`
+	FeeFor                *uuid.UUID  `json:"fee_for,omitempty"`
+	FeeScheduleID         *uint       `json:"fee_schedule_id,omitempty"`
+	EscrowID              *uint       `json:"escrow_id,omitempty"`
+	DisputeID             *uint       `json:"dispute_id,omitempty"`
+	Fees                  []fees.Item `json:"fees,omitempty" gorm:"-"`
+	Direction             string      `json:"direction,omitempty" gorm:"-"`
+	CreatedAt             time.Time   `json:"created_at"`
+	// SenderBalanceAfter and ReceiverBalanceAfter are the balances the transaction left each side with. They are
+	// never shown as they are, since one side must not see the other's balance; BalanceAfter shows the side of the
+	// account being read.
+	SenderBalanceAfter   *float64 `json:"-"`
+	ReceiverBalanceAfter *float64 `json:"-"`
+	BalanceAfter         *float64 `json:"balance_after,omitempty" gorm:"-"`
+}
+
+// HistoryQuery - the filters, order and page of an account's transaction history. Empty filters match everything.
+type HistoryQuery struct {
+	AccountNumber int64
+	From          *time.Time
+	To            *time.Time
+	Type          string
+	Status        string
+	Direction     string
+	MinAmount     *float64
+	MaxAmount     *float64
+	Counterparty  int64
+	Search        string
+	Sort          string
+	Limit         int
+	Cursor        *Cursor
+}
+
+// Cursor - the position after the last transaction of a page, in the sort order the page was read in
+type Cursor struct {
+	Sort          string    `json:"s"`
+	CreatedAt     time.Time `json:"c"`
+	Amount        float64   `json:"a"`
+	TransactionID uuid.UUID `json:"t"`
+}
+
+// HistoryPage - one page of an account's transaction history
+type HistoryPage struct {
+	Transactions []Transactions `json:"transactions"`
+	NextCursor   string         `json:"next_cursor,omitempty"`
 }
 
 type TransactionStore interface {
-	GetTransactionsFromAccount(ctx context.Context, accountNumber int64) ([]Transactions, error)
+	GetTransactionHistory(ctx context.Context, query HistoryQuery) (HistoryPage, error)
 	GetTransactionByReference(ctx context.Context, reference string) (*Transactions, error)
 	DebitAccount(ctx context.Context, senderAccountNumber int64, amount float64, description string, paymentMethod string) (Transactions, error)
 	CreditAccount(ctx context.Context, retrieveAccountNumber int64, amount float64, description string, paymentMethod string) (Transactions, error)
 	TransferFunds(ctx context.Context, senderAccountNumber int64, receiverAccountNumber int64, amount float64, description string, paymentMethod string) (Transactions, error)
 	GetUserAccountAndTransactionByTransactionID(ctx context.Context, transactionID string) (*users.User, *accounts.Account, *Transactions, error)
 	GetAccountandTransactionByTransactionID(ctx context.Context, transactionID string) (*accounts.Account, *Transactions, error)
+	TransferBetweenOwnAccounts(ctx context.Context, userID uint, fromAccountNumber int64, toAccountNumber int64, amount float64, description string) (Transactions, error)
+	QuoteFees(ctx context.Context, payerAccountNumber int64, c fees.Context) (fees.Quote, error)
 }
 
 type TransactionService struct {
@@ -72,6 +152,9 @@ func (s *TransactionService) GetTransactionByReference(ctx context.Context, refe
 
 // DebitAccount debits the specified account.
 func (s *TransactionService) DebitAccount(ctx context.Context, senderAccountNumber int64, amount float64, description string, paymentMethod string) (*Transactions, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
 	transaction, err := s.Store.DebitAccount(ctx, senderAccountNumber, amount, description, paymentMethod)
 	if err != nil {
 		return nil, err
@@ -81,6 +164,9 @@ func (s *TransactionService) DebitAccount(ctx context.Context, senderAccountNumb
 
 // CreditAccount credits an account for a transaction.
 func (s *TransactionService) CreditAccount(ctx context.Context, receiverAccountNumber int64, amount float64, description string, paymentMethod string) (*Transactions, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
 	transaction, err := s.Store.CreditAccount(ctx, receiverAccountNumber, amount, description, paymentMethod)
 	if err != nil {
 		return nil, err
@@ -90,6 +176,9 @@ func (s *TransactionService) CreditAccount(ctx context.Context, receiverAccountN
 
 // TransferFunds transfers funds by crediting and debiting specified users.
 func (s *TransactionService) TransferFunds(ctx context.Context, senderAccountNumber int64, receiverAccountNumber int64, amount float64, description string, paymentMethod string) (*Transactions, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
 	transaction, err := s.Store.TransferFunds(ctx, senderAccountNumber, receiverAccountNumber, amount, description, paymentMethod)
 	if err != nil {
 		return nil, err
@@ -97,11 +186,48 @@ func (s *TransactionService) TransferFunds(ctx context.Context, senderAccountNum
 	return &transaction, nil
 }
 
-// GetTransactionsFromAccount retrieves the transactions a specific account made.
-func (s *TransactionService) GetTransactionsFromAccount(ctx context.Context, accountNumber int64) ([]Transactions, error) {
-	transactions, err := s.Store.GetTransactionsFromAccount(ctx, accountNumber)
+// TransferBetweenOwnAccounts moves funds instantly and without fees between two wallets of the same user.
+func (s *TransactionService) TransferBetweenOwnAccounts(ctx context.Context, userID uint, fromAccountNumber int64, toAccountNumber int64, amount float64, description string) (*Transactions, error) {
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	transaction, err := s.Store.TransferBetweenOwnAccounts(ctx, userID, fromAccountNumber, toAccountNumber, amount, description)
 	if err != nil {
+		log.Printf("Error transferring between wallets of user %v: %v", userID, err)
 		return nil, err
 	}
-	return transactions, nil
+	return &transaction, nil
+}
+
+// QuoteFees returns the fees a transaction would be charged, before it is executed. The payer is the sender of a
+// debit or transfer and the receiver of a credit.
+func (s *TransactionService) QuoteFees(ctx context.Context, payerAccountNumber int64, transactionType string, paymentMethod string, amount float64) (fees.Quote, error) {
+	if amount <= 0 {
+		return fees.Quote{}, ErrInvalidAmount
+	}
+	quote, err := s.Store.QuoteFees(ctx, payerAccountNumber, fees.Context{
+		TransactionType: transactionType,
+		PaymentMethod:   paymentMethod,
+		Currency:        fees.Currency(),
+		Amount:          amount,
+	})
+	if err != nil {
+		log.Printf("Error quoting fees for account %v: %v", payerAccountNumber, err)
+		return quote, err
+	}
+	return quote, nil
+}
+
+// GetTransactionHistory retrieves one page of the transactions an account sent or received, filtered and sorted as
+// the query asks. Pass the page's next cursor back in to read the following page.
+func (s *TransactionService) GetTransactionHistory(ctx context.Context, query HistoryQuery) (HistoryPage, error) {
+	if err := ValidateHistoryQuery(&query); err != nil {
+		return HistoryPage{}, err
+	}
+	page, err := s.Store.GetTransactionHistory(ctx, query)
+	if err != nil {
+		log.Printf("Error fetching transaction history of account %v: %v", query.AccountNumber, err)
+		return HistoryPage{}, err
+	}
+	return page, nil
 }
@@ -1,7 +1,10 @@
 package transactions
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"github.com/google/uuid"
 	"math/rand"
 	"sync"
 	"time"
@@ -34,3 +37,68 @@ func GenerateTransactionRef() (string, error) {
 
 	return reference, nil
 }
+
+// EncodeCursor turns a cursor into the opaque string handed to clients
+func EncodeCursor(cursor Cursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor reads a cursor produced by EncodeCursor
+func DecodeCursor(value string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.TransactionID == uuid.Nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	return &cursor, nil
+}
+
+// ValidateHistoryQuery checks a history query and fills in the default sort order and page size
+func ValidateHistoryQuery(query *HistoryQuery) error {
+	if query.Sort == "" {
+		query.Sort = SortNewest
+	}
+	switch query.Sort {
+	case SortNewest, SortOldest, SortLargest, SortSmallest:
+	default:
+		return fmt.Errorf("%w: sort must be one of %s, %s, %s or %s", ErrInvalidQuery, SortNewest, SortOldest, SortLargest, SortSmallest)
+	}
+	if query.Cursor != nil && query.Cursor.Sort != query.Sort {
+		return fmt.Errorf("%w: the cursor belongs to a different sort order", ErrInvalidQuery)
+	}
+
+	if query.Limit == 0 {
+		query.Limit = defaultPageSize
+	}
+	if query.Limit < 0 || query.Limit > maxPageSize {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, maxPageSize)
+	}
+
+	switch query.Type {
+	case "", "Credit", "Debit", "Transfer", "Fee":
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidQuery, query.Type)
+	}
+	switch query.Status {
+	case "", "Pending", "Completed":
+	default:
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidQuery, query.Status)
+	}
+	switch query.Direction {
+	case "", DirectionIncoming, DirectionOutgoing:
+	default:
+		return fmt.Errorf("%w: direction must be %s or %s", ErrInvalidQuery, DirectionIncoming, DirectionOutgoing)
+	}
+
+	if query.From != nil && query.To != nil && !query.From.Before(*query.To) {
+		return fmt.Errorf("%w: from must be before to", ErrInvalidQuery)
+	}
+	if query.MinAmount != nil && query.MaxAmount != nil && *query.MinAmount > *query.MaxAmount {
+		return fmt.Errorf("%w: min_amount cannot exceed max_amount", ErrInvalidQuery)
+	}
+	return nil
+}
@@ -3,8 +3,10 @@ package http
 import (
 	"PayWalletEngine/internal/accounts"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 	"log"
 	"net/http"
 	"strconv"
@@ -22,7 +24,13 @@ func (h *Handler) CreateAccount(writer http.ResponseWriter, request *http.Reques
 
 	// Create the account in the database
 	if err := h.Accounts.CreateAccount(request.Context(), &acct); err != nil {
-		http.Error(writer, fmt.Sprintf("Failed to create account: %v", err), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if errors.Is(err, accounts.ErrInvalidAccountType) {
+			status = http.StatusBadRequest
+		} else if errors.Is(err, accounts.ErrDuplicateAccountType) {
+			status = http.StatusConflict
+		}
+		http.Error(writer, fmt.Sprintf("Failed to create account: %v", err), status)
 		log.Println("Failed to create account:", err)
 		return
 	}
@@ -58,7 +66,7 @@ func (h *Handler) GetAccountByID(writer http.ResponseWriter, request *http.Reque
 // GetAccountByNumber extracts the number from the URL parameters and then fetches the account with that number from the database using the GetAccountByNumber method of the AccountService interface. If the account is found, it encodes and sends the account as a response.
 func (h *Handler) GetAccountByNumber(writer http.ResponseWriter, request *http.Request) {
 	vars := mux.Vars(request)
-	number, err := strconv.ParseInt(vars["number"], 10, 64)
+	number, err := parseAccountNumber(vars["number"])
 	if err != nil {
 		http.Error(writer, err.Error(), http.StatusBadRequest)
 		return
@@ -82,7 +90,15 @@ func (h *Handler) UpdateAccountDetails(writer http.ResponseWriter, request *http
 	}
 	err := h.Accounts.UpdateAccountDetails(request.Context(), acct)
 	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if errors.Is(err, accounts.ErrInvalidAccountType) || errors.Is(err, accounts.ErrImmutableField) {
+			status = http.StatusBadRequest
+		} else if errors.Is(err, accounts.ErrDuplicateAccountType) || errors.Is(err, accounts.ErrAccountClosed) {
+			status = http.StatusConflict
+		} else if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		}
+		http.Error(writer, err.Error(), status)
 		return
 	}
 	if err := json.NewEncoder(writer).Encode(acct); err != nil {
@@ -96,7 +112,7 @@ func (h *Handler) UpdateAccountDetails(writer http.ResponseWriter, request *http
 func (h *Handler) GetUserDetailsByAccountNumber(writer http.ResponseWriter, request *http.Request) {
 
 	vars := mux.Vars(request)
-	accountNumber, err := strconv.ParseInt(vars["account_number"], 10, 64)
+	accountNumber, err := parseAccountNumber(vars["account_number"])
 	if err != nil {
 		http.Error(writer, err.Error(), http.StatusBadRequest)
 		return
@@ -136,3 +152,181 @@ func (h *Handler) GetAccountsByUserID(writer http.ResponseWriter, request *http.
 		return
 	}
 }
+
+// statusChangeRequest is the request body shared by the account lifecycle endpoints
+type statusChangeRequest struct {
+	Reason             string `json:"reason"`
+	SweepAccountNumber int64  `json:"sweep_account_number"`
+}
+
+// decodeStatusChange parses the account id and lifecycle request body, writing a Bad Request response on failure
+func decodeStatusChange(writer http.ResponseWriter, request *http.Request) (uint, statusChangeRequest, bool) {
+	var body statusChangeRequest
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return 0, body, false
+	}
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		http.Error(writer, "Invalid request body", http.StatusBadRequest)
+		return 0, body, false
+	}
+	if body.Reason == "" {
+		http.Error(writer, "A reason is required", http.StatusBadRequest)
+		return 0, body, false
+	}
+	if body.SweepAccountNumber != 0 {
+		if err := validateAccountNumbers(body.SweepAccountNumber); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return 0, body, false
+		}
+	}
+	return uint(id), body, true
+}
+
+// writeStatusChangeError maps account lifecycle errors onto HTTP status codes
+func writeStatusChangeError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(writer, "Account not found", http.StatusNotFound)
+	case errors.Is(err, accounts.ErrInvalidStatusTransition), errors.Is(err, accounts.ErrNonZeroBalance),
+		errors.Is(err, accounts.ErrAccountClosed), errors.Is(err, accounts.ErrAccountFrozen), errors.Is(err, accounts.ErrAccountDormant):
+		http.Error(writer, err.Error(), http.StatusConflict)
+	default:
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// FreezeAccount blocks debits on the account identified by the id URL parameter. Credits are still accepted.
+func (h *Handler) FreezeAccount(writer http.ResponseWriter, request *http.Request) {
+	id, body, ok := decodeStatusChange(writer, request)
+	if !ok {
+		return
+	}
+	if err := h.Accounts.FreezeAccount(request.Context(), id, body.Reason); err != nil {
+		writeStatusChangeError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(map[string]string{"status": accounts.StatusFrozen}); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// UnfreezeAccount returns a frozen or dormant account to active.
+func (h *Handler) UnfreezeAccount(writer http.ResponseWriter, request *http.Request) {
+	id, body, ok := decodeStatusChange(writer, request)
+	if !ok {
+		return
+	}
+	if err := h.Accounts.UnfreezeAccount(request.Context(), id, body.Reason); err != nil {
+		writeStatusChangeError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(map[string]string{"status": accounts.StatusActive}); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// CloseAccount closes the account, sweeping any remaining balance to the nominated sweep_account_number as a final settlement.
+func (h *Handler) CloseAccount(writer http.ResponseWriter, request *http.Request) {
+	id, body, ok := decodeStatusChange(writer, request)
+	if !ok {
+		return
+	}
+	if err := h.Accounts.CloseAccount(request.Context(), id, body.SweepAccountNumber, body.Reason); err != nil {
+		writeStatusChangeError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(map[string]string{"status": accounts.StatusClosed}); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetAccountStatusHistory returns every status change recorded for the account, with its reason.
+func (h *Handler) GetAccountStatusHistory(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	history, err := h.Accounts.GetAccountStatusHistory(request.Context(), uint(id))
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(history); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// SetDefaultAccount makes the account identified by the id URL parameter its owner's default wallet.
+func (h *Handler) SetDefaultAccount(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.Accounts.SetDefaultAccount(request.Context(), uint(id)); err != nil {
+		writeStatusChangeError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(map[string]string{"status": "OK"}); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// SetOverdraftLimit approves an overdraft on the account identified by the id URL parameter, with the annual rate
+// charged on it. A limit of zero removes it.
+func (h *Handler) SetOverdraftLimit(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		OverdraftLimit *float64 `json:"overdraft_limit"`
+		OverdraftRate  float64  `json:"overdraft_rate"`
+		Reason         string   `json:"reason"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		http.Error(writer, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if body.OverdraftLimit == nil || body.Reason == "" {
+		http.Error(writer, "An overdraft_limit and a reason are required", http.StatusBadRequest)
+		return
+	}
+
+	account, err := h.Accounts.SetOverdraftLimit(request.Context(), uint(id), *body.OverdraftLimit, body.OverdraftRate, body.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, accounts.ErrInvalidOverdraftLimit), errors.Is(err, accounts.ErrInvalidOverdraftRate):
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, accounts.ErrSystemAccount):
+			http.Error(writer, err.Error(), http.StatusConflict)
+		default:
+			writeStatusChangeError(writer, err)
+		}
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(account); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetOverdrawnAccounts reports every account with a negative balance, with its limit and how much of it is used.
+func (h *Handler) GetOverdrawnAccounts(writer http.ResponseWriter, request *http.Request) {
+	overdrawn, err := h.Accounts.GetOverdrawnAccounts(request.Context())
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(overdrawn); err != nil {
+		log.Panicln(err)
+	}
+}
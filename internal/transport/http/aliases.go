@@ -0,0 +1,147 @@
+package http
+
+import (
+	"PayWalletEngine/internal/aliases"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// writeAliasError maps alias errors onto HTTP status codes
+func writeAliasError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, aliases.ErrInvalidAlias), errors.Is(err, aliases.ErrInvalidCode), errors.Is(err, aliases.ErrUsernameAliasMismatch):
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(writer, "Alias not found", http.StatusNotFound)
+	case errors.Is(err, aliases.ErrTooManyAttempts):
+		http.Error(writer, err.Error(), http.StatusTooManyRequests)
+	case errors.Is(err, aliases.ErrAliasTaken), errors.Is(err, aliases.ErrNoDefaultAccount), errors.Is(err, aliases.ErrAlreadyVerified):
+		http.Error(writer, err.Error(), http.StatusConflict)
+	default:
+		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// RegisterAlias registers an email, phone number or @username for a user. Email and phone aliases receive a verification code and stay unverified until it is confirmed.
+func (h *Handler) RegisterAlias(writer http.ResponseWriter, request *http.Request) {
+	var aliasRequest struct {
+		UserID uint   `json:"user_id"`
+		Alias  string `json:"alias"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&aliasRequest); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	alias, err := h.Aliases.RegisterAlias(request.Context(), aliasRequest.UserID, aliasRequest.Alias)
+	if err != nil {
+		writeAliasError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(alias); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// VerifyAlias confirms an alias with the code that was sent to the email address or phone number.
+func (h *Handler) VerifyAlias(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var verifyRequest struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&verifyRequest); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	alias, err := h.Aliases.VerifyAlias(request.Context(), uint(id), verifyRequest.Code)
+	if err != nil {
+		writeAliasError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(alias); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// ResendVerificationCode sends a new verification code to an unverified alias, replacing the previous one.
+func (h *Handler) ResendVerificationCode(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	alias, err := h.Aliases.ResendVerificationCode(request.Context(), uint(id))
+	if err != nil {
+		writeAliasError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(alias); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetAliasesByUserID lists the aliases registered by the user identified by the user_id URL parameter.
+func (h *Handler) GetAliasesByUserID(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	userID, err := strconv.ParseUint(vars["user_id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userAliases, err := h.Aliases.GetAliasesByUserID(request.Context(), uint(userID))
+	if err != nil {
+		writeAliasError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(userAliases); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// DeleteAlias removes an alias so it no longer resolves to the user's account.
+func (h *Handler) DeleteAlias(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Aliases.DeleteAlias(request.Context(), uint(id)); err != nil {
+		writeAliasError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(map[string]string{"status": "OK"}); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// LookupAlias returns the masked display name behind an alias so the sender can confirm the recipient before paying.
+func (h *Handler) LookupAlias(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	resolution, err := h.Aliases.ResolveAlias(request.Context(), vars["alias"])
+	if err != nil {
+		writeAliasError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(resolution); err != nil {
+		log.Panicln(err)
+	}
+}
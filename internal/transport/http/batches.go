@@ -0,0 +1,99 @@
+package http
+
+import (
+	"PayWalletEngine/internal/batches"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// writeBatchError maps batch errors onto HTTP status codes
+func writeBatchError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, batches.ErrInvalidBatch):
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(writer, "Batch or sender account not found", http.StatusNotFound)
+	default:
+		writeTransactionError(writer, err)
+	}
+}
+
+// ExecuteBatch pays many receivers from one sender. The legs come either as JSON or, with a text/csv content type, as
+// CSV with the sender, mode and payment method given as query parameters.
+func (h *Handler) ExecuteBatch(writer http.ResponseWriter, request *http.Request) {
+	var batch batches.Batch
+
+	mediaType, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type"))
+	if mediaType == "text/csv" {
+		query := request.URL.Query()
+		sender, err := parseAccountNumber(query.Get("sender_account_number"))
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		legs, err := batches.ParseCSV(request.Body)
+		if err != nil {
+			writeBatchError(writer, err)
+			return
+		}
+		batch = batches.Batch{
+			SenderAccountNumber: sender,
+			Mode:                query.Get("mode"),
+			PaymentMethod:       query.Get("payment_method"),
+			Legs:                legs,
+		}
+	} else if err := json.NewDecoder(request.Body).Decode(&batch); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	numbers := []int64{batch.SenderAccountNumber}
+	for _, leg := range batch.Legs {
+		numbers = append(numbers, leg.ReceiverAccountNumber)
+	}
+	if err := validateAccountNumbers(numbers...); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := h.Batches.ExecuteBatch(request.Context(), &batch)
+	if err != nil && !errors.Is(err, batches.ErrBatchFailed) {
+		writeBatchError(writer, err)
+		return
+	}
+
+	// A failed all-or-nothing batch is still recorded, so its per-leg results are returned with the error status
+	if err != nil {
+		writer.WriteHeader(http.StatusUnprocessableEntity)
+	} else {
+		writer.WriteHeader(http.StatusCreated)
+	}
+	if err := json.NewEncoder(writer).Encode(batch); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetBatchByID fetches a batch with the result of each leg.
+func (h *Handler) GetBatchByID(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	batch, err := h.Batches.GetBatchByID(request.Context(), uint(id))
+	if err != nil {
+		writeBatchError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(batch); err != nil {
+		log.Panicln(err)
+	}
+}
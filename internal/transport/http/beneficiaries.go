@@ -0,0 +1,131 @@
+package http
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/aliases"
+	"PayWalletEngine/internal/beneficiaries"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// writeBeneficiaryError maps beneficiary errors onto HTTP status codes
+func writeBeneficiaryError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, beneficiaries.ErrInvalidDestination), errors.Is(err, accounts.ErrInvalidAccountNumber), errors.Is(err, aliases.ErrInvalidAlias):
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, beneficiaries.ErrNotOwner):
+		http.Error(writer, err.Error(), http.StatusForbidden)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(writer, "Beneficiary or destination not found", http.StatusNotFound)
+	case errors.Is(err, beneficiaries.ErrCoolingOffLimit), errors.Is(err, aliases.ErrNoDefaultAccount):
+		http.Error(writer, err.Error(), http.StatusConflict)
+	default:
+		writeTransactionError(writer, err)
+	}
+}
+
+// CreateBeneficiary saves a payee, identified by an account number or alias, for a user.
+func (h *Handler) CreateBeneficiary(writer http.ResponseWriter, request *http.Request) {
+	var beneficiary beneficiaries.Beneficiary
+	if err := json.NewDecoder(request.Body).Decode(&beneficiary); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Beneficiaries.CreateBeneficiary(request.Context(), &beneficiary); err != nil {
+		writeBeneficiaryError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(beneficiary); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetBeneficiaryByID fetches a single saved payee.
+func (h *Handler) GetBeneficiaryByID(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	beneficiary, err := h.Beneficiaries.GetBeneficiaryByID(request.Context(), uint(id))
+	if err != nil {
+		writeBeneficiaryError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(beneficiary); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetBeneficiariesByUserID lists the payees saved by the user identified by the user_id URL parameter.
+func (h *Handler) GetBeneficiariesByUserID(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	userID, err := strconv.ParseUint(vars["user_id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.Beneficiaries.GetBeneficiariesByUserID(request.Context(), uint(userID))
+	if err != nil {
+		writeBeneficiaryError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// UpdateBeneficiary renames a payee or points it at a new account number or alias.
+func (h *Handler) UpdateBeneficiary(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var beneficiary beneficiaries.Beneficiary
+	if err := json.NewDecoder(request.Body).Decode(&beneficiary); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	beneficiary.ID = uint(id)
+
+	updated, err := h.Beneficiaries.UpdateBeneficiary(request.Context(), beneficiary)
+	if err != nil {
+		writeBeneficiaryError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(updated); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// DeleteBeneficiary removes a saved payee. Past transfers keep their link to it.
+func (h *Handler) DeleteBeneficiary(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Beneficiaries.DeleteBeneficiary(request.Context(), uint(id)); err != nil {
+		writeBeneficiaryError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(map[string]string{"status": "OK"}); err != nil {
+		log.Panicln(err)
+	}
+}
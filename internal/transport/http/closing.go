@@ -0,0 +1,180 @@
+package http
+
+import (
+	"PayWalletEngine/internal/closing"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// writeClosingError maps end-of-day errors onto HTTP status codes
+func writeClosingError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, closing.ErrInvalidDay),
+		errors.Is(err, closing.ErrInvalidAsOf),
+		errors.Is(err, closing.ErrInvalidReopen):
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, closing.ErrDayClosed),
+		errors.Is(err, closing.ErrDayNotClosed),
+		errors.Is(err, closing.ErrPreviousDayOpen),
+		errors.Is(err, closing.ErrLaterDayClosed):
+		http.Error(writer, err.Error(), http.StatusConflict)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(writer, "Business day or account not found", http.StatusNotFound)
+	default:
+		writeTransactionError(writer, err)
+	}
+}
+
+// parseBusinessDay reads the YYYY-MM-DD date in the path
+func parseBusinessDay(request *http.Request) (time.Time, error) {
+	date, err := time.Parse("2006-01-02", mux.Vars(request)["date"])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: date must be YYYY-MM-DD", closing.ErrInvalidDay)
+	}
+	return date, nil
+}
+
+// parseAsOf reads the as_of parameter: a timestamp, or a YYYY-MM-DD date meaning the end of that day, or so far today.
+// Without it the balance is given as of now.
+func parseAsOf(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return now, nil
+	}
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		if end := date.AddDate(0, 0, 1); end.Before(now) {
+			return end, nil
+		}
+		if date.After(now) {
+			return time.Time{}, fmt.Errorf("%w: must not be in the future", closing.ErrInvalidAsOf)
+		}
+		return now, nil
+	}
+	asOf, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: must be YYYY-MM-DD or an RFC 3339 timestamp", closing.ErrInvalidAsOf)
+	}
+	return asOf, nil
+}
+
+// CloseBusinessDay closes the day in the path.
+func (h *Handler) CloseBusinessDay(writer http.ResponseWriter, request *http.Request) {
+	date, err := parseBusinessDay(request)
+	if err != nil {
+		writeClosingError(writer, err)
+		return
+	}
+
+	dayClose, err := h.Closing.CloseDay(request.Context(), date)
+	if err != nil {
+		writeClosingError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(dayClose); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// ReopenBusinessDay reopens the latest closed day so it can be closed again.
+func (h *Handler) ReopenBusinessDay(writer http.ResponseWriter, request *http.Request) {
+	date, err := parseBusinessDay(request)
+	if err != nil {
+		writeClosingError(writer, err)
+		return
+	}
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	dayClose, err := h.Closing.ReopenDay(request.Context(), date, body.Reason)
+	if err != nil {
+		writeClosingError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(dayClose); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetBusinessDayCloses lists the closed and reopened days, the latest first.
+func (h *Handler) GetBusinessDayCloses(writer http.ResponseWriter, request *http.Request) {
+	list, err := h.Closing.GetDayCloses(request.Context())
+	if err != nil {
+		writeClosingError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetTrialBalance returns the trial balance of a closed day.
+func (h *Handler) GetTrialBalance(writer http.ResponseWriter, request *http.Request) {
+	date, err := parseBusinessDay(request)
+	if err != nil {
+		writeClosingError(writer, err)
+		return
+	}
+
+	trial, err := h.Closing.GetTrialBalance(request.Context(), date)
+	if err != nil {
+		writeClosingError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(trial); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetDailyBalances returns every account's balance at the close of a closed day.
+func (h *Handler) GetDailyBalances(writer http.ResponseWriter, request *http.Request) {
+	date, err := parseBusinessDay(request)
+	if err != nil {
+		writeClosingError(writer, err)
+		return
+	}
+
+	list, err := h.Closing.GetDailyBalances(request.Context(), date)
+	if err != nil {
+		writeClosingError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetAccountBalanceAsOf returns the balance of the account identified by the id URL parameter at a point in time.
+func (h *Handler) GetAccountBalanceAsOf(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	asOf, err := parseAsOf(request.URL.Query().Get("as_of"), time.Now())
+	if err != nil {
+		writeClosingError(writer, err)
+		return
+	}
+
+	balance, err := h.Closing.GetBalanceAsOf(request.Context(), uint(id), asOf)
+	if err != nil {
+		writeClosingError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(balance); err != nil {
+		log.Panicln(err)
+	}
+}
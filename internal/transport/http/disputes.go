@@ -0,0 +1,241 @@
+package http
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/disputes"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// writeDisputeError maps dispute errors onto HTTP status codes
+func writeDisputeError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, disputes.ErrInvalidDispute):
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, disputes.ErrNotParty), errors.Is(err, disputes.ErrNotAgent):
+		http.Error(writer, err.Error(), http.StatusForbidden)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(writer, "Dispute, transaction or account not found", http.StatusNotFound)
+	case errors.Is(err, disputes.ErrDisputeExists), errors.Is(err, disputes.ErrDisputeClosed), errors.Is(err, disputes.ErrAlreadyResponded),
+		errors.Is(err, disputes.ErrDeadlinePassed), errors.Is(err, disputes.ErrProvisionalCredit):
+		http.Error(writer, err.Error(), http.StatusConflict)
+	case errors.Is(err, disputes.ErrNotDisputable), errors.Is(err, accounts.ErrInsufficientFunds):
+		http.Error(writer, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		writeTransactionError(writer, err)
+	}
+}
+
+// parseDisputeID reads the id URL parameter, writing a 400 when it is not a number
+func parseDisputeID(writer http.ResponseWriter, request *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// writeDispute encodes a dispute or writes the error that stopped it being returned
+func writeDispute(writer http.ResponseWriter, dispute disputes.Dispute, err error) {
+	if err != nil {
+		writeDisputeError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(dispute); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// writeDisputes encodes a list of disputes or writes the error that stopped it being returned
+func writeDisputes(writer http.ResponseWriter, list []disputes.Dispute, err error) {
+	if err != nil {
+		writeDisputeError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// OpenDispute opens a dispute against a transfer on behalf of its sender.
+func (h *Handler) OpenDispute(writer http.ResponseWriter, request *http.Request) {
+	var dispute disputes.Dispute
+	if err := json.NewDecoder(request.Body).Decode(&dispute); err != nil || dispute.UserID == 0 || dispute.TransactionID == uuid.Nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Disputes.OpenDispute(request.Context(), &dispute); err != nil {
+		writeDisputeError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(dispute); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetDisputeByID fetches a single dispute with its evidence.
+func (h *Handler) GetDisputeByID(writer http.ResponseWriter, request *http.Request) {
+	id, ok := parseDisputeID(writer, request)
+	if !ok {
+		return
+	}
+	dispute, err := h.Disputes.GetDisputeByID(request.Context(), id)
+	writeDispute(writer, dispute, err)
+}
+
+// GetDisputesByUserID lists the disputes the user identified by the user_id URL parameter has opened.
+func (h *Handler) GetDisputesByUserID(writer http.ResponseWriter, request *http.Request) {
+	userID, err := strconv.ParseUint(mux.Vars(request)["user_id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, err := h.Disputes.GetDisputesByUserID(request.Context(), uint(userID))
+	writeDisputes(writer, list, err)
+}
+
+// GetDisputesByMerchant lists the disputes opened against transfers into the user's accounts.
+func (h *Handler) GetDisputesByMerchant(writer http.ResponseWriter, request *http.Request) {
+	userID, err := strconv.ParseUint(mux.Vars(request)["user_id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, err := h.Disputes.GetDisputesByMerchant(request.Context(), uint(userID))
+	writeDisputes(writer, list, err)
+}
+
+// GetDisputeQueue lists disputes for the support agent named by the agent_id query parameter, optionally filtered
+// by status.
+func (h *Handler) GetDisputeQueue(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	agentID, err := strconv.ParseUint(query.Get("agent_id"), 10, 64)
+	if err != nil {
+		http.Error(writer, "agent_id is required", http.StatusBadRequest)
+		return
+	}
+	list, err := h.Disputes.GetDisputeQueue(request.Context(), uint(agentID), query.Get("status"))
+	writeDisputes(writer, list, err)
+}
+
+// AddDisputeEvidence attaches a document to a dispute on behalf of the customer, the merchant or an agent.
+func (h *Handler) AddDisputeEvidence(writer http.ResponseWriter, request *http.Request) {
+	id, ok := parseDisputeID(writer, request)
+	if !ok {
+		return
+	}
+	var evidence disputes.Evidence
+	if err := json.NewDecoder(request.Body).Decode(&evidence); err != nil || evidence.UserID == 0 {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	dispute, err := h.Disputes.AddDisputeEvidence(request.Context(), id, evidence)
+	if err != nil {
+		writeDisputeError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(dispute); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// RespondToDispute records the merchant's response to a dispute.
+func (h *Handler) RespondToDispute(writer http.ResponseWriter, request *http.Request) {
+	id, ok := parseDisputeID(writer, request)
+	if !ok {
+		return
+	}
+	var body struct {
+		UserID   uint   `json:"user_id"`
+		Response string `json:"response"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil || body.UserID == 0 {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	dispute, err := h.Disputes.RespondToDispute(request.Context(), id, body.UserID, body.Response)
+	writeDispute(writer, dispute, err)
+}
+
+// WithdrawDispute closes a dispute on behalf of the customer who opened it.
+func (h *Handler) WithdrawDispute(writer http.ResponseWriter, request *http.Request) {
+	id, ok := parseDisputeID(writer, request)
+	if !ok {
+		return
+	}
+	var actor struct {
+		UserID uint `json:"user_id"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&actor); err != nil || actor.UserID == 0 {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	dispute, err := h.Disputes.WithdrawDispute(request.Context(), id, actor.UserID)
+	writeDispute(writer, dispute, err)
+}
+
+// ReviewDispute puts a dispute under review by a support agent, optionally crediting the customer provisionally.
+func (h *Handler) ReviewDispute(writer http.ResponseWriter, request *http.Request) {
+	id, ok := parseDisputeID(writer, request)
+	if !ok {
+		return
+	}
+	var body struct {
+		AgentID           uint `json:"agent_id"`
+		ProvisionalCredit bool `json:"provisional_credit"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil || body.AgentID == 0 {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	dispute, err := h.Disputes.ReviewDispute(request.Context(), id, body.AgentID, body.ProvisionalCredit)
+	writeDispute(writer, dispute, err)
+}
+
+// DecideDispute closes a dispute as won or lost on behalf of a support agent.
+func (h *Handler) DecideDispute(writer http.ResponseWriter, request *http.Request) {
+	id, ok := parseDisputeID(writer, request)
+	if !ok {
+		return
+	}
+	var body struct {
+		AgentID uint   `json:"agent_id"`
+		Outcome string `json:"outcome"`
+		Note    string `json:"note"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil || body.AgentID == 0 {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	dispute, err := h.Disputes.DecideDispute(request.Context(), id, body.AgentID, body.Outcome, body.Note)
+	writeDispute(writer, dispute, err)
+}
+
+// GetDisputeTransactions lists the money movements posted for a dispute.
+func (h *Handler) GetDisputeTransactions(writer http.ResponseWriter, request *http.Request) {
+	id, ok := parseDisputeID(writer, request)
+	if !ok {
+		return
+	}
+	txns, err := h.Disputes.GetDisputeTransactions(request.Context(), id)
+	if err != nil {
+		writeDisputeError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(txns); err != nil {
+		log.Panicln(err)
+	}
+}
@@ -0,0 +1,196 @@
+package http
+
+import (
+	"PayWalletEngine/internal/escrows"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// writeEscrowError maps escrow errors onto HTTP status codes
+func writeEscrowError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, escrows.ErrInvalidEscrow):
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, escrows.ErrNotParty):
+		http.Error(writer, err.Error(), http.StatusForbidden)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(writer, "Escrow, milestone or account not found", http.StatusNotFound)
+	case errors.Is(err, escrows.ErrEscrowDisputed), errors.Is(err, escrows.ErrEscrowClosed), errors.Is(err, escrows.ErrMilestoneReleased):
+		http.Error(writer, err.Error(), http.StatusConflict)
+	default:
+		writeTransactionError(writer, err)
+	}
+}
+
+// CreateEscrow moves funds from the buyer's account into escrow.
+func (h *Handler) CreateEscrow(writer http.ResponseWriter, request *http.Request) {
+	var escrow escrows.Escrow
+	if err := json.NewDecoder(request.Body).Decode(&escrow); err != nil || escrow.BuyerUserID == 0 {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if err := validateAccountNumbers(escrow.BuyerAccountNumber, escrow.SellerAccountNumber); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Escrows.CreateEscrow(request.Context(), &escrow); err != nil {
+		writeEscrowError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(escrow); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetEscrowByID fetches a single escrow with its milestones.
+func (h *Handler) GetEscrowByID(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	escrow, err := h.Escrows.GetEscrowByID(request.Context(), uint(id))
+	if err != nil {
+		writeEscrowError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(escrow); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetEscrowsByUserID lists the escrows the user identified by the user_id URL parameter takes part in.
+func (h *Handler) GetEscrowsByUserID(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	userID, err := strconv.ParseUint(vars["user_id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.Escrows.GetEscrowsByUserID(request.Context(), uint(userID))
+	if err != nil {
+		writeEscrowError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// ReleaseEscrowMilestone pays one milestone to the seller on behalf of the buyer or the arbiter.
+func (h *Handler) ReleaseEscrowMilestone(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	milestoneID, err := strconv.ParseUint(vars["milestone_id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var actor struct {
+		UserID uint `json:"user_id"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&actor); err != nil || actor.UserID == 0 {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	escrow, err := h.Escrows.ReleaseMilestone(request.Context(), uint(id), uint(milestoneID), actor.UserID)
+	if err != nil {
+		writeEscrowError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(escrow); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// OpenEscrowDispute freezes the escrow on behalf of its buyer or seller.
+func (h *Handler) OpenEscrowDispute(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		UserID uint   `json:"user_id"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil || body.UserID == 0 {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	escrow, err := h.Escrows.OpenEscrowDispute(request.Context(), uint(id), body.UserID, body.Reason)
+	if err != nil {
+		writeEscrowError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(escrow); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// ResolveEscrowDispute lets the arbiter split the held funds between seller and buyer.
+func (h *Handler) ResolveEscrowDispute(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		UserID       uint     `json:"user_id"`
+		SellerAmount *float64 `json:"seller_amount"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil || body.UserID == 0 || body.SellerAmount == nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	escrow, err := h.Escrows.ResolveEscrowDispute(request.Context(), uint(id), body.UserID, *body.SellerAmount)
+	if err != nil {
+		writeEscrowError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(escrow); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetEscrowTransactions lists every transaction that moved money into or out of the escrow.
+func (h *Handler) GetEscrowTransactions(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	txns, err := h.Escrows.GetEscrowTransactions(request.Context(), uint(id))
+	if err != nil {
+		writeEscrowError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(txns); err != nil {
+		log.Panicln(err)
+	}
+}
@@ -0,0 +1,113 @@
+package http
+
+import (
+	"PayWalletEngine/internal/fees"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// writeFeeError maps fee errors onto HTTP status codes
+func writeFeeError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fees.ErrInvalidSchedule):
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(writer, "Fee schedule or account not found", http.StatusNotFound)
+	default:
+		writeTransactionError(writer, err)
+	}
+}
+
+// CreateFeeSchedule adds a fee rule.
+func (h *Handler) CreateFeeSchedule(writer http.ResponseWriter, request *http.Request) {
+	schedule := fees.Schedule{Active: true}
+	if err := json.NewDecoder(request.Body).Decode(&schedule); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Fees.CreateFeeSchedule(request.Context(), &schedule); err != nil {
+		writeFeeError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(schedule); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetFeeSchedules lists every fee rule.
+func (h *Handler) GetFeeSchedules(writer http.ResponseWriter, request *http.Request) {
+	list, err := h.Fees.GetFeeSchedules(request.Context())
+	if err != nil {
+		writeFeeError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// UpdateFeeSchedule replaces a fee rule, including switching it on or off.
+func (h *Handler) UpdateFeeSchedule(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var schedule fees.Schedule
+	if err := json.NewDecoder(request.Body).Decode(&schedule); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	schedule.ID = uint(id)
+
+	updated, err := h.Fees.UpdateFeeSchedule(request.Context(), schedule)
+	if err != nil {
+		writeFeeError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(updated); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// QuoteFees returns the fees a transaction would be charged before it is executed. The account_number query
+// parameter names the payer: the sender of a debit or transfer, or the receiver of a credit.
+func (h *Handler) QuoteFees(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	accountNumber, err := parseAccountNumber(query.Get("account_number"))
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	amount, err := strconv.ParseFloat(query.Get("amount"), 64)
+	if err != nil {
+		http.Error(writer, "Invalid amount", http.StatusBadRequest)
+		return
+	}
+	transactionType := query.Get("type")
+	switch transactionType {
+	case "Credit", "Debit", "Transfer":
+	default:
+		http.Error(writer, "type must be Credit, Debit or Transfer", http.StatusBadRequest)
+		return
+	}
+
+	quote, err := h.Transaction.QuoteFees(request.Context(), accountNumber, transactionType, query.Get("payment_method"), amount)
+	if err != nil {
+		writeFeeError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(quote); err != nil {
+		log.Panicln(err)
+	}
+}
@@ -2,8 +2,27 @@ package http
 
 import (
 	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/aliases"
+	"PayWalletEngine/internal/batches"
+	"PayWalletEngine/internal/beneficiaries"
+	"PayWalletEngine/internal/closing"
+	"PayWalletEngine/internal/disputes"
+	"PayWalletEngine/internal/escrows"
+	"PayWalletEngine/internal/events"
+	"PayWalletEngine/internal/fees"
+	"PayWalletEngine/internal/integrity"
+	"PayWalletEngine/internal/interest"
+	"PayWalletEngine/internal/ledger"
+	"PayWalletEngine/internal/mandates"
+	"PayWalletEngine/internal/paymentrequests"
+	"PayWalletEngine/internal/pots"
+	"PayWalletEngine/internal/privacy"
+	"PayWalletEngine/internal/reconciliation"
+	"PayWalletEngine/internal/schedules"
+	"PayWalletEngine/internal/statements"
 	"PayWalletEngine/internal/transactions"
 	"PayWalletEngine/internal/users"
+	"PayWalletEngine/internal/webhooks"
 	"context"
 	"encoding/json"
 	"github.com/gorilla/mux"
@@ -15,13 +34,37 @@ import (
 	"time"
 )
 
+// Services - the domain services the handler serves, one field per feature
+type Services struct {
+	Transaction     transactions.TransactionService
+	Users           users.UserService
+	Accounts        accounts.AccountService
+	Privacy         privacy.PrivacyService
+	Aliases         aliases.AliasService
+	Beneficiaries   beneficiaries.BeneficiaryService
+	PaymentRequests paymentrequests.PaymentRequestService
+	Schedules       schedules.ScheduleService
+	Mandates        mandates.MandateService
+	Batches         batches.BatchService
+	Fees            fees.FeeService
+	Interest        interest.InterestService
+	Pots            pots.PotService
+	Escrows         escrows.EscrowService
+	Disputes        disputes.DisputeService
+	Statements      statements.StatementService
+	Reconciliation  reconciliation.ReconciliationService
+	Integrity       integrity.IntegrityService
+	Closing         closing.ClosingService
+	Ledger          ledger.LedgerService
+	Webhooks        webhooks.WebhookService
+	Outbox          events.OutboxService
+}
+
 // Handler - stores pointer to our comments service
 type Handler struct {
-	Router      *mux.Router
-	Transaction transactions.TransactionService
-	Users       users.UserService
-	Accounts    accounts.AccountService
-	Server      *http.Server
+	Services
+	Router *mux.Router
+	Server *http.Server
 }
 
 // Response object
@@ -30,13 +73,9 @@ type Response struct {
 }
 
 // NewHandler - returns a pointer to a Handler
-func NewHandler(users users.UserService, transactions transactions.TransactionService, accounts accounts.AccountService) *Handler {
+func NewHandler(services Services) *Handler {
 	log.Info("setting up our handler")
-	h := &Handler{
-		Users:       users,
-		Transaction: transactions,
-		Accounts:    accounts,
-	}
+	h := &Handler{Services: services}
 
 	h.Router = mux.NewRouter()
 
@@ -76,14 +115,160 @@ func (h *Handler) mapRoutes() {
 	h.Router.HandleFunc("/api/v1/users/username/{username}", h.GetByUsername).Methods("GET")
 	h.Router.HandleFunc("/api/v1/users/ping", h.Ping).Methods("GET")
 	h.Router.HandleFunc("/api/v1/users/password/reset", h.ResetPassword).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/users/{id}/export", h.ExportUserData).Methods("GET")
+	h.Router.HandleFunc("/api/v1/users/{id}/erase", h.EraseUser).Methods("POST")
 
 	// AccountNumber Routes
 	h.Router.HandleFunc("/api/v1/accounts/create", h.CreateAccount).Methods("POST")
+	h.Router.HandleFunc("/api/v1/accounts/overdrawn", h.GetOverdrawnAccounts).Methods("GET")
 	h.Router.HandleFunc("/api/v1/accounts/{id}", h.GetAccountByID).Methods("GET")
 	h.Router.HandleFunc("/api/v1/accounts/{id}/update", h.UpdateAccountDetails).Methods("PUT")
 	h.Router.HandleFunc("/api/v1/accounts/{account_number}/user", h.GetUserDetailsByAccountNumber).Methods("GET")
 	h.Router.HandleFunc("/api/v1/accounts/number/{number}", h.GetAccountByNumber).Methods("GET")
 	h.Router.HandleFunc("/api/v1/accounts/user/{user_id}", h.GetAccountsByUserID).Methods("GET")
+	h.Router.HandleFunc("/api/v1/accounts/{id}/freeze", h.FreezeAccount).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/accounts/{id}/unfreeze", h.UnfreezeAccount).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/accounts/{id}/close", h.CloseAccount).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/accounts/{id}/status-history", h.GetAccountStatusHistory).Methods("GET")
+	h.Router.HandleFunc("/api/v1/accounts/{id}/default", h.SetDefaultAccount).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/accounts/{id}/overdraft", h.SetOverdraftLimit).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/accounts/{id}/statement", h.GetAccountStatement).Methods("GET")
+	h.Router.HandleFunc("/api/v1/accounts/{id}/balance", h.GetAccountBalanceAsOf).Methods("GET")
+
+	// Alias Routes
+	h.Router.HandleFunc("/api/v1/aliases", h.RegisterAlias).Methods("POST")
+	h.Router.HandleFunc("/api/v1/aliases/{id}/verify", h.VerifyAlias).Methods("POST")
+	h.Router.HandleFunc("/api/v1/aliases/{id}/resend", h.ResendVerificationCode).Methods("POST")
+	h.Router.HandleFunc("/api/v1/aliases/{id}", h.DeleteAlias).Methods("DELETE")
+	h.Router.HandleFunc("/api/v1/aliases/user/{user_id}", h.GetAliasesByUserID).Methods("GET")
+	h.Router.HandleFunc("/api/v1/aliases/lookup/{alias}", h.LookupAlias).Methods("GET")
+
+	// Beneficiary Routes
+	h.Router.HandleFunc("/api/v1/beneficiaries", h.CreateBeneficiary).Methods("POST")
+	h.Router.HandleFunc("/api/v1/beneficiaries/{id}", h.GetBeneficiaryByID).Methods("GET")
+	h.Router.HandleFunc("/api/v1/beneficiaries/{id}", h.UpdateBeneficiary).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/beneficiaries/{id}", h.DeleteBeneficiary).Methods("DELETE")
+	h.Router.HandleFunc("/api/v1/beneficiaries/user/{user_id}", h.GetBeneficiariesByUserID).Methods("GET")
+
+	// Payment Request Routes
+	h.Router.HandleFunc("/api/v1/payment-requests", h.CreatePaymentRequest).Methods("POST")
+	h.Router.HandleFunc("/api/v1/payment-requests/{id}", h.GetPaymentRequestByID).Methods("GET")
+	h.Router.HandleFunc("/api/v1/payment-requests/{id}/pay", h.PayPaymentRequest).Methods("POST")
+	h.Router.HandleFunc("/api/v1/payment-requests/{id}/decline", h.DeclinePaymentRequest).Methods("POST")
+	h.Router.HandleFunc("/api/v1/payment-requests/{id}/cancel", h.CancelPaymentRequest).Methods("POST")
+	h.Router.HandleFunc("/api/v1/payment-requests/user/{user_id}/incoming", h.GetIncomingPaymentRequests).Methods("GET")
+	h.Router.HandleFunc("/api/v1/payment-requests/user/{user_id}/outgoing", h.GetOutgoingPaymentRequests).Methods("GET")
+
+	// Schedule Routes
+	h.Router.HandleFunc("/api/v1/schedules", h.CreateSchedule).Methods("POST")
+	h.Router.HandleFunc("/api/v1/schedules/{id}", h.GetScheduleByID).Methods("GET")
+	h.Router.HandleFunc("/api/v1/schedules/{id}/runs", h.GetScheduleRuns).Methods("GET")
+	h.Router.HandleFunc("/api/v1/schedules/{id}/pause", h.PauseSchedule).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/schedules/{id}/resume", h.ResumeSchedule).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/schedules/{id}/cancel", h.CancelSchedule).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/schedules/user/{user_id}", h.GetSchedulesByUserID).Methods("GET")
+
+	// Mandate Routes
+	h.Router.HandleFunc("/api/v1/mandates", h.CreateMandate).Methods("POST")
+	h.Router.HandleFunc("/api/v1/mandates/{id}", h.GetMandateByID).Methods("GET")
+	h.Router.HandleFunc("/api/v1/mandates/{id}/revoke", h.RevokeMandate).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/mandates/{id}/pull", h.PullFunds).Methods("POST")
+	h.Router.HandleFunc("/api/v1/mandates/{id}/pulls", h.GetMandatePulls).Methods("GET")
+	h.Router.HandleFunc("/api/v1/mandates/user/{user_id}", h.GetMandatesByUserID).Methods("GET")
+	h.Router.HandleFunc("/api/v1/mandates/merchant/{account_number}", h.GetMandatesByMerchant).Methods("GET")
+
+	// Fee Routes
+	h.Router.HandleFunc("/api/v1/fees/schedules", h.CreateFeeSchedule).Methods("POST")
+	h.Router.HandleFunc("/api/v1/fees/schedules", h.GetFeeSchedules).Methods("GET")
+	h.Router.HandleFunc("/api/v1/fees/schedules/{id}", h.UpdateFeeSchedule).Methods("PUT")
+
+	// Interest Routes
+	h.Router.HandleFunc("/api/v1/interest/plans", h.CreateInterestPlan).Methods("POST")
+	h.Router.HandleFunc("/api/v1/interest/plans", h.GetInterestPlans).Methods("GET")
+	h.Router.HandleFunc("/api/v1/interest/plans/{id}", h.UpdateInterestPlan).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/interest/accounts/{id}", h.GetInterestSummary).Methods("GET")
+
+	// Pot Routes
+	h.Router.HandleFunc("/api/v1/pots", h.CreatePot).Methods("POST")
+	h.Router.HandleFunc("/api/v1/pots/{id}", h.GetPotByID).Methods("GET")
+	h.Router.HandleFunc("/api/v1/pots/user/{user_id}", h.GetPotsByUserID).Methods("GET")
+	h.Router.HandleFunc("/api/v1/pots/{id}/deposit", h.DepositToPot).Methods("POST")
+	h.Router.HandleFunc("/api/v1/pots/{id}/withdraw", h.WithdrawFromPot).Methods("POST")
+	h.Router.HandleFunc("/api/v1/pots/{id}/lock", h.LockPot).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/pots/{id}/close", h.ClosePot).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/pots/{id}/rules", h.AddPotRule).Methods("POST")
+	h.Router.HandleFunc("/api/v1/pots/{id}/rules/{rule_id}/disable", h.DisablePotRule).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/pots/{id}/movements", h.GetPotMovements).Methods("GET")
+
+	// Escrow Routes
+	h.Router.HandleFunc("/api/v1/escrows", h.CreateEscrow).Methods("POST")
+	h.Router.HandleFunc("/api/v1/escrows/{id}", h.GetEscrowByID).Methods("GET")
+	h.Router.HandleFunc("/api/v1/escrows/user/{user_id}", h.GetEscrowsByUserID).Methods("GET")
+	h.Router.HandleFunc("/api/v1/escrows/{id}/milestones/{milestone_id}/release", h.ReleaseEscrowMilestone).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/escrows/{id}/dispute", h.OpenEscrowDispute).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/escrows/{id}/resolve", h.ResolveEscrowDispute).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/escrows/{id}/transactions", h.GetEscrowTransactions).Methods("GET")
+
+	// Dispute Routes
+	h.Router.HandleFunc("/api/v1/disputes", h.OpenDispute).Methods("POST")
+	h.Router.HandleFunc("/api/v1/disputes/queue", h.GetDisputeQueue).Methods("GET")
+	h.Router.HandleFunc("/api/v1/disputes/user/{user_id}", h.GetDisputesByUserID).Methods("GET")
+	h.Router.HandleFunc("/api/v1/disputes/merchant/{user_id}", h.GetDisputesByMerchant).Methods("GET")
+	h.Router.HandleFunc("/api/v1/disputes/{id}", h.GetDisputeByID).Methods("GET")
+	h.Router.HandleFunc("/api/v1/disputes/{id}/evidence", h.AddDisputeEvidence).Methods("POST")
+	h.Router.HandleFunc("/api/v1/disputes/{id}/respond", h.RespondToDispute).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/disputes/{id}/withdraw", h.WithdrawDispute).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/disputes/{id}/review", h.ReviewDispute).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/disputes/{id}/decide", h.DecideDispute).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/disputes/{id}/transactions", h.GetDisputeTransactions).Methods("GET")
+
+	// Reconciliation Routes
+	h.Router.HandleFunc("/api/v1/reconciliation/expected-credits", h.CreateExpectedCredit).Methods("POST")
+	h.Router.HandleFunc("/api/v1/reconciliation/expected-credits", h.GetExpectedCredits).Methods("GET")
+	h.Router.HandleFunc("/api/v1/reconciliation/expected-credits/{id}/cancel", h.CancelExpectedCredit).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/reconciliation/imports", h.ImportBankStatement).Methods("POST")
+	h.Router.HandleFunc("/api/v1/reconciliation/imports", h.GetBankStatementImports).Methods("GET")
+	h.Router.HandleFunc("/api/v1/reconciliation/imports/{id}", h.GetReconciliationReport).Methods("GET")
+	h.Router.HandleFunc("/api/v1/reconciliation/exceptions", h.GetReconciliationExceptions).Methods("GET")
+	h.Router.HandleFunc("/api/v1/reconciliation/lines/{id}/match", h.MatchBankStatementLine).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/reconciliation/lines/{id}/ignore", h.IgnoreBankStatementLine).Methods("PUT")
+
+	// Integrity Routes
+	h.Router.HandleFunc("/api/v1/integrity/verify", h.VerifyBalances).Methods("POST")
+	h.Router.HandleFunc("/api/v1/integrity/reports", h.GetIntegrityReports).Methods("GET")
+	h.Router.HandleFunc("/api/v1/integrity/reports/{id}", h.GetIntegrityReport).Methods("GET")
+
+	// Closing Routes
+	h.Router.HandleFunc("/api/v1/closes", h.GetBusinessDayCloses).Methods("GET")
+	h.Router.HandleFunc("/api/v1/closes/{date}", h.CloseBusinessDay).Methods("POST")
+	h.Router.HandleFunc("/api/v1/closes/{date}/reopen", h.ReopenBusinessDay).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/closes/{date}/trial-balance", h.GetTrialBalance).Methods("GET")
+	h.Router.HandleFunc("/api/v1/closes/{date}/balances", h.GetDailyBalances).Methods("GET")
+
+	// Ledger Routes
+	h.Router.HandleFunc("/api/v1/ledger/accounts", h.GetGLAccounts).Methods("GET")
+	h.Router.HandleFunc("/api/v1/ledger/accounts", h.CreateGLAccount).Methods("POST")
+	h.Router.HandleFunc("/api/v1/ledger/accounts/{code}", h.UpdateGLAccount).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/ledger/mappings", h.GetGLMappings).Methods("GET")
+	h.Router.HandleFunc("/api/v1/ledger/mappings", h.CreateGLMapping).Methods("POST")
+	h.Router.HandleFunc("/api/v1/ledger/mappings/{id}", h.UpdateGLMapping).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/ledger/mappings/{id}", h.DeleteGLMapping).Methods("DELETE")
+	h.Router.HandleFunc("/api/v1/ledger/journal", h.GetJournal).Methods("GET")
+	h.Router.HandleFunc("/api/v1/ledger/trial-balance", h.GetGLTrialBalance).Methods("GET")
+
+	// Webhook Routes
+	h.Router.HandleFunc("/api/v1/webhooks/endpoints", h.CreateWebhookEndpoint).Methods("POST")
+	h.Router.HandleFunc("/api/v1/webhooks/endpoints/{id}", h.GetWebhookEndpoint).Methods("GET")
+	h.Router.HandleFunc("/api/v1/webhooks/endpoints/{id}", h.UpdateWebhookEndpoint).Methods("PUT")
+	h.Router.HandleFunc("/api/v1/webhooks/endpoints/{id}", h.DeleteWebhookEndpoint).Methods("DELETE")
+	h.Router.HandleFunc("/api/v1/webhooks/endpoints/{id}/deliveries", h.GetWebhookDeliveries).Methods("GET")
+	h.Router.HandleFunc("/api/v1/webhooks/endpoints/{id}/dead-letters/replay", h.ReplayWebhookDeadLetters).Methods("POST")
+	h.Router.HandleFunc("/api/v1/webhooks/deliveries/{id}/attempts", h.GetWebhookDeliveryAttempts).Methods("GET")
+	h.Router.HandleFunc("/api/v1/webhooks/deliveries/{id}/replay", h.ReplayWebhookDelivery).Methods("POST")
+	h.Router.HandleFunc("/api/v1/webhooks/user/{user_id}", h.GetWebhookEndpointsByUserID).Methods("GET")
+
+	// Outbox Routes
+	h.Router.HandleFunc("/api/v1/outbox/pending", h.GetPendingOutbox).Methods("GET")
 
 	// Transactions Routes
 	h.Router.HandleFunc("/api/v1/transactions/account/{account_number}", h.GetTransactionsFromAccount).Methods("GET")
@@ -91,6 +276,10 @@ func (h *Handler) mapRoutes() {
 	h.Router.HandleFunc("/api/v1/transactions/credit", h.CreditAccount).Methods("POST")
 	h.Router.HandleFunc("/api/v1/transactions/debit", h.DebitAccount).Methods("POST")
 	h.Router.HandleFunc("/api/v1/transactions/transfer", h.TransferFunds).Methods("POST")
+	h.Router.HandleFunc("/api/v1/transactions/internal-transfer", h.TransferBetweenOwnAccounts).Methods("POST")
+	h.Router.HandleFunc("/api/v1/transactions/batch", h.ExecuteBatch).Methods("POST")
+	h.Router.HandleFunc("/api/v1/transactions/batch/{id}", h.GetBatchByID).Methods("GET")
+	h.Router.HandleFunc("/api/v1/transactions/quote", h.QuoteFees).Methods("GET")
 	h.Router.HandleFunc("/api/v1/transactions/{transaction_id}/user-account", h.GetUserAccountAndTransactionByTransactionID).Methods("GET")
 	h.Router.HandleFunc("/api/v1/transactions/{transaction_id}/account", h.GetAccountByTransactionID).Methods("GET")
 }
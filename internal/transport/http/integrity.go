@@ -0,0 +1,84 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// writeIntegrityError maps integrity check errors onto HTTP status codes
+func writeIntegrityError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(writer, "Integrity report not found", http.StatusNotFound)
+	default:
+		writeTransactionError(writer, err)
+	}
+}
+
+// VerifyBalances runs the balance integrity check now. With freeze=true the customer accounts it finds
+// discrepancies on are frozen.
+func (h *Handler) VerifyBalances(writer http.ResponseWriter, request *http.Request) {
+	freeze := false
+	if value := request.URL.Query().Get("freeze"); value != "" {
+		var err error
+		if freeze, err = strconv.ParseBool(value); err != nil {
+			http.Error(writer, "freeze must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := h.Integrity.Verify(request.Context(), freeze)
+	if err != nil {
+		writeIntegrityError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(report); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetIntegrityReports lists the latest integrity check reports, newest first.
+func (h *Handler) GetIntegrityReports(writer http.ResponseWriter, request *http.Request) {
+	limit := 0
+	if value := request.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			http.Error(writer, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	list, err := h.Integrity.GetReports(request.Context(), limit)
+	if err != nil {
+		writeIntegrityError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetIntegrityReport returns one integrity check report with its discrepancies.
+func (h *Handler) GetIntegrityReport(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.Integrity.GetReport(request.Context(), uint(id))
+	if err != nil {
+		writeIntegrityError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(report); err != nil {
+		log.Panicln(err)
+	}
+}
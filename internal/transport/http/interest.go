@@ -0,0 +1,102 @@
+package http
+
+import (
+	"PayWalletEngine/internal/interest"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// writeInterestError maps interest errors onto HTTP status codes
+func writeInterestError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, interest.ErrInvalidPlan):
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, interest.ErrPlanExists):
+		http.Error(writer, err.Error(), http.StatusConflict)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(writer, "Interest plan or account not found", http.StatusNotFound)
+	default:
+		writeTransactionError(writer, err)
+	}
+}
+
+// CreateInterestPlan attaches an interest rate to an account type.
+func (h *Handler) CreateInterestPlan(writer http.ResponseWriter, request *http.Request) {
+	plan := interest.Plan{Active: true}
+	if err := json.NewDecoder(request.Body).Decode(&plan); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Interest.CreateInterestPlan(request.Context(), &plan); err != nil {
+		writeInterestError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(plan); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetInterestPlans lists every interest plan.
+func (h *Handler) GetInterestPlans(writer http.ResponseWriter, request *http.Request) {
+	list, err := h.Interest.GetInterestPlans(request.Context())
+	if err != nil {
+		writeInterestError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// UpdateInterestPlan replaces an interest plan, including switching it on or off.
+func (h *Handler) UpdateInterestPlan(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var plan interest.Plan
+	if err := json.NewDecoder(request.Body).Decode(&plan); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	plan.ID = uint(id)
+
+	updated, err := h.Interest.UpdateInterestPlan(request.Context(), plan)
+	if err != nil {
+		writeInterestError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(updated); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetInterestSummary shows an account's accrued but unpaid interest, recent accruals and payouts.
+func (h *Handler) GetInterestSummary(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	summary, err := h.Interest.GetInterestSummary(request.Context(), uint(id))
+	if err != nil {
+		writeInterestError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(summary); err != nil {
+		log.Panicln(err)
+	}
+}
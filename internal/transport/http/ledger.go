@@ -0,0 +1,245 @@
+package http
+
+import (
+	"PayWalletEngine/internal/ledger"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// writeLedgerError maps general ledger errors onto HTTP status codes
+func writeLedgerError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ledger.ErrInvalidGLAccount),
+		errors.Is(err, ledger.ErrInvalidMapping),
+		errors.Is(err, ledger.ErrInvalidJournal),
+		errors.Is(err, ledger.ErrUnknownGLAccount):
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ledger.ErrGLAccountExists),
+		errors.Is(err, ledger.ErrMappingExists):
+		http.Error(writer, err.Error(), http.StatusConflict)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(writer, "GL account or mapping not found", http.StatusNotFound)
+	default:
+		writeTransactionError(writer, err)
+	}
+}
+
+// parseJournalDate reads a required YYYY-MM-DD date bounding a journal
+func parseJournalDate(name string, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("%w: %s is required", ledger.ErrInvalidJournal, name)
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s must be a YYYY-MM-DD date", ledger.ErrInvalidJournal, name)
+	}
+	return date, nil
+}
+
+// CreateGLAccount adds an account to the chart of accounts.
+func (h *Handler) CreateGLAccount(writer http.ResponseWriter, request *http.Request) {
+	var account ledger.GLAccount
+	if err := json.NewDecoder(request.Body).Decode(&account); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Ledger.CreateGLAccount(request.Context(), &account); err != nil {
+		writeLedgerError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(account); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetGLAccounts lists the chart of accounts by code.
+func (h *Handler) GetGLAccounts(writer http.ResponseWriter, request *http.Request) {
+	list, err := h.Ledger.GetGLAccounts(request.Context())
+	if err != nil {
+		writeLedgerError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// UpdateGLAccount renames or recategorizes the GL account identified by the code URL parameter.
+func (h *Handler) UpdateGLAccount(writer http.ResponseWriter, request *http.Request) {
+	var account ledger.GLAccount
+	if err := json.NewDecoder(request.Body).Decode(&account); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	account.Code = mux.Vars(request)["code"]
+
+	updated, err := h.Ledger.UpdateGLAccount(request.Context(), account)
+	if err != nil {
+		writeLedgerError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(updated); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// CreateGLMapping maps a kind of transaction onto a debit and a credit GL account.
+func (h *Handler) CreateGLMapping(writer http.ResponseWriter, request *http.Request) {
+	var mapping ledger.Mapping
+	if err := json.NewDecoder(request.Body).Decode(&mapping); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Ledger.CreateGLMapping(request.Context(), &mapping); err != nil {
+		writeLedgerError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(mapping); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetGLMappings lists the GL mappings.
+func (h *Handler) GetGLMappings(writer http.ResponseWriter, request *http.Request) {
+	list, err := h.Ledger.GetGLMappings(request.Context())
+	if err != nil {
+		writeLedgerError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// UpdateGLMapping replaces the GL mapping identified by the id URL parameter.
+func (h *Handler) UpdateGLMapping(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var mapping ledger.Mapping
+	if err := json.NewDecoder(request.Body).Decode(&mapping); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	mapping.ID = uint(id)
+
+	updated, err := h.Ledger.UpdateGLMapping(request.Context(), mapping)
+	if err != nil {
+		writeLedgerError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(updated); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// DeleteGLMapping removes the GL mapping identified by the id URL parameter.
+func (h *Handler) DeleteGLMapping(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Ledger.DeleteGLMapping(request.Context(), uint(id)); err != nil {
+		writeLedgerError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(map[string]string{"status": "OK"}); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetJournal exports the daily summarized journal over whole days, from and to included, as JSON or CSV.
+func (h *Handler) GetJournal(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	from, err := parseJournalDate("from", query.Get("from"))
+	if err != nil {
+		writeLedgerError(writer, err)
+		return
+	}
+	to, err := parseJournalDate("to", query.Get("to"))
+	if err != nil {
+		writeLedgerError(writer, err)
+		return
+	}
+	format := strings.ToLower(query.Get("format"))
+	if format == "" {
+		format = ledger.FormatJSON
+	}
+	if !ledger.ValidFormat(format) {
+		writeLedgerError(writer, fmt.Errorf("%w: format must be json or csv", ledger.ErrInvalidJournal))
+		return
+	}
+
+	journal, err := h.Ledger.GetJournal(request.Context(), from, to.AddDate(0, 0, 1))
+	if err != nil {
+		writeLedgerError(writer, err)
+		return
+	}
+
+	if format == ledger.FormatJSON {
+		if err := json.NewEncoder(writer).Encode(journal); err != nil {
+			log.Panicln(err)
+		}
+		return
+	}
+
+	var file bytes.Buffer
+	if err := ledger.WriteJournalCSV(&file, journal); err != nil {
+		writeLedgerError(writer, err)
+		return
+	}
+	filename := fmt.Sprintf("journal-%s-%s.csv", from.Format("20060102"), to.Format("20060102"))
+	writer.Header().Set("Content-Type", "text/csv; charset=UTF-8")
+	writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if _, err := file.WriteTo(writer); err != nil {
+		log.Println(err)
+	}
+}
+
+// GetGLTrialBalance returns every GL account's debits and credits up to the end of the as_of day, or up to now.
+func (h *Handler) GetGLTrialBalance(writer http.ResponseWriter, request *http.Request) {
+	now := time.Now()
+	asOf := now
+	if value := request.URL.Query().Get("as_of"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			writeLedgerError(writer, fmt.Errorf("%w: as_of must be a YYYY-MM-DD date", ledger.ErrInvalidJournal))
+			return
+		}
+		if date.After(now) {
+			writeLedgerError(writer, fmt.Errorf("%w: as_of must not be in the future", ledger.ErrInvalidJournal))
+			return
+		}
+		if end := date.AddDate(0, 0, 1); end.Before(now) {
+			asOf = end
+		}
+	}
+
+	trial, err := h.Ledger.GetTrialBalance(request.Context(), asOf)
+	if err != nil {
+		writeLedgerError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(trial); err != nil {
+		log.Panicln(err)
+	}
+}
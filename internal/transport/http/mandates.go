@@ -0,0 +1,191 @@
+package http
+
+import (
+	"PayWalletEngine/internal/mandates"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// writeMandateError maps mandate errors onto HTTP status codes
+func writeMandateError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, mandates.ErrInvalidMandate):
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, mandates.ErrNotOwner), errors.Is(err, mandates.ErrNotMerchant):
+		http.Error(writer, err.Error(), http.StatusForbidden)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(writer, "Mandate or account not found", http.StatusNotFound)
+	case errors.Is(err, mandates.ErrMandateRevoked), errors.Is(err, mandates.ErrOutsideValidity):
+		http.Error(writer, err.Error(), http.StatusConflict)
+	case errors.Is(err, mandates.ErrLimitExceeded):
+		http.Error(writer, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		writeTransactionError(writer, err)
+	}
+}
+
+// CreateMandate records a customer's authorisation for a merchant account to pull funds.
+func (h *Handler) CreateMandate(writer http.ResponseWriter, request *http.Request) {
+	var mandate mandates.Mandate
+	if err := json.NewDecoder(request.Body).Decode(&mandate); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if err := validateAccountNumbers(mandate.CustomerAccountNumber, mandate.MerchantAccountNumber); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Mandates.CreateMandate(request.Context(), &mandate); err != nil {
+		writeMandateError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(mandate); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetMandateByID fetches a single mandate.
+func (h *Handler) GetMandateByID(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mandate, err := h.Mandates.GetMandateByID(request.Context(), uint(id))
+	if err != nil {
+		writeMandateError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(mandate); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetMandatesByUserID lists the mandates granted by the customer identified by the user_id URL parameter.
+func (h *Handler) GetMandatesByUserID(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	userID, err := strconv.ParseUint(vars["user_id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.Mandates.GetMandatesByUserID(request.Context(), uint(userID))
+	if err != nil {
+		writeMandateError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetMandatesByMerchant lists the mandates granted to the merchant account in the URL.
+func (h *Handler) GetMandatesByMerchant(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	accountNumber, err := parseAccountNumber(vars["account_number"])
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.Mandates.GetMandatesByMerchant(request.Context(), accountNumber)
+	if err != nil {
+		writeMandateError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// RevokeMandate lets the customer withdraw a mandate.
+func (h *Handler) RevokeMandate(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var actor struct {
+		UserID uint `json:"user_id"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&actor); err != nil || actor.UserID == 0 {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	mandate, err := h.Mandates.RevokeMandate(request.Context(), uint(id), actor.UserID)
+	if err != nil {
+		writeMandateError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(mandate); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// PullFunds lets a merchant collect funds from the customer within the mandate's terms.
+func (h *Handler) PullFunds(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var pullRequest struct {
+		MerchantAccountNumber int64   `json:"merchant_account_number"`
+		Amount                float64 `json:"amount"`
+		Description           string  `json:"description"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&pullRequest); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if err := validateAccountNumbers(pullRequest.MerchantAccountNumber); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pull, err := h.Mandates.PullFunds(request.Context(), uint(id), pullRequest.MerchantAccountNumber, pullRequest.Amount, pullRequest.Description)
+	if err != nil {
+		writeMandateError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(pull); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetMandatePulls lists every pull attempted under a mandate.
+func (h *Handler) GetMandatePulls(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pulls, err := h.Mandates.GetMandatePulls(request.Context(), uint(id))
+	if err != nil {
+		writeMandateError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(pulls); err != nil {
+		log.Panicln(err)
+	}
+}
@@ -0,0 +1,29 @@
+package http
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// GetPendingOutbox lists the outbox events not published yet, oldest first, so a stuck relay can be spotted.
+func (h *Handler) GetPendingOutbox(writer http.ResponseWriter, request *http.Request) {
+	limit := 0
+	if value := request.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			http.Error(writer, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	list, err := h.Outbox.GetPending(request.Context(), limit)
+	if err != nil {
+		writeTransactionError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
@@ -0,0 +1,180 @@
+package http
+
+import (
+	"PayWalletEngine/internal/paymentrequests"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// writePaymentRequestError maps payment request errors onto HTTP status codes
+func writePaymentRequestError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, paymentrequests.ErrInvalidRequest):
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, paymentrequests.ErrNotPayer), errors.Is(err, paymentrequests.ErrNotRequester):
+		http.Error(writer, err.Error(), http.StatusForbidden)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(writer, "Payment request or account not found", http.StatusNotFound)
+	case errors.Is(err, paymentrequests.ErrNotPending), errors.Is(err, paymentrequests.ErrExpired):
+		http.Error(writer, err.Error(), http.StatusConflict)
+	default:
+		writeTransactionError(writer, err)
+	}
+}
+
+// CreatePaymentRequest asks another user, identified by account number or alias, to pay an amount.
+func (h *Handler) CreatePaymentRequest(writer http.ResponseWriter, request *http.Request) {
+	var createRequest struct {
+		RequesterAccountNumber int64     `json:"requester_account_number"`
+		PayerAccountNumber     int64     `json:"payer_account_number"`
+		PayerAlias             string    `json:"payer_alias"`
+		Amount                 float64   `json:"amount"`
+		Note                   string    `json:"note"`
+		ExpiresAt              time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&createRequest); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if createRequest.PayerAlias != "" {
+		if createRequest.PayerAccountNumber != 0 {
+			http.Error(writer, "Provide either payer_account_number or payer_alias, not both", http.StatusBadRequest)
+			return
+		}
+		resolution, err := h.Aliases.ResolveAlias(request.Context(), createRequest.PayerAlias)
+		if err != nil {
+			writeAliasError(writer, err)
+			return
+		}
+		createRequest.PayerAccountNumber = resolution.AccountNumber
+	}
+
+	if err := validateAccountNumbers(createRequest.RequesterAccountNumber, createRequest.PayerAccountNumber); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	paymentRequest := paymentrequests.PaymentRequest{
+		RequesterAccountNumber: createRequest.RequesterAccountNumber,
+		PayerAccountNumber:     createRequest.PayerAccountNumber,
+		Amount:                 createRequest.Amount,
+		Note:                   createRequest.Note,
+		ExpiresAt:              createRequest.ExpiresAt,
+	}
+	if err := h.PaymentRequests.CreatePaymentRequest(request.Context(), &paymentRequest); err != nil {
+		writePaymentRequestError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(paymentRequest); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetPaymentRequestByID fetches a single payment request.
+func (h *Handler) GetPaymentRequestByID(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	paymentRequest, err := h.PaymentRequests.GetPaymentRequestByID(request.Context(), uint(id))
+	if err != nil {
+		writePaymentRequestError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(paymentRequest); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetIncomingPaymentRequests lists the requests a user has been asked to pay, filtered by the optional status query parameter.
+func (h *Handler) GetIncomingPaymentRequests(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	userID, err := strconv.ParseUint(vars["user_id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.PaymentRequests.GetIncomingPaymentRequests(request.Context(), uint(userID), request.URL.Query().Get("status"))
+	if err != nil {
+		writePaymentRequestError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetOutgoingPaymentRequests lists the requests a user has sent, filtered by the optional status query parameter.
+func (h *Handler) GetOutgoingPaymentRequests(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	userID, err := strconv.ParseUint(vars["user_id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.PaymentRequests.GetOutgoingPaymentRequests(request.Context(), uint(userID), request.URL.Query().Get("status"))
+	if err != nil {
+		writePaymentRequestError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// PayPaymentRequest pays a pending request from the payer's account.
+func (h *Handler) PayPaymentRequest(writer http.ResponseWriter, request *http.Request) {
+	h.actOnPaymentRequest(writer, request, h.PaymentRequests.PayPaymentRequest)
+}
+
+// DeclinePaymentRequest lets the payer refuse a pending request.
+func (h *Handler) DeclinePaymentRequest(writer http.ResponseWriter, request *http.Request) {
+	h.actOnPaymentRequest(writer, request, h.PaymentRequests.DeclinePaymentRequest)
+}
+
+// CancelPaymentRequest lets the requester withdraw a pending request.
+func (h *Handler) CancelPaymentRequest(writer http.ResponseWriter, request *http.Request) {
+	h.actOnPaymentRequest(writer, request, h.PaymentRequests.CancelPaymentRequest)
+}
+
+// actOnPaymentRequest decodes the acting user and applies a status change to the request named in the URL
+func (h *Handler) actOnPaymentRequest(writer http.ResponseWriter, request *http.Request, action func(ctx context.Context, requestID uint, userID uint) (paymentrequests.PaymentRequest, error)) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var actor struct {
+		UserID uint `json:"user_id"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&actor); err != nil || actor.UserID == 0 {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	paymentRequest, err := action(request.Context(), uint(id), actor.UserID)
+	if err != nil {
+		writePaymentRequestError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(paymentRequest); err != nil {
+		log.Panicln(err)
+	}
+}
@@ -0,0 +1,270 @@
+package http
+
+import (
+	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/pots"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// writePotError maps pot errors onto HTTP status codes
+func writePotError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, pots.ErrInvalidPot), errors.Is(err, pots.ErrInvalidRule):
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, pots.ErrNotOwner):
+		http.Error(writer, err.Error(), http.StatusForbidden)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(writer, "Pot, rule or account not found", http.StatusNotFound)
+	case errors.Is(err, pots.ErrPotLocked), errors.Is(err, pots.ErrPotClosed):
+		http.Error(writer, err.Error(), http.StatusConflict)
+	case errors.Is(err, pots.ErrInsufficientPotFunds), errors.Is(err, accounts.ErrInsufficientFunds):
+		http.Error(writer, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		writeTransactionError(writer, err)
+	}
+}
+
+// decodePotActor parses the pot id and the acting user from the request, writing a Bad Request response on failure
+func decodePotActor(writer http.ResponseWriter, request *http.Request) (uint, uint, bool) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	var actor struct {
+		UserID uint `json:"user_id"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&actor); err != nil || actor.UserID == 0 {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return uint(id), actor.UserID, true
+}
+
+// CreatePot opens a savings pot on one of the user's accounts.
+func (h *Handler) CreatePot(writer http.ResponseWriter, request *http.Request) {
+	var pot pots.Pot
+	if err := json.NewDecoder(request.Body).Decode(&pot); err != nil || pot.UserID == 0 {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if err := validateAccountNumbers(pot.AccountNumber); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Pots.CreatePot(request.Context(), &pot); err != nil {
+		writePotError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(pot); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetPotByID fetches a single pot with its auto-save rules.
+func (h *Handler) GetPotByID(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pot, err := h.Pots.GetPotByID(request.Context(), uint(id))
+	if err != nil {
+		writePotError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(pot); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetPotsByUserID lists the pots of the user identified by the user_id URL parameter.
+func (h *Handler) GetPotsByUserID(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	userID, err := strconv.ParseUint(vars["user_id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.Pots.GetPotsByUserID(request.Context(), uint(userID))
+	if err != nil {
+		writePotError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// DepositToPot moves money from the pot's account into the pot.
+func (h *Handler) DepositToPot(writer http.ResponseWriter, request *http.Request) {
+	h.movePotFunds(writer, request, h.Pots.Deposit)
+}
+
+// WithdrawFromPot moves money from the pot back to its account.
+func (h *Handler) WithdrawFromPot(writer http.ResponseWriter, request *http.Request) {
+	h.movePotFunds(writer, request, h.Pots.Withdraw)
+}
+
+// movePotFunds decodes a pot movement request and hands it to move
+func (h *Handler) movePotFunds(writer http.ResponseWriter, request *http.Request, move func(ctx context.Context, potID uint, userID uint, amount float64) (pots.Movement, error)) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		UserID uint    `json:"user_id"`
+		Amount float64 `json:"amount"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil || body.UserID == 0 {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	movement, err := move(request.Context(), uint(id), body.UserID, body.Amount)
+	if err != nil {
+		writePotError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(movement); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// LockPot blocks withdrawals from the pot until the given time.
+func (h *Handler) LockPot(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		UserID      uint      `json:"user_id"`
+		LockedUntil time.Time `json:"locked_until"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil || body.UserID == 0 {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	pot, err := h.Pots.LockPot(request.Context(), uint(id), body.UserID, body.LockedUntil)
+	if err != nil {
+		writePotError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(pot); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// ClosePot returns the pot's balance to its account and closes it.
+func (h *Handler) ClosePot(writer http.ResponseWriter, request *http.Request) {
+	id, userID, ok := decodePotActor(writer, request)
+	if !ok {
+		return
+	}
+
+	pot, err := h.Pots.ClosePot(request.Context(), id, userID)
+	if err != nil {
+		writePotError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(pot); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// AddPotRule attaches a round-up or weekly auto-save rule to the pot.
+func (h *Handler) AddPotRule(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		pots.Rule
+		UserID uint `json:"user_id"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil || body.UserID == 0 {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	rule := body.Rule
+	rule.PotID = uint(id)
+
+	if err := h.Pots.AddPotRule(request.Context(), body.UserID, &rule); err != nil {
+		writePotError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(rule); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// DisablePotRule stops one of the pot's auto-save rules.
+func (h *Handler) DisablePotRule(writer http.ResponseWriter, request *http.Request) {
+	id, userID, ok := decodePotActor(writer, request)
+	if !ok {
+		return
+	}
+	ruleID, err := strconv.ParseUint(mux.Vars(request)["rule_id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule, err := h.Pots.DisablePotRule(request.Context(), id, uint(ruleID), userID)
+	if err != nil {
+		writePotError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(rule); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetPotMovements lists the money moved into and out of the pot.
+func (h *Handler) GetPotMovements(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	movements, err := h.Pots.GetPotMovements(request.Context(), uint(id))
+	if err != nil {
+		writePotError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(movements); err != nil {
+		log.Panicln(err)
+	}
+}
@@ -0,0 +1,70 @@
+package http
+
+import (
+	"PayWalletEngine/internal/privacy"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// ExportUserData extracts the id from the URL parameters and returns a zip archive of everything held about that user, as JSON plus CSV files.
+func (h *Handler) ExportUserData(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	archive, err := h.Privacy.ExportUserData(request.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(writer, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(writer, "Failed to export user data", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/zip")
+	writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"user-%d-export.zip\"", id))
+	writer.WriteHeader(http.StatusOK)
+	if _, err := writer.Write(archive); err != nil {
+		log.Println("Failed to write export archive:", err)
+	}
+}
+
+// EraseUser extracts the id from the URL parameters and pseudonymizes that user's personal data. Erasure closes the user's accounts, and is refused with a Conflict status while the user still holds money or has open holds.
+func (h *Handler) EraseUser(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.Privacy.EraseUser(request.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, privacy.ErrAlreadyErased) || errors.Is(err, privacy.ErrOutstandingBalance) || errors.Is(err, privacy.ErrOpenHolds) {
+			http.Error(writer, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.Error(writer, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(writer, "Failed to erase user", http.StatusInternalServerError)
+		log.Println(err)
+		return
+	}
+
+	if err := json.NewEncoder(writer).Encode(map[string]string{"status": "User data erased"}); err != nil {
+		log.Panicln(err)
+	}
+}
@@ -0,0 +1,211 @@
+package http
+
+import (
+	"PayWalletEngine/internal/reconciliation"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// maxStatementSize bounds the bank statement files that can be imported
+const maxStatementSize = 10 << 20
+
+// writeReconciliationError maps reconciliation errors onto HTTP status codes
+func writeReconciliationError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, reconciliation.ErrInvalidImport),
+		errors.Is(err, reconciliation.ErrInvalidExpectedCredit),
+		errors.Is(err, reconciliation.ErrInvalidMatch):
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, reconciliation.ErrDuplicateImport),
+		errors.Is(err, reconciliation.ErrExpectedCreditExists),
+		errors.Is(err, reconciliation.ErrExpectedCreditClosed),
+		errors.Is(err, reconciliation.ErrLineResolved),
+		errors.Is(err, reconciliation.ErrAlreadyReconciled):
+		http.Error(writer, err.Error(), http.StatusConflict)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(writer, "Import, line, expected credit, transaction or account not found", http.StatusNotFound)
+	default:
+		writeTransactionError(writer, err)
+	}
+}
+
+// parseReconciliationID reads the numeric ID in the path
+func parseReconciliationID(writer http.ResponseWriter, request *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// CreateExpectedCredit announces funding a user is sending to the bank account.
+func (h *Handler) CreateExpectedCredit(writer http.ResponseWriter, request *http.Request) {
+	var credit reconciliation.ExpectedCredit
+	if err := json.NewDecoder(request.Body).Decode(&credit); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Reconciliation.CreateExpectedCredit(request.Context(), &credit); err != nil {
+		writeReconciliationError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(credit); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetExpectedCredits lists expected credits, optionally filtered by status.
+func (h *Handler) GetExpectedCredits(writer http.ResponseWriter, request *http.Request) {
+	list, err := h.Reconciliation.GetExpectedCredits(request.Context(), request.URL.Query().Get("status"))
+	if err != nil {
+		writeReconciliationError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// CancelExpectedCredit withdraws a pending expected credit.
+func (h *Handler) CancelExpectedCredit(writer http.ResponseWriter, request *http.Request) {
+	id, ok := parseReconciliationID(writer, request)
+	if !ok {
+		return
+	}
+	credit, err := h.Reconciliation.CancelExpectedCredit(request.Context(), id)
+	if err != nil {
+		writeReconciliationError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(credit); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// ImportBankStatement reconciles a bank statement file sent as the request body. The format is given with the format
+// parameter, or else taken from a text/csv or XML content type.
+func (h *Handler) ImportBankStatement(writer http.ResponseWriter, request *http.Request) {
+	format := request.URL.Query().Get("format")
+	if format == "" {
+		switch mediaType, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type")); mediaType {
+		case "text/csv":
+			format = reconciliation.FormatCSV
+		case "application/xml", "text/xml":
+			format = reconciliation.FormatCamt053
+		}
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(writer, request.Body, maxStatementSize))
+	if err != nil {
+		http.Error(writer, "Statement file is too large or unreadable", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.Reconciliation.ImportBankStatement(request.Context(), format, data)
+	if err != nil {
+		writeReconciliationError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(report); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetBankStatementImports lists the imported bank statements.
+func (h *Handler) GetBankStatementImports(writer http.ResponseWriter, request *http.Request) {
+	list, err := h.Reconciliation.GetImports(request.Context())
+	if err != nil {
+		writeReconciliationError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetReconciliationReport shows the matched, unmatched and discrepant lines of an import.
+func (h *Handler) GetReconciliationReport(writer http.ResponseWriter, request *http.Request) {
+	id, ok := parseReconciliationID(writer, request)
+	if !ok {
+		return
+	}
+	report, err := h.Reconciliation.GetReconciliationReport(request.Context(), id)
+	if err != nil {
+		writeReconciliationError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(report); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetReconciliationExceptions lists the lines waiting to be matched by hand.
+func (h *Handler) GetReconciliationExceptions(writer http.ResponseWriter, request *http.Request) {
+	list, err := h.Reconciliation.GetExceptions(request.Context())
+	if err != nil {
+		writeReconciliationError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// MatchBankStatementLine resolves an exception against an expected credit, an existing credit or an account.
+func (h *Handler) MatchBankStatementLine(writer http.ResponseWriter, request *http.Request) {
+	id, ok := parseReconciliationID(writer, request)
+	if !ok {
+		return
+	}
+	var match reconciliation.Match
+	if err := json.NewDecoder(request.Body).Decode(&match); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	line, err := h.Reconciliation.MatchLine(request.Context(), id, match)
+	if err != nil {
+		writeReconciliationError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(line); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// IgnoreBankStatementLine takes an exception out of the queue without posting it.
+func (h *Handler) IgnoreBankStatementLine(writer http.ResponseWriter, request *http.Request) {
+	id, ok := parseReconciliationID(writer, request)
+	if !ok {
+		return
+	}
+	var body struct {
+		Note string `json:"note"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	line, err := h.Reconciliation.IgnoreLine(request.Context(), id, body.Note)
+	if err != nil {
+		writeReconciliationError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(line); err != nil {
+		log.Panicln(err)
+	}
+}
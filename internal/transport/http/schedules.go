@@ -0,0 +1,151 @@
+package http
+
+import (
+	"PayWalletEngine/internal/schedules"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// writeScheduleError maps schedule errors onto HTTP status codes
+func writeScheduleError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, schedules.ErrInvalidSchedule):
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, schedules.ErrNotOwner):
+		http.Error(writer, err.Error(), http.StatusForbidden)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(writer, "Schedule or account not found", http.StatusNotFound)
+	case errors.Is(err, schedules.ErrInvalidStatusTransition):
+		http.Error(writer, err.Error(), http.StatusConflict)
+	default:
+		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// CreateSchedule sets up a one-off future transfer or a standing order.
+func (h *Handler) CreateSchedule(writer http.ResponseWriter, request *http.Request) {
+	var schedule schedules.Schedule
+	if err := json.NewDecoder(request.Body).Decode(&schedule); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if err := validateAccountNumbers(schedule.SenderAccountNumber, schedule.ReceiverAccountNumber); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Schedules.CreateSchedule(request.Context(), &schedule); err != nil {
+		writeScheduleError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(schedule); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetScheduleByID fetches a single schedule.
+func (h *Handler) GetScheduleByID(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	schedule, err := h.Schedules.GetScheduleByID(request.Context(), uint(id))
+	if err != nil {
+		writeScheduleError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(schedule); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetSchedulesByUserID lists the schedules of the user identified by the user_id URL parameter.
+func (h *Handler) GetSchedulesByUserID(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	userID, err := strconv.ParseUint(vars["user_id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.Schedules.GetSchedulesByUserID(request.Context(), uint(userID))
+	if err != nil {
+		writeScheduleError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetScheduleRuns lists the occurrences a schedule has executed, failed or is retrying.
+func (h *Handler) GetScheduleRuns(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	runs, err := h.Schedules.GetScheduleRuns(request.Context(), uint(id))
+	if err != nil {
+		writeScheduleError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(runs); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// PauseSchedule stops a schedule from running until it is resumed.
+func (h *Handler) PauseSchedule(writer http.ResponseWriter, request *http.Request) {
+	h.changeScheduleStatus(writer, request, h.Schedules.PauseSchedule)
+}
+
+// ResumeSchedule reactivates a paused schedule.
+func (h *Handler) ResumeSchedule(writer http.ResponseWriter, request *http.Request) {
+	h.changeScheduleStatus(writer, request, h.Schedules.ResumeSchedule)
+}
+
+// CancelSchedule stops a schedule for good.
+func (h *Handler) CancelSchedule(writer http.ResponseWriter, request *http.Request) {
+	h.changeScheduleStatus(writer, request, h.Schedules.CancelSchedule)
+}
+
+// changeScheduleStatus decodes the acting user and applies a status change to the schedule named in the URL
+func (h *Handler) changeScheduleStatus(writer http.ResponseWriter, request *http.Request, action func(ctx context.Context, scheduleID uint, userID uint) (schedules.Schedule, error)) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var actor struct {
+		UserID uint `json:"user_id"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&actor); err != nil || actor.UserID == 0 {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	schedule, err := action(request.Context(), uint(id), actor.UserID)
+	if err != nil {
+		writeScheduleError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(schedule); err != nil {
+		log.Panicln(err)
+	}
+}
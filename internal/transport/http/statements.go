@@ -0,0 +1,109 @@
+package http
+
+import (
+	"PayWalletEngine/internal/statements"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// writeStatementError maps statement errors onto HTTP status codes
+func writeStatementError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, statements.ErrInvalidStatement):
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(writer, "Account not found", http.StatusNotFound)
+	default:
+		writeTransactionError(writer, err)
+	}
+}
+
+// parseStatementDate reads a required YYYY-MM-DD date bounding a statement
+func parseStatementDate(name string, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("%w: %s is required", statements.ErrInvalidStatement, name)
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s must be a YYYY-MM-DD date", statements.ErrInvalidStatement, name)
+	}
+	return date, nil
+}
+
+// GetAccountStatement renders an account's statement over whole days, from and to included, as JSON, CSV, PDF,
+// camt.053 XML or MT940.
+func (h *Handler) GetAccountStatement(writer http.ResponseWriter, request *http.Request) {
+	vars := mux.Vars(request)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := request.URL.Query()
+	from, err := parseStatementDate("from", query.Get("from"))
+	if err != nil {
+		writeStatementError(writer, err)
+		return
+	}
+	to, err := parseStatementDate("to", query.Get("to"))
+	if err != nil {
+		writeStatementError(writer, err)
+		return
+	}
+	format := strings.ToLower(query.Get("format"))
+	if format == "" {
+		format = statements.FormatJSON
+	}
+	if !statements.ValidFormat(format) {
+		writeStatementError(writer, fmt.Errorf("%w: format must be json, csv, pdf, camt053 or mt940", statements.ErrInvalidStatement))
+		return
+	}
+
+	statement, err := h.Statements.GetStatement(request.Context(), uint(id), from, to.AddDate(0, 0, 1))
+	if err != nil {
+		writeStatementError(writer, err)
+		return
+	}
+
+	if format == statements.FormatJSON {
+		if err := json.NewEncoder(writer).Encode(statement); err != nil {
+			log.Panicln(err)
+		}
+		return
+	}
+
+	// render the file before answering, so a statement that cannot be rendered is reported as an error
+	var file bytes.Buffer
+	var contentType string
+	switch format {
+	case statements.FormatCSV:
+		contentType, err = "text/csv; charset=UTF-8", statements.WriteCSV(&file, statement)
+	case statements.FormatPDF:
+		contentType, err = "application/pdf", statements.WritePDF(&file, statement)
+	case statements.FormatCamt053:
+		contentType, err = "application/xml; charset=UTF-8", statements.WriteCamt053(&file, statement)
+	case statements.FormatMT940:
+		contentType, err = "text/plain; charset=US-ASCII", statements.WriteMT940(&file, statement)
+	}
+	if err != nil {
+		writeStatementError(writer, err)
+		return
+	}
+
+	filename := fmt.Sprintf("statement-%d-%s-%s.%s", statement.AccountNumber, from.Format("20060102"), to.Format("20060102"), statements.FileExtension(format))
+	writer.Header().Set("Content-Type", contentType)
+	writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if _, err := file.WriteTo(writer); err != nil {
+		log.Println(err)
+	}
+}
@@ -2,38 +2,127 @@ package http
 
 import (
 	"PayWalletEngine/internal/accounts"
+	"PayWalletEngine/internal/closing"
 	"PayWalletEngine/internal/transactions"
 	"PayWalletEngine/internal/users"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gorilla/mux"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
-// GetTransactionsFromAccount handles the retrieval of all transactions made by a specific sender.
+// parseHistoryTime reads a from or to query parameter given as RFC 3339 or as a date. A date used as the end of the
+// range includes that whole day.
+func parseHistoryTime(value string, endOfRange bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: dates must be RFC 3339 or YYYY-MM-DD", transactions.ErrInvalidQuery)
+	}
+	if endOfRange {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// parseHistoryAmount reads an optional amount bound from the query string
+func parseHistoryAmount(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid amount %q", transactions.ErrInvalidQuery, value)
+	}
+	return &amount, nil
+}
+
+// parseHistoryQuery builds a history query from the filter, sort and paging query parameters
+func parseHistoryQuery(accountNumber int64, values url.Values) (transactions.HistoryQuery, error) {
+	query := transactions.HistoryQuery{
+		AccountNumber: accountNumber,
+		Type:          values.Get("type"),
+		Status:        values.Get("status"),
+		Direction:     values.Get("direction"),
+		Search:        strings.TrimSpace(values.Get("q")),
+		Sort:          values.Get("sort"),
+	}
+	var err error
+	if query.From, err = parseHistoryTime(values.Get("from"), false); err != nil {
+		return query, err
+	}
+	if query.To, err = parseHistoryTime(values.Get("to"), true); err != nil {
+		return query, err
+	}
+	if query.MinAmount, err = parseHistoryAmount(values.Get("min_amount")); err != nil {
+		return query, err
+	}
+	if query.MaxAmount, err = parseHistoryAmount(values.Get("max_amount")); err != nil {
+		return query, err
+	}
+	if counterparty := values.Get("counterparty"); counterparty != "" {
+		if query.Counterparty, err = parseAccountNumber(counterparty); err != nil {
+			return query, err
+		}
+	}
+	if limit := values.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 {
+			return query, fmt.Errorf("%w: limit must be a positive number", transactions.ErrInvalidQuery)
+		}
+	}
+	if cursor := values.Get("cursor"); cursor != "" {
+		if query.Cursor, err = transactions.DecodeCursor(cursor); err != nil {
+			return query, err
+		}
+	}
+	return query, nil
+}
+
+// GetTransactionsFromAccount handles the retrieval of one page of the transactions an account sent or received,
+// filtered and sorted by the query parameters.
 func (h *Handler) GetTransactionsFromAccount(writer http.ResponseWriter, request *http.Request) {
 	vars := mux.Vars(request)
-	senderAccountNumberStr := vars["account_number"]
-	if senderAccountNumberStr == "" {
+	accountNumberStr := vars["account_number"]
+	if accountNumberStr == "" {
 		http.Error(writer, "Account number is required", http.StatusBadRequest)
 		return
 	}
 
-	senderAccountNumber, err := strconv.ParseInt(senderAccountNumberStr, 10, 64)
+	accountNumber, err := parseAccountNumber(accountNumberStr)
 	if err != nil {
-		http.Error(writer, "Invalid account number format", http.StatusBadRequest)
+		http.Error(writer, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	txns, err := h.Transaction.GetTransactionsFromAccount(request.Context(), senderAccountNumber)
+	query, err := parseHistoryQuery(accountNumber, request.URL.Query())
 	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.Transaction.GetTransactionHistory(request.Context(), query)
+	if err != nil {
+		if errors.Is(err, transactions.ErrInvalidQuery) {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
 	writer.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(writer).Encode(txns)
+	err = json.NewEncoder(writer).Encode(page)
 	if err != nil {
 		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
 	}
@@ -137,10 +226,14 @@ func (h *Handler) CreditAccount(writer http.ResponseWriter, request *http.Reques
 		http.Error(writer, "Invalid request format", http.StatusBadRequest)
 		return
 	}
+	if err := validateAccountNumbers(creditRequest.ReceiverAccountNumber); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	txn, err := h.Transaction.CreditAccount(request.Context(), creditRequest.ReceiverAccountNumber, creditRequest.Amount, creditRequest.Description, creditRequest.PaymentMethod)
 	if err != nil {
-		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+		writeTransactionError(writer, err)
 		log.Println(err)
 		return
 	}
@@ -166,10 +259,14 @@ func (h *Handler) DebitAccount(writer http.ResponseWriter, request *http.Request
 		http.Error(writer, "Invalid request format", http.StatusBadRequest)
 		return
 	}
+	if err := validateAccountNumbers(debitRequest.SenderAccountNumber); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	txn, err := h.Transaction.DebitAccount(request.Context(), debitRequest.SenderAccountNumber, debitRequest.Amount, debitRequest.Description, debitRequest.PaymentMethod)
 	if err != nil {
-		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+		writeTransactionError(writer, err)
 		log.Println(err)
 		return
 	}
@@ -187,6 +284,8 @@ func (h *Handler) TransferFunds(writer http.ResponseWriter, request *http.Reques
 	var transferRequest struct {
 		SenderAccountNumber   int64   `json:"sender_account_number"`
 		ReceiverAccountNumber int64   `json:"receiver_account_number"`
+		ReceiverAlias         string  `json:"receiver_alias"`
+		BeneficiaryID         uint    `json:"beneficiary_id"`
 		Amount                float64 `json:"amount"`
 		Description           string  `json:"description"`
 		PaymentMethod         string  `json:"payment_method"`
@@ -198,9 +297,86 @@ func (h *Handler) TransferFunds(writer http.ResponseWriter, request *http.Reques
 		return
 	}
 
+	// A saved beneficiary replaces the receiver fields and applies its cooling-off limit
+	if transferRequest.BeneficiaryID != 0 {
+		if transferRequest.ReceiverAccountNumber != 0 || transferRequest.ReceiverAlias != "" {
+			http.Error(writer, "Provide either a beneficiary_id or a receiver, not both", http.StatusBadRequest)
+			return
+		}
+		if err := validateAccountNumbers(transferRequest.SenderAccountNumber); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		txn, err := h.Beneficiaries.TransferToBeneficiary(request.Context(), transferRequest.SenderAccountNumber, transferRequest.BeneficiaryID, transferRequest.Amount, transferRequest.Description, transferRequest.PaymentMethod)
+		if err != nil {
+			writeBeneficiaryError(writer, err)
+			return
+		}
+		if err := json.NewEncoder(writer).Encode(txn); err != nil {
+			http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// A receiver alias is an alternative to the receiver account number, not an addition to it
+	if transferRequest.ReceiverAlias != "" {
+		if transferRequest.ReceiverAccountNumber != 0 {
+			http.Error(writer, "Provide either receiver_account_number or receiver_alias, not both", http.StatusBadRequest)
+			return
+		}
+		resolution, err := h.Aliases.ResolveAlias(request.Context(), transferRequest.ReceiverAlias)
+		if err != nil {
+			writeAliasError(writer, err)
+			return
+		}
+		transferRequest.ReceiverAccountNumber = resolution.AccountNumber
+	}
+
+	if err := validateAccountNumbers(transferRequest.SenderAccountNumber, transferRequest.ReceiverAccountNumber); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	txn, err := h.Transaction.TransferFunds(request.Context(), transferRequest.SenderAccountNumber, transferRequest.ReceiverAccountNumber, transferRequest.Amount, transferRequest.Description, transferRequest.PaymentMethod)
+	if err != nil {
+		writeTransactionError(writer, err)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(writer).Encode(txn)
 	if err != nil {
 		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// TransferBetweenOwnAccounts handles instant, fee-free transfers between two wallets held by the same user.
+func (h *Handler) TransferBetweenOwnAccounts(writer http.ResponseWriter, request *http.Request) {
+	var transferRequest struct {
+		UserID            uint    `json:"user_id"`
+		FromAccountNumber int64   `json:"from_account_number"`
+		ToAccountNumber   int64   `json:"to_account_number"`
+		Amount            float64 `json:"amount"`
+		Description       string  `json:"description"`
+	}
+
+	err := json.NewDecoder(request.Body).Decode(&transferRequest)
+	if err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if err := validateAccountNumbers(transferRequest.FromAccountNumber, transferRequest.ToAccountNumber); err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	txn, err := h.Transaction.TransferBetweenOwnAccounts(request.Context(), transferRequest.UserID, transferRequest.FromAccountNumber, transferRequest.ToAccountNumber, transferRequest.Amount, transferRequest.Description)
+	if err != nil {
+		if errors.Is(err, transactions.ErrNotOwnAccounts) {
+			http.Error(writer, err.Error(), http.StatusForbidden)
+			return
+		}
+		writeTransactionError(writer, err)
 		return
 	}
 
@@ -210,3 +386,22 @@ func (h *Handler) TransferFunds(writer http.ResponseWriter, request *http.Reques
 		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
+
+// writeTransactionError reports invalid amounts as a Bad Request, insufficient funds as an Unprocessable Entity, account
+// status violations and postings into a closed business day as a Conflict and anything else as an Internal Server Error
+func writeTransactionError(writer http.ResponseWriter, err error) {
+	if errors.Is(err, transactions.ErrInvalidAmount) {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, accounts.ErrInsufficientFunds) {
+		http.Error(writer, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if errors.Is(err, accounts.ErrAccountFrozen) || errors.Is(err, accounts.ErrAccountDormant) || errors.Is(err, accounts.ErrAccountClosed) ||
+		errors.Is(err, closing.ErrPostingDayClosed) {
+		http.Error(writer, err.Error(), http.StatusConflict)
+		return
+	}
+	http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
+}
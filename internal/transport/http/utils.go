@@ -1,9 +1,35 @@
 package http
 
-import "regexp"
+import (
+	"PayWalletEngine/internal/accounts"
+	"regexp"
+	"strconv"
+)
 
 func isValidEmail(email string) bool {
 	// A simple email validation regex (can be refined further as needed)
 	re := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
 	return re.MatchString(email)
 }
+
+// parseAccountNumber parses an account number from a URL parameter and verifies its check digits
+func parseAccountNumber(value string) (int64, error) {
+	accountNumber, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, accounts.ErrInvalidAccountNumber
+	}
+	if err := accounts.ValidateAccountNumber(accountNumber); err != nil {
+		return 0, err
+	}
+	return accountNumber, nil
+}
+
+// validateAccountNumbers verifies the check digits of account numbers taken from a request body
+func validateAccountNumbers(accountNumbers ...int64) error {
+	for _, accountNumber := range accountNumbers {
+		if err := accounts.ValidateAccountNumber(accountNumber); err != nil {
+			return err
+		}
+	}
+	return nil
+}
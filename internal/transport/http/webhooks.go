@@ -0,0 +1,214 @@
+package http
+
+import (
+	"PayWalletEngine/internal/webhooks"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// writeWebhookError maps webhook errors onto HTTP status codes
+func writeWebhookError(writer http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, webhooks.ErrInvalidEndpoint),
+		errors.Is(err, webhooks.ErrInvalidQuery):
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, webhooks.ErrNotDeadLettered):
+		http.Error(writer, err.Error(), http.StatusConflict)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		http.Error(writer, "User, webhook endpoint or delivery not found", http.StatusNotFound)
+	default:
+		writeTransactionError(writer, err)
+	}
+}
+
+// CreateWebhookEndpoint registers a webhook endpoint. The response is the only one that includes its secret.
+func (h *Handler) CreateWebhookEndpoint(writer http.ResponseWriter, request *http.Request) {
+	var endpoint webhooks.Endpoint
+	if err := json.NewDecoder(request.Body).Decode(&endpoint); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Webhooks.CreateEndpoint(request.Context(), &endpoint); err != nil {
+		writeWebhookError(writer, err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(writer).Encode(endpoint); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetWebhookEndpoint returns the webhook endpoint identified by the id URL parameter.
+func (h *Handler) GetWebhookEndpoint(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	endpoint, err := h.Webhooks.GetEndpoint(request.Context(), uint(id))
+	if err != nil {
+		writeWebhookError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(endpoint); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetWebhookEndpointsByUserID lists the webhook endpoints of the user identified by the user_id URL parameter.
+func (h *Handler) GetWebhookEndpointsByUserID(writer http.ResponseWriter, request *http.Request) {
+	userID, err := strconv.ParseUint(mux.Vars(request)["user_id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.Webhooks.GetEndpointsByUserID(request.Context(), uint(userID))
+	if err != nil {
+		writeWebhookError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// UpdateWebhookEndpoint changes the URL, events and active flag of the webhook endpoint identified by the id URL
+// parameter.
+func (h *Handler) UpdateWebhookEndpoint(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var body struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Active bool     `json:"active"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		http.Error(writer, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.Webhooks.UpdateEndpoint(request.Context(), webhooks.Endpoint{
+		ID:     uint(id),
+		URL:    body.URL,
+		Events: body.Events,
+		Active: body.Active,
+	})
+	if err != nil {
+		writeWebhookError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(updated); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// DeleteWebhookEndpoint deletes the webhook endpoint identified by the id URL parameter.
+func (h *Handler) DeleteWebhookEndpoint(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Webhooks.DeleteEndpoint(request.Context(), uint(id)); err != nil {
+		writeWebhookError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(map[string]string{"status": "OK"}); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetWebhookDeliveries lists the latest deliveries of the webhook endpoint identified by the id URL parameter,
+// optionally filtered by status.
+func (h *Handler) GetWebhookDeliveries(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := request.URL.Query()
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			http.Error(writer, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	list, err := h.Webhooks.GetDeliveries(request.Context(), uint(id), query.Get("status"), limit)
+	if err != nil {
+		writeWebhookError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// ReplayWebhookDeadLetters queues every dead-lettered delivery of the webhook endpoint identified by the id URL
+// parameter again.
+func (h *Handler) ReplayWebhookDeadLetters(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	replayed, err := h.Webhooks.ReplayDeadLetters(request.Context(), uint(id))
+	if err != nil {
+		writeWebhookError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(map[string]int64{"replayed": replayed}); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// GetWebhookDeliveryAttempts lists every attempt at sending the delivery identified by the id URL parameter.
+func (h *Handler) GetWebhookDeliveryAttempts(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.Webhooks.GetDeliveryAttempts(request.Context(), uint(id))
+	if err != nil {
+		writeWebhookError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(list); err != nil {
+		log.Panicln(err)
+	}
+}
+
+// ReplayWebhookDelivery queues the dead-lettered delivery identified by the id URL parameter again.
+func (h *Handler) ReplayWebhookDelivery(writer http.ResponseWriter, request *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(request)["id"], 10, 64)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := h.Webhooks.ReplayDelivery(request.Context(), uint(id))
+	if err != nil {
+		writeWebhookError(writer, err)
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(delivery); err != nil {
+		log.Panicln(err)
+	}
+}
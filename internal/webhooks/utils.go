@@ -0,0 +1,120 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	crypto "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultMaxAttempts is used when WEBHOOK_MAX_ATTEMPTS is unset or invalid
+	defaultMaxAttempts = 8
+	// defaultRetryBackoff is used when WEBHOOK_RETRY_BACKOFF is unset or invalid
+	defaultRetryBackoff = 30 * time.Second
+	// maxRetryDelay caps the wait between two attempts
+	maxRetryDelay = 6 * time.Hour
+	// minSecretLength is the shortest secret a user may choose
+	minSecretLength = 16
+)
+
+// EventTypes lists every event type an endpoint can subscribe to
+var EventTypes = []string{EventTransactionCompleted, EventTransactionFailed, EventAccountFrozen, EventUserActivated}
+
+// RetryPolicy decides how often a failed delivery is attempted again before it is dead-lettered
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first
+	MaxAttempts int
+	// Backoff is the wait after the first failed attempt; it doubles after every further one
+	Backoff time.Duration
+}
+
+// ConfiguredRetryPolicy reads the retry policy from WEBHOOK_MAX_ATTEMPTS and WEBHOOK_RETRY_BACKOFF
+func ConfiguredRetryPolicy() RetryPolicy {
+	policy := RetryPolicy{MaxAttempts: defaultMaxAttempts, Backoff: defaultRetryBackoff}
+	if attempts, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil && attempts > 0 {
+		policy.MaxAttempts = attempts
+	}
+	if backoff, err := time.ParseDuration(os.Getenv("WEBHOOK_RETRY_BACKOFF")); err == nil && backoff > 0 {
+		policy.Backoff = backoff
+	}
+	return policy
+}
+
+// Delay returns the wait before the attempt that follows the given failed attempt
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// Normalize validates an endpoint's URL, events and secret, and sorts its events without duplicates
+func Normalize(endpoint *Endpoint) error {
+	target, err := url.Parse(endpoint.URL)
+	if err != nil || (target.Scheme != "https" && target.Scheme != "http") || target.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidEndpoint)
+	}
+	if len(endpoint.URL) > 500 {
+		return fmt.Errorf("%w: url is at most 500 characters", ErrInvalidEndpoint)
+	}
+	if len(endpoint.Events) == 0 {
+		return fmt.Errorf("%w: subscribe to at least one event", ErrInvalidEndpoint)
+	}
+	seen := make(map[string]bool)
+	events := make([]string, 0, len(endpoint.Events))
+	for _, event := range endpoint.Events {
+		if !KnownEvent(event) {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidEndpoint, event)
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+	sort.Strings(events)
+	endpoint.Events = events
+	if endpoint.Secret != "" && len(endpoint.Secret) < minSecretLength {
+		return fmt.Errorf("%w: secret must be at least %d characters", ErrInvalidEndpoint, minSecretLength)
+	}
+	return nil
+}
+
+// KnownEvent reports whether endpoints can subscribe to an event type
+func KnownEvent(event string) bool {
+	for _, known := range EventTypes {
+		if known == event {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateSecret returns a random signing secret
+func GenerateSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := crypto.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// Sign returns the signature header of a delivery: the hex HMAC-SHA256, keyed with the endpoint's secret, of the
+// timestamp header, a dot and the body. Receivers recompute it to check the delivery came from us and is recent.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
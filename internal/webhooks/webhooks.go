@@ -0,0 +1,370 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Event types a webhook endpoint can subscribe to
+const (
+	EventTransactionCompleted = "transaction.completed"
+	EventTransactionFailed    = "transaction.failed"
+	EventAccountFrozen        = "account.frozen"
+	EventUserActivated        = "user.activated"
+)
+
+// Delivery statuses. A dead delivery has used up its attempts and waits in the dead-letter queue to be replayed; a
+// cancelled delivery belonged to an endpoint that was deleted before it went out.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+	DeliveryCancelled = "cancelled"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderEventID   = "X-Webhook-Event-ID"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	// deliveryBatchSize caps how many deliveries a single pass of the worker sends
+	deliveryBatchSize = 100
+	// deliveryTimeout bounds one delivery attempt
+	deliveryTimeout = 10 * time.Second
+	// claimLease is how long a claimed delivery is hidden from other workers, so one whose worker died goes out again
+	claimLease = time.Minute
+	// maxDeliveries caps the delivery log returned at once
+	maxDeliveries = 100
+)
+
+var (
+	ErrInvalidEndpoint = errors.New("invalid webhook endpoint")
+	ErrInvalidQuery    = errors.New("invalid delivery query")
+	ErrNotDeadLettered = errors.New("only dead-lettered deliveries can be replayed")
+)
+
+// Endpoint - a URL a user has registered to receive events about their accounts. The secret signs every delivery and
+// is only returned when the endpoint is created.
+type Endpoint struct {
+	ID        uint      `json:"id"`
+	UserID    uint      `json:"user_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Delivery - one event on its way to one endpoint. Payload is the JSON body sent.
+type Delivery struct {
+	ID            uint       `json:"id"`
+	EndpointID    uint       `json:"endpoint_id"`
+	EventID       string     `json:"event_id"`
+	EventType     string     `json:"event_type"`
+	Payload       string     `json:"payload"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// Attempt - one try at sending a delivery. StatusCode is zero when no response came back.
+type Attempt struct {
+	ID          uint      `json:"id"`
+	DeliveryID  uint      `json:"delivery_id"`
+	Attempt     int       `json:"attempt"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// Dispatch - a claimed delivery with the endpoint it goes to
+type Dispatch struct {
+	Delivery Delivery
+	URL      string
+	Secret   string
+}
+
+// Event - the body of every delivery
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// FailedTransaction - the data of a transaction.failed event
+type FailedTransaction struct {
+	SenderAccountNumber   int64   `json:"sender_account_number,omitempty"`
+	ReceiverAccountNumber int64   `json:"receiver_account_number,omitempty"`
+	Amount                float64 `json:"amount"`
+	Type                  string  `json:"type"`
+	PaymentMethod         string  `json:"payment_method"`
+	Description           string  `json:"description"`
+	Error                 string  `json:"error"`
+}
+
+// AccountFrozen - the data of an account.frozen event
+type AccountFrozen struct {
+	AccountID     uint   `json:"account_id"`
+	AccountNumber int64  `json:"account_number"`
+	UserID        uint   `json:"user_id"`
+	Reason        string `json:"reason"`
+}
+
+// UserActivated - the data of a user.activated event. Deliveries are kept after the user is erased, so it carries
+// the user ID only.
+type UserActivated struct {
+	UserID uint `json:"user_id"`
+}
+
+type WebhookStore interface {
+	CreateWebhookEndpoint(ctx context.Context, endpoint *Endpoint) error
+	GetWebhookEndpoint(ctx context.Context, id uint) (Endpoint, error)
+	GetWebhookEndpointsByUserID(ctx context.Context, userID uint) ([]Endpoint, error)
+	UpdateWebhookEndpoint(ctx context.Context, endpoint Endpoint) (Endpoint, error)
+	DeleteWebhookEndpoint(ctx context.Context, id uint) error
+	GetWebhookDeliveries(ctx context.Context, endpointID uint, status string, limit int) ([]Delivery, error)
+	GetWebhookDeliveryAttempts(ctx context.Context, deliveryID uint) ([]Attempt, error)
+	ReplayWebhookDelivery(ctx context.Context, id uint, now time.Time) (Delivery, error)
+	ReplayDeadWebhookDeliveries(ctx context.Context, endpointID uint, now time.Time) (int64, error)
+	ClaimDueWebhookDeliveries(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]Dispatch, error)
+	RecordWebhookAttempt(ctx context.Context, delivery Delivery, attempt Attempt) error
+}
+
+// WebhookService is the blueprint for the webhook logic
+type WebhookService struct {
+	Store  WebhookStore
+	Client *http.Client
+	Retry  RetryPolicy
+}
+
+func NewWebhookService(store WebhookStore) WebhookService {
+	return WebhookService{
+		Store:  store,
+		Client: &http.Client{Timeout: deliveryTimeout},
+		Retry:  ConfiguredRetryPolicy(),
+	}
+}
+
+// CreateEndpoint registers an active endpoint. A secret is generated unless one is given.
+func (s *WebhookService) CreateEndpoint(ctx context.Context, endpoint *Endpoint) error {
+	if err := Normalize(endpoint); err != nil {
+		return err
+	}
+	if endpoint.Secret == "" {
+		secret, err := GenerateSecret()
+		if err != nil {
+			log.Printf("Error generating webhook secret: %v", err)
+			return err
+		}
+		endpoint.Secret = secret
+	}
+	endpoint.Active = true
+	if err := s.Store.CreateWebhookEndpoint(ctx, endpoint); err != nil {
+		log.Printf("Error creating webhook endpoint: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s *WebhookService) GetEndpoint(ctx context.Context, id uint) (Endpoint, error) {
+	endpoint, err := s.Store.GetWebhookEndpoint(ctx, id)
+	if err != nil {
+		log.Printf("Error fetching webhook endpoint %v: %v", id, err)
+		return endpoint, err
+	}
+	return endpoint, nil
+}
+
+func (s *WebhookService) GetEndpointsByUserID(ctx context.Context, userID uint) ([]Endpoint, error) {
+	list, err := s.Store.GetWebhookEndpointsByUserID(ctx, userID)
+	if err != nil {
+		log.Printf("Error fetching webhook endpoints of user %v: %v", userID, err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// UpdateEndpoint changes an endpoint's URL, events and whether it is active. A paused endpoint keeps its pending
+// deliveries until it is active again, but receives no new events.
+func (s *WebhookService) UpdateEndpoint(ctx context.Context, endpoint Endpoint) (Endpoint, error) {
+	if err := Normalize(&endpoint); err != nil {
+		return Endpoint{}, err
+	}
+	updated, err := s.Store.UpdateWebhookEndpoint(ctx, endpoint)
+	if err != nil {
+		log.Printf("Error updating webhook endpoint %v: %v", endpoint.ID, err)
+		return updated, err
+	}
+	return updated, nil
+}
+
+// DeleteEndpoint removes an endpoint and cancels its pending deliveries. Its delivery log is kept.
+func (s *WebhookService) DeleteEndpoint(ctx context.Context, id uint) error {
+	if err := s.Store.DeleteWebhookEndpoint(ctx, id); err != nil {
+		log.Printf("Error deleting webhook endpoint %v: %v", id, err)
+		return err
+	}
+	return nil
+}
+
+// GetDeliveries returns an endpoint's latest deliveries, newest first, optionally with one status only
+func (s *WebhookService) GetDeliveries(ctx context.Context, endpointID uint, status string, limit int) ([]Delivery, error) {
+	switch status {
+	case "", DeliveryPending, DeliveryDelivered, DeliveryDead, DeliveryCancelled:
+	default:
+		return nil, fmt.Errorf("%w: status must be pending, delivered, dead or cancelled", ErrInvalidQuery)
+	}
+	if limit <= 0 || limit > maxDeliveries {
+		limit = maxDeliveries
+	}
+	list, err := s.Store.GetWebhookDeliveries(ctx, endpointID, status, limit)
+	if err != nil {
+		log.Printf("Error fetching deliveries of webhook endpoint %v: %v", endpointID, err)
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *WebhookService) GetDeliveryAttempts(ctx context.Context, deliveryID uint) ([]Attempt, error) {
+	list, err := s.Store.GetWebhookDeliveryAttempts(ctx, deliveryID)
+	if err != nil {
+		log.Printf("Error fetching attempts of webhook delivery %v: %v", deliveryID, err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// ReplayDelivery puts a dead-lettered delivery back in the queue with a fresh set of attempts
+func (s *WebhookService) ReplayDelivery(ctx context.Context, id uint) (Delivery, error) {
+	delivery, err := s.Store.ReplayWebhookDelivery(ctx, id, time.Now())
+	if err != nil {
+		log.Printf("Error replaying webhook delivery %v: %v", id, err)
+		return delivery, err
+	}
+	return delivery, nil
+}
+
+// ReplayDeadLetters puts every dead-lettered delivery of an endpoint back in the queue and returns how many there were
+func (s *WebhookService) ReplayDeadLetters(ctx context.Context, endpointID uint) (int64, error) {
+	replayed, err := s.Store.ReplayDeadWebhookDeliveries(ctx, endpointID, time.Now())
+	if err != nil {
+		log.Printf("Error replaying dead deliveries of webhook endpoint %v: %v", endpointID, err)
+		return 0, err
+	}
+	return replayed, nil
+}
+
+// RunDelivery sends due deliveries once per interval until the context is cancelled
+func (s *WebhookService) RunDelivery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.DeliverDue(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue claims the pending deliveries that are due and sends each of them once
+func (s *WebhookService) DeliverDue(ctx context.Context, now time.Time) {
+	due, err := s.Store.ClaimDueWebhookDeliveries(ctx, now, deliveryBatchSize, claimLease)
+	if err != nil {
+		log.Printf("Error claiming webhook deliveries: %v", err)
+		return
+	}
+	for _, dispatch := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		s.deliver(ctx, dispatch)
+	}
+}
+
+// deliver sends a delivery and records the attempt. A delivery that fails is retried with exponential backoff until
+// it runs out of attempts, then it is dead-lettered.
+func (s *WebhookService) deliver(ctx context.Context, dispatch Dispatch) {
+	delivery := dispatch.Delivery
+	delivery.Attempts++
+	attempt := Attempt{DeliveryID: delivery.ID, Attempt: delivery.Attempts, AttemptedAt: time.Now()}
+
+	statusCode, err := s.send(ctx, dispatch, attempt.AttemptedAt)
+	attempt.DurationMs = time.Since(attempt.AttemptedAt).Milliseconds()
+	attempt.StatusCode = statusCode
+
+	switch {
+	case err == nil:
+		delivered := time.Now()
+		delivery.Status = DeliveryDelivered
+		delivery.DeliveredAt = &delivered
+		delivery.NextAttemptAt = nil
+		delivery.LastError = ""
+	case delivery.Attempts < s.Retry.MaxAttempts:
+		next := time.Now().Add(s.Retry.Delay(delivery.Attempts))
+		attempt.Error = err.Error()
+		delivery.NextAttemptAt = &next
+		delivery.LastError = attempt.Error
+	default:
+		attempt.Error = err.Error()
+		delivery.Status = DeliveryDead
+		delivery.NextAttemptAt = nil
+		delivery.LastError = attempt.Error
+		log.Printf("Webhook delivery %d of %s to endpoint %d dead-lettered after %d attempts: %s",
+			delivery.ID, delivery.EventType, delivery.EndpointID, delivery.Attempts, attempt.Error)
+	}
+
+	if err := s.Store.RecordWebhookAttempt(ctx, delivery, attempt); err != nil {
+		log.Printf("Error recording attempt %d of webhook delivery %v: %v", attempt.Attempt, delivery.ID, err)
+	}
+}
+
+// send posts the signed payload to the endpoint. Any response other than 2xx is a failure.
+func (s *WebhookService) send(ctx context.Context, dispatch Dispatch, now time.Time) (int, error) {
+	body := []byte(dispatch.Delivery.Payload)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, dispatch.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "PayWalletEngine-Webhooks/1.0")
+	request.Header.Set(HeaderEvent, dispatch.Delivery.EventType)
+	request.Header.Set(HeaderEventID, dispatch.Delivery.EventID)
+	request.Header.Set(HeaderTimestamp, timestamp)
+	request.Header.Set(HeaderSignature, Sign(dispatch.Secret, timestamp, body))
+
+	response, err := s.Client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("endpoint responded %s", response.Status)
+	}
+	return response.StatusCode, nil
+}